@@ -0,0 +1,168 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultBackfillBatch is the batch size of a Backfill without one.
+const defaultBackfillBatch = 1000
+
+// Backfill is a data migration updating or deleting the rows of a table
+// in batches over a range of integer keys, see RunBackfill.
+type Backfill struct {
+	// Name identifies the backfill in the progress table, so an
+	// interrupted backfill resumes after its last committed batch.
+	Name string
+	// Statement updates or deletes the rows of a batch. It takes the
+	// first and the last key of the batch, inclusive, as its parameters,
+	// in the placeholder syntax of the driver:
+	//
+	//	UPDATE users SET active = true WHERE active IS NULL AND id BETWEEN $1 AND $2
+	Statement string
+	// Table and Key are the table and its integer key column, used to
+	// find the last key when To is 0.
+	Table, Key string
+	// From and To are the first and the last key of the range, inclusive.
+	From, To int64
+	// BatchSize is the number of keys per batch, 1000 if 0.
+	BatchSize int64
+	// Pause is the time to sleep between batches, to throttle the load
+	// on the database and its replicas.
+	Pause time.Duration
+}
+
+func backfillTableName(c *config) string {
+	return c.versionTableName() + "_backfill"
+}
+
+// RunBackfill runs the backfill b, one transaction per batch. The next key
+// is recorded with each batch in a table next to the version table, so
+// running an interrupted backfill again resumes it, and running a finished
+// one does nothing. As it commits each batch, call it with the database,
+// e.g. after Up, rather than from the transaction of a Go migration.
+func RunBackfill(db *sql.DB, b Backfill) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+
+	if b.Name == "" || b.Statement == "" {
+		return errors.New("backfill needs a name and a statement")
+	}
+	if b.BatchSize <= 0 {
+		b.BatchSize = defaultBackfillBatch
+	}
+	if b.To == 0 {
+		last, err := lastBackfillKey(c, db, b)
+		if err != nil {
+			return err
+		}
+		b.To = last
+	}
+
+	next, err := backfillProgress(c, db, b.Name)
+	if err != nil {
+		return err
+	}
+	if next < b.From {
+		next = b.From
+	}
+
+	for first := next; first <= b.To; first += b.BatchSize {
+		if first > next && b.Pause > 0 {
+			time.Sleep(b.Pause)
+		}
+		last := first + b.BatchSize - 1
+		if last > b.To {
+			last = b.To
+		}
+
+		n, err := runBackfillBatch(c, db, b, first, last)
+		if err != nil {
+			return errors.Wrapf(err, "failed to backfill %s, keys %d to %d", b.Name, first, last)
+		}
+		printProgress(c, "BACKFILL %s: keys %d to %d, %d rows\n", b.Name, first, last, n)
+	}
+
+	return nil
+}
+
+// lastBackfillKey returns the largest key of the table of b.
+func lastBackfillKey(c *config, db *sql.DB, b Backfill) (int64, error) {
+	if b.Table == "" || b.Key == "" {
+		return 0, errors.New("backfill needs a table and a key to find the last key, or To")
+	}
+
+	var last sql.NullInt64
+	d := c.dialect
+	query := fmt.Sprintf("SELECT MAX(%s) FROM %s", quoteTableName(d, b.Key), quoteTableName(d, b.Table))
+	if err := db.QueryRow(query).Scan(&last); err != nil {
+		return 0, errors.Wrapf(err, "failed to find the last key of %s", b.Table)
+	}
+	return last.Int64, nil
+}
+
+// backfillProgress returns the next key of the backfill, or 0 if it never
+// ran. Create the backfill table if it doesn't exist.
+func backfillProgress(c *config, db *sql.DB, name string) (int64, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT name, next_key FROM %s", quoteTableName(c.dialect, backfillTableName(c))))
+	if err != nil {
+		if !c.dialect.isMissingTable(err) {
+			return 0, errors.Wrap(err, "failed to query backfill table")
+		}
+		if _, err := db.Exec(c.dialect.createBackfillTableSQL(c)); err != nil {
+			return 0, errors.Wrap(err, "failed to create backfill table")
+		}
+		return 0, nil
+	}
+	defer rows.Close()
+
+	var next int64
+	for rows.Next() {
+		var n string
+		var key int64
+		if err := rows.Scan(&n, &key); err != nil {
+			return 0, errors.Wrap(err, "failed to scan row")
+		}
+		if n == name {
+			next = key
+		}
+	}
+	return next, errors.Wrap(rows.Err(), "failed to query backfill table")
+}
+
+// runBackfillBatch runs the statement of b for the keys first to last and
+// records the next key in the same transaction. It returns the number of
+// rows affected.
+func runBackfillBatch(c *config, db *sql.DB, b Backfill, first, last int64) (int64, error) {
+	var n int64
+	err := retryBusy(c, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+
+		res, err := tx.Exec(b.Statement, first, last)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		n = rowsAffected(res)
+
+		d := c.dialect
+		if _, err := tx.Exec(bind(c, d.deleteBackfillSQL(c)), b.Name); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "failed to delete backfill progress")
+		}
+		if _, err := tx.Exec(bind(c, d.insertBackfillSQL(c)), b.Name, last+1); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "failed to insert backfill progress")
+		}
+
+		return errors.Wrap(tx.Commit(), "failed to commit transaction")
+	})
+	return n, err
+}
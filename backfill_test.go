@@ -0,0 +1,82 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunBackfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, active INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 25; i++ {
+		if _, err := db.Exec("INSERT INTO users (id) VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Backfill{
+		Name:      "activate_users",
+		Statement: "UPDATE users SET active = 1 WHERE id BETWEEN ? AND ?",
+		Table:     "users",
+		Key:       "id",
+		BatchSize: 10,
+	}
+	active := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE active = 1").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// An interrupted run stopped after the first batch.
+	if err := RunBackfill(db, Backfill{Name: b.Name, Statement: b.Statement, To: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE users SET active = NULL"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunBackfill(db, b); err != nil {
+		t.Fatal(err)
+	}
+	if n := active(); n != 15 {
+		t.Errorf("expected the backfill to resume after key 10 and update 15 users, got %d", n)
+	}
+
+	if _, err := db.Exec("UPDATE users SET active = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunBackfill(db, b); err != nil {
+		t.Fatal(err)
+	}
+	if n := active(); n != 0 {
+		t.Errorf("expected a finished backfill to do nothing, updated %d users", n)
+	}
+
+	if err := RunBackfill(db, Backfill{Name: "missing_range", Statement: b.Statement}); err == nil {
+		t.Error("expected a backfill without a range to fail")
+	}
+}
@@ -0,0 +1,275 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithSingleTransaction makes Up, UpTo and UpAll apply the pending
+// migrations in a single transaction, committed once all of them are
+// applied, for all-or-nothing deploys: if one fails, none is applied and
+// the error is an ErrBatchFailed telling which one failed. On dialects
+// with savepoints, all but Redshift, each migration runs in its own, so
+// the failing one is rolled back alone before the whole transaction is.
+//
+// The dialect must run DDL in transactions, unlike MySQL, and the
+// migrations must be able to share a transaction: SQL migrations
+// annotated with NO TRANSACTION, FOREIGN KEYS OFF or ONLY IF, and version
+// directories, make it fail before applying any migration. Migrations
+// aren't marked dirty, as none can be partially applied.
+func WithSingleTransaction() OptionsFunc {
+	return func(o *options) { o.singleTx = true }
+}
+
+// ErrBatchFailed is returned when a migration applied with
+// WithSingleTransaction fails. The migrations applied before it in the
+// transaction were rolled back with it.
+type ErrBatchFailed struct {
+	Version    int64   // version of the failed migration
+	RolledBack []int64 // versions applied before it in the transaction
+	Err        error   // error of the failed migration, an ErrMigrationFailed
+}
+
+func (e *ErrBatchFailed) Error() string {
+	return fmt.Sprintf("migration %d failed, rolled back the %d migrations applied before it in the same transaction: %v", e.Version, len(e.RolledBack), e.Err)
+}
+
+// Cause returns the underlying error, for errors.Cause.
+func (e *ErrBatchFailed) Cause() error { return e.Err }
+
+// Unwrap returns the underlying error, for errors.As and errors.Is.
+func (e *ErrBatchFailed) Unwrap() error { return e.Err }
+
+// upBatch applies the pending migrations in a single transaction, see
+// WithSingleTransaction. Heavy migrations deferred by the maintenance
+// window of o end the batch if stop is set, as with Up, and are left out
+// otherwise, as with UpAll. Repeatable migrations are applied once the
+// transaction committed if repeatables is set.
+func upBatch(c *config, db *sql.DB, dir string, pending Migrations, o options, stop, repeatables bool) error {
+	var batch Migrations
+	for _, m := range pending {
+		deferred, window, err := o.deferred(c, m)
+		if err != nil {
+			return err
+		}
+		if deferred {
+			deferHeavy(c, m, window)
+			if stop {
+				break
+			}
+			continue
+		}
+		batch = append(batch, m)
+	}
+	if err := checkBatch(c, db, batch); err != nil {
+		return err
+	}
+
+	h := newHooks(db, dir, o)
+	if len(batch) > 0 {
+		if err := h.before(c); err != nil {
+			return err
+		}
+		if err := runBatch(c, db, batch, o); err != nil {
+			return err
+		}
+	} else {
+		current, err := ensureDBVersion(c, db)
+		if err != nil {
+			return err
+		}
+		printProgress(c, "goose: no migrations to run. current version: %d\n", current)
+	}
+
+	if repeatables {
+		if err := applyRepeatables(c, db, dir, h); err != nil {
+			return err
+		}
+	}
+	return h.after(c)
+}
+
+// checkBatch checks that the migrations can be applied in a single
+// transaction, and that the migrations they depend on are applied or
+// applied before them in the batch.
+func checkBatch(c *config, db *sql.DB, batch Migrations) error {
+	if d := c.dialect; !transactionalDDL(d) {
+		return errors.Errorf("%s doesn't run DDL in transactions, migrations can't be applied in a single transaction", dialectName(d))
+	}
+
+	inBatch := make(map[int64]bool)
+	for _, m := range batch {
+		if m.dir {
+			return errors.Errorf("%s: version directories can't be applied in a single transaction", filepath.Base(m.Source))
+		}
+		if !m.Registered && fileExt(m.Source) == ".go" {
+			return errNotRegistered(m)
+		}
+		if !m.Registered {
+			unsupported, err := unsupportedInBatch(c, m)
+			if err != nil {
+				return err
+			}
+			if unsupported != "" {
+				return errors.Errorf("%s: the %s annotation is not supported in a single transaction", filepath.Base(m.Source), unsupported)
+			}
+		}
+
+		var outside []int64
+		for _, v := range m.dependsOn {
+			if !inBatch[v] {
+				outside = append(outside, v)
+			}
+		}
+		if err := checkDependencies(c, db, &Migration{Version: m.Version, dependsOn: outside}); err != nil {
+			return err
+		}
+		inBatch[m.Version] = true
+	}
+	return nil
+}
+
+// unsupportedInBatch returns the annotation of a SQL migration that keeps
+// it from sharing a transaction with other migrations, if any.
+func unsupportedInBatch(c *config, m *Migration) (string, error) {
+	parsed, err := scanSQLFile(c, m.Source, true, discardStatement)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse SQL migration file %q", filepath.Base(m.Source))
+	}
+	switch {
+	case !parsed.useTx:
+		return "NO TRANSACTION", nil
+	case parsed.foreignKeysOff:
+		return "FOREIGN KEYS OFF", nil
+	case len(parsed.guards) > 0:
+		return "ONLY IF", nil
+	}
+	return "", nil
+}
+
+// savepointName returns the name of the savepoint of the migration m.
+func savepointName(m *Migration) string {
+	return fmt.Sprintf("goose_%d", m.Version)
+}
+
+// runBatch applies the migrations in a single transaction, each one in a
+// savepoint if the dialect supports them.
+func runBatch(c *config, db *sql.DB, batch Migrations, o options) error {
+	ctx, begin, done, err := hookedBegin(withTxSettings(context.Background(), o.tx), c, db)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	printInfo(c, "Begin transaction\n")
+	tx, err := begin(ctx, txOptions(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if err := applyTxSettings(ctx, c, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	savepoints := supportsSavepoints(c.dialect)
+	results := make([]*MigrationResult, len(batch))
+	for i, m := range batch {
+		if savepoints {
+			if _, err := tx.Exec("SAVEPOINT " + savepointName(m)); err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "failed to create savepoint")
+			}
+		}
+
+		results[i] = &MigrationResult{Migration: m, Direction: true}
+		start := time.Now()
+		if err := runInBatch(withResult(ctx, results[i]), c, tx, m); err != nil {
+			if savepoints {
+				printInfo(c, "Rollback to savepoint %s\n", savepointName(m))
+				if _, err := tx.Exec("ROLLBACK TO SAVEPOINT " + savepointName(m)); err != nil {
+					c.logger.Printf("goose: failed to roll back to savepoint %s: %v\n", savepointName(m), err)
+				}
+			}
+			printInfo(c, "Rollback transaction\n")
+			tx.Rollback()
+
+			failed := &ErrBatchFailed{Version: m.Version, Err: err}
+			for _, applied := range batch[:i] {
+				failed.RolledBack = append(failed.RolledBack, applied.Version)
+			}
+			return failed
+		}
+		results[i].Duration = time.Since(start)
+
+		if savepoints {
+			if _, err := tx.Exec("RELEASE SAVEPOINT " + savepointName(m)); err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "failed to release savepoint")
+			}
+		}
+	}
+
+	printInfo(c, "Commit transaction\n")
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	handler := c.resultHandler
+	for i, m := range batch {
+		if err := recordChecksum(c, db, m); err != nil {
+			return err
+		}
+		printProgress(c, "OK    %s\n", filepath.Base(m.Source))
+		if handler != nil {
+			handler(results[i])
+		}
+		if o.results != nil {
+			o.results(results[i])
+		}
+	}
+	return nil
+}
+
+// runInBatch applies the migration m in the transaction of a batch,
+// returning an ErrMigrationFailed if it fails.
+func runInBatch(ctx context.Context, c *config, tx *sql.Tx, m *Migration) error {
+	if err := tagSession(c, tx, m.Version); err != nil {
+		return err
+	}
+
+	if m.Registered {
+		if m.UpFn != nil {
+			if err := m.UpFn(tx); err != nil {
+				return migrationFailed(m, errors.Wrapf(err, "failed to run Go migration %q", filepath.Base(m.Source)))
+			}
+		}
+	} else {
+		parsed, err := scanSQLFile(c, m.Source, true, collationCheck(c))
+		if err != nil {
+			return migrationFailed(m, errors.Wrapf(err, "failed to run SQL migration %q", filepath.Base(m.Source)))
+		}
+		if err := checkDestructive(parsed); err != nil {
+			return migrationFailed(m, errors.Wrapf(err, "failed to run SQL migration %q", filepath.Base(m.Source)))
+		}
+
+		ctx = withSourceFile(ctx, m.Source)
+		i := 0
+		_, err = scanSQLFile(c, m.Source, true, func(query string, line int) error {
+			i++
+			return execStatement(ctx, c, tx, query, i, parsed.count, line)
+		})
+		if err != nil {
+			return migrationFailed(m, errors.Wrapf(err, "failed to run SQL migration %q", filepath.Base(m.Source)))
+		}
+	}
+
+	if err := recordVersion(c, tx, m, true); err != nil {
+		return migrationFailed(m, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSingleTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for v := int64(1); v <= 2; v++ {
+		writeSQLMigration(t, dir, v, fmt.Sprintf("t%d", v))
+	}
+	broken := filepath.Join(dir, "00003_broken.sql")
+	if err := ioutil.WriteFile(broken, []byte("-- +goose Up\nCREATE TABLE t3 (id int);\nINSERT INTO missing VALUES (1);\n\n-- +goose Down\nDROP TABLE t3;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Up(db, dir, WithSingleTransaction())
+	failed, ok := err.(*ErrBatchFailed)
+	if !ok {
+		t.Fatalf("expected an ErrBatchFailed, got %v", err)
+	}
+	if failed.Version != 3 || !reflect.DeepEqual(failed.RolledBack, []int64{1, 2}) {
+		t.Errorf("got failed migration %d after %v, want 3 after [1 2]", failed.Version, failed.RolledBack)
+	}
+	if m, ok := failed.Err.(*ErrMigrationFailed); !ok || m.StatementNumber != 2 {
+		t.Errorf("expected the failed statement to be reported, got %v", failed.Err)
+	}
+	if version, err := EnsureDBVersion(db); err != nil || version != 0 {
+		t.Errorf("expected nothing to be applied, got version %d, %v", version, err)
+	}
+	if _, err := db.Exec("SELECT 1 FROM t1"); err == nil {
+		t.Error("expected the first migration to be rolled back")
+	}
+
+	writeSQLMigration(t, dir, 3, "t3")
+	if err := os.Remove(broken); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "00004_concurrently.sql"), []byte("-- +goose NO TRANSACTION\n-- +goose Up\nCREATE TABLE t4 (id int);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpAll(db, dir, WithSingleTransaction()); err == nil {
+		t.Error("expected a NO TRANSACTION migration to fail the batch")
+	}
+	if version, err := EnsureDBVersion(db); err != nil || version != 0 {
+		t.Errorf("expected the batch to fail before applying any migration, got version %d, %v", version, err)
+	}
+	if err := UpTo(db, dir, 3, WithSingleTransaction()); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := EnsureDBVersion(db); err != nil || version != 3 {
+		t.Errorf("got version %d, %v, want 3", version, err)
+	}
+}
@@ -0,0 +1,243 @@
+// Package bundle packs a directory of migrations into a single compressed
+// file at build time and serves it back to goose as a MigrationSource.
+//
+// Bundles are compressed with a named Codec. Gzip is available out of the
+// box; zstd is in the github.com/lonja/goose/bundlezstd module, which keeps
+// its dependency out of this one, and other codecs, e.g. xz, can be added
+// with Register:
+//
+//	bundle.Register(bundle.Codec{
+//		Name: "xz",
+//		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) },
+//		NewReader: func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) },
+//	})
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const magic = "goose-bundle\n"
+
+// Codec compresses and decompresses the contents of a bundle.
+type Codec struct {
+	Name      string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.Reader, error)
+}
+
+// Gzip compresses bundles with compress/gzip.
+var Gzip = Codec{
+	Name:      "gzip",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, gzip.BestCompression) },
+	NewReader: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{Gzip.Name: Gzip}
+)
+
+// Register makes a codec available to Load by its name.
+func Register(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name] = c
+}
+
+// sqlFiles returns the paths of the .sql files of dir, in name order,
+// following symlinks. The directory is listed rather than globbed, so
+// names with glob metacharacters, like C:\[work]\migrations, are read as
+// is.
+func sqlFiles(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(entries)
+
+	var names []string
+	for _, e := range entries {
+		name := filepath.Join(dir, e)
+		if strings.ToLower(filepath.Ext(e)) != ".sql" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Write packs the .sql files of dir into a bundle compressed with codec.
+// Files are stored under dir, so the bundle is used with the same dir
+// argument as the directory on disk.
+func Write(w io.Writer, dir string, codec Codec) error {
+	names, err := sqlFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, magic+codec.Name+"\n"); err != nil {
+		return err
+	}
+	cw, err := codec.NewWriter(w)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s writer", codec.Name)
+	}
+	tw := tar.NewWriter(cw)
+
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name: cleanPath(name),
+			Mode: 0644,
+			Size: int64(len(data)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// WriteFile packs the .sql files of dir into the bundle file at name.
+func WriteFile(name, dir string, codec Codec) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, dir, codec); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Bundle is a decompressed, in-memory set of migration files.
+// It implements goose.MigrationSource.
+type Bundle struct {
+	files map[string][]byte
+	dirs  map[string][]string
+}
+
+// Load decompresses a bundle created by Write.
+func Load(data []byte) (*Bundle, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != magic {
+		return nil, errors.New("not a goose migration bundle")
+	}
+	name, err := r.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read bundle codec")
+	}
+	name = strings.TrimSuffix(name, "\n")
+
+	codecsMu.RLock()
+	codec, ok := codecs[name]
+	codecsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%q: unknown bundle codec", name)
+	}
+
+	cr, err := codec.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s reader", codec.Name)
+	}
+	if c, ok := cr.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	b := &Bundle{files: map[string][]byte{}, dirs: map[string][]string{}}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read bundle")
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read bundle")
+		}
+		b.files[hdr.Name] = data
+		dir, base := path.Split(hdr.Name)
+		dir = cleanPath(dir)
+		b.dirs[dir] = append(b.dirs[dir], base)
+	}
+
+	for _, names := range b.dirs {
+		sort.Strings(names)
+	}
+
+	return b, nil
+}
+
+// LoadFile decompresses the bundle file at name.
+func LoadFile(name string) (*Bundle, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
+
+// ReadDir returns the sorted names of the files bundled under dir.
+func (b *Bundle) ReadDir(dir string) ([]string, error) {
+	names, ok := b.dirs[cleanPath(dir)]
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: dir, Err: os.ErrNotExist}
+	}
+	return append([]string(nil), names...), nil
+}
+
+// Open opens the bundled file at name.
+func (b *Bundle) Open(name string) (io.ReadCloser, error) {
+	data, ok := b.files[cleanPath(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func cleanPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
@@ -0,0 +1,88 @@
+package bundle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "../examples/sql-migrations", Gzip); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := b.ReadDir("../examples/sql-migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("incorrect number of files. got %v, want 3", names)
+	}
+
+	for _, name := range names {
+		path := "../examples/sql-migrations/" + name
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := b.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: bundled content differs from file", name)
+		}
+	}
+
+	if _, err := b.ReadDir("missing"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	if _, err := Load([]byte(magic + "lz4\n")); err == nil {
+		t.Error("expected unknown codec error")
+	}
+}
+
+func TestWriteGlobMetacharacters(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "[work]")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_init.sql"), []byte("-- +goose Up\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, dir, Gzip); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names, err := b.ReadDir(dir); err != nil || len(names) != 1 {
+		t.Errorf("expected the migration of %s to be bundled, got %v, %v", dir, names, err)
+	}
+}
@@ -0,0 +1,34 @@
+// Package bundlezstd compresses goose bundles with zstd, which decompresses
+// several times faster than gzip at a similar ratio. It is a module of its
+// own, so goose doesn't depend on the zstd implementation.
+//
+// Importing it registers the codec, so bundle.Load reads zstd bundles:
+//
+//	err := bundle.WriteFile("migrations.bundle", "migrations", bundlezstd.Codec)
+package bundlezstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/lonja/goose/v4/bundle"
+)
+
+// Codec compresses bundles with zstd at its best compression level.
+var Codec = bundle.Codec{
+	Name: "zstd",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	},
+	NewReader: func(r io.Reader) (io.Reader, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+func init() {
+	bundle.Register(Codec)
+}
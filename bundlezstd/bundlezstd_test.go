@@ -0,0 +1,48 @@
+package bundlezstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/lonja/goose/v4/bundle"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, "../examples/sql-migrations", Codec); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bundle.Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := b.ReadDir("../examples/sql-migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("incorrect number of files. got %v, want 3", names)
+	}
+	for _, name := range names {
+		path := "../examples/sql-migrations/" + name
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := b.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: bundled content differs from file", name)
+		}
+	}
+}
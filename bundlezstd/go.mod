@@ -0,0 +1,12 @@
+module github.com/lonja/goose/bundlezstd
+
+go 1.22
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/lonja/goose/v4 v4.0.0
+)
+
+require github.com/pkg/errors v0.9.1 // indirect
+
+replace github.com/lonja/goose/v4 => ../
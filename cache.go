@@ -0,0 +1,62 @@
+package goose
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// versionCache holds the versions GetDBVersion read, per database and
+// version table.
+var versionCache = struct {
+	sync.Mutex
+	entries map[versionCacheKey]cachedVersion
+}{entries: make(map[versionCacheKey]cachedVersion)}
+
+type versionCacheKey struct {
+	db    *sql.DB
+	table string
+}
+
+type cachedVersion struct {
+	version int64
+	expires time.Time
+}
+
+// SetVersionCacheTTL sets how long GetDBVersion reuses the version it read
+// from a database, e.g. for readiness probes checking the version every
+// few seconds. Zero, the default, disables the cache.
+//
+// Migrations run through goose always read the version table and
+// invalidate the cache; changes made by other processes are seen once the
+// cached version expires or after InvalidateVersionCache.
+func SetVersionCacheTTL(ttl time.Duration) {
+	updateConfig(func(c *config) { c.versionCacheTTL = ttl })
+	InvalidateVersionCache()
+}
+
+// InvalidateVersionCache drops the versions cached by GetDBVersion.
+func InvalidateVersionCache() {
+	versionCache.Lock()
+	defer versionCache.Unlock()
+	versionCache.entries = make(map[versionCacheKey]cachedVersion)
+}
+
+// cachedDBVersion returns the cached version of db, if it hasn't expired.
+func cachedDBVersion(c *config, db *sql.DB) (int64, bool) {
+	versionCache.Lock()
+	defer versionCache.Unlock()
+
+	e, ok := versionCache.entries[versionCacheKey{db, c.versionTableName()}]
+	if !ok || time.Now().After(e.expires) {
+		return 0, false
+	}
+	return e.version, true
+}
+
+// cacheDBVersion caches the version of db for ttl.
+func cacheDBVersion(c *config, db *sql.DB, version int64, ttl time.Duration) {
+	versionCache.Lock()
+	defer versionCache.Unlock()
+	versionCache.entries[versionCacheKey{db, c.versionTableName()}] = cachedVersion{version, time.Now().Add(ttl)}
+}
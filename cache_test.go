@@ -0,0 +1,60 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVersionCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	SetVersionCacheTTL(time.Hour)
+	defer SetVersionCacheTTL(0)
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+
+	version := func(want int64) {
+		t.Helper()
+		got, err := GetDBVersion(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got version %d, want %d", got, want)
+		}
+	}
+
+	version(0)
+	if err := UpTo(db, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	version(1)
+
+	// Changes made behind goose's back are seen after invalidation.
+	if _, err := db.Exec(GetDialect().insertVersionSQL(runConfig()), 2, true); err != nil {
+		t.Fatal(err)
+	}
+	version(1)
+	InvalidateVersionCache()
+	version(2)
+}
@@ -0,0 +1,401 @@
+package goose
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DriftAction tells goose how to handle an applied migration whose
+// checksum no longer matches the one recorded when it was applied.
+type DriftAction int
+
+const (
+	// DriftFail aborts the run with an error. This is the default.
+	DriftFail DriftAction = iota
+	// DriftAccept records the new checksum and continues.
+	DriftAccept
+	// DriftReapply rolls the migration back and applies it again. Only
+	// SQL migrations annotated with '-- +goose REAPPLY ON DRIFT' are
+	// reapplied, as rolling back usually loses data; the run fails for
+	// the others.
+	DriftReapply
+)
+
+// DriftResolver decides what to do with an applied migration
+// whose recorded checksum differs from the actual one.
+type DriftResolver func(m *Migration, recorded, actual string) DriftAction
+
+func failOnDrift(*Migration, string, string) DriftAction { return DriftFail }
+
+// SetVerifyChecksums enables recording and verification of SQL migration checksums.
+func SetVerifyChecksums(v bool) {
+	updateConfig(func(c *config) { c.verifyChecksums = v })
+}
+
+// SetDriftResolver sets the resolver consulted when checksum drift is detected.
+// A nil resolver restores the default, which fails the run.
+func SetDriftResolver(r DriftResolver) {
+	if r == nil {
+		r = failOnDrift
+	}
+	updateConfig(func(c *config) { c.driftResolver = r })
+}
+
+func checksumTableName(c *config) string {
+	return c.versionTableName() + "_checksum"
+}
+
+// checksumCache holds the checksums of migration files on the local
+// filesystem keyed by path, so repeated runs in a process only hash the
+// files whose modification time or size changed.
+var checksumCache = struct {
+	sync.Mutex
+	entries map[string]cachedChecksum
+}{entries: make(map[string]cachedChecksum)}
+
+type cachedChecksum struct {
+	stamp    string // modification times and sizes of the hashed files
+	checksum string
+}
+
+// fileChecksum returns the hex encoded SHA-256 of the migration file,
+// followed by its .down.sql file for paired .up.sql migrations.
+func fileChecksum(c *config, path string) (string, error) {
+	stamp, cacheable := fileStamp(c, path)
+	if cacheable {
+		checksumCache.Lock()
+		cached, ok := checksumCache.entries[path]
+		checksumCache.Unlock()
+		if ok && cached.stamp == stamp {
+			return cached.checksum, nil
+		}
+	}
+
+	checksum, err := hashMigrationFile(c, path)
+	if err != nil {
+		return "", err
+	}
+
+	if cacheable {
+		checksumCache.Lock()
+		checksumCache.entries[path] = cachedChecksum{stamp: stamp, checksum: checksum}
+		checksumCache.Unlock()
+	}
+	return checksum, nil
+}
+
+// fileChecksums returns the checksums of the migration files keyed by
+// path, hashing them in parallel.
+func fileChecksums(c *config, paths []string) (map[string]string, error) {
+	checksums := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	parallel(len(paths), func(i int) {
+		checksums[i], errs[i] = fileChecksum(c, paths[i])
+	})
+
+	byPath := make(map[string]string, len(paths))
+	for i, path := range paths {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		byPath[path] = checksums[i]
+	}
+	return byPath, nil
+}
+
+// fileStamp returns the modification times and sizes of the migration file
+// and its paired .down.sql file, or false if they can't be known, e.g.
+// for migrations not read from the local filesystem.
+func fileStamp(c *config, path string) (string, bool) {
+	if _, ok := c.source.(osSource); !ok {
+		return "", false
+	}
+
+	files := []string{path}
+	if down, ok := pairedDownFile(path); ok {
+		files = append(files, down)
+	}
+
+	stamps := make([]string, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) && i > 0 {
+			stamps[i] = "-"
+			continue
+		}
+		if err != nil {
+			return "", false
+		}
+		stamps[i] = fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	}
+	return strings.Join(stamps, ","), true
+}
+
+func hashMigrationFile(c *config, path string) (string, error) {
+	h := sha256.New()
+	if err := hashFile(c, h, path); err != nil {
+		return "", err
+	}
+	if down, ok := pairedDownFile(path); ok {
+		if err := hashFile(c, h, down); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(c *config, w io.Writer, path string) error {
+	f, err := c.source.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open migration file")
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return errors.Wrap(err, "failed to read migration file")
+	}
+	return nil
+}
+
+// dbChecksums returns the recorded checksums keyed by version.
+// Create the checksum table if it doesn't exist.
+func dbChecksums(c *config, db *sql.DB) (map[int64]string, error) {
+	checksums := make(map[int64]string)
+
+	rows, err := db.Query(fmt.Sprintf("SELECT version_id, checksum FROM %s", quoteTableName(c.dialect, checksumTableName(c))))
+	if err != nil {
+		if !c.dialect.isMissingTable(err) {
+			return nil, errors.Wrap(err, "failed to query checksum table")
+		}
+		if _, err := db.Exec(c.dialect.createChecksumTableSQL(c)); err != nil {
+			return nil, errors.Wrap(err, "failed to create checksum table")
+		}
+		return checksums, nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		checksums[version] = checksum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to get next row")
+	}
+
+	return checksums, nil
+}
+
+func storeChecksum(c *config, db *sql.DB, version int64, checksum string) error {
+	d := c.dialect
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if _, err := tx.Exec(bind(c, d.deleteChecksumSQL(c)), version); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "failed to delete checksum")
+	}
+	if _, err := tx.Exec(bind(c, d.insertChecksumSQL(c)), version, checksum); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "failed to insert checksum")
+	}
+
+	return tx.Commit()
+}
+
+// checksummed reports whether the checksum of a migration is recorded:
+// only SQL files are, not migrations registered from Go with a .sql name.
+func checksummed(m *Migration) bool {
+	return !m.Registered && fileExt(m.Source) == ".sql"
+}
+
+// recordChecksum stores the checksum of an applied SQL migration.
+func recordChecksum(c *config, db *sql.DB, m *Migration) error {
+	if !c.verifyChecksums || !checksummed(m) {
+		return nil
+	}
+	if _, err := dbChecksums(c, db); err != nil {
+		return err
+	}
+
+	checksum, err := fileChecksum(c, m.Source)
+	if err != nil {
+		return err
+	}
+
+	return storeChecksum(c, db, m.Version, checksum)
+}
+
+// forgetChecksum removes the checksum of a rolled back SQL migration.
+func forgetChecksum(c *config, db *sql.DB, m *Migration) error {
+	if !c.verifyChecksums || !checksummed(m) {
+		return nil
+	}
+	if _, err := dbChecksums(c, db); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(bind(c, c.dialect.deleteChecksumSQL(c)), m.Version); err != nil {
+		return errors.Wrap(err, "failed to delete checksum")
+	}
+
+	return nil
+}
+
+// verifyAppliedChecksums compares the checksums of applied SQL migrations
+// with the recorded ones and lets the drift resolver handle mismatches.
+// Applied migrations without a recorded checksum are baselined.
+func verifyAppliedChecksums(c *config, db *sql.DB, dir string) error {
+	if !c.verifyChecksums {
+		return nil
+	}
+
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(c, db, migrations)
+	if err != nil {
+		return err
+	}
+
+	recorded, err := dbChecksums(c, db)
+	if err != nil {
+		return err
+	}
+
+	actuals, err := appliedChecksums(c, migrations, applied)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		actual, ok := actuals[m.Source]
+		if !ok {
+			continue
+		}
+
+		checksum, ok := recorded[m.Version]
+		if !ok {
+			if err := storeChecksum(c, db, m.Version, actual); err != nil {
+				return err
+			}
+			continue
+		}
+		if checksum == actual {
+			continue
+		}
+
+		switch c.driftResolver(m, checksum, actual) {
+		case DriftAccept:
+			if err := storeChecksum(c, db, m.Version, actual); err != nil {
+				return err
+			}
+			c.logger.Printf("ACCEPTED drift of %s\n", filepath.Base(m.Source))
+		case DriftReapply:
+			if err := checkReapplyOnDrift(c, m); err != nil {
+				return err
+			}
+			if err := m.down(c, db, options{}); err != nil {
+				return err
+			}
+			if err := m.apply(c, db); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("checksum mismatch for applied migration %q: recorded %s, actual %s", filepath.Base(m.Source), checksum, actual)
+		}
+	}
+
+	return nil
+}
+
+// checkReapplyOnDrift fails unless the drifted SQL migration is annotated
+// with REAPPLY ON DRIFT.
+func checkReapplyOnDrift(c *config, m *Migration) error {
+	parsed, err := scanSQLFile(c, m.Source, true, discardStatement)
+	if err != nil {
+		return err
+	}
+	if !parsed.reapplyOnDrift {
+		return errors.Errorf("drifted migration %q can't be reapplied, annotate it with '-- +goose REAPPLY ON DRIFT' if its Down and Up sections may run again", filepath.Base(m.Source))
+	}
+	return nil
+}
+
+// AcceptDrift updates the recorded checksums of all applied SQL migrations
+// to match the files on disk. Run it after reviewing the drifted migrations.
+func AcceptDrift(db *sql.DB, dir string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return acceptDrift(c, db, dir)
+}
+
+// acceptDrift is AcceptDrift, for callers holding runMu.
+func acceptDrift(c *config, db *sql.DB, dir string) error {
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(c, db, migrations)
+	if err != nil {
+		return err
+	}
+
+	recorded, err := dbChecksums(c, db)
+	if err != nil {
+		return err
+	}
+
+	actuals, err := appliedChecksums(c, migrations, applied)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		actual, ok := actuals[m.Source]
+		if !ok {
+			continue
+		}
+		if recorded[m.Version] == actual {
+			continue
+		}
+
+		if err := storeChecksum(c, db, m.Version, actual); err != nil {
+			return err
+		}
+		c.logger.Printf("ACCEPTED drift of %s\n", filepath.Base(m.Source))
+	}
+
+	return nil
+}
+
+// appliedChecksums returns the checksums of the applied SQL migrations
+// keyed by source.
+func appliedChecksums(c *config, migrations Migrations, applied map[int64]bool) (map[string]string, error) {
+	var paths []string
+	for _, m := range migrations {
+		if applied[m.Version] && checksummed(m) {
+			paths = append(paths, m.Source)
+		}
+	}
+	return fileChecksums(c, paths)
+}
@@ -0,0 +1,212 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChecksumDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetVerifyChecksums(true)
+	defer SetVerifyChecksums(false)
+	defer SetDriftResolver(nil)
+
+	writeSQLMigration(t, dir, 1, "one")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit the applied migration.
+	src := "-- +goose Up\nCREATE TABLE one (id int, name text);\n\n-- +goose Down\nDROP TABLE one;\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_one.sql"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err == nil {
+		t.Fatal("expected checksum mismatch error")
+	}
+
+	var resolved bool
+	SetDriftResolver(func(m *Migration, recorded, actual string) DriftAction {
+		resolved = m.Version == 1 && recorded != actual
+		return DriftAccept
+	})
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !resolved {
+		t.Error("drift resolver was not consulted")
+	}
+
+	SetDriftResolver(nil)
+	if err := Up(db, dir); err != nil {
+		t.Errorf("expected accepted checksum to be recorded, got %v", err)
+	}
+}
+
+func TestChecksumDriftReapply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetVerifyChecksums(true)
+	defer SetVerifyChecksums(false)
+	defer SetDriftResolver(nil)
+
+	writeSQLMigration(t, dir, 1, "one")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO one (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	SetDriftResolver(func(*Migration, string, string) DriftAction { return DriftReapply })
+	path := filepath.Join(dir, "00001_one.sql")
+	src := "-- +goose Up\nCREATE TABLE one (id int, name text);\n\n-- +goose Down\nDROP TABLE one;\n"
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err == nil {
+		t.Fatal("a migration without REAPPLY ON DRIFT was reapplied")
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM one").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("the rows of the drifted migration were lost: %d, %v", n, err)
+	}
+
+	src = "-- +goose Up\n-- +goose REAPPLY ON DRIFT\nCREATE TABLE one (id int, name text);\n\n-- +goose Down\nDROP TABLE one;\n"
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO one (id, name) VALUES (1, 'a')"); err != nil {
+		t.Errorf("the annotated migration wasn't reapplied: %v", err)
+	}
+}
+
+func TestChecksumCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for v := int64(1); v <= 20; v++ {
+		writeSQLMigration(t, dir, v, "t")
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("%05d_t.sql", v)))
+	}
+	checksums, err := fileChecksums(runConfig(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checksums) != len(paths) {
+		t.Fatalf("expected %d checksums, got %d", len(paths), len(checksums))
+	}
+
+	// Files are hashed again only when their modification time or size
+	// changes.
+	path := paths[0]
+	before := checksums[path]
+	stamp := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fileChecksum(runConfig(), path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("-- +goose Up\nCREATE TABLE u (id int);\n\n-- +goose Down\nDROP TABLE u;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+	if checksum, err := fileChecksum(runConfig(), path); err != nil || checksum != before {
+		t.Errorf("expected the cached checksum %s, got %s (%v)", before, checksum, err)
+	}
+
+	if err := os.Chtimes(path, time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if checksum, err := fileChecksum(runConfig(), path); err != nil || checksum == before {
+		t.Errorf("expected a new checksum after the file changed, got %s (%v)", checksum, err)
+	}
+}
+
+func TestChecksumRegisteredAndQueryErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetVerifyChecksums(true)
+	defer SetVerifyChecksums(false)
+
+	// A migration registered from Go has no file to checksum, whatever its
+	// name.
+	writeSQLMigration(t, dir, 1, "one")
+	AddMigrationVersion(2, "00002_seed.sql", func(tx *sql.Tx) error { return nil }, nil)
+	defer func() {
+		registryMu.Lock()
+		delete(registeredGoMigrations, 2)
+		registryMu.Unlock()
+	}()
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a missing checksum table is created, other errors are returned.
+	db.Close()
+	if _, err := dbChecksums(runConfig(), db); err == nil || !strings.Contains(err.Error(), "failed to query checksum table") {
+		t.Errorf("got error %v, want the query error", err)
+	}
+}
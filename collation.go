@@ -0,0 +1,31 @@
+package goose
+
+import (
+	"regexp"
+)
+
+// SetAllowCollationChanges acknowledges that migrations may alter database
+// or column collations and character sets. Such changes can rewrite whole
+// tables and change comparison behavior, so they are refused by default.
+func SetAllowCollationChanges(v bool) {
+	updateConfig(func(c *config) { c.allowCollationChanges = v })
+}
+
+var (
+	matchAlter            = regexp.MustCompile(`(?is)^\s*ALTER\s+(TABLE|DATABASE|SCHEMA)\b`)
+	matchCollationClause  = regexp.MustCompile(`(?i)\b(COLLATE|CHARACTER\s+SET|CHARSET|LC_COLLATE|LC_CTYPE|ENCODING)\b`)
+	matchAlterCollation   = regexp.MustCompile(`(?is)^\s*ALTER\s+COLLATION\b`)
+	matchRefreshCollation = regexp.MustCompile(`(?i)\bREFRESH\s+COLLATION\s+VERSION\b`)
+)
+
+// changesCollation reports whether the statement alters an existing
+// collation or character set.
+func changesCollation(stmt string) bool {
+	stmt = clearStatement(stmt)
+
+	if matchAlterCollation.MatchString(stmt) || matchRefreshCollation.MatchString(stmt) {
+		return true
+	}
+
+	return matchAlter.MatchString(stmt) && matchCollationClause.MatchString(stmt)
+}
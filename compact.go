@@ -0,0 +1,97 @@
+package goose
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCompactVersionTable is returned by operations that need the history of
+// applied migrations, which a compact version table doesn't keep.
+var ErrCompactVersionTable = errors.New("not supported with a compact version table")
+
+// SetCompactVersionTable selects the compact bookkeeping mode, which keeps a
+// single row with the current version and a checksum of the set of applied
+// migrations instead of one row per applied migration.
+//
+// All migrations up to the current version are considered applied, so
+// migrations can't be applied out of order (UpAll, fix and the imports
+// return ErrCompactVersionTable). Adding or removing a migration below the
+// current version changes the checksum, which makes the next Up or Down
+// fail instead of silently skipping it.
+//
+// The mode only decides how the version table is created and read; choose
+// it once per project.
+func SetCompactVersionTable(v bool) {
+	updateConfig(func(c *config) { c.compactVersionTable = v })
+}
+
+// appliedSetChecksum extends the checksum of the applied set sum with the
+// next version applied.
+func appliedSetChecksum(sum string, version int64) string {
+	h := sha256.Sum256([]byte(sum + ":" + strconv.FormatInt(version, 10)))
+	return hex.EncodeToString(h[:])
+}
+
+// compactDBVersion returns the version recorded in the compact version
+// table, creating and initializing the table if it doesn't exist.
+func compactDBVersion(c *config, db *sql.DB) (int64, error) {
+	var version int64
+	t := versionTableFor(c, c.dialect)
+	err := db.QueryRow(fmt.Sprintf("SELECT %s FROM %s", t.versionID, t.name)).Scan(&version)
+	if err == sql.ErrNoRows {
+		if _, err := db.Exec(compactInitialVersionSQL(c)); err != nil {
+			return 0, errors.Wrap(err, "failed to insert initial migration")
+		}
+		return 0, nil
+	}
+	if err != nil {
+		if err := versionTableError(c, err); !isVersionTableMissing(err) {
+			return 0, err
+		}
+		return 0, createMissingVersionTable(c, db)
+	}
+
+	return version, nil
+}
+
+func compactInitialVersionSQL(c *config) string {
+	t := versionTableFor(c, c.dialect)
+	return fmt.Sprintf("INSERT INTO %s (%s, checksum) VALUES (0, '');", t.name, t.versionID)
+}
+
+// recordCompactVersion moves the compact version table from the state
+// before m was applied or rolled back to the state after. The update only
+// matches the expected state, so a changed set of migrations or a
+// concurrent run fails instead of overwriting the version.
+func recordCompactVersion(c *config, q Querier, m *Migration, direction bool) error {
+	from, fromSum := m.Previous, m.previousSetChecksum
+	to, toSum := m.Version, m.setChecksum
+	if !direction {
+		from, fromSum, to, toSum = to, toSum, from, fromSum
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to < 0 {
+		to = 0
+	}
+
+	res, err := q.Exec(bind(c, c.dialect.updateCompactVersionSQL(c)), to, toSum, from, fromSum)
+	if err != nil {
+		return errors.Wrap(err, "failed to update goose version")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to update goose version")
+	}
+	if n != 1 {
+		return errors.Errorf("version table doesn't match the migrations applied up to version %d: migrations were added or removed below the current version, or applied concurrently", from)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompactVersionTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetCompactVersionTable(true)
+	defer SetCompactVersionTable(false)
+
+	writeSQLMigration(t, dir, 1, "one")
+	writeSQLMigration(t, dir, 3, "three")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", TableName())).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Errorf("expected a single row in the version table, got %d", rows)
+	}
+
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 1 {
+		t.Fatalf("expected version 1 after down, got %d (%v)", v, err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A migration added below the current version changes the applied set.
+	writeSQLMigration(t, dir, 2, "two")
+	writeSQLMigration(t, dir, 4, "four")
+	if err := Up(db, dir); err == nil {
+		t.Fatal("expected an error for a migration added below the current version")
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 3 {
+		t.Fatalf("expected version 3 to be kept, got %d (%v)", v, err)
+	}
+
+	if _, err := AppliedDBVersions(db); err != ErrCompactVersionTable {
+		t.Errorf("expected ErrCompactVersionTable, got %v", err)
+	}
+}
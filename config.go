@@ -0,0 +1,334 @@
+package goose
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// config holds the package level configuration. It is guarded by configMu,
+// so goose can be configured and used from multiple goroutines, e.g. when
+// migrating shards in parallel. Read it with currentConfig and change it
+// with updateConfig.
+type config struct {
+	dialect               SQLDialect
+	dialectSet            bool
+	tableName             string
+	versionColumns        VersionColumns
+	verbosity             Verbosity
+	logger                Logger
+	versionParser         VersionParser
+	source                MigrationSource
+	verifyChecksums       bool
+	driftResolver         DriftResolver
+	allowCollationChanges bool
+	tagSessions           bool
+	rewriteBudget         int64
+	rewriteThroughput     int64
+	compactVersionTable   bool
+	watchInterval         time.Duration
+	sequentialVersions    bool
+	timestampFormat       string
+	timestampUTC          bool
+	clock                 func() time.Time
+	busyTimeout           time.Duration
+	strictOrder           bool
+	noFixUp               bool
+	generateDown          bool
+	migrationTimeout      time.Duration
+	rollbackHistory       bool
+	schema                string
+	preHook               string
+	postHook              string
+	versionCacheTTL       time.Duration
+	emptyDirMode          EmptyDirMode
+	resultHandler         func(*MigrationResult)
+	connectionHook        ConnectionHook
+	sessionVariables      map[string]string
+	schemaDumpPath        string
+	schemaDumper          SchemaDumper
+	dirtyTracking         bool
+	pinnedVersion         int64 // -1 if not pinned
+	copier                Copier
+	retrySkipped          bool
+	statementRedactor     func(string) string
+	placeholder           Placeholder
+	excludes              []string
+	recursive             bool
+	denyDestructive       bool
+	denyPatterns          []*regexp.Regexp
+	store                 Store
+	environment           string
+	versionTableTTL       time.Duration
+}
+
+var (
+	configMu sync.RWMutex
+	cfg      = config{
+		dialect:        &PostgresDialect{},
+		tableName:      "goose_db_version",
+		versionColumns: defaultVersionColumns,
+		logger:         &stdLogger{},
+		versionParser:  NumericComponent,
+		source:         osSource{},
+		driftResolver:  failOnDrift,
+		// A conservative guess for a table rewrite on commodity disks.
+		rewriteThroughput: 64 << 20,
+		watchInterval:     500 * time.Millisecond,
+		busyTimeout:       5 * time.Second,
+		pinnedVersion:     -1,
+		timestampFormat:   defaultTimestampFormat,
+	}
+)
+
+// runMu keeps the configuration the same during a run. The goose
+// functions migrating or reading migrations hold it for reading, and the
+// configuration functions for writing, so they wait for running
+// migrations to finish. Runs of a Provider have their own configuration
+// and don't hold it. As it isn't reentrant, goose functions holding it call unexported versions of
+// each other, and migrations must not change the configuration.
+var runMu sync.RWMutex
+
+// currentConfig returns a snapshot of the package level configuration.
+func currentConfig() config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return cfg
+}
+
+// runConfig returns a copy of the package level configuration for a run.
+// The run reads it, and passes it to the functions it calls, instead of
+// the package level configuration.
+func runConfig() *config {
+	c := currentConfig()
+	return &c
+}
+
+// updateConfig changes the package level configuration once running
+// migrations are done.
+func updateConfig(fn func(c *config)) {
+	runMu.Lock()
+	defer runMu.Unlock()
+	configMu.Lock()
+	defer configMu.Unlock()
+	fn(&cfg)
+}
+
+// Setting is a resolved configuration value, as reported by
+// EffectiveConfig.
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// EffectiveConfig returns the configuration goose uses to migrate dir,
+// with defaults resolved, so misconfiguration can be diagnosed in one step.
+func EffectiveConfig(dir string) []Setting {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return effectiveConfig(c, dir)
+}
+
+// effectiveConfig is EffectiveConfig, for callers holding runMu.
+func effectiveConfig(c *config, dir string) []Setting {
+	budget := "none"
+	if c.rewriteBudget > 0 {
+		budget = fmt.Sprintf("%d bytes", c.rewriteBudget)
+	}
+	bookkeeping := "history"
+	if c.compactVersionTable {
+		bookkeeping = "compact"
+	}
+	if c.store != nil {
+		bookkeeping = fmt.Sprintf("store (%T)", c.store)
+	}
+	schema := c.schema
+	if schema == "" {
+		schema = "default"
+	}
+	preHook, postHook := c.preHook, c.postHook
+	if preHook == "" {
+		preHook = preHookFile + " if present"
+	}
+	if postHook == "" {
+		postHook = postHookFile + " if present"
+	}
+	dialect := dialectName(c.dialect)
+	if !c.dialectSet {
+		dialect += " (detected from the driver)"
+	}
+	versionCache := "off"
+	if c.versionCacheTTL > 0 {
+		versionCache = c.versionCacheTTL.String()
+	}
+	schemaDump := "off"
+	if c.schemaDumpPath != "" {
+		schemaDump = c.schemaDumpPath
+		if c.schemaDumper != nil {
+			schemaDump += " (" + funcName(c.schemaDumper) + ")"
+		}
+	}
+	sessionVariables := "none"
+	if len(c.sessionVariables) > 0 {
+		var vars []string
+		for name, value := range c.sessionVariables {
+			vars = append(vars, name+"="+value)
+		}
+		sort.Strings(vars)
+		sessionVariables = strings.Join(vars, ", ")
+	}
+	connectionHook := "none"
+	if c.connectionHook != nil {
+		connectionHook = funcName(c.connectionHook)
+	}
+	copier := "none"
+	if c.copier != nil {
+		copier = funcName(c.copier)
+	}
+	resultHandler := "none"
+	if c.resultHandler != nil {
+		resultHandler = funcName(c.resultHandler)
+	}
+	pinned := "none"
+	if c.pinnedVersion >= 0 {
+		pinned = fmt.Sprint(c.pinnedVersion)
+	}
+	skipped := "recorded"
+	if c.retrySkipped {
+		skipped = "pending"
+	}
+	clock := "time.Now"
+	if c.clock != nil {
+		clock = funcName(c.clock)
+	}
+	timezone := "local"
+	if c.timestampUTC {
+		timezone = "UTC"
+	}
+	redactor := "none"
+	if c.statementRedactor != nil {
+		redactor = funcName(c.statementRedactor)
+	}
+	denyPatterns := "none"
+	if len(c.denyPatterns) > 0 {
+		var patterns []string
+		for _, re := range c.denyPatterns {
+			patterns = append(patterns, strings.TrimPrefix(re.String(), "(?is)"))
+		}
+		denyPatterns = strings.Join(patterns, ", ")
+	}
+	excludes := "none"
+	if len(c.excludes) > 0 {
+		excludes = strings.Join(c.excludes, ", ")
+	}
+	environment := c.environment
+	if environment == "" {
+		environment = "none"
+	}
+	versionTableTTL := "off"
+	if c.versionTableTTL > 0 {
+		versionTableTTL = c.versionTableTTL.String()
+	}
+	rollbacks := "deleted"
+	if c.rollbackHistory {
+		rollbacks = "recorded"
+	}
+
+	return []Setting{
+		{"dialect", dialect},
+		{"schema", schema},
+		{"table", c.tableName},
+		{"placeholders", c.placeholder.String()},
+		{"columns", fmt.Sprintf("%s, %s, %s, %s", c.versionColumns.ID, c.versionColumns.VersionID, c.versionColumns.IsApplied, c.versionColumns.Timestamp)},
+		{"bookkeeping", bookkeeping},
+		{"rollbacks", rollbacks},
+		{"skipped migrations", skipped},
+		{"dirty tracking", fmt.Sprint(c.dirtyTracking)},
+		{"pinned version", pinned},
+		{"dir", dir},
+		{"empty dir", c.emptyDirMode.String()},
+		{"excludes", excludes},
+		{"environment", environment},
+		{"recursive", fmt.Sprint(c.recursive)},
+		{"source", sourceName(c.source)},
+		{"version parser", funcName(c.versionParser)},
+		{"sequential versions", fmt.Sprint(c.sequentialVersions)},
+		{"timestamp format", c.timestampFormat},
+		{"timestamp timezone", timezone},
+		{"clock", clock},
+		{"verify checksums", fmt.Sprint(c.verifyChecksums)},
+		{"drift resolver", funcName(c.driftResolver)},
+		{"allow collation changes", fmt.Sprint(c.allowCollationChanges)},
+		{"deny destructive", fmt.Sprint(c.denyDestructive)},
+		{"deny patterns", denyPatterns},
+		{"session tagging", fmt.Sprint(c.tagSessions)},
+		{"rewrite budget", budget},
+		{"rewrite throughput", fmt.Sprintf("%d bytes/s", c.rewriteThroughput)},
+		{"watch interval", c.watchInterval.String()},
+		{"busy timeout", c.busyTimeout.String()},
+		{"version table ttl", versionTableTTL},
+		{"migration timeout", c.migrationTimeout.String()},
+		{"version cache", versionCache},
+		{"pre hook", preHook},
+		{"post hook", postHook},
+		{"result handler", resultHandler},
+		{"statement redactor", redactor},
+		{"connection hook", connectionHook},
+		{"session variables", sessionVariables},
+		{"copier", copier},
+		{"schema dump", schemaDump},
+		{"verbosity", c.verbosity.String()},
+		{"features", enabledFeatures(c)},
+	}
+}
+
+// PrintConfig logs the effective configuration for dir.
+func PrintConfig(dir string) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	printConfig(c, dir)
+}
+
+// printConfig is PrintConfig, for callers holding runMu.
+func printConfig(c *config, dir string) {
+	for _, s := range effectiveConfig(c, dir) {
+		c.logger.Printf("    %-24s %s\n", s.Name+":", s.Value)
+	}
+}
+
+func enabledFeatures(c *config) string {
+	var names []string
+	for _, f := range featureList(c) {
+		if f.Enabled {
+			names = append(names, f.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+func sourceName(s MigrationSource) string {
+	if _, ok := s.(osSource); ok {
+		return "filesystem"
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// funcName returns the name of the function f, e.g. a VersionParser.
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	return strings.TrimPrefix(name, "github.com/lonja/goose/v4.")
+}
@@ -0,0 +1,27 @@
+package goose
+
+import "testing"
+
+func TestEffectiveConfig(t *testing.T) {
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	want := map[string]string{
+		"dialect":        "sqlite3",
+		"table":          "goose_db_version",
+		"dir":            "migrations",
+		"source":         "filesystem",
+		"version parser": "NumericComponent",
+	}
+	for _, s := range EffectiveConfig("migrations") {
+		if v, ok := want[s.Name]; ok && v != s.Value {
+			t.Errorf("%s: got %q, want %q", s.Name, s.Value, v)
+		}
+		delete(want, s.Name)
+	}
+	for name := range want {
+		t.Errorf("missing setting %q", name)
+	}
+}
@@ -0,0 +1,373 @@
+package goose
+
+import (
+	"bufio"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigFiles are the configuration files the goose command reads from
+// the working directory, in order, when no -config is given.
+var ConfigFiles = []string{"goose.yaml", ".goose.env"}
+
+// ConfigFile is a configuration shared by the goose command and programs
+// using goose, so pipelines don't pass the same flags on every run. It is
+// either a subset of YAML, flat key: value pairs, without nested keys,
+// lists or multi-line values:
+//
+//	driver: postgres
+//	dsn: postgres://app:${DB_PASSWORD}@db/app
+//	dir: db/migrations
+//	table: app_version
+//	timeout: 5m
+//	track-dirty: true
+//
+// or environment variables, in a file ending with .env:
+//
+//	GOOSE_DRIVER=postgres
+//	GOOSE_DBSTRING=postgres://app:${DB_PASSWORD}@db/app
+//	GOOSE_MIGRATION_DIR=db/migrations
+//	GOOSE_TIMEOUT=5m
+//
+// Other keys are options named as the flags of the goose command, see
+// Apply. Environment variables in values are expanded, except in single
+// quoted YAML values.
+type ConfigFile struct {
+	Driver  string
+	DSN     string
+	Dir     string
+	Table   string
+	Options map[string]string
+}
+
+// envKeys maps the variables of .env configuration files to keys.
+var envKeys = map[string]string{
+	"GOOSE_DRIVER":        "driver",
+	"GOOSE_DBSTRING":      "dsn",
+	"GOOSE_DSN":           "dsn",
+	"GOOSE_MIGRATION_DIR": "dir",
+	"GOOSE_DIR":           "dir",
+	"GOOSE_TABLE":         "table",
+}
+
+// LoadConfigFile reads a configuration file, in the .env format if its
+// name ends with .env and in YAML otherwise.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open configuration file")
+	}
+	defer f.Close()
+
+	env := strings.HasSuffix(filepath.Base(path), ".env")
+	c := &ConfigFile{Options: make(map[string]string)}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		var key, value string
+		if env {
+			key, value, err = parseEnvLine(line)
+		} else {
+			key, value, err = parseYAMLLine(line)
+		}
+		if err != nil {
+			return nil, errors.Errorf("%s:%d: %v", path, n, err)
+		}
+
+		switch key {
+		case "driver":
+			c.Driver = value
+		case "dsn":
+			c.DSN = value
+		case "dir":
+			c.Dir = value
+		case "table":
+			c.Table = value
+		default:
+			c.Options[key] = value
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	if c.Dir != "" && !filepath.IsAbs(c.Dir) && !strings.Contains(c.Dir, "://") {
+		c.Dir = filepath.Join(filepath.Dir(path), c.Dir)
+	}
+	return c, nil
+}
+
+// parseYAMLLine parses a flat key: value pair.
+func parseYAMLLine(line string) (string, string, error) {
+	if line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(line, "- ") {
+		return "", "", errors.New("only flat key: value pairs are supported")
+	}
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", errors.Errorf("expected key: value, got %q", line)
+	}
+	key := strings.TrimSpace(line[:i])
+	value := strings.TrimSpace(line[i+1:])
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", "", errors.Errorf("%s: invalid double quoted value %s", key, value)
+		}
+		return key, os.ExpandEnv(unquoted), nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", "", errors.Errorf("%s: invalid single quoted value %s", key, value)
+		}
+		return key, strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return key, os.ExpandEnv(value), nil
+}
+
+// parseEnvLine parses a GOOSE_NAME=value variable.
+func parseEnvLine(line string) (string, string, error) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "export ")
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", "", errors.Errorf("expected NAME=value, got %q", line)
+	}
+	name := strings.TrimSpace(line[:i])
+	value := strings.TrimSpace(line[i+1:])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '\'' {
+			value = value[1 : len(value)-1]
+		} else {
+			value = os.ExpandEnv(value[1 : len(value)-1])
+		}
+	} else {
+		value = os.ExpandEnv(value)
+	}
+
+	if key, ok := envKeys[name]; ok {
+		return key, value, nil
+	}
+	if !strings.HasPrefix(name, "GOOSE_") {
+		return "", "", errors.Errorf("%s is not a goose variable", name)
+	}
+	return strings.Replace(strings.ToLower(strings.TrimPrefix(name, "GOOSE_")), "_", "-", -1), value, nil
+}
+
+// configOptions apply the options of configuration files that are
+// package level settings to c, by the name of the flag of the goose
+// command.
+var configOptions = map[string]func(c *config, value string) error{
+	"v": boolOption(func(c *config, v bool) {
+		c.verbosity = VerbosityNormal
+		if v {
+			c.verbosity = VerbosityVerbose
+		}
+	}),
+	"quiet": boolOption(func(c *config, v bool) {
+		if v {
+			c.verbosity = VerbosityQuiet
+		}
+	}),
+	"checksums":               boolOption(func(c *config, v bool) { c.verifyChecksums = v }),
+	"allow-collation-changes": boolOption(func(c *config, v bool) { c.allowCollationChanges = v }),
+	"sequential":              boolOption(func(c *config, v bool) { c.sequentialVersions = v }),
+	"utc":                     boolOption(func(c *config, v bool) { c.timestampUTC = v }),
+	"compact":                 boolOption(func(c *config, v bool) { c.compactVersionTable = v }),
+	"rollback-history":        boolOption(func(c *config, v bool) { c.rollbackHistory = v }),
+	"track-dirty":             boolOption(func(c *config, v bool) { c.dirtyTracking = v }),
+	"recursive":               boolOption(func(c *config, v bool) { c.recursive = v }),
+	"timeout":                 durationOption(func(c *config, d time.Duration) { c.migrationTimeout = d }),
+	"watch-interval":          durationOption(func(c *config, d time.Duration) { c.watchInterval = watchInterval(d) }),
+	"timestamp-format": func(c *config, v string) error {
+		layout, err := checkTimestampFormat(v)
+		if err != nil {
+			return err
+		}
+		c.timestampFormat = layout
+		return nil
+	},
+	"schema":      func(c *config, v string) error { c.schema = v; return nil },
+	"env":         func(c *config, v string) error { c.environment = v; return nil },
+	"sql-mode":    func(c *config, v string) error { c.sessionVariables = withSQLMode(c.sessionVariables, v); return nil },
+	"schema-dump": func(c *config, v string) error { c.schemaDumpPath, c.schemaDumper = v, nil; return nil },
+	"pre-hook":    func(c *config, v string) error { c.preHook = v; return nil },
+	"post-hook":   func(c *config, v string) error { c.postHook = v; return nil },
+	"rewrite-budget": func(c *config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.rewriteBudget = n
+		return nil
+	},
+	"pin-version": func(c *config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.pinnedVersion = n
+		return nil
+	},
+	"experimental": func(c *config, v string) error {
+		for _, name := range strings.Split(v, ",") {
+			f, err := lookupFeature(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			f.set(c, true)
+		}
+		return nil
+	},
+	"exclude": func(c *config, v string) error {
+		c.excludes = nil
+		for _, p := range strings.Split(v, ",") {
+			c.excludes = append(c.excludes, strings.TrimSpace(p))
+		}
+		return nil
+	},
+}
+
+// commandOptions are options of configuration files only used by the goose
+// command.
+var commandOptions = map[string]bool{"parallel": true, "continue": true, "bundle": true, "sets": true, "set": true}
+
+func boolOption(set func(c *config, v bool)) func(*config, string) error {
+	return func(c *config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		set(c, b)
+		return nil
+	}
+}
+
+func durationOption(set func(c *config, d time.Duration)) func(*config, string) error {
+	return func(c *config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		set(c, d)
+		return nil
+	}
+}
+
+// Apply sets the dialect, the version table and the options of the
+// configuration that are package level settings. Options of the goose
+// command only, like parallel, are left to it. Nothing is set if an
+// option is invalid.
+func (c *ConfigFile) Apply() error {
+	var err error
+	updateConfig(func(cfg *config) {
+		next := *cfg
+		if err = c.applyTo(&next); err == nil {
+			*cfg = next
+		}
+	})
+	return err
+}
+
+// applyTo sets the dialect, the version table and the options of the
+// configuration in cfg.
+func (c *ConfigFile) applyTo(cfg *config) error {
+	if c.Driver != "" {
+		dialect, err := newDialect(c.Driver)
+		if err != nil {
+			return err
+		}
+		cfg.dialect, cfg.dialectSet = dialect, true
+	}
+	if c.Table != "" {
+		cfg.tableName = c.Table
+	}
+
+	names := make([]string, 0, len(c.Options))
+	for name := range c.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		apply, ok := configOptions[name]
+		if !ok {
+			if commandOptions[name] {
+				continue
+			}
+			return errors.Errorf("unknown option %q", name)
+		}
+		if err := apply(cfg, c.Options[name]); err != nil {
+			return errors.Wrapf(err, "option %s", name)
+		}
+	}
+	return nil
+}
+
+// NewProviderFromConfig opens the database of the configuration, as Open
+// does, and returns a Provider migrating it with the migrations of its
+// dir, configured by its options and opts instead of the package level
+// configuration. Close the provider to close the database.
+func NewProviderFromConfig(c *ConfigFile, opts ...ProviderOption) (*Provider, error) {
+	if c.Driver == "" || c.DSN == "" {
+		return nil, errors.New("the configuration needs a driver and a dsn")
+	}
+	cfg := currentConfig()
+	if err := c.applyTo(&cfg); err != nil {
+		return nil, err
+	}
+	db, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{db: db, dir: c.Dir, cfg: cfg, ownsDB: true}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Open applies the configuration and opens its database, with the
+// database/sql driver of its dialect: postgres for Redshift, CockroachDB
+// and YugabyteDB, mysql for TiDB. The driver must be imported.
+func (c *ConfigFile) Open() (*sql.DB, error) {
+	if c.Driver == "" || c.DSN == "" {
+		return nil, errors.New("the configuration needs a driver and a dsn")
+	}
+	if err := c.Apply(); err != nil {
+		return nil, err
+	}
+	return c.open()
+}
+
+// open opens the database of the configuration.
+func (c *ConfigFile) open() (*sql.DB, error) {
+	driver := c.Driver
+	switch driver {
+	case "redshift", "cockroach", "yugabyte":
+		driver = "postgres"
+	case "tidb":
+		driver = "mysql"
+	}
+	db, err := sql.Open(driver, c.DSN)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s database", c.Driver)
+	}
+	return db, nil
+}
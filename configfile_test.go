@@ -0,0 +1,134 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("GOOSE_TEST_PASSWORD", "s3cret")
+	defer os.Unsetenv("GOOSE_TEST_PASSWORD")
+
+	files := map[string]string{
+		"goose.yaml": `# shared by CI and the app
+driver: sqlite3
+dsn: "file:${GOOSE_TEST_PASSWORD}.db"
+dir: migrations
+table: app_version # comment
+timeout: 5m
+exclude: '*_draft.sql'
+parallel: 4
+`,
+		".goose.env": `GOOSE_DRIVER=sqlite3
+export GOOSE_DBSTRING='file:${GOOSE_TEST_PASSWORD}.db'
+GOOSE_MIGRATION_DIR=/srv/migrations
+GOOSE_TRACK_DIRTY=true
+`,
+		"nested.yaml": "options:\n  timeout: 5m\n",
+		"list.yaml":   "exclude:\n- '*_helpers.go'\n",
+		"other.env":   "DATABASE_URL=postgres://\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := LoadConfigFile(filepath.Join(dir, "goose.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ConfigFile{
+		Driver:  "sqlite3",
+		DSN:     "file:s3cret.db",
+		Dir:     filepath.Join(dir, "migrations"),
+		Table:   "app_version",
+		Options: map[string]string{"timeout": "5m", "exclude": "*_draft.sql", "parallel": "4"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+
+	defer SetDialect("postgres")
+	defer SetTableName("goose_db_version")
+	defer SetMigrationTimeout(0)
+	defer SetExcludes()
+	if err := c.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := currentConfig(); cfg.tableName != "app_version" || cfg.migrationTimeout != 5*time.Minute || dialectName(cfg.dialect) != "sqlite3" {
+		t.Errorf("expected the configuration to be applied, got table %s, timeout %v, dialect %s", cfg.tableName, cfg.migrationTimeout, dialectName(cfg.dialect))
+	}
+	c.Options["timout"] = "1m"
+	if err := c.Apply(); err == nil {
+		t.Error("expected an unknown option to fail")
+	}
+
+	c, err = LoadConfigFile(filepath.Join(dir, ".goose.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &ConfigFile{
+		Driver:  "sqlite3",
+		DSN:     "file:${GOOSE_TEST_PASSWORD}.db",
+		Dir:     "/srv/migrations",
+		Options: map[string]string{"track-dirty": "true"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+
+	for _, name := range []string{"nested.yaml", "list.yaml", "other.env"} {
+		if _, err := LoadConfigFile(filepath.Join(dir, name)); err == nil {
+			t.Errorf("expected %s to fail", name)
+		}
+	}
+}
+
+func TestNewProviderFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeSQLMigration(t, dir, 1, "a")
+	c := &ConfigFile{
+		Driver:  "sqlite3",
+		DSN:     filepath.Join(dir, "test.db"),
+		Dir:     dir,
+		Table:   "app_version",
+		Options: map[string]string{"track-dirty": "true", "quiet": "true"},
+	}
+	p, err := NewProviderFromConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Up(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := p.db.QueryRow("SELECT COUNT(*) FROM app_version").Scan(&n); err != nil || n != 2 {
+		t.Errorf("expected the migration recorded in app_version, got %d rows, %v", n, err)
+	}
+	if cfg := currentConfig(); cfg.tableName != "goose_db_version" || cfg.dirtyTracking {
+		t.Error("the configuration of the provider leaked to the package level configuration")
+	}
+
+	c.Options["timout"] = "1m"
+	if _, err := NewProviderFromConfig(c); err == nil {
+		t.Error("expected an unknown option to fail")
+	}
+}
@@ -0,0 +1,144 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// ConnectionHook sets up a connection before migrations run on it.
+type ConnectionHook func(ctx context.Context, conn *sql.Conn) error
+
+// SetConnectionHook sets a function called with the connection of each
+// migration before its transaction begins, e.g. to set session options,
+// assume a role with SET ROLE, or authenticate with a token on managed
+// databases like Azure SQL. With a hook, each migration runs on a
+// dedicated connection of the pool. A nil hook removes it.
+func SetConnectionHook(fn ConnectionHook) {
+	updateConfig(func(c *config) { c.connectionHook = fn })
+}
+
+// migrationConn returns a dedicated connection of db, set up by the
+// connection hook and with the session variables, and a function resetting
+// the session variables and the timeouts of the migration run with ctx
+// before releasing it to the pool.
+func migrationConn(ctx context.Context, c *config, db *sql.DB) (*sql.Conn, func(), error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get a connection")
+	}
+
+	if hook := c.connectionHook; hook != nil {
+		if err := hook(ctx, conn); err != nil {
+			conn.Close()
+			return nil, nil, errors.Wrap(err, "failed to set up connection")
+		}
+	}
+	release := func() {
+		resetSession(ctx, c, conn)
+		conn.Close()
+	}
+	if err := setSessionVariables(ctx, c, conn); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return conn, release, nil
+}
+
+// resetSession restores the session variables and the timeouts set on
+// conn for the migration run with ctx, which would otherwise stay set on
+// the connection when it returns to the pool.
+func resetSession(ctx context.Context, c *config, conn *sql.Conn) {
+	_, resets, _ := timeoutStatements(ctx, c, false)
+	if vars := c.sessionVariables; len(vars) > 0 {
+		if s, ok := c.dialect.(sessionVariableSetter); ok {
+			for _, name := range sortedNames(vars) {
+				resets = append(resets, s.resetSessionVariableSQL(name))
+			}
+		}
+	}
+
+	for _, query := range resets {
+		// ctx may be done by now.
+		if _, err := conn.ExecContext(context.Background(), query); err != nil {
+			c.logger.Printf("goose: failed to execute %q: %v\n", query, err)
+		}
+	}
+}
+
+// dedicatedConn reports whether migrations run on a dedicated connection,
+// set up by the connection hook and with the session variables.
+func dedicatedConn(c *config) bool {
+	return c.connectionHook != nil || len(c.sessionVariables) > 0
+}
+
+// noTxQuerier returns the querier running the statements of a migration
+// without transaction, with a function releasing it: a dedicated
+// connection, set up by the connection hook, with the session variables
+// and with the timeouts of the migration run with ctx, if any of these are
+// set.
+func noTxQuerier(ctx context.Context, c *config, db *sql.DB) (Querier, func(), error) {
+	if !dedicatedConn(c) && !hasTimeouts(ctx) {
+		return busyRetryQuerier{db, c}, func() {}, nil
+	}
+
+	conn, release, err := migrationConn(ctx, c, db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applyConnSettings(ctx, c, conn); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return busyRetryQuerier{connQuerier{conn}, c}, release, nil
+}
+
+// hookedBegin returns the function beginning the transaction of a
+// migration: on a dedicated connection if a connection hook, session
+// variables, timeouts, which may stay set on the session, or a copier are
+// set, with a function releasing it. The returned context carries the
+// dedicated connection, see connFrom.
+func hookedBegin(ctx context.Context, c *config, db *sql.DB) (context.Context, func(context.Context, *sql.TxOptions) (*sql.Tx, error), func(), error) {
+	if !dedicatedConn(c) && !hasTimeouts(ctx) && c.copier == nil {
+		return ctx, db.BeginTx, func() {}, nil
+	}
+
+	conn, release, err := migrationConn(ctx, c, db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return withConn(ctx, conn), conn.BeginTx, release, nil
+}
+
+type connKey struct{}
+
+// withConn returns a copy of ctx carrying the dedicated connection of a
+// migration.
+func withConn(ctx context.Context, conn *sql.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// connFrom returns the dedicated connection of the migration run with ctx,
+// if any.
+func connFrom(ctx context.Context) (*sql.Conn, bool) {
+	conn, ok := ctx.Value(connKey{}).(*sql.Conn)
+	return conn, ok
+}
+
+// connQuerier executes statements on a dedicated connection.
+type connQuerier struct {
+	conn *sql.Conn
+}
+
+func (q connQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return q.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (q connQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return q.conn.ExecContext(ctx, query, args...)
+}
+
+func (q connQuerier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return q.conn.QueryContext(context.Background(), query, args...)
+}
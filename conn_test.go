@@ -0,0 +1,127 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConnectionHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	// Temporary tables only exist on the connection that created them.
+	calls := 0
+	SetConnectionHook(func(ctx context.Context, conn *sql.Conn) error {
+		calls++
+		_, err := conn.ExecContext(ctx, "CREATE TEMP TABLE IF NOT EXISTS session_role AS SELECT 'migrator' AS name")
+		return err
+	})
+	defer SetConnectionHook(nil)
+
+	migrations := map[string]string{
+		"00001_a.sql": "-- +goose Up\nCREATE TABLE a AS SELECT name FROM session_role;\n-- +goose Down\nDROP TABLE a;\n",
+		"00002_b.sql": "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE TABLE b AS SELECT name FROM session_role;\n-- +goose Down\nDROP TABLE b;\n",
+	}
+	for name, src := range migrations {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the hook to run once per migration, got %d calls", calls)
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM b").Scan(&name); err != nil || name != "migrator" {
+		t.Errorf("expected the migration to see the session set up by the hook, got %q (%v)", name, err)
+	}
+}
+
+func TestSessionVariables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	defer SetSessionVariables(nil)
+
+	if err := SetSessionVariables(map[string]string{"sql_mode; DROP": "x"}); err == nil {
+		t.Error("expected an invalid variable name to fail")
+	}
+	if err := SetSessionVariables(map[string]string{"time_zone": "+00:00", "max_execution_time": "1000"}); err != nil {
+		t.Fatal(err)
+	}
+	SetSQLMode("ANSI_QUOTES,STRICT_ALL_TABLES")
+
+	writeSQLMigration(t, dir, 1, "a")
+	err = Up(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "session variables are not supported by the sqlite3 dialect") {
+		t.Fatalf("expected session variables to be rejected, got %v", err)
+	}
+
+	if err := SetDialect("mysql"); err != nil {
+		t.Fatal(err)
+	}
+	statements, err := sessionVariablesSQL(runConfig(), currentConfig().sessionVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"SET SESSION max_execution_time = 1000;",
+		"SET SESSION sql_mode = 'ANSI_QUOTES,STRICT_ALL_TABLES';",
+		"SET SESSION time_zone = '+00:00';",
+	}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("got %q, want %q", statements, want)
+	}
+	if got := mysqlSessionValue(`it's \`); got != `'it''s \\'` {
+		t.Errorf("got %s", got)
+	}
+	for value, want := range map[string]string{"1000": "1000", "-1.5": "-1.5", "1e5": "'1e5'", "NaN": "'NaN'", "Inf": "'Inf'", "0x10": "'0x10'"} {
+		if got := mysqlSessionValue(value); got != want {
+			t.Errorf("mysqlSessionValue(%q) = %s, want %s", value, got, want)
+		}
+	}
+	if got, want := (MySQLDialect{}).resetSessionVariableSQL("sql_mode"), "SET SESSION sql_mode = DEFAULT;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	SetSQLMode("")
+	if _, ok := currentConfig().sessionVariables["sql_mode"]; ok {
+		t.Error("expected an empty mode to remove sql_mode")
+	}
+}
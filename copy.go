@@ -0,0 +1,174 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// copyTerminator ends the data of a COPY block, as in psql scripts.
+const copyTerminator = `\.`
+
+// copyBlock is a COPY ... FROM STDIN statement with its data, annotated
+// with '-- +goose COPY':
+//
+//	-- +goose COPY
+//	COPY users (id, name) FROM STDIN;
+//	1	alice
+//	2	\N
+//	\.
+//
+// Rows are in the text format of COPY: tab separated columns, \N for NULL
+// and backslash escapes.
+type copyBlock struct {
+	statement string
+	rows      [][]interface{}
+	data      string // rows as in the script, for a Copier
+}
+
+// parseCopyBlock parses the statement if it is an annotated COPY block.
+func parseCopyBlock(query string) (*copyBlock, bool) {
+	if !strings.Contains(query, sqlCmdPrefix+"COPY\n") {
+		return nil, false
+	}
+
+	block := &copyBlock{}
+	var statement []string
+	var data strings.Builder
+	inData := false
+	for _, line := range strings.Split(strings.TrimSuffix(query, "\n"), "\n") {
+		switch {
+		case line == copyTerminator:
+			inData = false
+		case inData:
+			block.rows = append(block.rows, copyRow(line))
+			data.WriteString(line + "\n")
+		case strings.HasPrefix(strings.TrimSpace(line), "--"):
+		default:
+			statement = append(statement, line)
+			inData = endsWithSemicolon(line)
+		}
+	}
+	block.statement = strings.TrimSuffix(strings.TrimSpace(strings.Join(statement, "\n")), ";")
+	block.data = data.String()
+
+	return block, true
+}
+
+// copyRow splits a line of COPY data into its values.
+func copyRow(line string) []interface{} {
+	fields := strings.Split(line, "\t")
+	row := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if field == `\N` {
+			continue // NULL
+		}
+		row[i] = unescapeCopyField(field)
+	}
+	return row
+}
+
+var copyEscapes = map[byte]byte{'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v'}
+
+func unescapeCopyField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i == len(field)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if e, ok := copyEscapes[field[i]]; ok {
+			b.WriteByte(e)
+		} else {
+			b.WriteByte(field[i])
+		}
+	}
+	return b.String()
+}
+
+// Copier loads data with a COPY ... FROM STDIN statement on driverConn,
+// the driver connection of the transaction of a migration, and returns
+// the number of copied rows. The data is in the text format of COPY.
+type Copier func(ctx context.Context, driverConn interface{}, statement string, data io.Reader) (int64, error)
+
+// SetCopier sets the function loading the data of '-- +goose COPY'
+// blocks, for drivers that don't support COPY through prepared statements
+// like github.com/lib/pq does, e.g. goosepgx.Copy for pgx. With a copier,
+// each migration runs on a dedicated connection of the pool. A nil copier
+// removes it.
+func SetCopier(c Copier) {
+	updateConfig(func(cfg *config) { cfg.copier = c })
+}
+
+// copyResult is the result of a COPY run by a Copier.
+type copyResult int64
+
+func (r copyResult) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported by COPY")
+}
+
+func (r copyResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+// preparerContext is implemented by *sql.Tx.
+type preparerContext interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// execCopy loads the data of a COPY block. The driver must support COPY
+// through prepared statements, like github.com/lib/pq, unless a Copier is
+// set, and the block must run in a transaction so all rows go to the same
+// connection.
+func execCopy(ctx context.Context, c *config, q Querier, block *copyBlock) (sql.Result, error) {
+	if name := dialectName(c.dialect); name != "postgres" {
+		return nil, errors.Errorf("'-- +goose COPY' is not supported by the %s dialect", name)
+	}
+	p, ok := q.(preparerContext)
+	if !ok {
+		return nil, errors.New("'-- +goose COPY' needs a transaction, remove '-- +goose NO TRANSACTION'")
+	}
+
+	if copier := c.copier; copier != nil {
+		conn, ok := connFrom(ctx)
+		if !ok {
+			return nil, errors.New("'-- +goose COPY' with a copier needs the dedicated connection of a migration")
+		}
+		var n int64
+		err := conn.Raw(func(driverConn interface{}) error {
+			var err error
+			n, err = copier(ctx, driverConn, block.statement, strings.NewReader(block.data))
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to copy")
+		}
+		return copyResult(n), nil
+	}
+
+	stmt, err := p.PrepareContext(ctx, block.statement)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepare COPY")
+	}
+	defer stmt.Close()
+
+	for i, row := range block.rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return nil, errors.Wrapf(err, "failed to copy row %d", i+1)
+		}
+	}
+	// Flush the rows. The result has the number of copied rows.
+	res, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to complete COPY")
+	}
+
+	return res, nil
+}
@@ -0,0 +1,146 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var copyMigration = `-- +goose Up
+CREATE TABLE users (id int, name text, bio text);
+
+-- +goose COPY
+COPY users (id, name, bio) FROM STDIN;
+1	alice	likes; semicolons
+2	\N	-- not a comment
+3	bob	tab\there\\
+\.
+
+INSERT INTO users VALUES (4, 'carol', '');
+
+-- +goose Down
+DROP TABLE users;
+`
+
+func TestParseCopyBlock(t *testing.T) {
+	parsed, err := parseSQLMigration(runConfig(), strings.NewReader(copyMigration), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.statements) != 3 || parsed.copyBlocks != 1 {
+		t.Fatalf("expected 3 statements with a COPY block, got %d with %d: %q", len(parsed.statements), parsed.copyBlocks, parsed.statements)
+	}
+
+	block, ok := parseCopyBlock(parsed.statements[1])
+	if !ok {
+		t.Fatalf("expected a COPY block, got %q", parsed.statements[1])
+	}
+	if want := "COPY users (id, name, bio) FROM STDIN"; block.statement != want {
+		t.Errorf("got statement %q, want %q", block.statement, want)
+	}
+	rows := [][]interface{}{
+		{"1", "alice", "likes; semicolons"},
+		{"2", nil, "-- not a comment"},
+		{"3", "bob", "tab\there\\"},
+	}
+	if !reflect.DeepEqual(block.rows, rows) {
+		t.Errorf("got rows %q, want %q", block.rows, rows)
+	}
+	if _, ok := parseCopyBlock(parsed.statements[2]); ok {
+		t.Error("expected the INSERT not to be a COPY block")
+	}
+
+	unterminated := "-- +goose Up\n-- +goose COPY\nCOPY users FROM STDIN;\n1\talice\n"
+	if _, err := parseSQLMigration(runConfig(), strings.NewReader(unterminated), true); err == nil {
+		t.Error("expected unterminated COPY data to fail")
+	}
+}
+
+func TestCopyNeedsPostgres(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_users.sql"), []byte(copyMigration), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = Up(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "not supported by the sqlite3 dialect") {
+		t.Fatalf("expected COPY to be rejected, got %v", err)
+	}
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Error("expected the migration to be rolled back")
+	}
+}
+
+func TestCopier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	parsed, err := parseSQLMigration(runConfig(), strings.NewReader(copyMigration), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := parseCopyBlock(parsed.statements[1])
+
+	var statement, data string
+	SetCopier(func(ctx context.Context, driverConn interface{}, s string, r io.Reader) (int64, error) {
+		b, err := ioutil.ReadAll(r)
+		statement, data = s, string(b)
+		return 3, err
+	})
+	defer SetCopier(nil)
+
+	ctx, begin, done, err := hookedBegin(context.Background(), runConfig(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+	tx, err := begin(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	res, err := execCopy(ctx, runConfig(), tx, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := rowsAffected(res); n != 3 {
+		t.Errorf("got %d rows copied, want 3", n)
+	}
+	if statement != block.statement {
+		t.Errorf("got statement %q, want %q", statement, block.statement)
+	}
+	if want := "1\talice\tlikes; semicolons\n2\t\\N\t-- not a comment\n3\tbob\ttab\\there\\\\\n"; data != want {
+		t.Errorf("got data %q, want %q", data, want)
+	}
+}
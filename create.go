@@ -6,12 +6,34 @@ import (
 	"os"
 	"path/filepath"
 	"text/template"
-	"time"
 )
 
-// Create writes a new blank migration file.
+// Create writes a new blank migration file. With the generate-down
+// feature, the down section of a SQL migration whose template has up
+// statements is filled with the suggestion of GenerateDown.
 func CreateWithTemplate(db *sql.DB, dir string, migrationTemplate *template.Template, name, migrationType string) error {
-	version := time.Now().Format(timestampFormat)
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return createWithTemplate(c, db, dir, migrationTemplate, name, migrationType)
+}
+
+// createWithTemplate is CreateWithTemplate, for callers holding runMu.
+func createWithTemplate(c *config, db *sql.DB, dir string, migrationTemplate *template.Template, name, migrationType string) error {
+	var version string
+	if c.sequentialVersions {
+		next, err := nextSequentialVersion(c, dir)
+		if err != nil {
+			return err
+		}
+		version = fmt.Sprintf("%05d", next)
+	} else {
+		next, err := timestampVersion(c, dir)
+		if err != nil {
+			return err
+		}
+		version = next
+	}
 	filename := fmt.Sprintf("%v_%v.%v", version, name, migrationType)
 
 	fpath := filepath.Join(dir, filename)
@@ -29,14 +51,26 @@ func CreateWithTemplate(db *sql.DB, dir string, migrationTemplate *template.Temp
 	if err != nil {
 		return err
 	}
-
-	log.Printf("Created new file: %s\n", path)
+	if migrationType == "sql" && c.generateDown {
+		if err := appendDown(c, path); err != nil {
+			return err
+		}
+	}
+	c.logger.Printf("Created new file: %s\n", path)
 	return nil
 }
 
 // Create writes a new blank migration file.
 func Create(db *sql.DB, dir, name, migrationType string) error {
-	return CreateWithTemplate(db, dir, nil, name, migrationType)
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return create(c, db, dir, name, migrationType)
+}
+
+// create is Create, for callers holding runMu.
+func create(c *config, db *sql.DB, dir, name, migrationType string) error {
+	return createWithTemplate(c, db, dir, nil, name, migrationType)
 }
 
 func writeTemplateToFile(path string, t *template.Template, version string) (string, error) {
@@ -69,7 +103,7 @@ var goSQLMigrationTemplate = template.Must(template.New("goose.go-migration").Pa
 
 import (
 	"database/sql"
-	"github.com/lonja/goose"
+	"github.com/lonja/goose/v4"
 )
 
 func init() {
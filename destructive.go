@@ -0,0 +1,89 @@
+package goose
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// SetDenyDestructive refuses the up sections of SQL migrations with a
+// DROP TABLE, a TRUNCATE or a DELETE without WHERE, unless the migration
+// is annotated with:
+//
+//	-- +goose ALLOW DESTRUCTIVE
+//
+// Refused migrations fail before any of their statements is executed, and
+// are reported by Validate. Down sections are not checked, as they
+// usually drop what the up section created. See SetDenyPatterns.
+func SetDenyDestructive(v bool) {
+	updateConfig(func(c *config) { c.denyDestructive = v })
+}
+
+// SetDenyPatterns refuses, as SetDenyDestructive does, the up sections of
+// SQL migrations with a statement matching one of the regular expressions,
+// such as `^ALTER\s+TABLE\s+\S+\s+DROP\s+COLUMN`. Matching ignores case,
+// and comments are removed from statements first. No patterns, the
+// default, leave the built-in policy of SetDenyDestructive alone.
+func SetDenyPatterns(patterns ...string) error {
+	var denied []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(`(?is)` + p)
+		if err != nil {
+			return errors.Wrapf(err, "invalid deny pattern %q", p)
+		}
+		denied = append(denied, re)
+	}
+	updateConfig(func(c *config) { c.denyPatterns = denied })
+	return nil
+}
+
+var (
+	matchDropTable   = regexp.MustCompile(`(?is)^\s*DROP\s+TABLE\b`)
+	matchTruncate    = regexp.MustCompile(`(?is)^\s*TRUNCATE\b`)
+	matchDelete      = regexp.MustCompile(`(?is)^\s*DELETE\s+FROM\b`)
+	matchWhereClause = regexp.MustCompile(`(?i)\bWHERE\b`)
+)
+
+// denyPolicy is the policy of SetDenyDestructive and SetDenyPatterns.
+type denyPolicy struct {
+	destructive bool
+	patterns    []*regexp.Regexp
+}
+
+// currentDenyPolicy returns the policy refusing statements, nil if none is
+// set.
+func currentDenyPolicy(c *config) *denyPolicy {
+	if !c.denyDestructive && len(c.denyPatterns) == 0 {
+		return nil
+	}
+	return &denyPolicy{destructive: c.denyDestructive, patterns: c.denyPatterns}
+}
+
+// denies reports whether the policy refuses the statement.
+func (p *denyPolicy) denies(query string) bool {
+	stmt := clearStatement(query)
+	if p.destructive {
+		if matchDropTable.MatchString(stmt) || matchTruncate.MatchString(stmt) {
+			return true
+		}
+		if matchDelete.MatchString(stmt) && !matchWhereClause.MatchString(stmt) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDestructive fails if the parsed up section of a SQL migration has
+// a statement refused by the deny policy and the migration isn't annotated
+// with ALLOW DESTRUCTIVE.
+func checkDestructive(parsed *parsedSQL) error {
+	if parsed.destructive == "" || parsed.allowDestructive {
+		return nil
+	}
+	return errors.Errorf("statement %q is destructive, annotate the migration with '-- +goose ALLOW DESTRUCTIVE' if it is intended", statementSnippet(parsed.destructive))
+}
@@ -0,0 +1,121 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDenyDestructive(t *testing.T) {
+	deny := &denyPolicy{destructive: true}
+	for stmt, want := range map[string]bool{
+		"DROP TABLE users;\n":                      true,
+		"-- gone\ndrop table if exists users;\n":   true,
+		"TRUNCATE users;\n":                        true,
+		"DELETE FROM users;\n":                     true,
+		"DELETE FROM users WHERE id = 1;\n":        false,
+		"DROP INDEX users_name;\n":                 false,
+		"CREATE TABLE users (id int);\n":           false,
+		"UPDATE users SET name = 'deleted';\n":     false,
+		"ALTER TABLE users DROP COLUMN name;\n":    false,
+		"INSERT INTO log VALUES ('DROP TABLE');\n": false,
+	} {
+		if got := deny.denies(stmt); got != want {
+			t.Errorf("denies(%q) = %v, want %v", stmt, got, want)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	files := map[string]string{
+		"00002_purge.sql": "-- +goose Up\nCREATE TABLE b (id int);\nDELETE FROM a;\n\n-- +goose Down\nDROP TABLE b;\n",
+		"00003_drop.sql":  "-- +goose Up\n-- +goose ALLOW DESTRUCTIVE\nDROP TABLE a;\n\n-- +goose Down\nCREATE TABLE a (id int);\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SetDenyDestructive(true)
+	defer SetDenyDestructive(false)
+
+	problems, err := Validate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0].String(), "00002_purge.sql: statement \"DELETE FROM a;\" is destructive") {
+		t.Fatalf("got problems %v", problems)
+	}
+
+	err = UpAll(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "ALLOW DESTRUCTIVE") {
+		t.Fatalf("got error %v, want the destructive statement refused", err)
+	}
+	if current, err := GetDBVersion(db); err != nil || current != 1 {
+		t.Fatalf("got version %d, %v, want 1", current, err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'b'").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("the refused migration ran statements: %d, %v", n, err)
+	}
+
+	if err := SetDenyPatterns(`^DELETE\s+FROM\s+a\b`); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDenyPatterns()
+	SetDenyDestructive(false)
+	if err := UpAll(db, dir); err == nil {
+		t.Fatal("the deny pattern didn't refuse the migration")
+	}
+
+	if err := SetDenyPatterns("("); err == nil {
+		t.Error("an invalid pattern was accepted")
+	}
+	SetDenyPatterns()
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The steps of a version directory are all checked before any runs.
+	big := filepath.Join(dir, "00004_big_change")
+	if err := os.Mkdir(big, 0755); err != nil {
+		t.Fatal(err)
+	}
+	steps := map[string]string{
+		"01_tables.sql": "-- +goose Up\nCREATE TABLE c (id int);\n-- +goose Down\nDROP TABLE c;\n",
+		"02_purge.sql":  "-- +goose Up\nDELETE FROM b;\n-- +goose Down\n",
+	}
+	for name, src := range steps {
+		if err := ioutil.WriteFile(filepath.Join(big, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	SetDenyDestructive(true)
+	err = UpAll(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "step \"02_purge.sql\": statement \"DELETE FROM b;\" is destructive") {
+		t.Fatalf("got error %v, want the destructive step refused", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'c'").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("the refused version directory ran steps: %d, %v", n, err)
+	}
+}
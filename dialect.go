@@ -3,42 +3,321 @@ package goose
 import (
 	"database/sql"
 	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // SQLDialect abstracts the details of specific SQL dialects
 // for goose's few SQL specific statements
 type SQLDialect interface {
-	createVersionTableSQL() string // sql string to create the db version table
-	insertVersionSQL() string      // sql string to insert the initial version table row
-	deleteVersionSQL() string      // sql string to delete version
-	dbVersionQuery(db *sql.DB) (*sql.Rows, error)
-}
+	quoteIdentifier(name string) string // quotes a table, schema or column name
+
+	createVersionTableSQL(c *config) string    // sql string to create the db version table
+	createVersionIndexSQL(c *config) string    // sql string to index the version table by version, empty if not supported
+	insertVersionSQL(c *config) string         // sql string to insert the initial version table row
+	insertVersionsSQL(c *config, n int) string // sql string to insert n version table rows at once
+	deleteVersionSQL(c *config) string         // sql string to delete version
+	dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error)
+	isMissingTable(err error) bool // reports whether a query failed because the table doesn't exist
+
+	createChecksumTableSQL(c *config) string // sql string to create the checksum table
+	insertChecksumSQL(c *config) string      // sql string to insert a migration checksum
+	deleteChecksumSQL(c *config) string      // sql string to delete a migration checksum
 
-var dialect SQLDialect = &PostgresDialect{}
+	createRepeatableTableSQL(c *config) string // sql string to create the repeatable migration table
+	insertRepeatableSQL(c *config) string      // sql string to insert the checksum of a repeatable migration
+	deleteRepeatableSQL(c *config) string      // sql string to delete the checksum of a repeatable migration
+
+	createDirtyTableSQL(c *config) string // sql string to create the table marking an interrupted migration
+	insertDirtySQL(c *config) string      // sql string to mark a migration as running
+	deleteDirtySQL(c *config) string      // sql string to clear the mark of a migration
+
+	createBackfillTableSQL(c *config) string // sql string to create the backfill progress table
+	insertBackfillSQL(c *config) string      // sql string to insert the progress of a backfill
+	deleteBackfillSQL(c *config) string      // sql string to delete the progress of a backfill
+
+	createCompactVersionTableSQL(c *config) string // sql string to create the compact version table
+	updateCompactVersionSQL(c *config) string      // sql string to move the compact version table to another version
+}
 
 // GetDialect gets the SQLDialect
 func GetDialect() SQLDialect {
-	return dialect
+	return currentConfig().dialect
+}
+
+// plainIdentifier matches identifiers that never need quoting.
+var plainIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteTableName quotes a table name, optionally qualified with a schema,
+// for d. Parts that are plain identifiers are left alone, so they keep
+// the case folding of the database; names already containing quotes are
+// used as is.
+func quoteTableName(d SQLDialect, name string) string {
+	if strings.ContainsAny(name, "\"`") {
+		return name
+	}
+
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if !plainIdentifier.MatchString(part) {
+			parts[i] = d.quoteIdentifier(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// versionRows returns the placeholders of n version table rows, numbered
+// like ($1, $2), ($3, $4) if numbered is set, or like (?, ?), (?, ?).
+func versionRows(n int, numbered bool) string {
+	rows := make([]string, n)
+	for i := range rows {
+		if numbered {
+			rows[i] = fmt.Sprintf("($%d, $%d)", 2*i+1, 2*i+2)
+		} else {
+			rows[i] = "(?, ?)"
+		}
+	}
+	return strings.Join(rows, ", ")
+}
+
+// ddlTransactor is implemented by dialects that may not run DDL in
+// transactions.
+type ddlTransactor interface {
+	transactionalDDL() bool
+}
+
+// transactionalDDL reports whether d runs DDL in transactions, as most
+// dialects do.
+func transactionalDDL(d SQLDialect) bool {
+	t, ok := d.(ddlTransactor)
+	return !ok || t.transactionalDDL()
+}
+
+// savepointer is implemented by dialects that may not have savepoints.
+type savepointer interface {
+	savepoints() bool
+}
+
+// supportsSavepoints reports whether d has savepoints, as most do.
+func supportsSavepoints(d SQLDialect) bool {
+	s, ok := d.(savepointer)
+	return !ok || s.savepoints()
+}
+
+// rowLimiter is implemented by dialects without a LIMIT clause.
+type rowLimiter interface {
+	// firstRowSQL limits query to its first row.
+	firstRowSQL(query string) string
+}
+
+// firstRow limits query to its first row with the syntax of d.
+func firstRow(d SQLDialect, query string) string {
+	if l, ok := d.(rowLimiter); ok {
+		return l.firstRowSQL(query)
+	}
+	return query + " LIMIT 1"
+}
+
+// versionIndexName returns the name of the index of the version table,
+// quoted for d and without schema.
+func versionIndexName(c *config, d SQLDialect) string {
+	name := c.versionTableName()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return quoteTableName(d, strings.Trim(name, "\"`")+"_version_idx")
+}
+
+// versionIndexQualifier returns the schema of the version table followed
+// by a dot, quoted for d, or an empty string without schema.
+func versionIndexQualifier(c *config, d SQLDialect) string {
+	name := versionTableFor(c, d).name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i+1]
+	}
+	return ""
+}
+
+// versionIndexParts returns the schema of the version table, empty without
+// schema, and the name of its index, unquoted.
+func versionIndexParts(c *config) (schema, index string) {
+	name := c.versionTableName()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		schema, name = name[:i], name[i+1:]
+	}
+	return strings.Trim(schema, "\"`"), strings.Trim(name, "\"`") + "_version_idx"
+}
+
+// versionIndexChecker is implemented by dialects that can tell whether the
+// index of the version table exists, so it is created on version tables
+// created without it.
+type versionIndexChecker interface {
+	versionIndexExistsQuery(c *config) (string, []interface{}) // sql query returning 1 if the index of the version table exists and 0 otherwise, with its arguments
+}
+
+// currentVersionSQL returns the query of the current version: the latest
+// applied migration whose latest record isn't a rollback. It is resolved
+// by the database with the index of the version table, instead of
+// scanning the whole table.
+func currentVersionSQL(c *config, d SQLDialect) string {
+	t := versionTableFor(c, d)
+	return firstRow(d, fmt.Sprintf("SELECT v.%[2]s FROM %[1]s v WHERE v.%[3]s = true AND NOT EXISTS (SELECT 1 FROM %[1]s w WHERE w.%[2]s = v.%[2]s AND w.%[4]s > v.%[4]s) ORDER BY v.%[4]s DESC", t.name, t.versionID, t.isApplied, t.id))
+}
+
+// lockWaitSeconds rounds d up to whole seconds, of at least 1.
+func lockWaitSeconds(d time.Duration) int64 {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// pgMissingRelation matches the errors of Postgres and Redshift for a
+// missing table or schema (SQLSTATE 42P01 and 3F000).
+var pgMissingRelation = regexp.MustCompile(`(relation|schema) ".*" does not exist`)
+
+// quoteWith quotes an identifier with q, doubling q within it.
+func quoteWith(q, name string) string {
+	return q + strings.Replace(name, q, q+q, -1) + q
 }
 
-// SetDialect sets the SQLDialect
+// SetDialect sets the SQLDialect. Without it, the dialect is detected
+// from the driver of the database on first use, see EnsureDBVersion, and
+// defaults to postgres for unknown drivers. Redshift, TiDB, CockroachDB
+// (cockroach) and YugabyteDB (yugabyte) use the postgres and mysql drivers
+// and must always be set. An empty name restores detection.
 func SetDialect(d string) error {
+	if d == "" {
+		updateConfig(func(c *config) { c.dialect, c.dialectSet = &PostgresDialect{}, false })
+		return nil
+	}
+
+	dialect, err := newDialect(d)
+	if err != nil {
+		return err
+	}
+
+	updateConfig(func(c *config) { c.dialect, c.dialectSet = dialect, true })
+	return nil
+}
+
+// SwapDialect sets the dialect as SetDialect does, and returns a function
+// restoring the previous one, e.g. when a test is done.
+func SwapDialect(d string) (restore func(), err error) {
+	prev := currentConfig()
+	if err := SetDialect(d); err != nil {
+		return nil, err
+	}
+	return func() {
+		updateConfig(func(c *config) { c.dialect, c.dialectSet = prev.dialect, prev.dialectSet })
+	}, nil
+}
+
+func newDialect(d string) (SQLDialect, error) {
 	switch d {
 	case "postgres":
-		dialect = &PostgresDialect{}
+		return &PostgresDialect{}, nil
 	case "mysql":
-		dialect = &MySQLDialect{}
+		return &MySQLDialect{}, nil
 	case "sqlite3":
-		dialect = &Sqlite3Dialect{}
+		return &Sqlite3Dialect{}, nil
 	case "redshift":
-		dialect = &RedshiftDialect{}
+		return &RedshiftDialect{}, nil
 	case "tidb":
-		dialect = &TiDBDialect{}
-	default:
-		return fmt.Errorf("%q: unknown dialect", d)
+		return &TiDBDialect{}, nil
+	case "spanner":
+		return &SpannerDialect{}, nil
+	case "firebird":
+		return &FirebirdDialect{}, nil
+	case "cockroach":
+		return &CockroachDialect{}, nil
+	case "yugabyte":
+		return &YugabyteDialect{}, nil
+	}
+	if dialect, ok := registeredDialect(d); ok {
+		return dialect, nil
 	}
+	return nil, fmt.Errorf("%q: unknown dialect", d)
+}
 
-	return nil
+// driverDialects maps the package paths of common database/sql drivers to
+// their dialect.
+var driverDialects = []struct {
+	pkg, dialect string
+}{
+	{"github.com/lib/pq", "postgres"},
+	{"github.com/jackc/pgx", "postgres"},
+	{"github.com/go-sql-driver/mysql", "mysql"},
+	{"github.com/ziutek/mymysql", "mysql"},
+	{"github.com/mattn/go-sqlite3", "sqlite3"},
+	{"modernc.org/sqlite", "sqlite3"},
+	{"github.com/googleapis/go-sql-spanner", "spanner"},
+	{"github.com/nakagami/firebirdsql", "firebird"},
+}
+
+// driverDialect returns the name of the dialect of the driver of db, if
+// it is known.
+func driverDialect(db *sql.DB) (string, bool) {
+	t := reflect.TypeOf(db.Driver())
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	pkg := t.PkgPath()
+	for _, d := range driverDialects {
+		if pkg == d.pkg || strings.HasPrefix(pkg, d.pkg+"/") {
+			return d.dialect, true
+		}
+	}
+	return "", false
+}
+
+// detectDialect sets the dialect of the run configuration c from the
+// driver of db unless SetDialect was called. The package level
+// configuration is left as is, so runs against other drivers keep theirs.
+func detectDialect(c *config, db *sql.DB) {
+	if c.dialectSet {
+		return
+	}
+	name, ok := driverDialect(db)
+	if !ok {
+		return
+	}
+	c.dialect, _ = newDialect(name)
+}
+
+// dialectName returns the name SetDialect accepts for d.
+func dialectName(d SQLDialect) string {
+	switch d.(type) {
+	case *PostgresDialect, PostgresDialect:
+		return "postgres"
+	case *MySQLDialect, MySQLDialect:
+		return "mysql"
+	case *Sqlite3Dialect, Sqlite3Dialect:
+		return "sqlite3"
+	case *RedshiftDialect, RedshiftDialect:
+		return "redshift"
+	case *TiDBDialect, TiDBDialect:
+		return "tidb"
+	case *SpannerDialect, SpannerDialect:
+		return "spanner"
+	case *FirebirdDialect, FirebirdDialect:
+		return "firebird"
+	case *CockroachDialect, CockroachDialect:
+		return "cockroach"
+	case *YugabyteDialect, YugabyteDialect:
+		return "yugabyte"
+	}
+	if name, ok := registeredDialectName(d); ok {
+		return name
+	}
+	return fmt.Sprintf("%T", d)
 }
 
 ////////////////////////////
@@ -48,22 +327,47 @@ func SetDialect(d string) error {
 // PostgresDialect struct.
 type PostgresDialect struct{}
 
-func (pg PostgresDialect) createVersionTableSQL() string {
+func (pg PostgresDialect) quoteIdentifier(name string) string {
+	return quoteWith(`"`, name)
+}
+
+func (pg PostgresDialect) createSchemaSQL(schema string) string {
+	return fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", schema)
+}
+
+func (pg PostgresDialect) createVersionTableSQL(c *config) string {
+	t := versionTableFor(c, pg)
 	return fmt.Sprintf(`CREATE TABLE %s (
-            	id serial NOT NULL,
-                version_id bigint NOT NULL,
-                is_applied boolean NOT NULL,
-                tstamp timestamp NULL default now(),
-                PRIMARY KEY(id)
-            );`, TableName())
+            	%s serial NOT NULL,
+                %s bigint NOT NULL,
+                %s boolean NOT NULL,
+                %s timestamp NULL default now(),
+                PRIMARY KEY(%s)
+            );`, t.name, t.id, t.versionID, t.isApplied, t.tstamp, t.id)
+}
+
+func (pg PostgresDialect) createVersionIndexSQL(c *config) string {
+	t := versionTableFor(c, pg)
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s);", versionIndexName(c, pg), t.name, t.versionID, t.id)
+}
+
+func (pg PostgresDialect) versionIndexExistsQuery(c *config) (string, []interface{}) {
+	return "SELECT CASE WHEN to_regclass($1) IS NULL THEN 0 ELSE 1 END;", []interface{}{versionIndexQualifier(c, pg) + versionIndexName(c, pg)}
+}
+
+func (pg PostgresDialect) insertVersionSQL(c *config) string {
+	t := versionTableFor(c, pg)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2);", t.name, t.versionID, t.isApplied)
 }
 
-func (pg PostgresDialect) insertVersionSQL() string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES ($1, $2);", TableName())
+func (pg PostgresDialect) insertVersionsSQL(c *config, n int) string {
+	t := versionTableFor(c, pg)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES %s;", t.name, t.versionID, t.isApplied, versionRows(n, true))
 }
 
-func (pg PostgresDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query(fmt.Sprintf("SELECT * from %s ORDER BY id DESC", TableName()))
+func (pg PostgresDialect) dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error) {
+	t := versionTableFor(c, pg)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s ORDER BY %s DESC", t.id, t.versionID, t.isApplied, t.tstamp, t.name, t.id))
 	if err != nil {
 		return nil, err
 	}
@@ -71,8 +375,130 @@ func (pg PostgresDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
 	return rows, err
 }
 
-func (pg PostgresDialect) deleteVersionSQL() string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1;", TableName())
+func (pg PostgresDialect) deleteVersionSQL(c *config) string {
+	t := versionTableFor(c, pg)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=$1;", t.name, t.versionID)
+}
+
+func (pg PostgresDialect) isMissingTable(err error) bool {
+	return pgMissingRelation.MatchString(err.Error())
+}
+
+func (pg PostgresDialect) tableSizeQuery() string {
+	return "SELECT pg_total_relation_size($1::regclass);"
+}
+
+func (pg PostgresDialect) statementTimeoutSQL(d time.Duration) string {
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d;", d.Nanoseconds()/int64(time.Millisecond))
+}
+
+func (pg PostgresDialect) sessionStatementTimeoutSQL(d time.Duration) string {
+	return fmt.Sprintf("SET statement_timeout = %d;", d.Nanoseconds()/int64(time.Millisecond))
+}
+
+func (pg PostgresDialect) resetStatementTimeoutSQL() string {
+	return "RESET statement_timeout;"
+}
+
+func (pg PostgresDialect) lockTimeoutSQL(d time.Duration) []string {
+	return []string{fmt.Sprintf("SET LOCAL lock_timeout = %d;", d.Nanoseconds()/int64(time.Millisecond))}
+}
+
+func (pg PostgresDialect) sessionLockTimeoutSQL(d time.Duration) []string {
+	return []string{fmt.Sprintf("SET lock_timeout = %d;", d.Nanoseconds()/int64(time.Millisecond))}
+}
+
+func (pg PostgresDialect) resetLockTimeoutSQL() []string {
+	return []string{"RESET lock_timeout;"}
+}
+
+func (pg PostgresDialect) tagSessionSQL(tag string) string {
+	return fmt.Sprintf("SET LOCAL application_name = '%s';", tag)
+}
+
+func (pg PostgresDialect) createChecksumTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(pg, checksumTableName(c)))
+}
+
+func (pg PostgresDialect) insertChecksumSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, checksum) VALUES ($1, $2);", quoteTableName(pg, checksumTableName(c)))
+}
+
+func (pg PostgresDialect) deleteChecksumSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1;", quoteTableName(pg, checksumTableName(c)))
+}
+
+func (pg PostgresDialect) createDirtyTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(pg, dirtyTableName(c)))
+}
+
+func (pg PostgresDialect) insertDirtySQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id) VALUES ($1);", quoteTableName(pg, dirtyTableName(c)))
+}
+
+func (pg PostgresDialect) deleteDirtySQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1;", quoteTableName(pg, dirtyTableName(c)))
+}
+
+func (pg PostgresDialect) createBackfillTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                next_key bigint NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(pg, backfillTableName(c)))
+}
+
+func (pg PostgresDialect) insertBackfillSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, next_key) VALUES ($1, $2);", quoteTableName(pg, backfillTableName(c)))
+}
+
+func (pg PostgresDialect) deleteBackfillSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=$1;", quoteTableName(pg, backfillTableName(c)))
+}
+
+func (pg PostgresDialect) createRepeatableTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(pg, repeatableTableName(c)))
+}
+
+func (pg PostgresDialect) insertRepeatableSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum) VALUES ($1, $2);", quoteTableName(pg, repeatableTableName(c)))
+}
+
+func (pg PostgresDialect) deleteRepeatableSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=$1;", quoteTableName(pg, repeatableTableName(c)))
+}
+
+func (pg PostgresDialect) createCompactVersionTableSQL(c *config) string {
+	t := versionTableFor(c, pg)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                %s timestamp NULL default now()
+            );`, t.name, t.versionID, t.tstamp)
+}
+
+func (pg PostgresDialect) updateCompactVersionSQL(c *config) string {
+	t := versionTableFor(c, pg)
+	return fmt.Sprintf("UPDATE %s SET %s = $1, checksum = $2, %s = now() WHERE %s = $3 AND checksum = $4;", t.name, t.versionID, t.tstamp, t.versionID)
+}
+
+func (pg PostgresDialect) tryAdvisoryLockSQL() string {
+	return "SELECT pg_try_advisory_lock(hashtext($1));"
+}
+
+func (pg PostgresDialect) advisoryUnlockSQL() string {
+	return "SELECT pg_advisory_unlock(hashtext($1));"
 }
 
 ////////////////////////////
@@ -82,22 +508,48 @@ func (pg PostgresDialect) deleteVersionSQL() string {
 // MySQLDialect struct.
 type MySQLDialect struct{}
 
-func (m MySQLDialect) createVersionTableSQL() string {
+func (m MySQLDialect) quoteIdentifier(name string) string {
+	return quoteWith("`", name)
+}
+
+func (m MySQLDialect) createSchemaSQL(schema string) string {
+	return fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s;", schema)
+}
+
+func (m MySQLDialect) createVersionTableSQL(c *config) string {
+	t := versionTableFor(c, m)
 	return fmt.Sprintf(`CREATE TABLE %s (
-                id serial NOT NULL,
-                version_id bigint NOT NULL,
-                is_applied boolean NOT NULL,
-                tstamp timestamp NULL default now(),
-                PRIMARY KEY(id)
-            );`, TableName())
+                %s serial NOT NULL,
+                %s bigint NOT NULL,
+                %s boolean NOT NULL,
+                %s timestamp NULL default now(),
+                PRIMARY KEY(%s)
+            );`, t.name, t.id, t.versionID, t.isApplied, t.tstamp, t.id)
+}
+
+func (m MySQLDialect) createVersionIndexSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s);", versionIndexName(c, m), t.name, t.versionID, t.id)
 }
 
-func (m MySQLDialect) insertVersionSQL() string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+func (m MySQLDialect) versionIndexExistsQuery(c *config) (string, []interface{}) {
+	schema, index := versionIndexParts(c)
+	return "SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND index_name = ?;", []interface{}{schema, index}
 }
 
-func (m MySQLDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query(fmt.Sprintf("SELECT * %s ORDER BY id DESC", TableName()))
+func (m MySQLDialect) insertVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (?, ?);", t.name, t.versionID, t.isApplied)
+}
+
+func (m MySQLDialect) insertVersionsSQL(c *config, n int) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES %s;", t.name, t.versionID, t.isApplied, versionRows(n, false))
+}
+
+func (m MySQLDialect) dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error) {
+	t := versionTableFor(c, m)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s ORDER BY %s DESC", t.id, t.versionID, t.isApplied, t.tstamp, t.name, t.id))
 	if err != nil {
 		return nil, err
 	}
@@ -105,8 +557,135 @@ func (m MySQLDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
 	return rows, err
 }
 
-func (m MySQLDialect) deleteVersionSQL() string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", TableName())
+func (m MySQLDialect) deleteVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=?;", t.name, t.versionID)
+}
+
+func (m MySQLDialect) isMissingTable(err error) bool {
+	return strings.Contains(err.Error(), "Error 1146")
+}
+
+func (m MySQLDialect) tableSizeQuery() string {
+	return "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?;"
+}
+
+func (m MySQLDialect) createChecksumTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(m, checksumTableName(c)))
+}
+
+func (m MySQLDialect) insertChecksumSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, checksum) VALUES (?, ?);", quoteTableName(m, checksumTableName(c)))
+}
+
+func (m MySQLDialect) deleteChecksumSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", quoteTableName(m, checksumTableName(c)))
+}
+
+func (m MySQLDialect) createDirtyTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(m, dirtyTableName(c)))
+}
+
+func (m MySQLDialect) insertDirtySQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id) VALUES (?);", quoteTableName(m, dirtyTableName(c)))
+}
+
+func (m MySQLDialect) deleteDirtySQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", quoteTableName(m, dirtyTableName(c)))
+}
+
+func (m MySQLDialect) createBackfillTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                next_key bigint NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(m, backfillTableName(c)))
+}
+
+func (m MySQLDialect) insertBackfillSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, next_key) VALUES (?, ?);", quoteTableName(m, backfillTableName(c)))
+}
+
+func (m MySQLDialect) deleteBackfillSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?;", quoteTableName(m, backfillTableName(c)))
+}
+
+func (m MySQLDialect) createRepeatableTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m MySQLDialect) insertRepeatableSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum) VALUES (?, ?);", quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m MySQLDialect) deleteRepeatableSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?;", quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m MySQLDialect) createCompactVersionTableSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                %s timestamp NULL default now()
+            );`, t.name, t.versionID, t.tstamp)
+}
+
+func (m MySQLDialect) updateCompactVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("UPDATE %s SET %s = ?, checksum = ?, %s = now() WHERE %s = ? AND checksum = ?;", t.name, t.versionID, t.tstamp, t.versionID)
+}
+
+// MySQL limits lock waits in whole seconds, for the session.
+func (m MySQLDialect) lockTimeoutSQL(d time.Duration) []string {
+	return []string{
+		fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d;", lockWaitSeconds(d)),
+		fmt.Sprintf("SET SESSION lock_wait_timeout = %d;", lockWaitSeconds(d)),
+	}
+}
+
+func (m MySQLDialect) sessionLockTimeoutSQL(d time.Duration) []string {
+	return m.lockTimeoutSQL(d)
+}
+
+func (m MySQLDialect) resetLockTimeoutSQL() []string {
+	return []string{
+		"SET SESSION innodb_lock_wait_timeout = DEFAULT;",
+		"SET SESSION lock_wait_timeout = DEFAULT;",
+	}
+}
+
+func (m MySQLDialect) setSessionVariableSQL(name, value string) string {
+	return fmt.Sprintf("SET SESSION %s = %s;", name, mysqlSessionValue(value))
+}
+
+func (m MySQLDialect) resetSessionVariableSQL(name string) string {
+	return fmt.Sprintf("SET SESSION %s = DEFAULT;", name)
+}
+
+func (m MySQLDialect) tryAdvisoryLockSQL() string {
+	return "SELECT GET_LOCK(?, 0);"
+}
+
+func (m MySQLDialect) advisoryUnlockSQL() string {
+	return "SELECT RELEASE_LOCK(?);"
+}
+
+// transactionalDDL reports that MySQL commits DDL statements implicitly,
+// ending their transaction.
+func (m MySQLDialect) transactionalDDL() bool {
+	return false
 }
 
 ////////////////////////////
@@ -116,21 +695,49 @@ func (m MySQLDialect) deleteVersionSQL() string {
 // Sqlite3Dialect struct.
 type Sqlite3Dialect struct{}
 
-func (m Sqlite3Dialect) createVersionTableSQL() string {
+func (m Sqlite3Dialect) quoteIdentifier(name string) string {
+	return quoteWith(`"`, name)
+}
+
+func (m Sqlite3Dialect) createVersionTableSQL(c *config) string {
+	t := versionTableFor(c, m)
 	return fmt.Sprintf(`CREATE TABLE %s (
-                id INTEGER PRIMARY KEY AUTOINCREMENT,
-                version_id INTEGER NOT NULL,
-                is_applied INTEGER NOT NULL,
-                tstamp TIMESTAMP DEFAULT (datetime('now'))
-            );`, TableName())
+                %s INTEGER PRIMARY KEY AUTOINCREMENT,
+                %s INTEGER NOT NULL,
+                %s INTEGER NOT NULL,
+                %s TIMESTAMP DEFAULT (datetime('now'))
+            );`, t.name, t.id, t.versionID, t.isApplied, t.tstamp)
 }
 
-func (m Sqlite3Dialect) insertVersionSQL() string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+// The index of a table in an attached database is qualified with the
+// schema instead of the table.
+func (m Sqlite3Dialect) createVersionIndexSQL(c *config) string {
+	t := versionTableFor(c, m)
+	table, index := t.name, versionIndexName(c, m)
+	if i := strings.LastIndex(t.name, "."); i >= 0 {
+		table, index = t.name[i+1:], t.name[:i+1]+index
+	}
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s);", index, table, t.versionID, t.id)
+}
+
+func (m Sqlite3Dialect) versionIndexExistsQuery(c *config) (string, []interface{}) {
+	_, index := versionIndexParts(c)
+	return fmt.Sprintf("SELECT COUNT(*) FROM %ssqlite_master WHERE type = 'index' AND name = ?;", versionIndexQualifier(c, m)), []interface{}{index}
+}
+
+func (m Sqlite3Dialect) insertVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (?, ?);", t.name, t.versionID, t.isApplied)
+}
+
+func (m Sqlite3Dialect) insertVersionsSQL(c *config, n int) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES %s;", t.name, t.versionID, t.isApplied, versionRows(n, false))
 }
 
-func (m Sqlite3Dialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query(fmt.Sprintf("SELECT * from %s ORDER BY id DESC", TableName()))
+func (m Sqlite3Dialect) dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error) {
+	t := versionTableFor(c, m)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s ORDER BY %s DESC", t.id, t.versionID, t.isApplied, t.tstamp, t.name, t.id))
 	if err != nil {
 		return nil, err
 	}
@@ -138,74 +745,894 @@ func (m Sqlite3Dialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
 	return rows, err
 }
 
-func (m Sqlite3Dialect) deleteVersionSQL() string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", TableName())
+func (m Sqlite3Dialect) deleteVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=?;", t.name, t.versionID)
 }
 
-////////////////////////////
-// Redshift
-////////////////////////////
-
-// RedshiftDialect struct.
-type RedshiftDialect struct{}
+func (m Sqlite3Dialect) isMissingTable(err error) bool {
+	return strings.Contains(err.Error(), "no such table")
+}
 
-func (rs RedshiftDialect) createVersionTableSQL() string {
-	return fmt.Sprintf(`CREATE TABLE %s (
-            	id integer NOT NULL identity(1, 1),
-                version_id bigint NOT NULL,
-                is_applied boolean NOT NULL,
-                tstamp timestamp NULL default sysdate,
-                PRIMARY KEY(id)
-            );`, TableName())
+func (m Sqlite3Dialect) isBusy(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked")
 }
 
-func (rs RedshiftDialect) insertVersionSQL() string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES ($1, $2);", TableName())
+func (m Sqlite3Dialect) foreignKeysQuery() string {
+	return "PRAGMA foreign_keys;"
 }
 
-func (rs RedshiftDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query(fmt.Sprintf("SELECT * from %s ORDER BY id DESC", TableName()))
-	if err != nil {
-		return nil, err
+func (m Sqlite3Dialect) foreignKeysSQL(enabled bool) string {
+	if enabled {
+		return "PRAGMA foreign_keys = ON;"
 	}
+	return "PRAGMA foreign_keys = OFF;"
+}
 
-	return rows, err
+func (m Sqlite3Dialect) foreignKeyCheckSQL() string {
+	return "PRAGMA foreign_key_check;"
 }
 
-func (rs RedshiftDialect) deleteVersionSQL() string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", TableName())
+func (m Sqlite3Dialect) createChecksumTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id INTEGER NOT NULL,
+                checksum TEXT NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(m, checksumTableName(c)))
 }
 
-////////////////////////////
-// TiDB
-////////////////////////////
+func (m Sqlite3Dialect) insertChecksumSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, checksum) VALUES (?, ?);", quoteTableName(m, checksumTableName(c)))
+}
 
-// TiDBDialect struct.
-type TiDBDialect struct{}
+func (m Sqlite3Dialect) deleteChecksumSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", quoteTableName(m, checksumTableName(c)))
+}
 
-func (m TiDBDialect) createVersionTableSQL() string {
+func (m Sqlite3Dialect) createDirtyTableSQL(c *config) string {
 	return fmt.Sprintf(`CREATE TABLE %s (
-                id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE,
-                version_id bigint NOT NULL,
-                is_applied boolean NOT NULL,
-                tstamp timestamp NULL default now(),
-                PRIMARY KEY(id)
-            );`, TableName())
+                version_id INTEGER NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(m, dirtyTableName(c)))
 }
 
-func (m TiDBDialect) insertVersionSQL() string {
-	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?);", TableName())
+func (m Sqlite3Dialect) insertDirtySQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id) VALUES (?);", quoteTableName(m, dirtyTableName(c)))
 }
 
-func (m TiDBDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query(fmt.Sprintf("SELECT * from %s ORDER BY id DESC", TableName()))
-	if err != nil {
-		return nil, err
-	}
+func (m Sqlite3Dialect) deleteDirtySQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", quoteTableName(m, dirtyTableName(c)))
+}
 
-	return rows, err
+func (m Sqlite3Dialect) createBackfillTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name TEXT NOT NULL,
+                next_key INTEGER NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(m, backfillTableName(c)))
+}
+
+func (m Sqlite3Dialect) insertBackfillSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, next_key) VALUES (?, ?);", quoteTableName(m, backfillTableName(c)))
 }
 
-func (m TiDBDialect) deleteVersionSQL() string {
-	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", TableName())
+func (m Sqlite3Dialect) deleteBackfillSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?;", quoteTableName(m, backfillTableName(c)))
+}
+
+func (m Sqlite3Dialect) createRepeatableTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name TEXT NOT NULL,
+                checksum TEXT NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m Sqlite3Dialect) insertRepeatableSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum) VALUES (?, ?);", quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m Sqlite3Dialect) deleteRepeatableSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?;", quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m Sqlite3Dialect) createCompactVersionTableSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s INTEGER NOT NULL,
+                checksum TEXT NOT NULL,
+                %s TIMESTAMP DEFAULT (datetime('now'))
+            );`, t.name, t.versionID, t.tstamp)
+}
+
+func (m Sqlite3Dialect) updateCompactVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("UPDATE %s SET %s = ?, checksum = ?, %s = datetime('now') WHERE %s = ? AND checksum = ?;", t.name, t.versionID, t.tstamp, t.versionID)
+}
+
+////////////////////////////
+// Redshift
+////////////////////////////
+
+// RedshiftDialect struct.
+type RedshiftDialect struct{}
+
+func (rs RedshiftDialect) quoteIdentifier(name string) string {
+	return quoteWith(`"`, name)
+}
+
+func (rs RedshiftDialect) createSchemaSQL(schema string) string {
+	return fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", schema)
+}
+
+func (rs RedshiftDialect) createVersionTableSQL(c *config) string {
+	t := versionTableFor(c, rs)
+	return fmt.Sprintf(`CREATE TABLE %s (
+            	%s integer NOT NULL identity(1, 1),
+                %s bigint NOT NULL,
+                %s boolean NOT NULL,
+                %s timestamp NULL default sysdate,
+                PRIMARY KEY(%s)
+            );`, t.name, t.id, t.versionID, t.isApplied, t.tstamp, t.id)
+}
+
+// Redshift has no indexes.
+func (rs RedshiftDialect) createVersionIndexSQL(c *config) string {
+	return ""
+}
+
+func (rs RedshiftDialect) insertVersionSQL(c *config) string {
+	t := versionTableFor(c, rs)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2);", t.name, t.versionID, t.isApplied)
+}
+
+func (rs RedshiftDialect) insertVersionsSQL(c *config, n int) string {
+	t := versionTableFor(c, rs)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES %s;", t.name, t.versionID, t.isApplied, versionRows(n, true))
+}
+
+func (rs RedshiftDialect) dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error) {
+	t := versionTableFor(c, rs)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s ORDER BY %s DESC", t.id, t.versionID, t.isApplied, t.tstamp, t.name, t.id))
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, err
+}
+
+func (rs RedshiftDialect) deleteVersionSQL(c *config) string {
+	t := versionTableFor(c, rs)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=$1;", t.name, t.versionID)
+}
+
+func (rs RedshiftDialect) isMissingTable(err error) bool {
+	return pgMissingRelation.MatchString(err.Error())
+}
+
+func (rs RedshiftDialect) createChecksumTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(rs, checksumTableName(c)))
+}
+
+func (rs RedshiftDialect) insertChecksumSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, checksum) VALUES ($1, $2);", quoteTableName(rs, checksumTableName(c)))
+}
+
+func (rs RedshiftDialect) deleteChecksumSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1;", quoteTableName(rs, checksumTableName(c)))
+}
+
+func (rs RedshiftDialect) createDirtyTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(rs, dirtyTableName(c)))
+}
+
+func (rs RedshiftDialect) insertDirtySQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id) VALUES ($1);", quoteTableName(rs, dirtyTableName(c)))
+}
+
+func (rs RedshiftDialect) deleteDirtySQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1;", quoteTableName(rs, dirtyTableName(c)))
+}
+
+func (rs RedshiftDialect) createBackfillTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                next_key bigint NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(rs, backfillTableName(c)))
+}
+
+func (rs RedshiftDialect) insertBackfillSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, next_key) VALUES ($1, $2);", quoteTableName(rs, backfillTableName(c)))
+}
+
+func (rs RedshiftDialect) deleteBackfillSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=$1;", quoteTableName(rs, backfillTableName(c)))
+}
+
+func (rs RedshiftDialect) createRepeatableTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(rs, repeatableTableName(c)))
+}
+
+func (rs RedshiftDialect) insertRepeatableSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum) VALUES ($1, $2);", quoteTableName(rs, repeatableTableName(c)))
+}
+
+func (rs RedshiftDialect) deleteRepeatableSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=$1;", quoteTableName(rs, repeatableTableName(c)))
+}
+
+func (rs RedshiftDialect) savepoints() bool {
+	return false
+}
+
+func (rs RedshiftDialect) createCompactVersionTableSQL(c *config) string {
+	t := versionTableFor(c, rs)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                %s timestamp NULL default sysdate
+            );`, t.name, t.versionID, t.tstamp)
+}
+
+func (rs RedshiftDialect) updateCompactVersionSQL(c *config) string {
+	t := versionTableFor(c, rs)
+	return fmt.Sprintf("UPDATE %s SET %s = $1, checksum = $2, %s = sysdate WHERE %s = $3 AND checksum = $4;", t.name, t.versionID, t.tstamp, t.versionID)
+}
+
+////////////////////////////
+// TiDB
+////////////////////////////
+
+// TiDBDialect struct.
+type TiDBDialect struct{}
+
+func (m TiDBDialect) quoteIdentifier(name string) string {
+	return quoteWith("`", name)
+}
+
+func (m TiDBDialect) createSchemaSQL(schema string) string {
+	return fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s;", schema)
+}
+
+func (m TiDBDialect) createVersionTableSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE,
+                %s bigint NOT NULL,
+                %s boolean NOT NULL,
+                %s timestamp NULL default now(),
+                PRIMARY KEY(%s)
+            );`, t.name, t.id, t.versionID, t.isApplied, t.tstamp, t.id)
+}
+
+func (m TiDBDialect) createVersionIndexSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s);", versionIndexName(c, m), t.name, t.versionID, t.id)
+}
+
+func (m TiDBDialect) versionIndexExistsQuery(c *config) (string, []interface{}) {
+	schema, index := versionIndexParts(c)
+	return "SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND index_name = ?;", []interface{}{schema, index}
+}
+
+func (m TiDBDialect) insertVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (?, ?);", t.name, t.versionID, t.isApplied)
+}
+
+func (m TiDBDialect) insertVersionsSQL(c *config, n int) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES %s;", t.name, t.versionID, t.isApplied, versionRows(n, false))
+}
+
+func (m TiDBDialect) dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error) {
+	t := versionTableFor(c, m)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s ORDER BY %s DESC", t.id, t.versionID, t.isApplied, t.tstamp, t.name, t.id))
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, err
+}
+
+func (m TiDBDialect) deleteVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=?;", t.name, t.versionID)
+}
+
+func (m TiDBDialect) isMissingTable(err error) bool {
+	return strings.Contains(err.Error(), "Error 1146")
+}
+
+func (m TiDBDialect) tableSizeQuery() string {
+	return "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?;"
+}
+
+func (m TiDBDialect) createChecksumTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(m, checksumTableName(c)))
+}
+
+func (m TiDBDialect) insertChecksumSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, checksum) VALUES (?, ?);", quoteTableName(m, checksumTableName(c)))
+}
+
+func (m TiDBDialect) deleteChecksumSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", quoteTableName(m, checksumTableName(c)))
+}
+
+func (m TiDBDialect) createDirtyTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                PRIMARY KEY(version_id)
+            );`, quoteTableName(m, dirtyTableName(c)))
+}
+
+func (m TiDBDialect) insertDirtySQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id) VALUES (?);", quoteTableName(m, dirtyTableName(c)))
+}
+
+func (m TiDBDialect) deleteDirtySQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?;", quoteTableName(m, dirtyTableName(c)))
+}
+
+func (m TiDBDialect) createBackfillTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                next_key bigint NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(m, backfillTableName(c)))
+}
+
+func (m TiDBDialect) insertBackfillSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, next_key) VALUES (?, ?);", quoteTableName(m, backfillTableName(c)))
+}
+
+func (m TiDBDialect) deleteBackfillSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?;", quoteTableName(m, backfillTableName(c)))
+}
+
+func (m TiDBDialect) createRepeatableTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(name)
+            );`, quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m TiDBDialect) insertRepeatableSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum) VALUES (?, ?);", quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m TiDBDialect) deleteRepeatableSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?;", quoteTableName(m, repeatableTableName(c)))
+}
+
+func (m TiDBDialect) createCompactVersionTableSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                %s timestamp NULL default now()
+            );`, t.name, t.versionID, t.tstamp)
+}
+
+func (m TiDBDialect) updateCompactVersionSQL(c *config) string {
+	t := versionTableFor(c, m)
+	return fmt.Sprintf("UPDATE %s SET %s = ?, checksum = ?, %s = now() WHERE %s = ? AND checksum = ?;", t.name, t.versionID, t.tstamp, t.versionID)
+}
+
+// MySQL limits lock waits in whole seconds, for the session.
+func (m TiDBDialect) lockTimeoutSQL(d time.Duration) []string {
+	return []string{
+		fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d;", lockWaitSeconds(d)),
+		fmt.Sprintf("SET SESSION lock_wait_timeout = %d;", lockWaitSeconds(d)),
+	}
+}
+
+func (m TiDBDialect) sessionLockTimeoutSQL(d time.Duration) []string {
+	return m.lockTimeoutSQL(d)
+}
+
+func (m TiDBDialect) resetLockTimeoutSQL() []string {
+	return []string{
+		"SET SESSION innodb_lock_wait_timeout = DEFAULT;",
+		"SET SESSION lock_wait_timeout = DEFAULT;",
+	}
+}
+
+func (m TiDBDialect) setSessionVariableSQL(name, value string) string {
+	return fmt.Sprintf("SET SESSION %s = %s;", name, mysqlSessionValue(value))
+}
+
+func (m TiDBDialect) resetSessionVariableSQL(name string) string {
+	return fmt.Sprintf("SET SESSION %s = DEFAULT;", name)
+}
+
+func (m TiDBDialect) tryAdvisoryLockSQL() string {
+	return "SELECT GET_LOCK(?, 0);"
+}
+
+func (m TiDBDialect) advisoryUnlockSQL() string {
+	return "SELECT RELEASE_LOCK(?);"
+}
+
+// transactionalDDL reports that TiDB commits DDL statements implicitly,
+// ending their transaction.
+func (m TiDBDialect) transactionalDDL() bool {
+	return false
+}
+
+////////////////////////////
+// Spanner
+////////////////////////////
+
+// SpannerDialect struct, for Google Cloud Spanner with the GoogleSQL
+// dialect and the github.com/googleapis/go-sql-spanner driver.
+//
+// Spanner doesn't run DDL in transactions: migrations with DDL statements
+// need '-- +goose NO TRANSACTION'. DML statements can be run as
+// partitioned DML, e.g. for backfills, with '-- +goose PARTITIONED'.
+type SpannerDialect struct{}
+
+func (s SpannerDialect) quoteIdentifier(name string) string {
+	return quoteWith("`", name)
+}
+
+// transactionalDDL reports that Spanner runs DDL outside of transactions.
+func (s SpannerDialect) transactionalDDL() bool {
+	return false
+}
+
+func (s SpannerDialect) partitionedDMLSQL() (on, off string) {
+	return "SET AUTOCOMMIT_DML_MODE = 'PARTITIONED_NON_ATOMIC'", "SET AUTOCOMMIT_DML_MODE = 'TRANSACTIONAL'"
+}
+
+// Spanner has no auto increment, ids follow the greatest recorded one.
+func (s SpannerDialect) createVersionTableSQL(c *config) string {
+	t := versionTableFor(c, s)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s INT64 NOT NULL,
+                %s INT64 NOT NULL,
+                %s BOOL NOT NULL,
+                %s TIMESTAMP
+            ) PRIMARY KEY (%s)`, t.name, t.id, t.versionID, t.isApplied, t.tstamp, t.id)
+}
+
+func (s SpannerDialect) createVersionIndexSQL(c *config) string {
+	t := versionTableFor(c, s)
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s)", versionIndexName(c, s), t.name, t.versionID, t.id)
+}
+
+func (s SpannerDialect) versionIndexExistsQuery(c *config) (string, []interface{}) {
+	schema, index := versionIndexParts(c)
+	return "SELECT COUNT(*) FROM information_schema.indexes WHERE table_schema = @p1 AND index_name = @p2", []interface{}{schema, index}
+}
+
+func (s SpannerDialect) insertVersionSQL(c *config) string {
+	return s.insertVersionsSQL(c, 1)
+}
+
+func (s SpannerDialect) insertVersionsSQL(c *config, n int) string {
+	t := versionTableFor(c, s)
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("SELECT IFNULL(MAX(%s), 0) + %d, @p%d, @p%d, CURRENT_TIMESTAMP() FROM %s", t.id, i+1, 2*i+1, 2*i+2, t.name)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) %s", t.name, t.id, t.versionID, t.isApplied, t.tstamp, strings.Join(rows, " UNION ALL "))
+}
+
+func (s SpannerDialect) dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error) {
+	t := versionTableFor(c, s)
+	return db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s ORDER BY %s DESC", t.id, t.versionID, t.isApplied, t.tstamp, t.name, t.id))
+}
+
+func (s SpannerDialect) deleteVersionSQL(c *config) string {
+	t := versionTableFor(c, s)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=@p1", t.name, t.versionID)
+}
+
+func (s SpannerDialect) isMissingTable(err error) bool {
+	return strings.Contains(err.Error(), "Table not found")
+}
+
+func (s SpannerDialect) createChecksumTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id INT64 NOT NULL,
+                checksum STRING(64) NOT NULL
+            ) PRIMARY KEY (version_id)`, quoteTableName(s, checksumTableName(c)))
+}
+
+func (s SpannerDialect) insertChecksumSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, checksum) VALUES (@p1, @p2)", quoteTableName(s, checksumTableName(c)))
+}
+
+func (s SpannerDialect) deleteChecksumSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=@p1", quoteTableName(s, checksumTableName(c)))
+}
+
+func (s SpannerDialect) createDirtyTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id INT64 NOT NULL
+            ) PRIMARY KEY (version_id)`, quoteTableName(s, dirtyTableName(c)))
+}
+
+func (s SpannerDialect) insertDirtySQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id) VALUES (@p1)", quoteTableName(s, dirtyTableName(c)))
+}
+
+func (s SpannerDialect) deleteDirtySQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=@p1", quoteTableName(s, dirtyTableName(c)))
+}
+
+func (s SpannerDialect) createBackfillTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name STRING(255) NOT NULL,
+                next_key INT64 NOT NULL
+            ) PRIMARY KEY (name)`, quoteTableName(s, backfillTableName(c)))
+}
+
+func (s SpannerDialect) insertBackfillSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, next_key) VALUES (@p1, @p2)", quoteTableName(s, backfillTableName(c)))
+}
+
+func (s SpannerDialect) deleteBackfillSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=@p1", quoteTableName(s, backfillTableName(c)))
+}
+
+func (s SpannerDialect) createRepeatableTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name STRING(255) NOT NULL,
+                checksum STRING(64) NOT NULL
+            ) PRIMARY KEY (name)`, quoteTableName(s, repeatableTableName(c)))
+}
+
+func (s SpannerDialect) insertRepeatableSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum) VALUES (@p1, @p2)", quoteTableName(s, repeatableTableName(c)))
+}
+
+func (s SpannerDialect) deleteRepeatableSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=@p1", quoteTableName(s, repeatableTableName(c)))
+}
+
+// The compact version table has a single row, and an empty primary key.
+func (s SpannerDialect) createCompactVersionTableSQL(c *config) string {
+	t := versionTableFor(c, s)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s INT64 NOT NULL,
+                checksum STRING(64) NOT NULL,
+                %s TIMESTAMP
+            ) PRIMARY KEY ()`, t.name, t.versionID, t.tstamp)
+}
+
+func (s SpannerDialect) updateCompactVersionSQL(c *config) string {
+	t := versionTableFor(c, s)
+	return fmt.Sprintf("UPDATE %s SET %s = @p1, checksum = @p2, %s = CURRENT_TIMESTAMP() WHERE %s = @p3 AND checksum = @p4", t.name, t.versionID, t.tstamp, t.versionID)
+}
+
+////////////////////////////
+// Firebird
+////////////////////////////
+
+// FirebirdDialect struct, for Firebird 3 and later with the
+// github.com/nakagami/firebirdsql driver.
+//
+// Firebird has no LIMIT clause and no multi-row VALUES; the version table
+// id is an identity column.
+type FirebirdDialect struct{}
+
+func (f FirebirdDialect) quoteIdentifier(name string) string {
+	return quoteWith(`"`, name)
+}
+
+// transactionalDDL reports that goose creates its tables outside of the
+// transactions using them, as Firebird only makes a table usable once the
+// transaction creating it commits.
+func (f FirebirdDialect) transactionalDDL() bool {
+	return false
+}
+
+func (f FirebirdDialect) firstRowSQL(query string) string {
+	return query + " ROWS 1"
+}
+
+func (f FirebirdDialect) createVersionTableSQL(c *config) string {
+	t := versionTableFor(c, f)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s integer GENERATED BY DEFAULT AS IDENTITY NOT NULL,
+                %s bigint NOT NULL,
+                %s boolean NOT NULL,
+                %s timestamp DEFAULT CURRENT_TIMESTAMP,
+                PRIMARY KEY(%s)
+            )`, t.name, t.id, t.versionID, t.isApplied, t.tstamp, t.id)
+}
+
+func (f FirebirdDialect) createVersionIndexSQL(c *config) string {
+	t := versionTableFor(c, f)
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s)", versionIndexName(c, f), t.name, t.versionID, t.id)
+}
+
+func (f FirebirdDialect) versionIndexExistsQuery(c *config) (string, []interface{}) {
+	_, index := versionIndexParts(c)
+	return "SELECT COUNT(*) FROM RDB$INDICES WHERE UPPER(TRIM(RDB$INDEX_NAME)) = UPPER(?)", []interface{}{index}
+}
+
+func (f FirebirdDialect) insertVersionSQL(c *config) string {
+	t := versionTableFor(c, f)
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (?, ?)", t.name, t.versionID, t.isApplied)
+}
+
+// Parameters are cast, as Firebird can't tell their type in a select list.
+func (f FirebirdDialect) insertVersionsSQL(c *config, n int) string {
+	t := versionTableFor(c, f)
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = "SELECT CAST(? AS bigint), CAST(? AS boolean) FROM RDB$DATABASE"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) %s", t.name, t.versionID, t.isApplied, strings.Join(rows, " UNION ALL "))
+}
+
+func (f FirebirdDialect) dbVersionQuery(c *config, db *sql.DB) (*sql.Rows, error) {
+	t := versionTableFor(c, f)
+	return db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s ORDER BY %s DESC", t.id, t.versionID, t.isApplied, t.tstamp, t.name, t.id))
+}
+
+func (f FirebirdDialect) deleteVersionSQL(c *config) string {
+	t := versionTableFor(c, f)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=?", t.name, t.versionID)
+}
+
+func (f FirebirdDialect) isMissingTable(err error) bool {
+	return strings.Contains(err.Error(), "Table unknown")
+}
+
+func (f FirebirdDialect) createChecksumTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(version_id)
+            )`, quoteTableName(f, checksumTableName(c)))
+}
+
+func (f FirebirdDialect) insertChecksumSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, checksum) VALUES (?, ?)", quoteTableName(f, checksumTableName(c)))
+}
+
+func (f FirebirdDialect) deleteChecksumSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?", quoteTableName(f, checksumTableName(c)))
+}
+
+func (f FirebirdDialect) createDirtyTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                version_id bigint NOT NULL,
+                PRIMARY KEY(version_id)
+            )`, quoteTableName(f, dirtyTableName(c)))
+}
+
+func (f FirebirdDialect) insertDirtySQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (version_id) VALUES (?)", quoteTableName(f, dirtyTableName(c)))
+}
+
+func (f FirebirdDialect) deleteDirtySQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?", quoteTableName(f, dirtyTableName(c)))
+}
+
+func (f FirebirdDialect) createBackfillTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                next_key bigint NOT NULL,
+                PRIMARY KEY(name)
+            )`, quoteTableName(f, backfillTableName(c)))
+}
+
+func (f FirebirdDialect) insertBackfillSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, next_key) VALUES (?, ?)", quoteTableName(f, backfillTableName(c)))
+}
+
+func (f FirebirdDialect) deleteBackfillSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?", quoteTableName(f, backfillTableName(c)))
+}
+
+func (f FirebirdDialect) createRepeatableTableSQL(c *config) string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+                name varchar(255) NOT NULL,
+                checksum varchar(64) NOT NULL,
+                PRIMARY KEY(name)
+            )`, quoteTableName(f, repeatableTableName(c)))
+}
+
+func (f FirebirdDialect) insertRepeatableSQL(c *config) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum) VALUES (?, ?)", quoteTableName(f, repeatableTableName(c)))
+}
+
+func (f FirebirdDialect) deleteRepeatableSQL(c *config) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE name=?", quoteTableName(f, repeatableTableName(c)))
+}
+
+func (f FirebirdDialect) createCompactVersionTableSQL(c *config) string {
+	t := versionTableFor(c, f)
+	return fmt.Sprintf(`CREATE TABLE %s (
+                %s bigint NOT NULL,
+                checksum varchar(64) NOT NULL,
+                %s timestamp DEFAULT CURRENT_TIMESTAMP
+            )`, t.name, t.versionID, t.tstamp)
+}
+
+func (f FirebirdDialect) updateCompactVersionSQL(c *config) string {
+	t := versionTableFor(c, f)
+	return fmt.Sprintf("UPDATE %s SET %s = ?, checksum = ?, %s = CURRENT_TIMESTAMP WHERE %s = ? AND checksum = ?", t.name, t.versionID, t.tstamp, t.versionID)
+}
+
+////////////////////////////
+// CockroachDB and YugabyteDB
+////////////////////////////
+
+// CockroachDialect struct, for CockroachDB through its Postgres wire
+// protocol. Transactions failing with a serialization error are retried
+// for the busy timeout, see SetBusyTimeout, and status reads the version
+// table AS OF SYSTEM TIME, from the closest replica, without contending
+// with running migrations. The history of the version table can be kept
+// for those reads with SetVersionTableTTL.
+type CockroachDialect struct {
+	PostgresDialect
+}
+
+func (cr CockroachDialect) isBusy(err error) bool {
+	return errorCode(err) == serializationFailure
+}
+
+func (cr CockroachDialect) serializationRetryTimeout() time.Duration {
+	return serializationRetryTimeout
+}
+
+func (cr CockroachDialect) versionTableTTLSQL(c *config, ttl time.Duration) string {
+	return fmt.Sprintf("ALTER TABLE %s CONFIGURE ZONE USING gc.ttlseconds = %d", quoteTableName(cr, c.versionTableName()), int64(ttl/time.Second))
+}
+
+func (cr CockroachDialect) asOfSystemTime() string {
+	return "AS OF SYSTEM TIME follower_read_timestamp()"
+}
+
+// YugabyteDialect struct, for YugabyteDB through its Postgres compatible
+// YSQL API. Transactions failing with a serialization error are retried
+// for the busy timeout, see SetBusyTimeout.
+type YugabyteDialect struct {
+	PostgresDialect
+}
+
+func (y YugabyteDialect) isBusy(err error) bool {
+	return errorCode(err) == serializationFailure
+}
+
+func (y YugabyteDialect) serializationRetryTimeout() time.Duration {
+	return serializationRetryTimeout
+}
+
+// serializationFailure is the SQLSTATE of transactions that conflicted
+// with others and must be retried.
+const serializationFailure = "40001"
+
+// serializationRetryTimeout is how long CockroachDB and YugabyteDB retry
+// serialization failures when the busy timeout is zero.
+const serializationRetryTimeout = 30 * time.Second
+
+// serializationRetrier is implemented by the busy detectors of distributed
+// databases, whose transactions fail with serialization errors under
+// normal contention, so they are retried even without a busy timeout.
+type serializationRetrier interface {
+	serializationRetryTimeout() time.Duration
+}
+
+// versionTableTTLSetter is implemented by dialects that can keep the
+// history of the version table for a time, see SetVersionTableTTL.
+type versionTableTTLSetter interface {
+	versionTableTTLSQL(c *config, ttl time.Duration) string // sql string to keep the history of the version table for ttl
+}
+
+// SetVersionTableTTL sets how long CockroachDB keeps the history of the
+// rows of the version table, its gc.ttlseconds, so status can read it AS
+// OF SYSTEM TIME with follower reads long after it changed. It is set
+// when the version table is first used; zero, the default, leaves the
+// table alone. Other dialects fail to migrate with a TTL.
+func SetVersionTableTTL(ttl time.Duration) {
+	updateConfig(func(c *config) { c.versionTableTTL = ttl })
+}
+
+// versionTableTTLs holds the version tables whose TTL is known to be set.
+var versionTableTTLs sync.Map
+
+type versionTableTTLKey struct {
+	db    *sql.DB
+	table string
+	ttl   time.Duration
+}
+
+// ensureVersionTableTTL sets the TTL of the version table, see
+// SetVersionTableTTL, once per process.
+func ensureVersionTableTTL(c *config, db *sql.DB) error {
+	ttl := c.versionTableTTL
+	if ttl <= 0 {
+		return nil
+	}
+	key := versionTableTTLKey{db: db, table: c.versionTableName(), ttl: ttl}
+	if _, ok := versionTableTTLs.Load(key); ok {
+		return nil
+	}
+
+	d := c.dialect
+	s, ok := d.(versionTableTTLSetter)
+	if !ok {
+		return errors.Errorf("version table TTLs are not supported by the %s dialect", dialectName(d))
+	}
+	if _, err := db.Exec(s.versionTableTTLSQL(c, ttl)); err != nil {
+		return errors.Wrap(err, "failed to set the TTL of the version table")
+	}
+	versionTableTTLs.Store(key, true)
+	return nil
+}
+
+// historicalReader is implemented by dialects that can read a table as of
+// a recent time, for status.
+type historicalReader interface {
+	asOfSystemTime() string // clause following the table name in FROM
+}
+
+// dialects maps the names registered with RegisterDialect to dialects.
+var dialects = struct {
+	sync.RWMutex
+	byName map[string]SQLDialect
+}{byName: make(map[string]SQLDialect)}
+
+// RegisterDialect makes SetDialect accept name for d, e.g. the name of a
+// database compatible with the dialect of goose that d embeds:
+//
+//	type materialize struct{ goose.PostgresDialect }
+//
+//	goose.RegisterDialect("materialize", materialize{})
+//
+// The dialects of goose can't be registered again.
+func RegisterDialect(name string, d SQLDialect) error {
+	if _, err := newDialect(name); err == nil {
+		return fmt.Errorf("%q: dialect already registered", name)
+	}
+	dialects.Lock()
+	defer dialects.Unlock()
+	dialects.byName[name] = d
+	return nil
+}
+
+// registeredDialect returns the dialect registered with name.
+func registeredDialect(name string) (SQLDialect, bool) {
+	dialects.RLock()
+	defer dialects.RUnlock()
+	d, ok := dialects.byName[name]
+	return d, ok
+}
+
+// registeredDialectName returns the name d was registered with.
+func registeredDialectName(d SQLDialect) (string, bool) {
+	dialects.RLock()
+	defer dialects.RUnlock()
+	for name, r := range dialects.byName {
+		if reflect.TypeOf(r) == reflect.TypeOf(d) {
+			return name, true
+		}
+	}
+	return "", false
 }
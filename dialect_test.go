@@ -0,0 +1,395 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+func TestQuoteTableName(t *testing.T) {
+	tests := []struct {
+		dialect SQLDialect
+		name    string
+		want    string
+	}{
+		{&PostgresDialect{}, "goose_db_version", "goose_db_version"},
+		{&PostgresDialect{}, "myschema.goose_db_version", "myschema.goose_db_version"},
+		{&PostgresDialect{}, "my-schema.goose versions", `"my-schema"."goose versions"`},
+		{&PostgresDialect{}, `"MySchema".versions`, `"MySchema".versions`},
+		{&MySQLDialect{}, "my-db.goose_db_version", "`my-db`.goose_db_version"},
+		{&TiDBDialect{}, "odd name", "`odd name`"},
+		{&Sqlite3Dialect{}, "main.goose-versions", `main."goose-versions"`},
+		{&RedshiftDialect{}, "1st", `"1st"`},
+	}
+	if got, want := quoteWith("`", "odd`name"), "`odd``name`"; got != want {
+		t.Errorf("quoteWith = %s, want %s", got, want)
+	}
+	for _, test := range tests {
+		if got := quoteTableName(test.dialect, test.name); got != test.want {
+			t.Errorf("quoteTableName(%s, %q) = %s, want %s", dialectName(test.dialect), test.name, got, test.want)
+		}
+	}
+}
+
+func TestQuotedVersionTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetTableName("main.goose-versions")
+	defer SetTableName("goose_db_version")
+
+	writeSQLMigration(t, dir, 1, "one")
+	writeSQLMigration(t, dir, 3, "three")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Applying 2 after 3 makes up-all-unapplied swap their rows.
+	writeSQLMigration(t, dir, 2, "two")
+	if err := Run("up-all-unapplied", db, dir, "fix"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Status(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := AppliedDBVersions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied[1] || !applied[2] || applied[3] {
+		t.Errorf("expected 1 and 2 to be applied, got %v", applied)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM "goose-versions"`).Scan(&n); err != nil || n == 0 {
+		t.Fatalf("expected rows in the quoted version table, got %d (%v)", n, err)
+	}
+}
+
+func TestSetSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("ATTACH DATABASE ? AS ops", filepath.Join(dir, "ops.db")); err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // ops is attached to this connection only
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetSchema("ops")
+	defer SetSchema("")
+
+	if got := TableName(); got != "ops.goose_db_version" {
+		t.Errorf("TableName() = %s, want ops.goose_db_version", got)
+	}
+	if got := (PostgresDialect{}).createSchemaSQL(quoteTableName(&PostgresDialect{}, "my-ops")); got != `CREATE SCHEMA IF NOT EXISTS "my-ops";` {
+		t.Errorf("unexpected schema creation: %s", got)
+	}
+
+	writeSQLMigration(t, dir, 1, "one")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM ops.goose_db_version").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("expected 2 rows in ops.goose_db_version, got %d (%v)", n, err)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM main.sqlite_master WHERE name = 'goose_db_version'").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected no version table in the main schema, got %d (%v)", n, err)
+	}
+}
+
+func TestDetectDialect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pg, err := sql.Open("postgres", "postgres://localhost/goose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pg.Close()
+	if name, ok := driverDialect(pg); !ok || name != "postgres" {
+		t.Errorf("got dialect %q for lib/pq, want postgres", name)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// An explicit dialect is kept.
+	if err := SetDialect("mysql"); err != nil {
+		t.Fatal(err)
+	}
+	detectDialect(runConfig(), db)
+	if name := dialectName(GetDialect()); name != "mysql" {
+		t.Errorf("got dialect %s, want the explicit mysql", name)
+	}
+
+	if err := SetDialect(""); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	c := runConfig()
+	detectDialect(c, db)
+	if name := dialectName(c.dialect); name != "sqlite3" {
+		t.Errorf("got dialect %s, want sqlite3 detected from the driver", name)
+	}
+	if _, err := EnsureDBVersion(db); err != nil {
+		t.Fatal(err)
+	}
+	// The detected dialect is the one of the run only, runs against other
+	// drivers keep theirs.
+	if name := dialectName(GetDialect()); name == "sqlite3" {
+		t.Errorf("the detected dialect leaked to the package level configuration")
+	}
+}
+
+func TestSpannerDialect(t *testing.T) {
+	d := &SpannerDialect{}
+	if transactionalDDL(d) || !transactionalDDL(&PostgresDialect{}) {
+		t.Error("expected only Spanner to run DDL outside of transactions")
+	}
+	want := "INSERT INTO goose_db_version (id, version_id, is_applied, tstamp) " +
+		"SELECT IFNULL(MAX(id), 0) + 1, @p1, @p2, CURRENT_TIMESTAMP() FROM goose_db_version UNION ALL " +
+		"SELECT IFNULL(MAX(id), 0) + 2, @p3, @p4, CURRENT_TIMESTAMP() FROM goose_db_version"
+	if got := d.insertVersionsSQL(runConfig(), 2); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	partitioned := "-- +goose NO TRANSACTION\n-- +goose Up\n-- +goose PARTITIONED\nUPDATE users SET active = true WHERE active IS NULL;\n"
+	stmts, _, err := getSQLStatements(runConfig(), strings.NewReader(partitioned), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 1 || !isPartitioned(stmts[0]) {
+		t.Errorf("expected a partitioned statement, got %q", stmts)
+	}
+	if _, _, err := getSQLStatements(runConfig(), strings.NewReader(strings.TrimPrefix(partitioned, "-- +goose NO TRANSACTION\n")), true); err == nil {
+		t.Error("expected partitioned DML in a transaction to fail")
+	}
+}
+
+func TestFirebirdDialect(t *testing.T) {
+	d := &FirebirdDialect{}
+	if transactionalDDL(d) {
+		t.Error("expected Firebird to create tables outside of transactions")
+	}
+	want := "INSERT INTO goose_db_version (version_id, is_applied) " +
+		"SELECT CAST(? AS bigint), CAST(? AS boolean) FROM RDB$DATABASE UNION ALL " +
+		"SELECT CAST(? AS bigint), CAST(? AS boolean) FROM RDB$DATABASE"
+	if got := d.insertVersionsSQL(runConfig(), 2); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := firstRow(d, "SELECT id FROM t ORDER BY id"), "SELECT id FROM t ORDER BY id ROWS 1"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := firstRow(&PostgresDialect{}, "SELECT id FROM t ORDER BY id"), "SELECT id FROM t ORDER BY id LIMIT 1"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if name := dialectName(d); name != "firebird" {
+		t.Errorf("got dialect name %s, want firebird", name)
+	}
+}
+
+type sqlStateError struct{ Code string }
+
+func (e *sqlStateError) Error() string { return "sqlstate " + e.Code }
+
+type materializeDialect struct{ PostgresDialect }
+
+func TestDistributedDialects(t *testing.T) {
+	defer SetDialect("postgres")
+
+	for _, name := range []string{"cockroach", "yugabyte"} {
+		if err := SetDialect(name); err != nil {
+			t.Fatal(err)
+		}
+		if got := dialectName(GetDialect()); got != name {
+			t.Errorf("got dialect name %s, want %s", got, name)
+		}
+
+		attempts := 0
+		err := retryBusy(runConfig(), func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.Wrap(&sqlStateError{Code: "40001"}, "failed to commit")
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("%s: expected serialization failures to be retried, got %d attempts, %v", name, attempts, err)
+		}
+
+		SetBusyTimeout(0)
+		attempts = 0
+		err = retryBusy(runConfig(), func() error {
+			attempts++
+			if attempts < 2 {
+				return &sqlStateError{Code: "40001"}
+			}
+			return nil
+		})
+		SetBusyTimeout(5 * time.Second)
+		if err != nil || attempts != 2 {
+			t.Errorf("%s: expected serialization failures to be retried without a busy timeout, got %d attempts, %v", name, attempts, err)
+		}
+	}
+
+	SetVersionTableTTL(90 * time.Minute)
+	defer SetVersionTableTTL(0)
+	want := `ALTER TABLE goose_db_version CONFIGURE ZONE USING gc.ttlseconds = 5400`
+	if got := (CockroachDialect{}).versionTableTTLSQL(runConfig(), 90*time.Minute); got != want {
+		t.Errorf("got TTL statement %q, want %q", got, want)
+	}
+	if err := SetDialect("yugabyte"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureVersionTableTTL(runConfig(), nil); err == nil || !strings.Contains(err.Error(), "not supported by the yugabyte dialect") {
+		t.Errorf("got error %v, want the TTL refused", err)
+	}
+
+	if _, ok := SQLDialect(&CockroachDialect{}).(historicalReader); !ok {
+		t.Error("expected CockroachDB to read status as of a past time")
+	}
+	if _, ok := SQLDialect(&YugabyteDialect{}).(historicalReader); ok {
+		t.Error("expected YugabyteDB to read status at the current time")
+	}
+
+	if err := RegisterDialect("postgres", materializeDialect{}); err == nil {
+		t.Error("expected the dialects of goose not to be registered again")
+	}
+	if err := RegisterDialect("materialize", materializeDialect{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDialect("materialize"); err != nil {
+		t.Fatal(err)
+	}
+	if got := dialectName(GetDialect()); got != "materialize" {
+		t.Errorf("got dialect name %s, want materialize", got)
+	}
+}
+
+func TestCurrentVersionQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetRollbackHistory(true)
+	defer SetRollbackHistory(false)
+
+	for v, table := range []string{"a", "b", "c"} {
+		writeSQLMigration(t, dir, int64(v+1), table)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	// Roll back 3, then 2 and apply 2 again: the latest records of 3 and
+	// 2 are a rollback and an apply.
+	if err := DownTo(db, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpTo(db, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := EnsureDBVersion(db); err != nil || v != 2 {
+		t.Errorf("expected version 2, got %d, %v", v, err)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name = 'goose_db_version_version_idx'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected the version table to be indexed, got %d, %v", n, err)
+	}
+
+	// Version tables created without the index get it.
+	db2, err := sql.Open("sqlite3", filepath.Join(dir, "old.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+	if _, err := db2.Exec(Sqlite3Dialect{}.createVersionTableSQL(runConfig())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db2.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, true)"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := EnsureDBVersion(db2); err != nil || v != 0 {
+		t.Errorf("expected version 0, got %d, %v", v, err)
+	}
+	if err := db2.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name = 'goose_db_version_version_idx'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected the index to be created on the existing version table, got %d, %v", n, err)
+	}
+}
+
+func TestSwapDialect(t *testing.T) {
+	if err := SetDialect(""); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	restore, err := SwapDialect("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := dialectName(GetDialect()); name != "mysql" {
+		t.Errorf("got dialect %s, want mysql", name)
+	}
+	restore()
+	if c := currentConfig(); dialectName(c.dialect) != "postgres" || c.dialectSet {
+		t.Errorf("got dialect %s, set %v, want postgres detected from the driver", dialectName(c.dialect), c.dialectSet)
+	}
+	if _, err := SwapDialect("nosql"); err == nil {
+		t.Error("an unknown dialect was accepted")
+	}
+}
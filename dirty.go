@@ -0,0 +1,129 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// SetDirtyTracking enables marking migrations as running in a table next
+// to the version table, so a migration interrupted after changing the
+// database, e.g. by a crash during a NO TRANSACTION migration or after
+// DDL that MySQL commits implicitly, isn't silently left half applied.
+// Migrating a database with such a mark fails with ErrDirtyState until
+// the database is repaired by hand and the mark cleared with Resolve.
+func SetDirtyTracking(v bool) {
+	updateConfig(func(c *config) { c.dirtyTracking = v })
+}
+
+func dirtyTableName(c *config) string {
+	return c.versionTableName() + "_dirty"
+}
+
+// dirtyVersion returns the version of the migration marked as running, if
+// any. Create the dirty table if it doesn't exist.
+func dirtyVersion(c *config, db *sql.DB) (int64, bool, error) {
+	var version int64
+	err := db.QueryRow(fmt.Sprintf("SELECT version_id FROM %s", quoteTableName(c.dialect, dirtyTableName(c)))).Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, false, nil
+	case err != nil && c.dialect.isMissingTable(err):
+		if _, err := db.Exec(c.dialect.createDirtyTableSQL(c)); err != nil {
+			return 0, false, errors.Wrap(err, "failed to create dirty table")
+		}
+		return 0, false, nil
+	case err != nil:
+		return 0, false, errors.Wrap(err, "failed to query dirty table")
+	}
+
+	return version, true, nil
+}
+
+// markDirty marks m as running, failing if the database is dirty.
+func markDirty(c *config, db *sql.DB, m *Migration) error {
+	if !c.dirtyTracking {
+		return nil
+	}
+
+	version, dirty, err := dirtyVersion(c, db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return &ErrDirtyState{Version: version, Err: errors.New("repair the database by hand, then clear the mark with Resolve")}
+	}
+
+	if _, err := db.Exec(bind(c, c.dialect.insertDirtySQL(c)), m.Version); err != nil {
+		return errors.Wrap(err, "failed to mark migration as running")
+	}
+	return nil
+}
+
+// clearDirty clears the running mark of m once it succeeded, or failed
+// without changing the database: in a transaction on a dialect running
+// DDL in transactions, and without an ErrDirtyState.
+func clearDirty(c *config, db *sql.DB, m *Migration, runErr error) error {
+	if !c.dirtyTracking {
+		return nil
+	}
+	if runErr != nil && (errors.As(runErr, new(*ErrDirtyState)) || !transactionalDDL(c.dialect)) {
+		return nil
+	}
+
+	if _, err := db.Exec(bind(c, c.dialect.deleteDirtySQL(c)), m.Version); err != nil {
+		return errors.Wrap(err, "failed to clear running mark of migration")
+	}
+	return nil
+}
+
+// Resolve clears the mark of a migration interrupted with dirty tracking
+// enabled, see SetDirtyTracking, once the database was repaired by hand.
+// The migration is recorded as applied if applied is set, or as not
+// applied otherwise.
+func Resolve(db *sql.DB, dir string, applied bool) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return resolve(c, db, dir, applied)
+}
+
+// resolve is Resolve, for callers holding runMu.
+func resolve(c *config, db *sql.DB, dir string, applied bool) error {
+	version, dirty, err := dirtyVersion(c, db)
+	if err != nil {
+		return err
+	}
+	if !dirty {
+		return errors.New("database is not dirty")
+	}
+
+	m, recorded, err := markedMigration(c, db, dir, version)
+	if err != nil {
+		return err
+	}
+	if recorded != applied {
+		if err := recordVersion(c, db, m, applied); err != nil {
+			return err
+		}
+		record := recordChecksum
+		if !applied {
+			record = forgetChecksum
+		}
+		if err := record(c, db, m); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.Exec(bind(c, c.dialect.deleteDirtySQL(c)), version); err != nil {
+		return errors.Wrap(err, "failed to clear running mark of migration")
+	}
+	state := "APPLIED"
+	if !applied {
+		state = "UNAPPLIED"
+	}
+	c.logger.Println("RESOLVED AS", state, filepath.Base(m.Source))
+	return nil
+}
@@ -0,0 +1,77 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDirtyTracking(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetDirtyTracking(true)
+	defer SetDirtyTracking(false)
+
+	write := func(name, src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A migration failing in a transaction leaves no mark.
+	write("00001_a.sql", "-- +goose Up\nCREATE TABLE a (id int);\nINSERT INTO missing VALUES (1);\n-- +goose Down\nDROP TABLE a;\n")
+	if err := Up(db, dir); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	write("00001_a.sql", "-- +goose Up\nCREATE TABLE a (id int);\n-- +goose Down\nDROP TABLE a;\n")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A NO TRANSACTION migration failing halfway does.
+	write("00002_b.sql", "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE TABLE b (id int);\nINSERT INTO missing VALUES (1);\n-- +goose Down\nDROP TABLE b;\n")
+	if err := Up(db, dir); !errors.As(err, new(*ErrDirtyState)) {
+		t.Fatalf("expected ErrDirtyState, got %v", err)
+	}
+	write("00002_b.sql", "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE TABLE IF NOT EXISTS b (id int);\n-- +goose Down\nDROP TABLE b;\n")
+	var dirty *ErrDirtyState
+	if err := Up(db, dir); !errors.As(err, &dirty) || dirty.Version != 2 {
+		t.Fatalf("expected Up to refuse to migrate a dirty database, got %v", err)
+	}
+
+	// Repaired by hand.
+	if _, err := db.Exec("DROP TABLE b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Resolve(db, dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Errorf("expected version 2, got %d (%v)", v, err)
+	}
+	if err := Resolve(db, dir, true); err == nil {
+		t.Error("expected Resolve to fail on a clean database")
+	}
+}
@@ -2,55 +2,146 @@ package goose
 
 import (
 	"database/sql"
-	"fmt"
 )
 
-// Down rolls back a single migration from the current version.
-func Down(db *sql.DB, dir string) error {
-	currentVersion, err := GetDBVersion(db)
+// Down rolls back a single migration from the current version and
+// returns the rolled back migration.
+//
+// Deprecated: use Provider.Down, see NewProvider.
+func Down(db *sql.DB, dir string, opts ...OptionsFunc) (*Migration, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).Down(opts...)
+}
+
+// down is Down, for callers holding runMu.
+func down(c *config, db *sql.DB, dir string, o options) (*Migration, error) {
+	currentVersion, err := ensureDBVersion(c, db)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	migrations, err := CollectMigrations(dir, minVersion, maxVersion)
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	current, err := migrations.Current(currentVersion)
 	if err != nil {
-		return fmt.Errorf("no migration %v", currentVersion)
+		return nil, &ErrVersionNotFound{Version: currentVersion}
 	}
 
-	return current.Down(db)
+	h := newHooks(db, dir, o)
+	if err := h.before(c); err != nil {
+		return nil, err
+	}
+	if err := current.down(c, db, o); err != nil {
+		return nil, err
+	}
+	if err := h.after(c); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// DownTo rolls back the migrations newer than a specific version, keeping
+// it applied. It fails with ErrWrongDirection if the database is older than
+// the version, unless WithIdempotentTarget is set.
+//
+// Deprecated: use Provider.DownTo, see NewProvider.
+func DownTo(db *sql.DB, dir string, version int64, opts ...OptionsFunc) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).DownTo(version, opts...)
 }
 
-// DownTo rolls back migrations to a specific version.
-func DownTo(db *sql.DB, dir string, version int64) error {
-	migrations, err := CollectMigrations(dir, minVersion, maxVersion)
+// downTo is DownTo, for callers holding runMu.
+func downTo(c *config, db *sql.DB, dir string, version int64, opts ...OptionsFunc) error {
+	o := applyOptions(opts)
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
 	if err != nil {
 		return err
 	}
+	currentVersion, err := ensureDBVersion(c, db)
+	if err != nil {
+		return err
+	}
+	if currentVersion < version {
+		if o.idempotent {
+			printProgress(c, "goose: no migrations to run. current version: %d\n", currentVersion)
+			return nil
+		}
+		return &ErrWrongDirection{Command: "down-to", Target: version, Current: currentVersion}
+	}
+	if err := checkRunnable(c, migrations.between(version, currentVersion), false); err != nil {
+		return err
+	}
 
+	h := newHooks(db, dir, o)
 	for {
-		currentVersion, err := GetDBVersion(db)
+		currentVersion, err := ensureDBVersion(c, db)
 		if err != nil {
 			return err
 		}
 
 		current, err := migrations.Current(currentVersion)
 		if err != nil {
-			log.Printf("goose: no migrations to run. current version: %d\n", currentVersion)
-			return nil
+			printProgress(c, "goose: no migrations to run. current version: %d\n", currentVersion)
+			return h.after(c)
 		}
 
 		if current.Version <= version {
-			log.Printf("goose: no migrations to run. current version: %d\n", currentVersion)
-			return nil
+			printProgress(c, "goose: no migrations to run. current version: %d\n", currentVersion)
+			return h.after(c)
 		}
 
-		if err = current.Down(db); err != nil {
+		if err := h.before(c); err != nil {
+			return err
+		}
+		if err = current.down(c, db, o); err != nil {
 			return err
 		}
 	}
 }
+
+// DownAll rolls back the most recently applied migration according to the
+// order recorded in the version table. Unlike Down, it does not rely on
+// version ordering, so it undoes migrations applied out of order by UpAll
+// in the reverse order they were applied.
+func DownAll(db *sql.DB, dir string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return downAll(c, db, dir)
+}
+
+// downAll is DownAll, for callers holding runMu.
+func downAll(c *config, db *sql.DB, dir string) error {
+	applied, err := appliedDBVersionsInOrder(c, db)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		printProgress(c, "goose: no migrations to roll back. current version: 0\n")
+		return nil
+	}
+
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
+	if err != nil {
+		return err
+	}
+
+	last, err := migrations.Current(applied[0])
+	if err != nil {
+		return &ErrVersionNotFound{Version: applied[0]}
+	}
+
+	h := newHooks(db, dir, options{})
+	if err := h.before(c); err != nil {
+		return err
+	}
+	if err := last.down(c, db, options{}); err != nil {
+		return err
+	}
+	return h.after(c)
+}
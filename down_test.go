@@ -0,0 +1,291 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+func writeSQLMigration(t *testing.T, dir string, version int64, table string) {
+	t.Helper()
+	src := fmt.Sprintf("-- +goose Up\nCREATE TABLE %s (id int);\n\n-- +goose Down\nDROP TABLE %s;\n", table, table)
+	name := filepath.Join(dir, fmt.Sprintf("%05d_%s.sql", version, table))
+	if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "one")
+	writeSQLMigration(t, dir, 3, "three")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 is applied after 3, so it must be the first one rolled back.
+	writeSQLMigration(t, dir, 2, "two")
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []int64{2, 3, 1} {
+		applied, err := appliedDBVersionsInOrder(runConfig(), db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) == 0 || applied[0] != want {
+			t.Fatalf("incorrect last applied version. got %v, want %v", applied, want)
+		}
+		if err := DownAll(db, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applied, err := appliedDBVersionsInOrder(runConfig(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected all migrations to be rolled back, got %v", applied)
+	}
+}
+
+func TestRollbackHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetRollbackHistory(true)
+	defer SetRollbackHistory(false)
+
+	writeSQLMigration(t, dir, 1, "one")
+	noTx := "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE TABLE two (id int);\n\n-- +goose Down\nDROP TABLE two;\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00002_two.sql"), []byte(noTx), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := Down(db, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var history []string
+	rows, err := db.Query("SELECT version_id, is_applied FROM goose_db_version ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int64
+		var applied bool
+		if err := rows.Scan(&v, &applied); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, fmt.Sprintf("%d:%t", v, applied))
+	}
+	if got, want := fmt.Sprint(history), "[0:true 1:true 2:true 2:false 1:false]"; got != want {
+		t.Errorf("unexpected history. got %s, want %s", got, want)
+	}
+
+	if v, err := GetDBVersion(db); err != nil || v != 0 {
+		t.Fatalf("expected version 0, got %d (%v)", v, err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Fatalf("expected version 2, got %d (%v)", v, err)
+	}
+}
+
+func TestUpByOneAndDownReturnMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "one")
+	writeSQLMigration(t, dir, 2, "two")
+
+	for _, want := range []int64{1, 2} {
+		m, err := UpByOne(db, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Version != want {
+			t.Errorf("expected UpByOne to apply %d, got %d", want, m.Version)
+		}
+	}
+	if _, err := UpByOne(db, dir); err != ErrNoNextVersion {
+		t.Errorf("expected ErrNoNextVersion, got %v", err)
+	}
+
+	m, err := Down(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != 2 {
+		t.Errorf("expected Down to roll back 2, got %d", m.Version)
+	}
+
+	// After UpAll applied 2 out of order, the current version is 2 and 3 is
+	// applied already.
+	writeSQLMigration(t, dir, 3, "three")
+	if err := UpAll(db, dir, WithFileFilter(func(path string) bool { return !strings.HasSuffix(path, "_two.sql") })); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 4, "four")
+	m, err = UpByOne(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != 4 {
+		t.Errorf("expected UpByOne to skip the applied 3 and apply 4, got %d", m.Version)
+	}
+}
+
+func TestUpWithVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for v, table := range []string{"one", "two", "three"} {
+		writeSQLMigration(t, dir, int64(v+1), table)
+	}
+	bad := filepath.Join(dir, "00004_bad.sql")
+	if err := ioutil.WriteFile(bad, []byte("-- +goose Up\nSELECT * FROM missing;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := UpToWithVersion(db, dir, 2); err != nil || v != 2 {
+		t.Errorf("expected UpToWithVersion to reach 2, got %d, %v", v, err)
+	}
+	if v, err := UpWithVersion(db, dir); err == nil || v != 3 {
+		t.Errorf("expected UpWithVersion to fail at 3, got %d, %v", v, err)
+	}
+	if err := os.Remove(bad); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := UpAllWithVersion(db, dir); err != nil || v != 3 {
+		t.Errorf("expected UpAllWithVersion to report 3, got %d, %v", v, err)
+	}
+}
+
+func TestWrongDirection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for v, table := range []string{"a", "b", "c"} {
+		writeSQLMigration(t, dir, int64(v+1), table)
+	}
+	if err := UpTo(db, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var wrong *ErrWrongDirection
+	if err := UpTo(db, dir, 1); !errors.As(err, &wrong) || wrong.Target != 1 || wrong.Current != 2 {
+		t.Errorf("expected up-to 1 from 2 to fail, got %v", err)
+	}
+	if err := DownTo(db, dir, 3); !errors.As(err, &wrong) || wrong.Command != "down-to" {
+		t.Errorf("expected down-to 3 from 2 to fail, got %v", err)
+	}
+
+	// The target itself is a no-op, and with the option a passed one too.
+	if err := UpTo(db, dir, 2); err != nil {
+		t.Error(err)
+	}
+	if err := DownTo(db, dir, 2); err != nil {
+		t.Error(err)
+	}
+	if err := UpTo(db, dir, 1, WithIdempotentTarget()); err != nil {
+		t.Error(err)
+	}
+	if err := DownTo(db, dir, 3, WithIdempotentTarget()); err != nil {
+		t.Error(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Errorf("expected version 2, got %d, %v", v, err)
+	}
+}
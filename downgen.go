@@ -0,0 +1,163 @@
+package goose
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	matchCreateObject = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:UNIQUE\s+)?(TABLE|INDEX|VIEW|MATERIALIZED\s+VIEW|SEQUENCE|TYPE|SCHEMA|EXTENSION)\s+(?:CONCURRENTLY\s+)?(IF\s+NOT\s+EXISTS\s+)?([^\s(]+)(?:\s+ON\s+(?:ONLY\s+)?([^\s(]+))?`)
+	matchRenameTable  = regexp.MustCompile(`(?is)^RENAME\s+TABLE\s+(\S+)\s+TO\s+(\S+)$`)
+	matchRenameTo     = regexp.MustCompile(`(?is)^RENAME\s+TO\s+(\S+)$`)
+	matchRenameColumn = regexp.MustCompile(`(?is)^RENAME\s+(?:COLUMN\s+)?(\S+)\s+TO\s+(\S+)$`)
+	matchAddColumn    = regexp.MustCompile(`(?is)^ADD\s+(?:COLUMN\s+)?(IF\s+NOT\s+EXISTS\s+)?(\S+)`)
+	matchAddNamed     = regexp.MustCompile(`(?is)^ADD\s+CONSTRAINT\s+(\S+)`)
+	matchDataChange   = regexp.MustCompile(`(?i)^(INSERT|UPDATE|DELETE|MERGE|TRUNCATE|COPY|REPLACE)\b`)
+)
+
+// GenerateDown suggests the down section of the SQL migration at path from
+// the statements of its up section, undone in reverse order: a DROP for a
+// CREATE of a table, index, view, sequence, type, schema or extension, a
+// rename back for a RENAME and a DROP COLUMN or DROP CONSTRAINT for an
+// ALTER TABLE ... ADD. Other statements, such as data changes, get a TODO
+// comment to replace by hand. It is experimental, and the suggestion is a
+// skeleton to review, not a tested rollback.
+func GenerateDown(path string) (string, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return generateDown(c, path)
+}
+
+// generateDown is GenerateDown, for callers holding runMu.
+func generateDown(c *config, path string) (string, error) {
+	f, err := openSQLMigration(c, path, true)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open SQL migration file %q", filepath.Base(path))
+	}
+	defer f.Close()
+
+	parsed, err := parseSQLMigration(c, f, true)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse SQL migration file %q", filepath.Base(path))
+	}
+
+	var buf strings.Builder
+	for i := len(parsed.statements) - 1; i >= 0; i-- {
+		buf.WriteString(downStatement(c, parsed.statements[i]))
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// downStatement returns the statement undoing the up statement query, or
+// a TODO comment if it has none.
+func downStatement(c *config, query string) string {
+	stmt := strings.TrimSpace(clearStatement(query))
+	stmt = strings.TrimSpace(strings.TrimSuffix(stmt, ";"))
+
+	if m := matchCreateObject.FindStringSubmatch(stmt); m != nil && !strings.EqualFold(m[3], "ON") {
+		kind := strings.Join(strings.Fields(strings.ToUpper(m[1])), " ")
+		ifExists := ""
+		if m[2] != "" {
+			ifExists = "IF EXISTS "
+		}
+		down := "DROP " + kind + " " + ifExists + m[3]
+		if kind == "INDEX" && m[4] != "" {
+			if d := dialectName(c.dialect); d == "mysql" || d == "tidb" {
+				down += " ON " + m[4]
+			}
+		}
+		return down + ";"
+	}
+	if m := matchRenameTable.FindStringSubmatch(stmt); m != nil {
+		return "RENAME TABLE " + m[2] + " TO " + m[1] + ";"
+	}
+	if m := matchAlterTable.FindStringSubmatch(stmt); m != nil && !hasTopLevelComma(m[2]) {
+		table, clause := m[1], strings.TrimSpace(m[2])
+		if r := matchRenameTo.FindStringSubmatch(clause); r != nil {
+			return "ALTER TABLE " + r[1] + " RENAME TO " + table + ";"
+		}
+		if r := matchRenameColumn.FindStringSubmatch(clause); r != nil {
+			return "ALTER TABLE " + table + " RENAME COLUMN " + r[2] + " TO " + r[1] + ";"
+		}
+		if r := matchAddNamed.FindStringSubmatch(clause); r != nil {
+			return "ALTER TABLE " + table + " DROP CONSTRAINT " + r[1] + ";"
+		}
+		if r := matchAddColumn.FindStringSubmatch(clause); r != nil {
+			switch strings.ToUpper(r[2]) {
+			case "PRIMARY", "INDEX", "KEY", "UNIQUE", "FOREIGN", "CHECK", "CONSTRAINT", "FULLTEXT", "SPATIAL":
+			default:
+				ifExists := ""
+				if r[1] != "" {
+					ifExists = "IF EXISTS "
+				}
+				return "ALTER TABLE " + table + " DROP COLUMN " + ifExists + r[2] + ";"
+			}
+		}
+	}
+
+	snippet := strings.Join(strings.Fields(statementSnippet(stmt)), " ")
+	if matchDataChange.MatchString(stmt) {
+		return "-- TODO: revert the data change: " + snippet
+	}
+	return "-- TODO: revert: " + snippet
+}
+
+// hasTopLevelComma reports whether s has a comma outside parentheses, as
+// an ALTER TABLE with several clauses does.
+func hasTopLevelComma(s string) bool {
+	depth := 0
+	for _, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendDown appends the down section suggested by GenerateDown to the
+// SQL migration at path if its down section has no statements, for Create
+// with the generate-down feature.
+func appendDown(c *config, path string) error {
+	f, err := openSQLMigration(c, path, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open SQL migration file %q", filepath.Base(path))
+	}
+	parsed, err := parseSQLMigration(c, f, false)
+	f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse SQL migration file %q", filepath.Base(path))
+	}
+	if parsed.count > 0 {
+		return nil
+	}
+
+	down, err := generateDown(c, path)
+	if err != nil || down == "" {
+		return err
+	}
+	if parsed.downSections == 0 {
+		down = "\n-- +goose Down\n" + down
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	return ioutil.WriteFile(path, append(content, down...), 0644)
+}
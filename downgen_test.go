@@ -0,0 +1,102 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestGenerateDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := `-- +goose Up
+CREATE TABLE IF NOT EXISTS users (id int, name text);
+CREATE UNIQUE INDEX users_name ON users (name);
+ALTER TABLE users ADD COLUMN price numeric(10, 2);
+ALTER TABLE users ADD CONSTRAINT users_price CHECK (price > 0);
+ALTER TABLE users RENAME COLUMN name TO login;
+ALTER TABLE users RENAME TO accounts;
+INSERT INTO accounts (id, login) VALUES (1, 'admin');
+-- +goose StatementBegin
+CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;
+-- +goose StatementEnd
+
+-- +goose Down
+`
+	path := filepath.Join(dir, "00001_users.sql")
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	down, err := GenerateDown(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `-- TODO: revert: CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql
+-- TODO: revert the data change: INSERT INTO accounts (id, login) VALUES (1, 'admin')
+ALTER TABLE accounts RENAME TO users;
+ALTER TABLE users RENAME COLUMN login TO name;
+ALTER TABLE users DROP CONSTRAINT users_price;
+ALTER TABLE users DROP COLUMN price;
+DROP INDEX users_name;
+DROP TABLE IF EXISTS users;
+`
+	if down != want {
+		t.Errorf("got down section\n%s\nwant\n%s", down, want)
+	}
+
+	SetDialect("mysql")
+	defer SetDialect("postgres")
+	if got := downStatement(runConfig(), "CREATE INDEX users_name ON users (name);\n"); got != "DROP INDEX users_name ON users;" {
+		t.Errorf("got %q for a MySQL index", got)
+	}
+}
+
+func TestCreateGenerateDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := Experimental("generate-down", true); err != nil {
+		t.Fatal(err)
+	}
+	defer Experimental("generate-down", false)
+
+	tmpl := template.Must(template.New("table").Parse("-- +goose Up\nCREATE TABLE t{{.}} (id int);\n\n-- +goose Down\n"))
+	if err := CreateWithTemplate(nil, dir, tmpl, "table", "sql"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got files %v, %v", files, err)
+	}
+	content, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "-- +goose Down\nDROP TABLE t") {
+		t.Errorf("down section not generated:\n%s", content)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	parsed, err := parseSQLMigration(runConfig(), f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.statements) != 1 || !strings.HasPrefix(clearStatement(parsed.statements[0]), "DROP TABLE t") {
+		t.Errorf("got down statements %q", parsed.statements)
+	}
+}
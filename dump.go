@@ -0,0 +1,264 @@
+package goose
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaDumper writes the schema of db to w, see SetSchemaDump.
+type SchemaDumper func(db *sql.DB, w io.Writer) error
+
+// SetSchemaDump makes every call that migrates the database write its
+// resulting schema to path, like the schema.sql of Rails, so changes to
+// the schema can be reviewed along with the migrations. The schema is
+// written by dumper, or by DumpSchema if nil. An empty path disables the
+// dump.
+func SetSchemaDump(path string, dumper SchemaDumper) {
+	updateConfig(func(c *config) { c.schemaDumpPath, c.schemaDumper = path, dumper })
+}
+
+// DumpSchema writes the CREATE statements of the tables, indexes and views
+// of db to w, in name order, leaving out the tables of goose. It supports
+// the postgres, mysql, tidb and sqlite3 dialects, querying the catalog of
+// the database instead of running tools like pg_dump; set a SchemaDumper
+// with SetSchemaDump for other databases or a complete dump.
+func DumpSchema(db *sql.DB, w io.Writer) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return dumpSchema(c, db, w)
+}
+
+// dumpSchema is DumpSchema, for callers holding runMu.
+func dumpSchema(c *config, db *sql.DB, w io.Writer) error {
+	detectDialect(c, db)
+
+	switch name := dialectName(c.dialect); name {
+	case "postgres":
+		return dumpPostgresSchema(c, db, w)
+	case "mysql", "tidb":
+		return dumpMySQLSchema(c, db, w)
+	case "sqlite3":
+		return dumpSqlite3Schema(c, db, w)
+	default:
+		return errors.Errorf("dumping the schema is not supported by the %s dialect, set a SchemaDumper", name)
+	}
+}
+
+// writeSchemaDump writes the schema of db to the file set with
+// SetSchemaDump, if any.
+func writeSchemaDump(c *config, db *sql.DB) error {
+	if c.schemaDumpPath == "" {
+		return nil
+	}
+	dumper := c.schemaDumper
+	if dumper == nil {
+		dumper = func(db *sql.DB, w io.Writer) error { return dumpSchema(c, db, w) }
+	}
+
+	version, err := ensureDBVersion(c, db)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "-- Schema at version %d, dumped by goose; DO NOT EDIT.\n\n", version)
+	if err := dumper(db, &buf); err != nil {
+		return errors.Wrap(err, "failed to dump schema")
+	}
+	if err := ioutil.WriteFile(c.schemaDumpPath, buf.Bytes(), 0644); err != nil {
+		return errors.Wrap(err, "failed to write schema dump")
+	}
+	c.logger.Println("DUMPED", c.schemaDumpPath)
+
+	return nil
+}
+
+// isSchemaDump reports whether the file is the schema dump, which may be
+// kept in the migrations directory.
+func isSchemaDump(c *config, path string) bool {
+	dump := c.schemaDumpPath
+	return dump != "" && filepath.Clean(dump) == filepath.Clean(path)
+}
+
+// gooseTable reports whether the table is one of the tables of goose.
+func gooseTable(c *config, table string) bool {
+	for _, name := range []string{c.versionTableName(), checksumTableName(c), repeatableTableName(c), dirtyTableName(c), backfillTableName(c)} {
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		if strings.EqualFold(table, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func dumpSqlite3Schema(c *config, db *sql.DB, w io.Writer) error {
+	rows, err := db.Query(`SELECT tbl_name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 ELSE 2 END, name`)
+	if err != nil {
+		return errors.Wrap(err, "failed to query schema")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, statement string
+		if err := rows.Scan(&table, &statement); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+		if gooseTable(c, table) {
+			continue
+		}
+		fmt.Fprintf(w, "%s;\n\n", statement)
+	}
+	return errors.Wrap(rows.Err(), "failed to query schema")
+}
+
+// autoIncrement matches the counter of MySQL tables, left out of dumps.
+var autoIncrement = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+func dumpMySQLSchema(c *config, db *sql.DB, w io.Writer) error {
+	rows, err := db.Query(`SELECT table_name, table_type FROM information_schema.tables
+		WHERE table_schema = DATABASE() ORDER BY table_type, table_name`)
+	if err != nil {
+		return errors.Wrap(err, "failed to query tables")
+	}
+	type table struct{ name, kind string }
+	var tables []table
+	for rows.Next() {
+		var t table
+		if err := rows.Scan(&t.name, &t.kind); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "failed to scan row")
+		}
+		if !gooseTable(c, t.name) {
+			tables = append(tables, t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "failed to query tables")
+	}
+
+	for _, t := range tables {
+		var name, statement string
+		if t.kind == "VIEW" {
+			var charset, collation string
+			err = db.QueryRow("SHOW CREATE VIEW "+quoteWith("`", t.name)).Scan(&name, &statement, &charset, &collation)
+		} else {
+			err = db.QueryRow("SHOW CREATE TABLE "+quoteWith("`", t.name)).Scan(&name, &statement)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to query the definition of %s", t.name)
+		}
+		fmt.Fprintf(w, "%s;\n\n", autoIncrement.ReplaceAllString(statement, ""))
+	}
+	return nil
+}
+
+func dumpPostgresSchema(c *config, db *sql.DB, w io.Writer) error {
+	columns, err := db.Query(`SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull, coalesce(pg_get_expr(d.adbin, d.adrelid), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum`)
+	if err != nil {
+		return errors.Wrap(err, "failed to query columns")
+	}
+	var table string
+	var definitions []string
+	flush := func() {
+		if table != "" {
+			fmt.Fprintf(w, "CREATE TABLE %s (\n    %s\n);\n\n", quoteTableName(c.dialect, table), strings.Join(definitions, ",\n    "))
+		}
+	}
+	for columns.Next() {
+		var t, name, typ, def string
+		var notNull bool
+		if err := columns.Scan(&t, &name, &typ, &notNull, &def); err != nil {
+			columns.Close()
+			return errors.Wrap(err, "failed to scan row")
+		}
+		if gooseTable(c, t) {
+			continue
+		}
+		if t != table {
+			flush()
+			table, definitions = t, nil
+		}
+		column := quoteTableName(c.dialect, name) + " " + typ
+		if def != "" {
+			column += " DEFAULT " + def
+		}
+		if notNull {
+			column += " NOT NULL"
+		}
+		definitions = append(definitions, column)
+	}
+	columns.Close()
+	if err := columns.Err(); err != nil {
+		return errors.Wrap(err, "failed to query columns")
+	}
+	flush()
+
+	queries := []struct {
+		query  string
+		format string
+	}{
+		{`SELECT t.relname, c.conname || ' ' || pg_get_constraintdef(c.oid)
+			FROM pg_constraint c
+			JOIN pg_class t ON t.oid = c.conrelid
+			JOIN pg_namespace n ON n.oid = c.connamespace
+			WHERE n.nspname = current_schema() AND c.contype IN ('p', 'u', 'f', 'c', 'x')
+			ORDER BY t.relname, c.contype, c.conname`, "ALTER TABLE %s ADD CONSTRAINT %s;\n\n"},
+		{`SELECT i.tablename, i.indexdef
+			FROM pg_indexes i
+			WHERE i.schemaname = current_schema() AND NOT EXISTS (
+				SELECT 1 FROM pg_constraint c
+				JOIN pg_namespace n ON n.oid = c.connamespace
+				WHERE n.nspname = i.schemaname AND c.conname = i.indexname)
+			ORDER BY i.tablename, i.indexname`, "%[2]s;\n\n"},
+		{`SELECT viewname, definition FROM pg_views
+			WHERE schemaname = current_schema()
+			ORDER BY viewname`, "CREATE VIEW %s AS\n%s\n\n"},
+	}
+	for _, q := range queries {
+		if err := dumpRows(c, db, w, q.query, q.format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpRows writes the rows of a query of a table name and a definition
+// with format.
+func dumpRows(c *config, db *sql.DB, w io.Writer, query, format string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to query schema")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, definition string
+		if err := rows.Scan(&table, &definition); err != nil {
+			return errors.Wrap(err, "failed to scan row")
+		}
+		if !gooseTable(c, table) {
+			fmt.Fprintf(w, format, table, definition)
+		}
+	}
+	return errors.Wrap(rows.Err(), "failed to query schema")
+}
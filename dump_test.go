@@ -0,0 +1,55 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchemaDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	dump := filepath.Join(dir, "schema.sql")
+	SetSchemaDump(dump, nil)
+	defer SetSchemaDump("", nil)
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-- Schema at version 2, dumped by goose; DO NOT EDIT.\n\nCREATE TABLE a (id int);\n\nCREATE TABLE b (id int);\n\n"
+	if string(b) != want {
+		t.Errorf("expected schema dump:\n%s\ngot:\n%s", want, b)
+	}
+
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ioutil.ReadFile(dump); err != nil || strings.Contains(string(b), "CREATE TABLE b") {
+		t.Errorf("expected the dump to be updated after rolling back, got:\n%s", b)
+	}
+}
@@ -0,0 +1,82 @@
+package goose
+
+import "strings"
+
+// WithEnvironment makes Up apply the SQL migrations annotated with the
+// environment, like seed data for staging only:
+//
+//	-- +goose ENV staging,production
+//
+// Migrations without the annotation run in every environment. Annotated
+// migrations of other environments are left pending, and are skipped when
+// no environment is set.
+func WithEnvironment(name string) OptionsFunc {
+	return func(o *options) { o.environment = name }
+}
+
+// SetEnvironment sets the environment of the runs without WithEnvironment,
+// including the ones of Run and UpByOne. None is set by default.
+func SetEnvironment(name string) {
+	updateConfig(func(c *config) { c.environment = name })
+}
+
+// env returns the environment of a run, the one of WithEnvironment or
+// else of SetEnvironment.
+func (o options) env(c *config) string {
+	if o.environment != "" {
+		return o.environment
+	}
+	return c.environment
+}
+
+// inEnvironment returns the migrations that run in the environment, see
+// WithEnvironment, connected in the same order. Migrations that fail to
+// parse are kept, for checkRunnable to report.
+func (ms Migrations) inEnvironment(c *config, env string) Migrations {
+	keep := make([]bool, len(ms))
+	parallel(len(ms), func(i int) {
+		keep[i] = runsInEnvironment(c, ms[i], env)
+	})
+	return ms.kept(keep)
+}
+
+// kept returns the migrations of ms to keep, connected in the same order.
+func (ms Migrations) kept(keep []bool) Migrations {
+	var migrations Migrations
+	for i, m := range ms {
+		if keep[i] {
+			migrations = append(migrations, m)
+		}
+	}
+	if len(migrations) == len(ms) {
+		return ms
+	}
+
+	for i, m := range migrations {
+		m.Previous, m.Next = -1, -1
+		if i > 0 {
+			m.Previous = migrations[i-1].Version
+			migrations[i-1].Next = m.Version
+		}
+	}
+	return migrations
+}
+
+// runsInEnvironment reports whether the migration runs in the environment.
+// Only SQL files can be annotated.
+func runsInEnvironment(c *config, m *Migration, env string) bool {
+	if m.dir || m.Registered || fileExt(m.Source) != ".sql" {
+		return true
+	}
+
+	parsed, err := scanSQLFile(c, m.Source, true, discardStatement)
+	if err != nil || parsed.environments == nil {
+		return true
+	}
+	for _, name := range parsed.environments {
+		if strings.EqualFold(name, env) {
+			return true
+		}
+	}
+	return false
+}
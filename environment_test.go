@@ -0,0 +1,98 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	files := map[string]string{
+		"00001_users.sql": "-- +goose Up\nCREATE TABLE users (id int);\n-- +goose Down\nDROP TABLE users;\n",
+		"00002_seed.sql":  "-- +goose ENV Staging, dev\n-- +goose Up\nINSERT INTO users VALUES (1);\n-- +goose Down\nDELETE FROM users;\n",
+		"00003_posts.sql": "-- +goose Up\nCREATE TABLE posts (id int);\n-- +goose Down\nDROP TABLE posts;\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := Up(db, dir, WithEnvironment("production")); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("expected the seed to be skipped in production, got %d users", n)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 3 {
+		t.Errorf("expected version 3, got %d (%v)", v, err)
+	}
+
+	if err := UpAll(db, dir, WithEnvironment("staging")); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("expected the seed to run in staging, got %d users", n)
+	}
+
+	// UpByOne and Run take the environment too, of WithEnvironment or
+	// SetEnvironment.
+	db, err = sql.Open("sqlite3", filepath.Join(dir, "one.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := UpByOne(db, dir, WithEnvironment("production")); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := UpByOne(db, dir, WithEnvironment("dev")); err != nil || m.Version != 2 {
+		t.Fatalf("expected UpByOne to apply the seed in dev, got %v, %v", m, err)
+	}
+	SetEnvironment("staging")
+	defer SetEnvironment("")
+	if err := Run("down", db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run("up-by-one", db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 || count() != 1 {
+		t.Errorf("expected the seed to run in the staging environment set, got version %d (%v)", v, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "00004_bad.sql"), []byte("-- +goose ENV\n-- +goose Up\nSELECT 1;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err == nil || !strings.Contains(err.Error(), "needs environment names") {
+		t.Errorf("expected an invalid ENV annotation to fail, got %v", err)
+	}
+}
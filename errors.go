@@ -0,0 +1,308 @@
+package goose
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// ErrDuplicateVersion is returned when more than one migration has the
+// same version.
+type ErrDuplicateVersion struct {
+	Version int64
+	Sources []string
+}
+
+func (e *ErrDuplicateVersion) Error() string {
+	names := make([]string, len(e.Sources))
+	seen := make(map[string]bool)
+	sameName := false
+	for i, source := range e.Sources {
+		names[i] = filepath.Base(source)
+		sameName = sameName || seen[names[i]]
+		seen[names[i]] = true
+	}
+	if sameName {
+		// The same file in different folders, see SetRecursive.
+		for i, source := range e.Sources {
+			names[i] = filepath.Join(filepath.Base(filepath.Dir(source)), names[i])
+		}
+	}
+	return fmt.Sprintf("duplicate version %d: %s", e.Version, strings.Join(names, ", "))
+}
+
+// ErrVersionNotFound is returned when there is no migration for a version,
+// e.g. the current version of the database.
+type ErrVersionNotFound struct {
+	Version int64
+}
+
+func (e *ErrVersionNotFound) Error() string {
+	return fmt.Sprintf("no migration %d", e.Version)
+}
+
+// ErrVersionTableMissing is returned when the version table doesn't
+// exist where it is read without being created.
+type ErrVersionTableMissing struct {
+	Table string
+	Err   error
+}
+
+func (e *ErrVersionTableMissing) Error() string {
+	return fmt.Sprintf("version table %s does not exist: %v", e.Table, e.Err)
+}
+
+// Cause returns the underlying error, for errors.Cause.
+func (e *ErrVersionTableMissing) Cause() error { return e.Err }
+
+// Unwrap returns the underlying error, for errors.As and errors.Is.
+func (e *ErrVersionTableMissing) Unwrap() error { return e.Err }
+
+// ErrMigrationFailed is returned when a migration fails. Statement is the
+// SQL statement that failed, if any, redacted with the function set with
+// SetStatementRedactor, StatementNumber its position in the migration and
+// Line the line of the file where it starts, 0 if unknown. Code is the
+// error code of the database, like the SQLSTATE of PostgreSQL or the error
+// number of MySQL, if the driver reports one.
+type ErrMigrationFailed struct {
+	Version         int64
+	Source          string
+	Statement       string
+	StatementNumber int
+	Line            int
+	Code            string
+	Err             error
+}
+
+func (e *ErrMigrationFailed) Error() string { return e.Err.Error() }
+
+// Cause returns the underlying error, for errors.Cause.
+func (e *ErrMigrationFailed) Cause() error { return e.Err }
+
+// Unwrap returns the underlying error, for errors.As and errors.Is.
+func (e *ErrMigrationFailed) Unwrap() error { return e.Err }
+
+// ErrDirtyState is returned when a migration run without a transaction
+// fails after changing the database, leaving it partially migrated. It has
+// to be repaired by hand before migrating again.
+type ErrDirtyState struct {
+	Version int64
+	Err     error
+}
+
+func (e *ErrDirtyState) Error() string {
+	return fmt.Sprintf("database is dirty, migration %d was partially applied: %v", e.Version, e.Err)
+}
+
+// Cause returns the underlying error, for errors.Cause.
+func (e *ErrDirtyState) Cause() error { return e.Err }
+
+// Unwrap returns the underlying error, for errors.As and errors.Is.
+func (e *ErrDirtyState) Unwrap() error { return e.Err }
+
+// ErrConcurrentMigration is returned by Up when the version of the
+// database changed between two migrations it applied, which means another
+// process is migrating the same database.
+type ErrConcurrentMigration struct {
+	Expected int64 // version after the last migration applied by Up
+	Actual   int64
+}
+
+func (e *ErrConcurrentMigration) Error() string {
+	return fmt.Sprintf("concurrent migration detected: expected version %d, found %d", e.Expected, e.Actual)
+}
+
+// ErrTooManyPending is returned by Up with WithMaxPending when more
+// migrations are pending than allowed.
+type ErrTooManyPending struct {
+	Pending int
+	Max     int
+}
+
+func (e *ErrTooManyPending) Error() string {
+	return fmt.Sprintf("%d migrations are pending, more than the %d allowed: apply them in a supervised run", e.Pending, e.Max)
+}
+
+// ErrVersionPinned is returned when migrating up to a version newer than
+// the one set with PinVersion.
+type ErrVersionPinned struct {
+	Version int64
+	Pinned  int64
+}
+
+func (e *ErrVersionPinned) Error() string {
+	return fmt.Sprintf("can't migrate up to version %d, the version is pinned at %d", e.Version, e.Pinned)
+}
+
+// ErrWrongDirection is returned by UpTo when the database is newer than
+// the target version, and by DownTo when it is older, which would
+// otherwise do nothing.
+type ErrWrongDirection struct {
+	Command string // up-to or down-to
+	Target  int64
+	Current int64
+}
+
+func (e *ErrWrongDirection) Error() string {
+	if e.Command == "down-to" {
+		return fmt.Sprintf("can't roll back to version %d, the database is older at version %d", e.Target, e.Current)
+	}
+	return fmt.Sprintf("can't migrate up to version %d, the database is newer at version %d", e.Target, e.Current)
+}
+
+// ErrDependencyNotApplied is returned when applying a migration before the
+// migrations it depends on, declared in the migrations.json manifest of
+// its directory.
+type ErrDependencyNotApplied struct {
+	Version      int64
+	Dependencies []int64 // the ones not applied
+}
+
+func (e *ErrDependencyNotApplied) Error() string {
+	return fmt.Sprintf("migration %d depends on %v, which are not applied: apply them first, e.g. with up-all-unapplied", e.Version, e.Dependencies)
+}
+
+// ErrNotRunnable is returned before migrating when migrations that would
+// run can't, e.g. Go migrations not built into the binary or SQL files
+// that don't parse. Nothing is migrated.
+type ErrNotRunnable struct {
+	Problems []Problem
+}
+
+func (e *ErrNotRunnable) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return "migrations can't run, nothing was migrated:\n\t" + strings.Join(lines, "\n\t")
+}
+
+// statementError is a failed SQL statement, the number-th of its
+// migration, starting at line.
+type statementError struct {
+	statement string
+	number    int
+	line      int
+	err       error
+}
+
+func (e *statementError) Error() string { return e.err.Error() }
+func (e *statementError) Cause() error  { return e.err }
+func (e *statementError) Unwrap() error { return e.err }
+
+// migrationFailed wraps the error of a failed migration in an
+// ErrMigrationFailed.
+func migrationFailed(m *Migration, err error) error {
+	failed := &ErrMigrationFailed{Version: m.Version, Source: m.Source, Code: errorCode(err), Err: err}
+	for err != nil {
+		if s, ok := err.(*statementError); ok {
+			failed.Statement, failed.StatementNumber, failed.Line = s.statement, s.number, s.line
+			break
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return failed
+}
+
+// SetStatementRedactor sets a function applied to the SQL statements put
+// in errors, e.g. to mask literals before errors are sent to an error
+// tracker. A nil function, the default, keeps statements as they are.
+func SetStatementRedactor(fn func(statement string) string) {
+	updateConfig(func(c *config) { c.statementRedactor = fn })
+}
+
+// redactStatement applies the redactor set with SetStatementRedactor.
+func redactStatement(c *config, s string) string {
+	if redact := c.statementRedactor; redact != nil {
+		return redact(s)
+	}
+	return s
+}
+
+// errorCode returns the error code of the database in the chain of err:
+// the SQLSTATE of drivers implementing SQLState, like pgx, or else the Code
+// or Number field of the driver error, like the Code of github.com/lib/pq,
+// the Number of MySQL or the Code of sqlite3.
+func errorCode(err error) string {
+	for err != nil {
+		if s, ok := err.(interface{ SQLState() string }); ok {
+			return s.SQLState()
+		}
+		if code := errorCodeField(err); code != "" {
+			return code
+		}
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// errorCodeField returns the Code or Number field of a driver error.
+func errorCodeField(err error) string {
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, name := range []string{"Code", "Number"} {
+		f := v.FieldByName(name)
+		if !f.IsValid() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String:
+			if f.String() != "" {
+				return f.String()
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if f.Int() != 0 {
+				return fmt.Sprint(f.Int())
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if f.Uint() != 0 {
+				return fmt.Sprint(f.Uint())
+			}
+		}
+	}
+	return ""
+}
+
+// checkDuplicateVersions returns an ErrDuplicateVersion for the first
+// version with more than one migration.
+func checkDuplicateVersions(migrations Migrations) error {
+	sources := make(map[int64][]string)
+	var duplicates []int64
+	for _, m := range migrations {
+		sources[m.Version] = append(sources[m.Version], m.Source)
+		if len(sources[m.Version]) == 2 {
+			duplicates = append(duplicates, m.Version)
+		}
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	v := duplicates[0]
+	for _, d := range duplicates {
+		if d < v {
+			v = d
+		}
+	}
+	return &ErrDuplicateVersion{Version: v, Sources: sources[v]}
+}
@@ -0,0 +1,179 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestTypedErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	write := func(name, src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("00001_a.sql", "-- +goose Up\nCREATE TABLE a (id int);\n-- +goose Down\nDROP TABLE a;\n")
+	write("00001_b.sql", "-- +goose Up\nCREATE TABLE b (id int);\n-- +goose Down\nDROP TABLE b;\n")
+	err = Up(db, dir)
+	var duplicate *ErrDuplicateVersion
+	if !errors.As(err, &duplicate) || duplicate.Version != 1 || len(duplicate.Sources) != 2 {
+		t.Fatalf("expected ErrDuplicateVersion for version 1, got %v", err)
+	}
+	os.Remove(filepath.Join(dir, "00001_b.sql"))
+
+	write("00002_broken.sql", "-- +goose Up\nCREATE TABLE c (id int);\nINSERT INTO missing VALUES (1);\n-- +goose Down\n")
+	err = Up(db, dir)
+	var failed *ErrMigrationFailed
+	if !errors.As(err, &failed) || failed.Version != 2 || failed.Statement != "INSERT INTO missing VALUES (1);\n" {
+		t.Fatalf("expected ErrMigrationFailed for the INSERT of version 2, got %#v", err)
+	}
+	if failed.StatementNumber != 2 || failed.Line != 3 || failed.Code != "1" {
+		t.Errorf("expected statement 2 at line 3 with code 1, got statement %d at line %d with code %q", failed.StatementNumber, failed.Line, failed.Code)
+	}
+	if !strings.Contains(err.Error(), "statement 2 of 2 at line 3") {
+		t.Errorf("expected the error to locate the statement, got %v", err)
+	}
+	if errors.As(err, new(*ErrDirtyState)) {
+		t.Error("expected a failed migration in a transaction not to be dirty")
+	}
+
+	SetStatementRedactor(func(s string) string { return strings.Replace(s, "(1)", "(?)", -1) })
+	err = Up(db, dir)
+	SetStatementRedactor(nil)
+	if !errors.As(err, &failed) || failed.Statement != "INSERT INTO missing VALUES (?);\n" || strings.Contains(err.Error(), "(1)") {
+		t.Fatalf("expected the statement to be redacted, got %v", err)
+	}
+
+	write("00002_broken.sql", "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE TABLE c (id int);\nINSERT INTO missing VALUES (1);\n-- +goose Down\n")
+	err = Up(db, dir)
+	var dirty *ErrDirtyState
+	if !errors.As(err, &dirty) || dirty.Version != 2 {
+		t.Fatalf("expected ErrDirtyState for version 2, got %v", err)
+	}
+
+	os.Remove(filepath.Join(dir, "00001_a.sql"))
+	_, err = Down(db, dir)
+	var notFound *ErrVersionNotFound
+	if !errors.As(err, &notFound) || notFound.Version != 1 {
+		t.Fatalf("expected ErrVersionNotFound for version 1, got %v", err)
+	}
+}
+
+func TestConcurrentMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	// Another process applying migration 2 while migration 1 is recorded.
+	trigger := `-- +goose Up
+-- +goose StatementBegin
+CREATE TRIGGER concurrent AFTER INSERT ON goose_db_version WHEN NEW.version_id = 1
+BEGIN
+    INSERT INTO goose_db_version (version_id, is_applied) VALUES (2, 1);
+END;
+-- +goose StatementEnd
+-- +goose Down
+DROP TRIGGER concurrent;
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_trigger.sql"), []byte(trigger), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 2, "b")
+	writeSQLMigration(t, dir, 3, "c")
+
+	err = Up(db, dir)
+	var concurrent *ErrConcurrentMigration
+	if !errors.As(err, &concurrent) || concurrent.Expected != 1 || concurrent.Actual != 2 {
+		t.Fatalf("expected ErrConcurrentMigration from 1 to 2, got %v", err)
+	}
+	if _, err := db.Exec("SELECT * FROM c"); err == nil {
+		t.Error("expected Up to stop before migration 3")
+	}
+}
+
+func TestVersionTableErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	// A version table that can't be read is not mistaken for a missing one.
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE goose_db_version (x int)"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = EnsureDBVersion(db)
+	if err == nil || errors.As(err, new(*ErrVersionTableMissing)) {
+		t.Fatalf("expected the query error of the version table, got %v", err)
+	}
+
+	// A missing version table that can't be created.
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty.db"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ro, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, "empty.db")+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	_, err = EnsureDBVersion(ro)
+	var missing *ErrVersionTableMissing
+	if !errors.As(err, &missing) || missing.Table != "goose_db_version" {
+		t.Fatalf("expected ErrVersionTableMissing, got %v", err)
+	}
+
+	pg := PostgresDialect{}
+	if !pg.isMissingTable(errors.New(`pq: relation "goose_db_version" does not exist`)) {
+		t.Error("expected a missing relation to be a missing table")
+	}
+	if pg.isMissingTable(errors.New("pq: permission denied for relation goose_db_version")) {
+		t.Error("expected a permission error not to be a missing table")
+	}
+}
@@ -0,0 +1,130 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RewriteEstimate is the estimated cost of a pending statement
+// that rewrites a whole table.
+type RewriteEstimate struct {
+	Version    int64
+	Source     string
+	Statement  string
+	Table      string
+	Bytes      int64 // table size, -1 if the dialect can't tell
+	Duration   time.Duration
+	OverBudget bool
+}
+
+func (e RewriteEstimate) String() string {
+	size := "unknown size"
+	if e.Bytes >= 0 {
+		size = fmt.Sprintf("%d bytes, ~%v", e.Bytes, e.Duration.Round(time.Second))
+	}
+	flag := ""
+	if e.OverBudget {
+		flag = " OVER BUDGET"
+	}
+	return fmt.Sprintf("%s: rewrites %s (%s)%s", filepath.Base(e.Source), e.Table, size, flag)
+}
+
+// tableSizer is implemented by dialects that can tell the size of a table.
+type tableSizer interface {
+	tableSizeQuery() string // sql query returning the size in bytes of the table given as argument
+}
+
+// SetRewriteBudget sets the table size in bytes above which
+// EstimateRewrites flags a rewrite as over budget. 0 disables the budget.
+func SetRewriteBudget(bytes int64) {
+	updateConfig(func(c *config) { c.rewriteBudget = bytes })
+}
+
+// SetRewriteThroughput sets the rewrite speed in bytes per second
+// EstimateRewrites assumes to estimate durations.
+func SetRewriteThroughput(bytesPerSecond int64) {
+	updateConfig(func(c *config) { c.rewriteThroughput = bytesPerSecond })
+}
+
+var (
+	matchAlterTable    = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:ONLY\s+)?(?:IF\s+EXISTS\s+)?([^\s(]+)\s+(.*)$`)
+	matchRewriteClause = regexp.MustCompile(`(?is)\b(ALTER\s+(COLUMN\s+)?\S+\s+(SET\s+DATA\s+)?TYPE|MODIFY|CHANGE|CONVERT\s+TO|ENGINE\s*=|ADD\s+PRIMARY\s+KEY|DROP\s+PRIMARY\s+KEY|SET\s+TABLESPACE|SET\s+(UN)?LOGGED|FORCE)\b`)
+)
+
+// rewrittenTable returns the table rewritten by the statement, if any.
+func rewrittenTable(stmt string) (string, bool) {
+	m := matchAlterTable.FindStringSubmatch(clearStatement(stmt))
+	if m == nil || !matchRewriteClause.MatchString(m[2]) {
+		return "", false
+	}
+	return strings.Trim(m[1], "`"), true
+}
+
+// EstimateRewrites looks for statements rewriting whole tables in the
+// pending SQL migrations of dir, and estimates their cost from the current
+// table sizes without applying anything.
+func EstimateRewrites(db *sql.DB, dir string) ([]RewriteEstimate, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return estimateRewrites(c, db, dir)
+}
+
+// estimateRewrites is EstimateRewrites, for callers holding runMu.
+func estimateRewrites(c *config, db *sql.DB, dir string) ([]RewriteEstimate, error) {
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(c, db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	sizer, canSize := c.dialect.(tableSizer)
+
+	var estimates []RewriteEstimate
+	for _, m := range migrations {
+		if applied[m.Version] || fileExt(m.Source) != ".sql" {
+			continue
+		}
+
+		f, err := openSQLMigration(c, m.Source, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open SQL migration file")
+		}
+		parsed, err := parseSQLMigration(c, f, true)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse SQL migration %q", filepath.Base(m.Source))
+		}
+
+		for _, stmt := range parsed.statements {
+			table, ok := rewrittenTable(stmt)
+			if !ok {
+				continue
+			}
+
+			e := RewriteEstimate{Version: m.Version, Source: m.Source, Statement: clearStatement(stmt), Table: table, Bytes: -1}
+			if canSize {
+				if err := db.QueryRow(bind(c, sizer.tableSizeQuery()), table).Scan(&e.Bytes); err != nil {
+					return nil, errors.Wrapf(err, "failed to get size of table %s", table)
+				}
+				if c.rewriteThroughput > 0 {
+					e.Duration = time.Duration(float64(e.Bytes) / float64(c.rewriteThroughput) * float64(time.Second))
+				}
+				e.OverBudget = c.rewriteBudget > 0 && e.Bytes > c.rewriteBudget
+			}
+			estimates = append(estimates, e)
+		}
+	}
+
+	return estimates, nil
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"database/sql"
 
-	"github.com/lonja/goose"
+	"github.com/lonja/goose/v4"
 )
 
 func init() {
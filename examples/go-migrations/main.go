@@ -6,7 +6,7 @@ import (
 	"log"
 	"os"
 
-	"github.com/lonja/goose"
+	"github.com/lonja/goose/v4"
 
 	// Init DB drivers.
 	_ "github.com/go-sql-driver/mysql"
@@ -0,0 +1,125 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Feature is a behavior change that can be opted into with Experimental
+// before it becomes the default.
+type Feature struct {
+	Name        string
+	Description string
+	Enabled     bool
+}
+
+type feature struct {
+	description string
+	enabled     func(c *config) bool
+	set         func(c *config, v bool)
+}
+
+var features = map[string]feature{
+	"strict-order": {
+		description: "Up fails when migrations older than the current version are not applied, instead of skipping them",
+		enabled:     func(c *config) bool { return c.strictOrder },
+		set:         func(c *config, v bool) { c.strictOrder = v },
+	},
+	"checksums": {
+		description: "record the checksums of applied SQL migrations and fail on drift, see SetVerifyChecksums",
+		enabled:     func(c *config) bool { return c.verifyChecksums },
+		set:         func(c *config, v bool) { c.verifyChecksums = v },
+	},
+	"sequential-versions": {
+		description: "number new migrations sequentially and fail on version gaps, see SetSequentialVersions",
+		enabled:     func(c *config) bool { return c.sequentialVersions },
+		set:         func(c *config, v bool) { c.sequentialVersions = v },
+	},
+	"no-fixup": {
+		description: "WithFixOrder and up-all-unapplied fix leave the version table order alone",
+		enabled:     func(c *config) bool { return c.noFixUp },
+		set:         func(c *config, v bool) { c.noFixUp = v },
+	},
+	"generate-down": {
+		description: "create fills the empty down section of SQL migrations from their up section, see GenerateDown",
+		enabled:     func(c *config) bool { return c.generateDown },
+		set:         func(c *config, v bool) { c.generateDown = v },
+	},
+}
+
+// Experimental enables or disables the named feature, see Features.
+func Experimental(name string, enabled bool) error {
+	f, err := lookupFeature(name)
+	if err != nil {
+		return err
+	}
+	updateConfig(func(c *config) { f.set(c, enabled) })
+	return nil
+}
+
+// lookupFeature returns the named feature.
+func lookupFeature(name string) (feature, error) {
+	f, ok := features[name]
+	if !ok {
+		return feature{}, fmt.Errorf("%q: unknown feature, available: %s", name, strings.Join(featureNames(), ", "))
+	}
+	return f, nil
+}
+
+// Features lists the available features by name.
+func Features() []Feature {
+	c := currentConfig()
+	return featureList(&c)
+}
+
+// featureList is Features with the configuration c.
+func featureList(c *config) []Feature {
+	var list []Feature
+	for _, name := range featureNames() {
+		f := features[name]
+		list = append(list, Feature{Name: name, Description: f.description, Enabled: f.enabled(c)})
+	}
+	return list
+}
+
+func featureNames() []string {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkStrictOrder fails if the strict-order feature is enabled and
+// migrations selected by o older than the current version are not applied.
+func checkStrictOrder(c *config, db *sql.DB, dir string, o options) error {
+	if !c.strictOrder {
+		return nil
+	}
+
+	current, err := ensureDBVersion(c, db)
+	if err != nil {
+		return err
+	}
+	pending, err := collectPending(c, db, dir)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, m := range o.selected(c, pending) {
+		if m.Version < current {
+			missing = append(missing, fmt.Sprint(m.Version))
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("migrations %s are older than the current version %d but not applied; apply them with up-all-unapplied", strings.Join(missing, ", "), current)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExperimental(t *testing.T) {
+	if err := Experimental("no-such-feature", true); err == nil {
+		t.Error("expected an error for an unknown feature")
+	}
+
+	if err := Experimental("checksums", true); err != nil {
+		t.Fatal(err)
+	}
+	defer SetVerifyChecksums(false)
+	if !currentConfig().verifyChecksums {
+		t.Error("expected the checksums feature to enable checksum verification")
+	}
+	for _, f := range Features() {
+		if f.Name == "checksums" && !f.Enabled {
+			t.Error("expected Features to report checksums as enabled")
+		}
+	}
+}
+
+func TestStrictOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "one")
+	writeSQLMigration(t, dir, 3, "three")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	writeSQLMigration(t, dir, 2, "two")
+	if err := Up(db, dir); err != nil {
+		t.Fatalf("expected the missing migration to be skipped by default: %v", err)
+	}
+
+	if err := Experimental("strict-order", true); err != nil {
+		t.Fatal(err)
+	}
+	defer Experimental("strict-order", false)
+	if err := Up(db, dir); err == nil {
+		t.Error("expected strict-order to fail on the missing migration")
+	}
+}
@@ -0,0 +1,59 @@
+package goose
+
+// WithOnlyGo makes Up, UpTo and UpAll apply the Go migrations only, e.g.
+// in the deploy stage running data migrations, leaving the other
+// migrations pending. See WithFileFilter.
+func WithOnlyGo() OptionsFunc {
+	return func(o *options) { o.filters = append(o.filters, isGoMigration) }
+}
+
+// WithOnlySQL makes Up, UpTo and UpAll apply the SQL migrations only,
+// e.g. in the deploy stage running the migrations of a directory owned by
+// DBAs, leaving the other migrations pending. See WithFileFilter.
+func WithOnlySQL() OptionsFunc {
+	return func(o *options) { o.filters = append(o.filters, isSQLMigration) }
+}
+
+// WithFileFilter makes Up, UpTo and UpAll apply the migrations whose file
+// paths fn accepts only, leaving the others pending. Filters add up: a
+// migration is applied if every filter accepts it.
+//
+// Version directories are neither Go nor SQL migrations, and are left
+// pending by WithOnlyGo and WithOnlySQL. As a migration left pending is
+// older than the current version once a later one is applied, apply the
+// migrations of the other stages with UpAll, which applies migrations
+// older than the current version too.
+func WithFileFilter(fn func(path string) bool) OptionsFunc {
+	return func(o *options) {
+		o.filters = append(o.filters, func(m *Migration) bool { return fn(m.Source) })
+	}
+}
+
+// isGoMigration reports whether m is a Go migration, which may have any
+// name if it is registered.
+func isGoMigration(m *Migration) bool {
+	return m.Registered || !m.dir && fileExt(m.Source) == ".go"
+}
+
+// isSQLMigration reports whether m is a SQL migration file.
+func isSQLMigration(m *Migration) bool {
+	return !m.Registered && !m.dir && fileExt(m.Source) == ".sql"
+}
+
+// selected returns the migrations of ms that runs with o apply: the ones
+// of its environment accepted by its filters, connected in the same order.
+func (o options) selected(c *config, ms Migrations) Migrations {
+	ms = ms.inEnvironment(c, o.env(c))
+	if len(o.filters) == 0 {
+		return ms
+	}
+
+	keep := make([]bool, len(ms))
+	for i, m := range ms {
+		keep[i] = true
+		for _, accepts := range o.filters {
+			keep[i] = keep[i] && accepts(m)
+		}
+	}
+	return ms.kept(keep)
+}
@@ -0,0 +1,99 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 3, "c")
+	writeSQLMigration(t, dir, 4, "d")
+	var ran []int64
+	AddMigrationVersion(2, "00002_backfill.go", func(tx *sql.Tx) error {
+		ran = append(ran, 2)
+		return nil
+	}, nil)
+	defer func() {
+		registryMu.Lock()
+		delete(registeredGoMigrations, 2)
+		registryMu.Unlock()
+	}()
+
+	applied := func() []int64 {
+		t.Helper()
+		versions, err := AppliedDBVersions(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for v := int64(1); v <= 4; v++ {
+			if versions[v] {
+				got = append(got, v)
+			}
+		}
+		return got
+	}
+
+	if err := Up(db, dir, WithOnlySQL(), WithFileFilter(func(path string) bool { return !strings.HasSuffix(path, "_d.sql") })); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(); !reflect.DeepEqual(got, []int64{1, 3}) || len(ran) != 0 {
+		t.Errorf("expected the SQL migrations but 4 to be applied, got %v", got)
+	}
+
+	if err := UpAll(db, dir, WithOnlyGo()); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(); !reflect.DeepEqual(got, []int64{1, 2, 3}) || !reflect.DeepEqual(ran, []int64{2}) {
+		t.Errorf("expected the Go migration to be applied, got %v", got)
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(); !reflect.DeepEqual(got, []int64{1, 2, 3, 4}) || !reflect.DeepEqual(ran, []int64{2}) {
+		t.Errorf("expected the remaining migration to be applied, got %v", got)
+	}
+
+	db2, err := sql.Open("sqlite3", filepath.Join(dir, "staged.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+	db, ran = db2, nil
+	if err := UpTo(db, dir, 3, WithOnlySQL()); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpAll(db, dir, WithOnlyGo()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(); !reflect.DeepEqual(got, []int64{1, 2, 3, 4}) || !reflect.DeepEqual(ran, []int64{2}) {
+		t.Errorf("expected every migration to be applied once after the staged runs, got %v", got)
+	}
+}
@@ -8,21 +8,22 @@ import (
 )
 
 func Fix(dir string) error {
-	migrations, err := CollectMigrations(dir, minVersion, maxVersion)
-	if err != nil {
-		return err
-	}
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return fix(c, dir)
+}
 
-	// split into timestamped and versioned migrations
-	tsMigrations, err := migrations.timestamped()
+// fix is Fix, for callers holding runMu.
+func fix(c *config, dir string) error {
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
 	if err != nil {
 		return err
 	}
 
-	vMigrations, err := migrations.versioned()
-	if err != nil {
-		return err
-	}
+	// split into timestamped and versioned migrations
+	tsMigrations := migrations.Timestamped()
+	vMigrations := migrations.Versioned()
 	// Initial version.
 	version := int64(1)
 	if last, err := vMigrations.Last(); err == nil {
@@ -37,8 +38,7 @@ func Fix(dir string) error {
 		if err := os.Rename(oldPath, newPath); err != nil {
 			return err
 		}
-
-		log.Printf("RENAMED %s => %s", filepath.Base(oldPath), filepath.Base(newPath))
+		c.logger.Printf("RENAMED %s => %s", filepath.Base(oldPath), filepath.Base(newPath))
 		version++
 	}
 
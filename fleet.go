@@ -0,0 +1,162 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFleetAborted is reported for shards that were not migrated because
+// another shard failed and the fleet run stopped.
+var ErrFleetAborted = errors.New("fleet run aborted after a failure")
+
+// Shard is a database migrated by RunFleet.
+type Shard struct {
+	Name string // used in the report, defaults to the shard index
+	DSN  string
+}
+
+// FleetOptions configures RunFleet.
+type FleetOptions struct {
+	// Parallelism is the number of shards migrated at once. Defaults to 1.
+	Parallelism int
+	// ContinueOnError keeps migrating the remaining shards after a failure
+	// instead of stopping at the first one.
+	ContinueOnError bool
+}
+
+// ShardResult is the outcome of a fleet command on a single shard.
+type ShardResult struct {
+	Shard    string
+	Version  int64 // DB version after the command, -1 if unknown
+	Duration time.Duration
+	Err      error
+}
+
+// FleetReport aggregates the results of a fleet run in shard order.
+type FleetReport struct {
+	Results []ShardResult
+}
+
+// Failed returns the results of the shards that failed or were skipped.
+func (r *FleetReport) Failed() []ShardResult {
+	var failed []ShardResult
+	for _, res := range r.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+func (r *FleetReport) String() string {
+	var b strings.Builder
+	for _, res := range r.Results {
+		status := "OK"
+		if res.Err == ErrFleetAborted {
+			status = "SKIPPED"
+		} else if res.Err != nil {
+			status = "FAILED"
+		}
+		fmt.Fprintf(&b, "%-8s %-20s version %-16d %v", status, res.Shard, res.Version, res.Duration.Round(time.Millisecond))
+		if res.Err != nil && res.Err != ErrFleetAborted {
+			fmt.Fprintf(&b, " -- %v", res.Err)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d of %d shards migrated\n", len(r.Results)-len(r.Failed()), len(r.Results))
+	return b.String()
+}
+
+// RunFleet runs a goose command with the migrations in dir against every
+// shard, opening each with the given database/sql driver. It returns a
+// report with the outcome of every shard, and an error if any shard failed.
+func RunFleet(driver string, shards []Shard, opts FleetOptions, command, dir string, args ...string) (*FleetReport, error) {
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	report := &FleetReport{Results: make([]ShardResult, len(shards))}
+	for i, shard := range shards {
+		name := shard.Name
+		if name == "" {
+			name = fmt.Sprintf("shard-%d", i)
+		}
+		report.Results[i] = ShardResult{Shard: name, Version: -1, Err: ErrFleetAborted}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		aborted bool
+		work    = make(chan int)
+	)
+
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				mu.Lock()
+				stop := aborted
+				mu.Unlock()
+				if stop {
+					continue
+				}
+
+				res := migrateShard(driver, shards[i].DSN, command, dir, args...)
+				res.Shard = report.Results[i].Shard
+
+				mu.Lock()
+				report.Results[i] = res
+				if res.Err != nil && !opts.ContinueOnError {
+					aborted = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range shards {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if failed := report.Failed(); len(failed) > 0 {
+		return report, fmt.Errorf("%d of %d shards failed, first: %s: %v", len(failed), len(shards), failed[0].Shard, failed[0].Err)
+	}
+
+	return report, nil
+}
+
+func migrateShard(driver, dsn, command, dir string, args ...string) ShardResult {
+	start := time.Now()
+	res := ShardResult{Version: -1}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		res.Err = errors.Wrap(err, "failed to connect")
+		res.Duration = time.Since(start)
+		return res
+	}
+
+	res.Err = Run(command, db, dir, args...)
+	if res.Err == nil {
+		res.Version, res.Err = GetDBVersion(db)
+	}
+	res.Duration = time.Since(start)
+
+	return res
+}
@@ -0,0 +1,54 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunFleet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	shards := []Shard{
+		{Name: "a", DSN: filepath.Join(dir, "a.db")},
+		{Name: "broken", DSN: filepath.Join(dir, "missing", "b.db")},
+		{Name: "c", DSN: filepath.Join(dir, "c.db")},
+	}
+
+	report, err := RunFleet("sqlite3", shards, FleetOptions{Parallelism: 2, ContinueOnError: true}, "up", "examples/sql-migrations")
+	if err == nil {
+		t.Fatal("expected fleet error")
+	}
+	for _, res := range report.Results {
+		switch res.Shard {
+		case "broken":
+			if res.Err == nil || res.Err == ErrFleetAborted {
+				t.Errorf("expected connection error for shard %s, got %v", res.Shard, res.Err)
+			}
+		default:
+			if res.Err != nil || res.Version != 3 {
+				t.Errorf("shard %s: got version %v and error %v, want version 3", res.Shard, res.Version, res.Err)
+			}
+		}
+	}
+
+	// Stop on the first failure.
+	report, err = RunFleet("sqlite3", shards[1:], FleetOptions{}, "version", "examples/sql-migrations")
+	if err == nil {
+		t.Fatal("expected fleet error")
+	}
+	if res := report.Results[1]; res.Err != ErrFleetAborted {
+		t.Errorf("expected shard %s to be skipped, got %v", res.Shard, res.Err)
+	}
+	t.Log("\n" + report.String())
+}
@@ -0,0 +1,163 @@
+package goose
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Statements returns a Go migration function executing the statements in
+// order. It is used by the code GenerateGo writes.
+func Statements(statements ...string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, query := range statements {
+			if _, err := tx.Exec(query); err != nil {
+				return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(query))
+			}
+		}
+		return nil
+	}
+}
+
+// GenerateGo writes Go source registering the SQL migrations of dir as Go
+// migrations of package pkg, so a binary can be migrated without reading
+// any migration file at runtime:
+//
+//	//go:generate goose -dir ../sql generate-go migrations.go migrations
+//
+// The generated migrations keep the versions and names of the SQL files,
+// with a .go extension. Only register them in binaries run against a
+// directory without the SQL files, e.g. "."; otherwise both would be
+// collected under the same version.
+//
+// Migrations annotated with NO TRANSACTION, FOREIGN KEYS OFF, TIMEOUT,
+// COPY, LOADDATA or ONLY IF, and version directories, can't be expressed as Go
+// migrations and make GenerateGo fail.
+func GenerateGo(w io.Writer, dir, pkg string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+
+	sqlFiles, _, dirs, err := migrationFiles(c, dir)
+	if err != nil {
+		return err
+	}
+	if len(dirs) > 0 {
+		return errors.Errorf("%s: version directories are not supported by Go migrations", filepath.Base(dirs[0]))
+	}
+
+	type generated struct {
+		version  int64
+		name     string
+		up, down []string
+	}
+	var migrations []generated
+
+	for _, file := range sqlFiles {
+		v, err := parseVersion(c, file)
+		if err != nil {
+			continue // Skip any files that don't have version prefix.
+		}
+		up, err := generatedStatements(c, file, true)
+		if err != nil {
+			return err
+		}
+		down, err := generatedStatements(c, file, false)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), upSQLSuffix), ".sql") + ".go"
+		migrations = append(migrations, generated{version: v, name: name, up: up, down: down})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by goose generate-go from %s; DO NOT EDIT.\n\n", filepath.ToSlash(dir))
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	buf.WriteString("import \"github.com/lonja/goose/v4\"\n\n")
+	buf.WriteString("func init() {\n")
+	for _, m := range migrations {
+		fmt.Fprintf(&buf, "goose.AddNamedMigration(%q,\n", m.name)
+		writeStatements(&buf, m.up)
+		writeStatements(&buf, m.down)
+		buf.WriteString(")\n")
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "failed to format generated code")
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// generatedStatements parses the statements of a SQL migration for a Go
+// migration.
+func generatedStatements(c *config, file string, direction bool) ([]string, error) {
+	f, err := openSQLMigration(c, file, direction)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open SQL migration file %q", filepath.Base(file))
+	}
+	defer f.Close()
+
+	parsed, err := parseSQLMigration(c, f, direction)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse SQL migration file %q", filepath.Base(file))
+	}
+
+	if unsupported := unsupportedInGo(parsed); unsupported != "" {
+		return nil, errors.Errorf("%s: the %s annotation is not supported by Go migrations", filepath.Base(file), unsupported)
+	}
+
+	return parsed.statements, nil
+}
+
+// unsupportedInGo returns the annotation of a parsed SQL migration that
+// can't be expressed as a Go migration, if any.
+func unsupportedInGo(parsed *parsedSQL) string {
+	switch {
+	case !parsed.useTx:
+		return "NO TRANSACTION"
+	case parsed.foreignKeysOff:
+		return "FOREIGN KEYS OFF"
+	case parsed.timeout > 0:
+		return "TIMEOUT"
+	case parsed.copyBlocks > 0:
+		return "COPY"
+	case parsed.loads > 0:
+		return "LOADDATA"
+	case len(parsed.guards) > 0:
+		return "ONLY IF"
+	}
+	return ""
+}
+
+// writeStatements writes a goose.Statements call, with raw string literals
+// unless a statement contains backquotes or carriage returns.
+func writeStatements(buf *bytes.Buffer, statements []string) {
+	cleaned := stripAnnotations(statements)
+	if len(cleaned) == 0 {
+		buf.WriteString("goose.Statements(),\n")
+		return
+	}
+
+	buf.WriteString("goose.Statements(\n")
+	for _, s := range cleaned {
+		if strings.ContainsAny(s, "`\r") {
+			buf.WriteString(strconv.Quote(s))
+		} else {
+			buf.WriteString("`" + s + "`")
+		}
+		buf.WriteString(",\n")
+	}
+	buf.WriteString("),\n")
+}
@@ -0,0 +1,91 @@
+package goose
+
+import (
+	"bytes"
+	"database/sql"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00001_users.sql":    "-- +goose Up\nCREATE TABLE `users` (id int);\nINSERT INTO users VALUES (1);\n\n-- +goose Down\nDROP TABLE users;\n",
+		"00002_posts.up.sql": "CREATE TABLE posts (id int);\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := GenerateGo(&buf, dir, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "migrations.go", src, 0); err != nil {
+		t.Fatalf("generated code doesn't parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"package migrations",
+		`goose.AddNamedMigration("00001_users.go",`,
+		`"CREATE TABLE ` + "`users`" + ` (id int);"`,
+		"`INSERT INTO users VALUES (1);`",
+		"`DROP TABLE users;`",
+		`goose.AddNamedMigration("00002_posts.go",`,
+		"`CREATE TABLE posts (id int);`",
+		"goose.Statements(),",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code doesn't contain %s:\n%s", want, src)
+		}
+	}
+
+	noTx := "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY i ON users (id);\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00003_index.sql"), []byte(noTx), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = GenerateGo(&buf, dir, "migrations")
+	if err == nil || !strings.Contains(err.Error(), "NO TRANSACTION") {
+		t.Errorf("expected NO TRANSACTION to be rejected, got %v", err)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	up := Statements("CREATE TABLE users (id int);", "INSERT INTO users VALUES (1);")
+	if err := up(tx); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := tx.QueryRow("SELECT count(*) FROM users").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected 1 user, got %d (%v)", n, err)
+	}
+
+	if err := Statements("INSERT INTO missing VALUES (1);")(tx); err == nil {
+		t.Error("expected an error for a missing table")
+	}
+}
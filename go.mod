@@ -1,12 +1,12 @@
-module github.com/lonja/goose
+module github.com/lonja/goose/v4
 
-go 1.12
+go 1.13
 
 require (
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/lib/pq v1.0.0
 	github.com/mattn/go-sqlite3 v1.10.0
-	github.com/pkg/errors v0.8.1
+	github.com/pkg/errors v0.9.1
 	github.com/ziutek/mymysql v1.5.4
 	google.golang.org/appengine v1.4.0 // indirect
 )
@@ -7,30 +7,39 @@ import (
 	"sync"
 )
 
-const VERSION = "v2.6.0"
+const VERSION = "v4.0.0"
 
 var (
 	duplicateCheckOnce sync.Once
-	minVersion         = int64(0)
-	maxVersion         = int64((1 << 63) - 1)
-	timestampFormat    = "20060102150405"
-	verbose            = false
 )
 
-// SetVerbose set the goose verbosity mode
+// SetVerbose set the goose verbosity mode: VerbosityVerbose if v is set,
+// VerbosityNormal otherwise.
 func SetVerbose(v bool) {
-	verbose = v
+	if v {
+		SetVerbosity(VerbosityVerbose)
+	} else {
+		SetVerbosity(VerbosityNormal)
+	}
 }
 
 // Run runs a goose command.
 func Run(command string, db *sql.DB, dir string, args ...string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return run(c, command, db, dir, args...)
+}
+
+// run is Run, for callers holding runMu.
+func run(c *config, command string, db *sql.DB, dir string, args ...string) error {
 	switch command {
 	case "up":
-		if err := Up(db, dir); err != nil {
+		if err := upTo(c, db, dir, MaxVersion, applyOptions(nil)); err != nil {
 			return err
 		}
 	case "up-by-one":
-		if err := UpByOne(db, dir); err != nil {
+		if _, err := upByOne(c, db, dir, applyOptions(nil)); err != nil {
 			return err
 		}
 	case "up-to":
@@ -42,18 +51,25 @@ func Run(command string, db *sql.DB, dir string, args ...string) error {
 		if err != nil {
 			return fmt.Errorf("version must be a number (got '%s')", args[0])
 		}
-		if err := UpTo(db, dir, version); err != nil {
+		if err := upTo(c, db, dir, version, applyOptions(nil)); err != nil {
 			return err
 		}
 	case "up-all-unapplied":
-		var err error
-		err = UpAll(db, dir)
-		if args[0] == "fix" {
-			if err := fixUp(db); err != nil {
-				return err
-			}
+		var opts []OptionsFunc
+		if len(args) > 0 && args[0] == "fix" {
+			opts = append(opts, WithFixOrder())
 		}
-		if err != nil {
+		if _, err := upAllWithResult(c, db, dir, applyOptions(opts)); err != nil {
+			return err
+		}
+	case "watch":
+		if err := watch(db, dir, nil, func() (*config, func()) { return c, func() {} }); err != nil {
+			return err
+		}
+	case "config":
+		printConfig(c, dir)
+	case "accept-drift":
+		if err := acceptDrift(c, db, dir); err != nil {
 			return err
 		}
 	case "create":
@@ -65,11 +81,15 @@ func Run(command string, db *sql.DB, dir string, args ...string) error {
 		if len(args) == 2 {
 			migrationType = args[1]
 		}
-		if err := Create(db, dir, args[0], migrationType); err != nil {
+		if err := create(c, db, dir, args[0], migrationType); err != nil {
 			return err
 		}
 	case "down":
-		if err := Down(db, dir); err != nil {
+		if _, err := down(c, db, dir, applyOptions(nil)); err != nil {
+			return err
+		}
+	case "down-all":
+		if err := downAll(c, db, dir); err != nil {
 			return err
 		}
 	case "down-to":
@@ -81,29 +101,115 @@ func Run(command string, db *sql.DB, dir string, args ...string) error {
 		if err != nil {
 			return fmt.Errorf("version must be a number (got '%s')", args[0])
 		}
-		if err := DownTo(db, dir, version); err != nil {
+		if err := downTo(c, db, dir, version); err != nil {
+			return err
+		}
+	case "mark-applied", "mark-unapplied":
+		if len(args) == 0 {
+			return fmt.Errorf("%s must be of form: goose [OPTIONS] DRIVER DBSTRING %s VERSION", command, command)
+		}
+
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("version must be a number (got '%s')", args[0])
+		}
+		mark := markApplied
+		if command == "mark-unapplied" {
+			mark = markUnapplied
+		}
+		if err := mark(c, db, dir, version); err != nil {
+			return err
+		}
+	case "resolve":
+		if len(args) == 0 || (args[0] != "applied" && args[0] != "unapplied") {
+			return fmt.Errorf("resolve must be of form: goose [OPTIONS] DRIVER DBSTRING resolve applied|unapplied")
+		}
+		if err := resolve(c, db, dir, args[0] == "applied"); err != nil {
 			return err
 		}
+	case "estimate":
+		estimates, err := estimateRewrites(c, db, dir)
+		if err != nil {
+			return err
+		}
+		over := 0
+		for _, e := range estimates {
+			c.logger.Println(e)
+			if e.OverBudget {
+				over++
+			}
+		}
+		if over > 0 {
+			return fmt.Errorf("%d table rewrites over budget need approval", over)
+		}
 	case "fix":
-		if err := Fix(dir); err != nil {
+		if err := fix(c, dir); err != nil {
+			return err
+		}
+	case "import-flyway":
+		table := ""
+		if len(args) > 0 {
+			table = args[0]
+		}
+		if _, err := importFlyway(c, db, table); err != nil {
 			return err
 		}
+	case "import-migrate":
+		table := ""
+		if len(args) > 0 {
+			table = args[0]
+		}
+		if _, err := importMigrate(c, db, dir, table); err != nil {
+			return err
+		}
+	case "rename-flyway":
+		if err := renameFlywayMigrations(c, dir); err != nil {
+			return err
+		}
+	case "validate":
+		problems, err := validate(c, dir)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			c.logger.Println(p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d problems found", len(problems))
+		}
+	case "check-registrations":
+		problems, err := checkRegistrations(c, dir)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			c.logger.Println(p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d Go migrations not registered", len(problems))
+		}
 	case "redo":
-		if err := Redo(db, dir); err != nil {
+		if err := redo(c, db, dir, applyOptions(nil)); err != nil {
 			return err
 		}
 	case "reset":
-		if err := Reset(db, dir); err != nil {
+		if err := reset(c, db, dir, applyOptions(nil)); err != nil {
 			return err
 		}
 	case "status":
-		if err := Status(db, dir); err != nil {
+		if err := status(c, db, dir); err != nil {
 			return err
 		}
 	case "version":
-		if err := Version(db, dir); err != nil {
+		if err := printVersion(c, db, dir); err != nil {
+			return err
+		}
+	case "versions":
+		dbVersion, fileVersion, err := dbAndFileVersions(c, db, dir)
+		if err != nil {
 			return err
 		}
+		c.logger.Printf("goose: version %d, latest migration %d\n", dbVersion, fileVersion)
 	default:
 		return fmt.Errorf("%q: no such command", command)
 	}
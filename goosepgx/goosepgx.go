@@ -0,0 +1,62 @@
+// Package goosepgx runs goose migrations over pgx connection pools.
+//
+// Migrations run on a *sql.DB sharing the connections of the pool of the
+// application, instead of a second pool opened for them, and load the
+// data of '-- +goose COPY' blocks with the COPY protocol of pgx:
+//
+//	db := goosepgx.OpenDB(pool)
+//	goose.SetCopier(goosepgx.Copy)
+//	goose.SetResultHandler(goosepgx.Notify(pool, "goose"))
+//	err := goose.Up(db, "migrations")
+package goosepgx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lonja/goose/v4"
+)
+
+// OpenDB returns a *sql.DB using the connections of pool. Closing it
+// leaves the pool open.
+func OpenDB(pool *pgxpool.Pool) *sql.DB {
+	return stdlib.OpenDBFromPool(pool)
+}
+
+// Copy is a goose.Copier running COPY ... FROM STDIN on a pgx connection,
+// within the transaction of the migration.
+func Copy(ctx context.Context, driverConn interface{}, statement string, data io.Reader) (int64, error) {
+	conn, ok := driverConn.(*stdlib.Conn)
+	if !ok {
+		return 0, fmt.Errorf("goosepgx: %T is not a pgx connection, open the database with OpenDB", driverConn)
+	}
+
+	tag, err := conn.Conn().PgConn().CopyFrom(ctx, data, statement)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Notify returns a result handler, see goose.SetResultHandler, sending a
+// notification on channel of pool for each migration applied or rolled
+// back, so other sessions can follow the progress with LISTEN. The
+// payload is "up" or "down", the version and the name of the migration
+// separated by spaces, e.g. "up 3 00003_add_users.sql".
+func Notify(pool *pgxpool.Pool, channel string) func(*goose.MigrationResult) {
+	return func(r *goose.MigrationResult) {
+		direction := "down"
+		if r.Direction {
+			direction = "up"
+		}
+		payload := fmt.Sprintf("%s %d %s", direction, r.Migration.Version, filepath.Base(r.Migration.Source))
+		// Progress is best effort: a failed notification doesn't fail the
+		// migration, which is already committed.
+		pool.Exec(context.Background(), "SELECT pg_notify($1, $2)", channel, payload)
+	}
+}
@@ -0,0 +1,13 @@
+package goosepgx
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCopyNeedsPgx(t *testing.T) {
+	if _, err := Copy(context.Background(), struct{}{}, "COPY users FROM STDIN", strings.NewReader("")); err == nil {
+		t.Error("expected Copy to fail on a connection of another driver")
+	}
+}
@@ -0,0 +1,158 @@
+package goosetest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lonja/goose/v4"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// FakeDB is a database for unit testing code that calls goose, like the
+// boot sequence of an application running goose.Up at startup, without a
+// real database:
+//
+//	db := goosetest.NewFakeDB(t)
+//	defer db.Close()
+//	db.FailOn("CREATE INDEX", errors.New("disk full"))
+//	if err := app.Boot(db.DB); err == nil { ... }
+//
+// The tables of goose live in an in-memory SQLite database, so versions are
+// recorded and read as usual, while the statements of the migrations are
+// only recorded, see Statements. Queries, including the ONLY IF conditions
+// of migrations, run against the SQLite database. As goose writes its
+// tables with the sqlite3 dialect, the code under test must not set
+// another dialect.
+type FakeDB struct {
+	*sql.DB
+
+	mu         sync.Mutex
+	statements []string
+	failures   []failure
+}
+
+// failure makes the statements containing substr fail with err.
+type failure struct {
+	substr string
+	err    error
+}
+
+var fakeDBs int64
+
+// NewFakeDB returns a fresh fake database, with the goose version table
+// created, and sets the goose dialect to sqlite3 until the test is done.
+// Seed it with goose.MarkApplied to start from a migrated state.
+func NewFakeDB(t testing.TB) *FakeDB {
+	t.Helper()
+
+	f := &FakeDB{}
+	dsn := fmt.Sprintf("file:goosefake%d?mode=memory&cache=shared", atomic.AddInt64(&fakeDBs, 1))
+	f.DB = sql.OpenDB(fakeConnector{dsn: dsn, db: f})
+
+	restore, err := goose.SwapDialect("sqlite3")
+	if err != nil {
+		f.Close()
+		t.Fatalf("goosetest: %v", err)
+	}
+	t.Cleanup(restore)
+	if _, err := goose.EnsureDBVersion(f.DB); err != nil {
+		f.Close()
+		t.Fatalf("goosetest: failed to create version table: %v", err)
+	}
+
+	return f
+}
+
+// Statements returns the statements of migrations executed so far, in
+// order, including the ones of rolled back transactions.
+func (f *FakeDB) Statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.statements...)
+}
+
+// FailOn makes the statements of migrations containing substr fail with
+// err, e.g. to test how the code under test handles a failed migration.
+func (f *FakeDB) FailOn(substr string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, failure{substr: substr, err: err})
+}
+
+// exec records a statement of a migration, or fails it as set with FailOn.
+func (f *FakeDB) exec(query string) (driver.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, fail := range f.failures {
+		if strings.Contains(query, fail.substr) {
+			return nil, fail.err
+		}
+	}
+	f.statements = append(f.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+// bookkeeping reports whether query is one of goose on its own tables,
+// which all start with the name of the version table, or on SQLite itself.
+func bookkeeping(query string) bool {
+	table := goose.TableName()
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	q := strings.ToLower(query)
+	return strings.Contains(q, strings.ToLower(table)) ||
+		strings.Contains(q, "sqlite_master") ||
+		strings.HasPrefix(strings.TrimSpace(q), "pragma")
+}
+
+// fakeConnector connects to the SQLite database of a FakeDB.
+type fakeConnector struct {
+	dsn string
+	db  *FakeDB
+}
+
+func (c fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := (&sqlite3.SQLiteDriver{}).Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeConn{Conn: conn, db: c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+// fakeDriver is the driver of FakeDB, which can only be opened with
+// NewFakeDB.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("goosetest: open a fake database with NewFakeDB")
+}
+
+// fakeConn runs the statements of goose on SQLite and records the others.
+type fakeConn struct {
+	driver.Conn
+	db *FakeDB
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if bookkeeping(query) {
+		return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	}
+	return c.db.exec(query)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
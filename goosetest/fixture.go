@@ -0,0 +1,113 @@
+package goosetest
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lonja/goose/v4"
+)
+
+// Fixture applies migrations to a database once and gives every test a
+// transaction rolled back when the test is done, so tests start from the
+// migrated state without re-migrating:
+//
+//	var fixture *goosetest.Fixture
+//
+//	func TestMain(m *testing.M) { ... fixture = goosetest.NewFixture(db, "migrations") ... }
+//
+//	func TestUsers(t *testing.T) {
+//		tx, done := fixture.Begin(t)
+//		defer done()
+//		...
+//	}
+type Fixture struct {
+	db  *sql.DB
+	dir string
+
+	mu      sync.Mutex
+	version int64 // version the migrations were applied to, 0 before
+}
+
+// NewFixture returns a fixture applying the migrations of dir to db.
+// Migrations are applied by the first call to Begin.
+func NewFixture(db *sql.DB, dir string) *Fixture {
+	return &Fixture{db: db, dir: dir}
+}
+
+// Begin makes sure the migrations are applied and begins a transaction
+// for the test. Call done, usually deferred, to roll it back.
+//
+// If the version recorded by goose changed since the migrations were
+// applied, e.g. because a test rolled some back outside of its transaction,
+// they are applied again.
+func (f *Fixture) Begin(t testing.TB) (tx *sql.Tx, done func()) {
+	t.Helper()
+
+	if err := f.migrate(); err != nil {
+		t.Fatalf("goosetest: failed to migrate: %v", err)
+	}
+
+	tx, err := f.db.Begin()
+	if err != nil {
+		t.Fatalf("goosetest: failed to begin transaction: %v", err)
+	}
+
+	return tx, func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			t.Errorf("goosetest: failed to roll back: %v", err)
+		}
+	}
+}
+
+func (f *Fixture) migrate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := goose.NewProvider(f.db, f.dir)
+	if err != nil {
+		return err
+	}
+
+	if f.version != 0 {
+		current, err := p.GetDBVersion()
+		if err != nil {
+			return err
+		}
+		if current == f.version {
+			return nil
+		}
+	}
+
+	if err := p.Up(); err != nil {
+		return err
+	}
+	version, err := p.GetDBVersion()
+	if err != nil {
+		return err
+	}
+	f.version = version
+
+	return nil
+}
+
+var savepoints int64
+
+// Savepoint creates a savepoint in tx and returns a function rolling tx
+// back to it, to reset the state within a test.
+func Savepoint(t testing.TB, tx *sql.Tx) (rollback func()) {
+	t.Helper()
+
+	name := fmt.Sprintf("goosetest_%d", atomic.AddInt64(&savepoints, 1))
+	if _, err := tx.Exec("SAVEPOINT " + name); err != nil {
+		t.Fatalf("goosetest: failed to create savepoint: %v", err)
+	}
+
+	return func() {
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT " + name); err != nil {
+			t.Errorf("goosetest: failed to roll back to savepoint: %v", err)
+		}
+	}
+}
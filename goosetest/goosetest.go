@@ -0,0 +1,45 @@
+// Package goosetest provides helpers for unit testing migrations
+// without any external database.
+package goosetest
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lonja/goose/v4"
+
+	// Init DB driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var memoryDBs int64
+
+// NewMemoryDB returns a fresh in-memory SQLite database with the goose
+// version table created, and sets the goose dialect to sqlite3 until the
+// test is done. The database is dropped when it is closed.
+func NewMemoryDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	// A shared cache lets every connection of the pool see the same
+	// database, which lives as long as one of them is open.
+	dsn := fmt.Sprintf("file:goosetest%d?mode=memory&cache=shared", atomic.AddInt64(&memoryDBs, 1))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("goosetest: failed to open database: %v", err)
+	}
+
+	restore, err := goose.SwapDialect("sqlite3")
+	if err != nil {
+		db.Close()
+		t.Fatalf("goosetest: %v", err)
+	}
+	t.Cleanup(restore)
+	if _, err := goose.EnsureDBVersion(db); err != nil {
+		db.Close()
+		t.Fatalf("goosetest: failed to create version table: %v", err)
+	}
+
+	return db
+}
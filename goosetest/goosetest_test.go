@@ -0,0 +1,144 @@
+package goosetest
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/lonja/goose/v4"
+	"github.com/pkg/errors"
+)
+
+func TestNewMemoryDB(t *testing.T) {
+	db := NewMemoryDB(t)
+	defer db.Close()
+
+	if err := goose.Up(db, "../examples/sql-migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := goose.GetDBVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Errorf("incorrect version. got %v, want 3", version)
+	}
+
+	var username string
+	if err := db.QueryRow("SELECT username FROM users WHERE id = 0").Scan(&username); err != nil {
+		t.Fatal(err)
+	}
+	if username != "admin" {
+		t.Errorf("incorrect username. got %q, want %q", username, "admin")
+	}
+
+	// Every database starts out empty.
+	other := NewMemoryDB(t)
+	defer other.Close()
+
+	version, err = goose.GetDBVersion(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Errorf("incorrect version of a fresh database. got %v, want 0", version)
+	}
+}
+
+func TestFixture(t *testing.T) {
+	db := NewMemoryDB(t)
+	defer db.Close()
+
+	fixture := NewFixture(db, "../examples/sql-migrations")
+
+	countUsers := func(tx *sql.Tx) int {
+		t.Helper()
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	for i := 0; i < 2; i++ {
+		tx, done := fixture.Begin(t)
+		if n := countUsers(tx); n != 2 {
+			t.Errorf("run %d: expected the migrated state, got %d users", i, n)
+		}
+		if _, err := tx.Exec("INSERT INTO users (id, username, name, surname) VALUES (2, 'user', 'a', 'b')"); err != nil {
+			t.Fatal(err)
+		}
+
+		rollback := Savepoint(t, tx)
+		if _, err := tx.Exec("DELETE FROM users"); err != nil {
+			t.Fatal(err)
+		}
+		rollback()
+		if n := countUsers(tx); n != 3 {
+			t.Errorf("run %d: expected the savepoint state, got %d users", i, n)
+		}
+		done()
+	}
+
+	// Rolling back outside of a test transaction makes Begin migrate again.
+	if _, err := goose.Down(db, "../examples/sql-migrations"); err != nil {
+		t.Fatal(err)
+	}
+	tx, done := fixture.Begin(t)
+	defer done()
+	if v, err := goose.GetDBVersion(db); err != nil || v != 3 {
+		t.Errorf("expected version 3 again, got %d (%v)", v, err)
+	}
+	countUsers(tx)
+}
+
+func TestFakeDB(t *testing.T) {
+	db := NewFakeDB(t)
+	defer db.Close()
+
+	if err := goose.Up(db.DB, "../examples/sql-migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := goose.GetDBVersion(db.DB); err != nil || v != 3 {
+		t.Errorf("expected version 3, got %d (%v)", v, err)
+	}
+	statements := db.Statements()
+	if len(statements) != 4 || !strings.Contains(statements[0], "CREATE TABLE users") {
+		t.Errorf("expected the 4 statements of the migrations to be recorded, got %q", statements)
+	}
+	if _, err := db.Query("SELECT * FROM users"); err == nil {
+		t.Error("expected the statements of the migrations not to run")
+	}
+
+	// A failing statement fails the migration.
+	other := NewFakeDB(t)
+	defer other.Close()
+	if err := goose.MarkApplied(other.DB, "../examples/sql-migrations", 1); err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	other.FailOn("UPDATE users", boom)
+	err := goose.Up(other.DB, "../examples/sql-migrations")
+	var failed *goose.ErrMigrationFailed
+	if !errors.As(err, &failed) || failed.Version != 2 || errors.Cause(err) != boom {
+		t.Fatalf("expected migration 2 to fail with boom, got %v", err)
+	}
+	if v, err := goose.GetDBVersion(other.DB); err != nil || v != 1 {
+		t.Errorf("expected version 1, got %d (%v)", v, err)
+	}
+}
+
+func TestRestoresDialect(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		db := NewMemoryDB(t)
+		defer db.Close()
+	})
+	t.Run("fake", func(t *testing.T) {
+		db := NewFakeDB(t)
+		defer db.Close()
+	})
+	if _, ok := goose.GetDialect().(*goose.PostgresDialect); !ok {
+		t.Errorf("expected the dialect to be restored once the tests are done, got %T", goose.GetDialect())
+	}
+}
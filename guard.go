@@ -0,0 +1,54 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// errGuardSkipped is returned by migrations skipped by their guard and
+// left pending, see SetRetrySkipped.
+var errGuardSkipped = errors.New("migration skipped by its ONLY IF guard")
+
+// SetRetrySkipped sets whether SQL migrations skipped because the query of
+// their '-- +goose ONLY IF' annotation returned false are left pending, so
+// they run once the condition holds, e.g. after an optional extension is
+// installed, instead of being recorded as applied. As later migrations
+// move the version past them, pending skipped migrations are only retried
+// by up-all-unapplied.
+func SetRetrySkipped(retry bool) {
+	updateConfig(func(c *config) { c.retrySkipped = retry })
+}
+
+// checkGuards runs the queries of the '-- +goose ONLY IF' annotations of a
+// migration, and reports whether they all returned true:
+//
+//	-- +goose ONLY IF SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'postgis')
+//
+// A NULL result counts as false.
+func checkGuards(ctx context.Context, c *config, db *sql.DB, guards []string) (bool, error) {
+	for _, guard := range guards {
+		var ok sql.NullBool
+		if err := db.QueryRowContext(ctx, guard).Scan(&ok); err != nil {
+			return false, errors.Wrapf(err, "failed to check condition %q", guard)
+		}
+		if !ok.Bool {
+			printInfo(c, "Condition %q is false\n", guard)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// skipGuarded skips m, as its guard is false. It is recorded as applied
+// or rolled back without running, unless SetRetrySkipped leaves skipped
+// migrations pending; rollbacks are always recorded.
+func skipGuarded(c *config, db *sql.DB, m *Migration, direction bool) error {
+	printProgress(c, "SKIPPED %s\n", filepath.Base(m.Source))
+	if direction && c.retrySkipped {
+		return errGuardSkipped
+	}
+	return recordVersion(c, db, m, direction)
+}
@@ -0,0 +1,73 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOnlyIf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	guarded := "-- +goose ONLY IF SELECT count(*) > 0 FROM sqlite_master WHERE name = 'extension'\n" +
+		"-- +goose Up\nCREATE TABLE uses_extension (id int);\n-- +goose Down\nDROP TABLE uses_extension;\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_guarded.sql"), []byte(guarded), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 2, "b")
+
+	// Skipped migrations are recorded as applied.
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT * FROM uses_extension"); err == nil {
+		t.Error("expected the guarded migration to be skipped")
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Fatalf("expected version 2, got %d, %v", v, err)
+	}
+	if err := DownTo(db, dir, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Skipped migrations left pending run once the condition holds.
+	SetRetrySkipped(true)
+	defer SetRetrySkipped(false)
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := AppliedDBVersions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied[1] || !applied[2] {
+		t.Fatalf("expected only 2 to be applied, got %v", applied)
+	}
+
+	if _, err := db.Exec("CREATE TABLE extension (id int)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT * FROM uses_extension"); err != nil {
+		t.Errorf("expected the guarded migration to run, got %v", err)
+	}
+}
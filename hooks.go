@@ -0,0 +1,143 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	preHookFile  = "_pre.sql"
+	postHookFile = "_post.sql"
+)
+
+// SetHookScripts sets the SQL scripts run before the first and after the
+// last migration of each Up, Down, Redo or Reset call that runs any
+// migration. By default, these are the _pre.sql and _post.sql files of
+// the migrations directory, if they exist; an empty path restores the
+// default.
+//
+// Hook scripts are plain SQL, run in a transaction of their own and not
+// recorded, e.g. to refresh materialized views after schema changes. They
+// run on a connection set up as the ones of the migrations, with the
+// connection hook and the session variables, and their transaction has the
+// lock and statement timeouts of the migrations. Annotate them with
+// '-- +goose NO TRANSACTION' for statements that can't run in a
+// transaction.
+func SetHookScripts(pre, post string) {
+	updateConfig(func(c *config) { c.preHook, c.postHook = pre, post })
+}
+
+// isHookScript reports whether the file of the migrations directory dir is
+// a configured or default hook script, which is not a migration.
+func isHookScript(c *config, path, dir string) bool {
+	for _, hook := range []string{c.preHook, c.postHook, filepath.Join(dir, preHookFile), filepath.Join(dir, postHookFile)} {
+		if hook != "" && filepath.Clean(hook) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hooks runs the hook scripts around the migrations of a call.
+type hooks struct {
+	db      *sql.DB
+	dir     string
+	tx      txSettings
+	started bool
+}
+
+func newHooks(db *sql.DB, dir string, o options) *hooks {
+	return &hooks{db: db, dir: dir, tx: o.tx}
+}
+
+// before runs the pre hook script before the first migration.
+func (h *hooks) before(c *config) error {
+	if h.started {
+		return nil
+	}
+	h.started = true
+
+	return runHookScript(c, h.db, h.tx, c.preHook, filepath.Join(h.dir, preHookFile))
+}
+
+// after runs the post hook script and dumps the schema if any migration
+// ran.
+func (h *hooks) after(c *config) error {
+	if !h.started {
+		return nil
+	}
+
+	if err := runHookScript(c, h.db, h.tx, c.postHook, filepath.Join(h.dir, postHookFile)); err != nil {
+		return err
+	}
+	return writeSchemaDump(c, h.db)
+}
+
+// runHookScript runs the configured hook script, or the default one if it
+// exists, with the transaction settings of the migrations.
+func runHookScript(c *config, db *sql.DB, settings txSettings, configured, defaultPath string) error {
+	path := configured
+	if path == "" {
+		path = defaultPath
+	}
+
+	f, err := c.source.Open(path)
+	if os.IsNotExist(err) && configured == "" {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to open hook script")
+	}
+	defer f.Close()
+
+	parsed, err := parseSQLMigration(c, io.MultiReader(strings.NewReader("-- +goose Up\n"), f), true)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse hook script %q", filepath.Base(path))
+	}
+	if err := execHookStatements(withTxSettings(context.Background(), settings), c, db, parsed); err != nil {
+		return errors.Wrapf(err, "failed to run hook script %q", filepath.Base(path))
+	}
+	printProgress(c, "HOOK  %s\n", filepath.Base(path))
+
+	return nil
+}
+
+// execHookStatements executes the statements of a hook script as the ones
+// of a migration, in a transaction unless it is annotated with NO
+// TRANSACTION.
+func execHookStatements(ctx context.Context, c *config, db *sql.DB, parsed *parsedSQL) error {
+	if !parsed.useTx {
+		q, release, err := noTxQuerier(ctx, c, db)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return execStatements(ctx, c, q, parsed.statements)
+	}
+
+	ctx, begin, done, err := hookedBegin(ctx, c, db)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tx, err := begin(ctx, txOptions(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if err := applyTxSettings(ctx, c, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := execStatements(ctx, c, tx, parsed.statements); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
@@ -0,0 +1,138 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHookScripts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	if _, err := db.Exec("CREATE TABLE hooks (name text)"); err != nil {
+		t.Fatal(err)
+	}
+	hooks := map[string]string{
+		"_pre.sql":  "INSERT INTO hooks VALUES ('pre');\n",
+		"_post.sql": "INSERT INTO hooks VALUES ('post');\n",
+	}
+	for name, src := range hooks {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSQLMigration(t, dir, 1, "one")
+	writeSQLMigration(t, dir, 2, "two")
+
+	count := func(name string) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM hooks WHERE name = ?", name).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// Hooks run once around the batch, and not at all without migrations.
+	for i := 0; i < 2; i++ {
+		if err := Up(db, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pre, post := count("pre"), count("post"); pre != 1 || post != 1 {
+		t.Fatalf("expected the hooks to run once, got pre %d and post %d times", pre, post)
+	}
+
+	custom := filepath.Join(dir, "_custom.sql")
+	if err := ioutil.WriteFile(custom, []byte("INSERT INTO hooks VALUES ('custom');\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetHookScripts(custom, "")
+	defer SetHookScripts("", "")
+	if err := DownTo(db, dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if custom, post := count("custom"), count("post"); custom != 1 || post != 2 {
+		t.Fatalf("expected the custom pre hook and the default post hook, got custom %d and post %d times", custom, post)
+	}
+
+	if err := os.Remove(custom); err != nil {
+		t.Fatal(err)
+	}
+	SetHookScripts(filepath.Join(dir, "_missing.sql"), "")
+	if err := Up(db, dir); err == nil {
+		t.Error("expected a missing configured hook script to fail")
+	}
+}
+
+func TestHookScriptsConnection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	// Temporary tables only exist on the connection that created them.
+	SetConnectionHook(func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, "CREATE TEMP TABLE IF NOT EXISTS session_role AS SELECT 'migrator' AS name")
+		return err
+	})
+	defer SetConnectionHook(nil)
+
+	hooks := map[string]string{
+		"_pre.sql":    "CREATE TABLE pre AS SELECT name FROM session_role;\n",
+		"_post.sql":   "-- +goose NO TRANSACTION\nCREATE TABLE post AS SELECT name FROM session_role;\n",
+		"_notes.sql":  "-- not a hook script\n",
+		"00001_a.sql": "-- +goose Up\nCREATE TABLE a (id int);\n-- +goose Down\nDROP TABLE a;\n",
+	}
+	for name, src := range hooks {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := CollectMigrations(dir, MinVersion, MaxVersion); err == nil {
+		t.Error("expected a file named like a hook script but not configured to be collected")
+	}
+	if err := os.Remove(filepath.Join(dir, "_notes.sql")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"pre", "post"} {
+		var name string
+		if err := db.QueryRow("SELECT name FROM " + table).Scan(&name); err != nil || name != "migrator" {
+			t.Errorf("expected the %s hook to see the session set up by the connection hook, got %q (%v)", table, name, err)
+		}
+	}
+}
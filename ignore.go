@@ -0,0 +1,69 @@
+package goose
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ignoreFile lists files of a migrations directory that are not
+// migrations, one glob per line, matched by name. Blank lines and lines
+// starting with # are skipped:
+//
+//	# helpers of the Go migrations
+//	helpers_*.go
+//	*.gen.go
+const ignoreFile = ".gooseignore"
+
+// SetExcludes sets globs, matched by file name, of files in migrations
+// directories that are not migrations, in addition to the ones of their
+// .gooseignore and migrations.json. Go test files are never migrations and
+// don't need to be excluded.
+func SetExcludes(patterns ...string) {
+	updateConfig(func(c *config) { c.excludes = append([]string(nil), patterns...) })
+}
+
+// excludePatterns returns the globs set with SetExcludes and the ones of
+// the .gooseignore of dirpath, whose entries are names.
+func excludePatterns(c *config, dirpath string, names []string) ([]string, error) {
+	patterns := c.excludes
+	if containsName(names, ignoreFile) {
+		path := filepath.Join(dirpath, ignoreFile)
+		f, err := c.source.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open %s", ignoreFile)
+		}
+		defer f.Close()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			patterns = append(patterns, line)
+		}
+		if err := s.Err(); err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "exclude %q", pattern)
+		}
+	}
+	return patterns, nil
+}
+
+// matchesAny reports whether the file name matches one of the globs.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
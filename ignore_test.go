@@ -0,0 +1,57 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExcludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetExcludes()
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+	files := map[string]string{
+		"00003_c_test.go":  "package migrations",
+		"00004_helpers.go": "package migrations",
+		ignoreFile:         "# helpers of the Go migrations\n\n*_helpers.go\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions := func() []int64 {
+		t.Helper()
+		migrations, err := CollectMigrations(dir, MinVersion, MaxVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var versions []int64
+		for _, m := range migrations {
+			versions = append(versions, m.Version)
+		}
+		return versions
+	}
+
+	if got := versions(); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("expected test files and ignored files to be skipped, got %v", got)
+	}
+
+	SetExcludes("*_b.sql")
+	if got := versions(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected excluded files to be skipped, got %v", got)
+	}
+
+	SetExcludes("[")
+	if _, err := CollectMigrations(dir, MinVersion, MaxVersion); err == nil {
+		t.Error("expected an invalid exclude to fail")
+	}
+}
@@ -0,0 +1,215 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FlywayTable is the default Flyway schema history table.
+	FlywayTable = "flyway_schema_history"
+	// MigrateTable is the default golang-migrate schema table.
+	MigrateTable = "schema_migrations"
+)
+
+// ImportFlyway records every successfully applied versioned migration from
+// the Flyway schema history table in the goose version table, and returns
+// the versions it recorded. Flyway versions must be integers.
+func ImportFlyway(db *sql.DB, table string) ([]int64, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return importFlyway(c, db, table)
+}
+
+// importFlyway is ImportFlyway, for callers holding runMu.
+func importFlyway(c *config, db *sql.DB, table string) ([]int64, error) {
+	if table == "" {
+		table = FlywayTable
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT version FROM %s WHERE success ORDER BY installed_rank", table))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", table)
+	}
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var version sql.NullString
+		if err := rows.Scan(&version); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		// Repeatable migrations have no version.
+		if !version.Valid {
+			continue
+		}
+		v, err := strconv.ParseInt(version.String, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("flyway version %q is not an integer", version.String)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to get next row")
+	}
+
+	return importVersions(c, db, versions)
+}
+
+// ImportMigrate records the migrations in dir up to the version stored in
+// the golang-migrate schema table in the goose version table, and returns
+// the versions it recorded. It refuses to import a dirty database.
+func ImportMigrate(db *sql.DB, dir, table string) ([]int64, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return importMigrate(c, db, dir, table)
+}
+
+// importMigrate is ImportMigrate, for callers holding runMu.
+func importMigrate(c *config, db *sql.DB, dir, table string) ([]int64, error) {
+	if table == "" {
+		table = MigrateTable
+	}
+
+	var current int64
+	var dirty bool
+	q := firstRow(c.dialect, fmt.Sprintf("SELECT version, dirty FROM %s", table))
+	if err := db.QueryRow(q).Scan(&current, &dirty); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", table)
+	}
+	if dirty {
+		return nil, fmt.Errorf("%s: database is dirty at version %d, fix it with golang-migrate first", table, current)
+	}
+
+	names, err := c.source.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]bool)
+	var versions []int64
+	for _, name := range names {
+		v, err := parseVersion(c, name)
+		if err != nil || v > current || seen[v] {
+			continue
+		}
+		seen[v] = true
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return importVersions(c, db, versions)
+}
+
+// importVersions marks versions as applied without running them,
+// skipping the ones goose already knows about.
+func importVersions(c *config, db *sql.DB, versions []int64) ([]int64, error) {
+	if _, err := ensureDBVersion(c, db); err != nil {
+		return nil, errors.Wrap(err, "failed to ensure DB version")
+	}
+
+	applied, err := appliedDBVersions(c, db)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	var imported []int64
+	for _, v := range versions {
+		if applied[v] {
+			continue
+		}
+		applied[v] = true
+		imported = append(imported, v)
+	}
+	if err := insertVersions(c, tx, imported); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit transaction")
+	}
+	InvalidateVersionCache()
+
+	for _, v := range imported {
+		c.logger.Printf("IMPORTED %d\n", v)
+	}
+
+	return imported, nil
+}
+
+// versionBatchSize is the number of versions inserted per statement, well
+// below the bind parameter limits of the databases.
+const versionBatchSize = 100
+
+// insertVersions records versions as applied, in order, inserting them in
+// batches rather than one by one.
+func insertVersions(c *config, q Querier, versions []int64) error {
+	d := c.dialect
+	for len(versions) > 0 {
+		n := len(versions)
+		if n > versionBatchSize {
+			n = versionBatchSize
+		}
+
+		args := make([]interface{}, 0, 2*n)
+		for _, v := range versions[:n] {
+			args = append(args, v, true)
+		}
+		if _, err := q.Exec(bind(c, d.insertVersionsSQL(c, n)), args...); err != nil {
+			return errors.Wrapf(err, "failed to insert versions %d to %d", versions[0], versions[n-1])
+		}
+		versions = versions[n:]
+	}
+
+	return nil
+}
+
+// RenameFlywayMigrations renames Flyway style VXXX__name.ext files in dir
+// to the goose XXXXX_name.ext convention.
+func RenameFlywayMigrations(dir string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return renameFlywayMigrations(c, dir)
+}
+
+// renameFlywayMigrations is RenameFlywayMigrations, for callers holding runMu.
+func renameFlywayMigrations(c *config, dir string) error {
+	names, err := c.source.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		v, err := FlywayVersion(name)
+		if err != nil {
+			continue
+		}
+
+		desc := name[strings.Index(name, "__")+2:]
+		oldPath := filepath.Join(dir, name)
+		newPath := filepath.Join(dir, fmt.Sprintf("%05v_%s", v, desc))
+
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return err
+		}
+		c.logger.Printf("RENAMED %s => %s", name, filepath.Base(newPath))
+	}
+
+	return nil
+}
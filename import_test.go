@@ -0,0 +1,62 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInsertVersionsSQL(t *testing.T) {
+	if got, want := (&PostgresDialect{}).insertVersionsSQL(runConfig(), 2), "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, $2), ($3, $4);"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := (&MySQLDialect{}).insertVersionsSQL(runConfig(), 2), "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?), (?, ?);"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestImportVersionsInBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	var versions []int64
+	for v := int64(1); v <= 2*versionBatchSize+50; v++ {
+		versions = append(versions, v)
+	}
+	imported, err := importVersions(runConfig(), db, versions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != len(versions) {
+		t.Fatalf("imported %d versions, want %d", len(imported), len(versions))
+	}
+
+	// Already recorded versions are skipped.
+	imported, err = importVersions(runConfig(), db, append(versions, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || imported[0] != 1000 {
+		t.Fatalf("expected only version 1000 to be imported, got %v", imported)
+	}
+
+	if version, err := GetDBVersion(db); err != nil || version != 1000 {
+		t.Errorf("expected version 1000, got %d, %v", version, err)
+	}
+}
@@ -0,0 +1,314 @@
+package goose
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// loadData is a '-- +goose LOADDATA' annotation, loading a delimited file
+// into a table as a statement of its own:
+//
+//	-- +goose Up
+//	CREATE TABLE countries (code text, name text);
+//	-- +goose LOADDATA path=seed/countries.csv table=countries
+//
+// The path is relative to the migration file and read through the
+// migration source. Files ending with .csv are comma separated, with
+// double quotes around fields as needed; files ending with .tsv are tab
+// separated. The first row names the columns, and fields of \N are NULL.
+//
+// The data is loaded with COPY on Postgres in a transaction, with LOAD
+// DATA LOCAL INFILE on MySQL and TiDB when the file is on the local
+// filesystem, which the driver must allow, e.g. with allowAllFiles=true,
+// and with batched INSERTs otherwise.
+type loadData struct {
+	path  string
+	table string
+	comma rune
+}
+
+const loadDataCmd = "LOADDATA"
+
+// loadInsertParams bounds the parameters of a batched INSERT, below the
+// limit of older SQLite versions.
+const loadInsertParams = 900
+
+var (
+	loadIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+	loadOption     = regexp.MustCompile(`^(path|table)=(\S+)$`)
+)
+
+// parseLoadDataCmd parses the arguments of a LOADDATA annotation.
+func parseLoadDataCmd(cmd string) (*loadData, error) {
+	l := &loadData{}
+	for _, arg := range strings.Fields(strings.TrimPrefix(cmd, loadDataCmd)) {
+		m := loadOption.FindStringSubmatch(arg)
+		if m == nil {
+			return nil, errors.Errorf("unknown LOADDATA option %q, use path=FILE table=TABLE", arg)
+		}
+		if m[1] == "path" {
+			l.path = m[2]
+		} else {
+			l.table = m[2]
+		}
+	}
+
+	if l.path == "" || l.table == "" {
+		return nil, errors.New("'-- +goose LOADDATA' needs path=FILE and table=TABLE")
+	}
+	if !loadIdentifier.MatchString(l.table) {
+		return nil, errors.Errorf("LOADDATA table %q is not a plain table name", l.table)
+	}
+	switch strings.ToLower(filepath.Ext(l.path)) {
+	case ".csv":
+		l.comma = ','
+	case ".tsv":
+		l.comma = '\t'
+	default:
+		return nil, errors.Errorf("LOADDATA file %q must end with .csv or .tsv", l.path)
+	}
+	return l, nil
+}
+
+// parseLoadDataStatement parses the statement if it is a LOADDATA
+// annotation.
+func parseLoadDataStatement(query string) (*loadData, bool) {
+	cmd := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(query), sqlCmdPrefix))
+	if !strings.HasPrefix(query, sqlCmdPrefix) || !strings.HasPrefix(cmd, loadDataCmd+" ") {
+		return nil, false
+	}
+	l, err := parseLoadDataCmd(cmd)
+	if err != nil {
+		return nil, false // refused when the migration is parsed
+	}
+	return l, true
+}
+
+type sourceFileKey struct{}
+
+// withSourceFile returns a copy of ctx carrying the file of the running
+// migration, which the paths of LOADDATA annotations are relative to.
+func withSourceFile(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, sourceFileKey{}, name)
+}
+
+// loadPath returns the path of the loaded file.
+func loadPath(ctx context.Context, l *loadData) string {
+	if filepath.IsAbs(l.path) {
+		return l.path
+	}
+	source, _ := ctx.Value(sourceFileKey{}).(string)
+	return filepath.Join(filepath.Dir(source), filepath.FromSlash(l.path))
+}
+
+// execLoadData loads the file of a LOADDATA annotation into its table.
+func execLoadData(ctx context.Context, c *config, q Querier, l *loadData) (sql.Result, error) {
+	path := loadPath(ctx, l)
+	source := c.source
+
+	switch dialectName(c.dialect) {
+	case "mysql", "tidb":
+		if _, ok := source.(osSource); ok {
+			return execLoadDataInfile(ctx, q, l, path)
+		}
+	case "postgres":
+		if _, ok := q.(preparerContext); ok {
+			columns, rows, err := readLoadData(c, path, l.comma)
+			if err != nil {
+				return nil, err
+			}
+			return execCopy(ctx, c, q, &copyBlock{
+				statement: fmt.Sprintf("COPY %s (%s) FROM STDIN", l.table, strings.Join(columns, ", ")),
+				rows:      rows,
+				data:      copyData(rows),
+			})
+		}
+	}
+
+	columns, rows, err := readLoadData(c, path, l.comma)
+	if err != nil {
+		return nil, err
+	}
+	return execLoadInserts(ctx, c, q, l.table, columns, rows)
+}
+
+// readLoadData reads the columns and rows of a delimited file.
+func readLoadData(c *config, path string, comma rune) ([]string, [][]interface{}, error) {
+	f, err := c.source.Open(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open LOADDATA file")
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = comma
+	r.LazyQuotes = comma == '\t'
+	columns, err := readLoadColumns(r, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows [][]interface{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to read %s", filepath.Base(path))
+		}
+		row := make([]interface{}, len(record))
+		for i, field := range record {
+			if field != `\N` {
+				row[i] = field
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// readLoadColumns reads the header of a delimited file.
+func readLoadColumns(r *csv.Reader, path string) ([]string, error) {
+	columns, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the header of %s", filepath.Base(path))
+	}
+	for i, c := range columns {
+		columns[i] = strings.TrimSpace(c)
+		if !loadIdentifier.MatchString(columns[i]) {
+			return nil, errors.Errorf("%s: column %q is not a plain column name", filepath.Base(path), c)
+		}
+	}
+	return columns, nil
+}
+
+// copyData encodes rows in the text format of COPY, for a Copier.
+func copyData(rows [][]interface{}) string {
+	escaper := strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	var b strings.Builder
+	for _, row := range rows {
+		for i, v := range row {
+			if i > 0 {
+				b.WriteByte('\t')
+			}
+			if v == nil {
+				b.WriteString(`\N`)
+			} else {
+				b.WriteString(escaper.Replace(v.(string)))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// execLoadDataInfile loads a local file with LOAD DATA LOCAL INFILE.
+func execLoadDataInfile(ctx context.Context, q Querier, l *loadData, path string) (sql.Result, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve LOADDATA file")
+	}
+	f, err := osSource{}.Open(abs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open LOADDATA file")
+	}
+	header, err := bufio.NewReader(f).ReadString('\n')
+	f.Close()
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "failed to read the header of %s", filepath.Base(path))
+	}
+
+	r := csv.NewReader(strings.NewReader(header))
+	r.Comma = l.comma
+	columns, err := readLoadColumns(r, path)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := `FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"'`
+	if l.comma == '\t' {
+		fields = `FIELDS TERMINATED BY '\t'`
+	}
+	lines := `'\n'`
+	if strings.HasSuffix(header, "\r\n") {
+		lines = `'\r\n'`
+	}
+	quoted := strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(abs)
+	query := fmt.Sprintf("LOAD DATA LOCAL INFILE '%s' INTO TABLE %s %s LINES TERMINATED BY %s IGNORE 1 LINES (%s)",
+		quoted, l.table, fields, lines, strings.Join(columns, ", "))
+	if e, ok := q.(execerContext); ok {
+		return e.ExecContext(ctx, query)
+	}
+	return q.Exec(query)
+}
+
+// execLoadInserts inserts the rows in batches of multi-row INSERTs.
+func execLoadInserts(ctx context.Context, c *config, q Querier, table string, columns []string, rows [][]interface{}) (sql.Result, error) {
+	batch := loadInsertParams / len(columns)
+	if batch < 1 {
+		batch = 1
+	}
+
+	var inserted int64
+	for start := 0; start < len(rows); start += batch {
+		end := start + batch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var query strings.Builder
+		fmt.Fprintf(&query, "INSERT INTO %s (%s) VALUES ", table, strings.Join(columns, ", "))
+		var args []interface{}
+		for i, row := range rows[start:end] {
+			if len(row) != len(columns) {
+				return nil, errors.Errorf("LOADDATA row %d has %d fields, want %d", start+i+1, len(row), len(columns))
+			}
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteByte('(')
+			for j, v := range row {
+				if j > 0 {
+					query.WriteString(", ")
+				}
+				args = append(args, v)
+				query.WriteString(nativePlaceholder(c, len(args)))
+			}
+			query.WriteByte(')')
+		}
+
+		var err error
+		if e, ok := q.(execerContext); ok {
+			_, err = e.ExecContext(ctx, bind(c, query.String()), args...)
+		} else {
+			_, err = q.Exec(bind(c, query.String()), args...)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to insert rows %d to %d", start+1, end)
+		}
+		inserted += int64(end - start)
+	}
+	return copyResult(inserted), nil
+}
+
+// nativePlaceholder returns the n-th parameter in the style of the dialect.
+func nativePlaceholder(c *config, n int) string {
+	switch dialectName(c.dialect) {
+	case "postgres", "redshift", "cockroach", "yugabyte":
+		return "$" + strconv.Itoa(n)
+	case "spanner":
+		return "@p" + strconv.Itoa(n)
+	}
+	return "?"
+}
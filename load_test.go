@@ -0,0 +1,106 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	if err := os.Mkdir(filepath.Join(dir, "seed"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"seed/countries.csv": "code,name\nfr,France\nus,\"United States, The\"\nxx,\\N\n",
+		"seed/cities.tsv":    "name\tcountry\nParis\tfr\n",
+		"00001_seed.sql": `-- +goose Up
+CREATE TABLE countries (code text, name text);
+CREATE TABLE cities (name text, country text);
+-- +goose LOADDATA path=seed/countries.csv table=countries
+-- +goose LOADDATA path=seed/cities.tsv table=cities
+
+-- +goose Down
+DROP TABLE cities;
+DROP TABLE countries;
+`,
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT code, name FROM countries ORDER BY code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var code string
+		var name sql.NullString
+		if err := rows.Scan(&code, &name); err != nil {
+			t.Fatal(err)
+		}
+		if !name.Valid {
+			name.String = "NULL"
+		}
+		got = append(got, code+"="+name.String)
+	}
+	if want := []string{"fr=France", "us=United States, The", "xx=NULL"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got countries %q, want %q", got, want)
+	}
+
+	var city string
+	if err := db.QueryRow("SELECT name FROM cities WHERE country = 'fr'").Scan(&city); err != nil || city != "Paris" {
+		t.Errorf("expected Paris to be loaded from the TSV file, got %q, %v", city, err)
+	}
+}
+
+func TestParseLoadData(t *testing.T) {
+	invalid := []string{
+		"-- +goose Up\n-- +goose LOADDATA table=users\n",
+		"-- +goose Up\n-- +goose LOADDATA path=users.json table=users\n",
+		"-- +goose Up\n-- +goose LOADDATA path=users.csv table=users;DROP\n",
+		"-- +goose Up\n-- +goose LOADDATA path=users.csv table=users format=csv\n",
+		"-- +goose Up\nINSERT INTO users\n-- +goose LOADDATA path=users.csv table=users\nVALUES (1);\n",
+	}
+	for _, src := range invalid {
+		if _, err := parseSQLMigration(runConfig(), strings.NewReader(src), true); err == nil {
+			t.Errorf("expected %q to fail", src)
+		}
+	}
+
+	parsed, err := parseSQLMigration(runConfig(), strings.NewReader("-- +goose Up\n-- +goose LOADDATA path=users.csv table=users\n-- +goose Down\nDELETE FROM users;\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.loads != 0 || len(parsed.statements) != 1 {
+		t.Errorf("expected the Down section not to load data, got %q", parsed.statements)
+	}
+}
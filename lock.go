@@ -0,0 +1,147 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SessionLocker is a lock held while migrating, so processes migrating the
+// same database, e.g. replicas of a service migrating on startup, run one
+// after the other. NewAdvisoryLocker uses the locks of the database;
+// custom implementations may use an external coordinator like Consul,
+// etcd or Kubernetes leases. See WithSessionLocker.
+type SessionLocker interface {
+	// Lock blocks until the lock is acquired or ctx is done.
+	Lock(ctx context.Context) error
+	// Unlock releases the lock.
+	Unlock(ctx context.Context) error
+}
+
+// advisoryLocker is implemented by dialects with advisory locks, taken by
+// name on a session.
+type advisoryLocker interface {
+	tryAdvisoryLockSQL() string
+	advisoryUnlockSQL() string
+}
+
+// advisoryLockRetry is how long Lock waits before trying again to take an
+// advisory lock held by another session.
+var advisoryLockRetry = time.Second
+
+type advisoryLock struct {
+	db *sql.DB
+
+	mu   sync.Mutex
+	conn *sql.Conn // holding the lock
+	c    *config   // of the run holding the lock
+}
+
+// NewAdvisoryLocker returns a SessionLocker using the advisory locks of
+// db, named after the version table, for the postgres, mysql and tidb
+// dialects. The lock is held by a dedicated connection of db and released
+// by the database if the process dies.
+func NewAdvisoryLocker(db *sql.DB) SessionLocker {
+	return &advisoryLock{db: db}
+}
+
+func (l *advisoryLock) Lock(ctx context.Context) error {
+	c := lockConfig(ctx)
+	detectDialect(c, l.db)
+	d, ok := c.dialect.(advisoryLocker)
+	if !ok {
+		return errors.Errorf("advisory locks are not supported by the %s dialect", dialectName(c.dialect))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		return errors.New("advisory lock is already held")
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get a connection")
+	}
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, bind(c, d.tryAdvisoryLockSQL()), lockName(c)).Scan(&locked); err != nil {
+			conn.Close()
+			return errors.Wrap(err, "failed to take advisory lock")
+		}
+		if locked {
+			l.conn = conn
+			l.c = c
+			return nil
+		}
+
+		printInfo(c, "Advisory lock is held by another session, retrying in %v\n", advisoryLockRetry)
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return errors.Wrap(ctx.Err(), "failed to take advisory lock")
+		case <-time.After(advisoryLockRetry):
+		}
+	}
+}
+
+func (l *advisoryLock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return errors.New("advisory lock is not held")
+	}
+	c := l.c
+	defer func() {
+		l.conn.Close()
+		l.conn, l.c = nil, nil
+	}()
+
+	// Lock checked the dialect supports advisory locks.
+	d := c.dialect.(advisoryLocker)
+
+	if _, err := l.conn.ExecContext(ctx, bind(c, d.advisoryUnlockSQL()), lockName(c)); err != nil {
+		return errors.Wrap(err, "failed to release advisory lock")
+	}
+	return nil
+}
+
+// lockName returns the name of the advisory lock of the version table.
+func lockName(c *config) string {
+	return "goose:" + c.versionTableName()
+}
+
+// runConfigKey is the context key of the configuration of the run taking
+// a session lock.
+type runConfigKey struct{}
+
+// lockConfig returns the configuration of the run taking a session lock
+// with ctx, or the package level configuration.
+func lockConfig(ctx context.Context) *config {
+	if c, ok := ctx.Value(runConfigKey{}).(*config); ok {
+		return c
+	}
+	return runConfig()
+}
+
+// withSessionLock runs fn holding the lock of l, if any.
+func withSessionLock(c *config, l SessionLocker, fn func() error) (err error) {
+	if l == nil {
+		return fn()
+	}
+
+	ctx := context.WithValue(context.Background(), runConfigKey{}, c)
+	if err := l.Lock(ctx); err != nil {
+		return errors.Wrap(err, "failed to acquire session lock")
+	}
+	defer func() {
+		if unlockErr := l.Unlock(ctx); unlockErr != nil && err == nil {
+			err = errors.Wrap(unlockErr, "failed to release session lock")
+		}
+	}()
+
+	return fn()
+}
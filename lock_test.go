@@ -0,0 +1,78 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type recordingLocker struct {
+	calls []string
+}
+
+func (l *recordingLocker) Lock(ctx context.Context) error {
+	l.calls = append(l.calls, "lock")
+	return nil
+}
+
+func (l *recordingLocker) Unlock(ctx context.Context) error {
+	l.calls = append(l.calls, "unlock")
+	return nil
+}
+
+func TestSessionLocker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+
+	l := &recordingLocker{}
+	if err := Up(db, dir, WithSessionLocker(l)); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.calls) != 2 || l.calls[0] != "lock" || l.calls[1] != "unlock" {
+		t.Errorf("expected Up to lock and unlock once, got %v", l.calls)
+	}
+
+	// Every command migrating the database holds the lock.
+	writeSQLMigration(t, dir, 2, "b")
+	for _, c := range []struct {
+		name string
+		run  func(opt OptionsFunc) error
+	}{
+		{"UpByOne", func(opt OptionsFunc) error { _, err := UpByOne(db, dir, opt); return err }},
+		{"Redo", func(opt OptionsFunc) error { return Redo(db, dir, opt) }},
+		{"Down", func(opt OptionsFunc) error { _, err := Down(db, dir, opt); return err }},
+		{"DownTo", func(opt OptionsFunc) error { return DownTo(db, dir, 0, opt) }},
+		{"Reset", func(opt OptionsFunc) error { return Reset(db, dir, opt) }},
+	} {
+		l := &recordingLocker{}
+		if err := c.run(WithSessionLocker(l)); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(l.calls) != 2 || l.calls[0] != "lock" || l.calls[1] != "unlock" {
+			t.Errorf("expected %s to lock and unlock once, got %v", c.name, l.calls)
+		}
+	}
+
+	if err := Up(db, dir, WithSessionLocker(NewAdvisoryLocker(db))); err == nil {
+		t.Error("expected advisory locks to be unsupported by sqlite3")
+	}
+}
@@ -4,7 +4,8 @@ import (
 	std "log"
 )
 
-var log Logger = &stdLogger{}
+// log forwards to the configured logger.
+var log Logger = configLogger{}
 
 // Logger is standart logger interface
 type Logger interface {
@@ -15,9 +16,60 @@ type Logger interface {
 	Printf(format string, v ...interface{})
 }
 
+// Verbosity is the amount of output of goose runs, see SetVerbosity.
+type Verbosity int
+
+const (
+	// VerbosityQuiet only logs errors, warnings and the output of commands
+	// such as Status, for pipelines parsing the output.
+	VerbosityQuiet Verbosity = -1
+	// VerbosityNormal also logs the progress of runs, such as the applied
+	// migrations. It is the default.
+	VerbosityNormal Verbosity = 0
+	// VerbosityVerbose also logs the details of runs, such as the executed
+	// statements and transactions.
+	VerbosityVerbose Verbosity = 1
+)
+
+func (v Verbosity) String() string {
+	switch {
+	case v <= VerbosityQuiet:
+		return "quiet"
+	case v >= VerbosityVerbose:
+		return "verbose"
+	}
+	return "normal"
+}
+
+// SetVerbosity sets the amount of output of goose runs.
+func SetVerbosity(v Verbosity) {
+	updateConfig(func(c *config) { c.verbosity = v })
+}
+
+// printProgress logs the progress of a run, such as an applied migration,
+// unless quiet.
+func printProgress(c *config, format string, args ...interface{}) {
+	if c.verbosity > VerbosityQuiet {
+		c.logger.Printf(format, args...)
+	}
+}
+
 // SetLogger sets the logger for package output
 func SetLogger(l Logger) {
-	log = l
+	updateConfig(func(c *config) { c.logger = l })
+}
+
+// configLogger forwards to the logger set with SetLogger.
+type configLogger struct{}
+
+func (configLogger) Fatal(v ...interface{}) { currentConfig().logger.Fatal(v...) }
+func (configLogger) Fatalf(format string, v ...interface{}) {
+	currentConfig().logger.Fatalf(format, v...)
+}
+func (configLogger) Print(v ...interface{})   { currentConfig().logger.Print(v...) }
+func (configLogger) Println(v ...interface{}) { currentConfig().logger.Println(v...) }
+func (configLogger) Printf(format string, v ...interface{}) {
+	currentConfig().logger.Printf(format, v...)
 }
 
 // stdLogger is a default logger that outputs to a stdlib's log.std logger.
@@ -0,0 +1,80 @@
+package goose
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	std "log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerbosity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	var buf bytes.Buffer
+	SetLogger(std.New(&buf, "", 0))
+	defer SetLogger(&stdLogger{})
+	defer SetVerbosity(VerbosityNormal)
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+
+	SetVerbosity(VerbosityQuiet)
+	if err := UpTo(db, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := Version(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "goose: version 1\n" {
+		t.Errorf("expected only the output of version in quiet mode, got %q", got)
+	}
+
+	buf.Reset()
+	if err := Experimental("no-fixup", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fixUp(runConfig(), db); err != nil {
+		t.Fatal(err)
+	}
+	Experimental("no-fixup", false)
+	if got := buf.String(); got != "" {
+		t.Errorf("expected no output of the no-fixup feature in quiet mode, got %q", got)
+	}
+
+	buf.Reset()
+	SetVerbosity(VerbosityNormal)
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "OK    00002_b.sql\n") || strings.Contains(got, "Executing statement") {
+		t.Errorf("expected applied migrations without statements, got %q", got)
+	}
+
+	buf.Reset()
+	SetVerbose(true)
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "Executing statement 1 of 1: DROP TABLE b;") {
+		t.Errorf("expected executed statements in verbose mode, got %q", got)
+	}
+}
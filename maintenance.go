@@ -0,0 +1,157 @@
+package goose
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maintenanceWindow is a daily time window in which heavy migrations may
+// run, such as a table rewrite annotated with:
+//
+//	-- +goose HEAVY 01:00-05:00 UTC
+//
+// The zone is optional and defaults to the local one. A window ending
+// before it starts spans midnight.
+type maintenanceWindow struct {
+	start, end int // minutes since midnight
+	loc        *time.Location
+	spec       string
+}
+
+var windowSpec = regexp.MustCompile(`^(\d{2}):(\d{2})-(\d{2}):(\d{2})(?:\s+(\S+))?$`)
+
+// parseMaintenanceWindow parses a window such as "22:00-04:00 Europe/Paris".
+func parseMaintenanceWindow(s string) (*maintenanceWindow, error) {
+	m := windowSpec.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return nil, errors.Errorf("invalid maintenance window %q, use HH:MM-HH:MM [ZONE]", s)
+	}
+	minutes := func(h, min string) (int, bool) {
+		hh, _ := strconv.Atoi(h)
+		mm, _ := strconv.Atoi(min)
+		return hh*60 + mm, hh < 24 && mm < 60
+	}
+	start, ok1 := minutes(m[1], m[2])
+	end, ok2 := minutes(m[3], m[4])
+	if !ok1 || !ok2 || start == end {
+		return nil, errors.Errorf("invalid maintenance window %q", s)
+	}
+
+	w := &maintenanceWindow{start: start, end: end, loc: time.Local, spec: strings.TrimSpace(s)}
+	if m[5] != "" {
+		loc, err := time.LoadLocation(m[5])
+		if err != nil {
+			return nil, errors.Wrapf(err, "maintenance window %q", s)
+		}
+		w.loc = loc
+	}
+	return w, nil
+}
+
+// contains reports whether t is in the window.
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+func (w *maintenanceWindow) String() string { return w.spec }
+
+// WithMaintenanceWindow makes Up and UpAll defer the SQL migrations
+// annotated with '-- +goose HEAVY' outside their maintenance window, so
+// routine deploys proceed while table rewrites wait for off-peak hours.
+// window, such as "01:00-05:00 UTC", applies to heavy migrations
+// annotated without one; if empty, they are always deferred, and only
+// applied by runs without this option.
+//
+// Up stops before a deferred migration, leaving it and the ones after it
+// pending, while UpAll applies the migrations after it. Plan.Deferred
+// returns the migrations that would be deferred.
+func WithMaintenanceWindow(window string) OptionsFunc {
+	return func(o *options) {
+		o.maintenance = true
+		o.window = window
+	}
+}
+
+// checkMaintenanceWindow checks the window of WithMaintenanceWindow.
+func (o options) checkMaintenanceWindow() error {
+	if !o.maintenance || o.window == "" {
+		return nil
+	}
+	_, err := parseMaintenanceWindow(o.window)
+	return err
+}
+
+// heavyMigration reports whether the migration is annotated as heavy, with
+// its window, if any. Only SQL files can be annotated.
+func heavyMigration(c *config, m *Migration) (bool, *maintenanceWindow, error) {
+	if m.dir || m.Registered || fileExt(m.Source) != ".sql" {
+		return false, nil, nil
+	}
+
+	parsed, err := scanSQLFile(c, m.Source, true, discardStatement)
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "failed to parse SQL migration file %q", filepath.Base(m.Source))
+	}
+	return parsed.heavy, parsed.window, nil
+}
+
+// deferred reports whether m is a heavy migration to defer at the current
+// time, see WithMaintenanceWindow, with the window it waits for, nil if
+// none.
+func (o options) deferred(c *config, m *Migration) (bool, *maintenanceWindow, error) {
+	if !o.maintenance {
+		return false, nil, nil
+	}
+	heavy, w, err := heavyMigration(c, m)
+	if err != nil || !heavy {
+		return false, nil, err
+	}
+	if w == nil {
+		if o.window == "" {
+			return true, nil, nil
+		}
+		var err error
+		if w, err = parseMaintenanceWindow(o.window); err != nil {
+			return false, nil, err
+		}
+	}
+	return !w.contains(currentTime(c)), w, nil
+}
+
+// deferHeavy logs a migration deferred until the window.
+func deferHeavy(c *config, m *Migration, w *maintenanceWindow) {
+	until := "a run without a maintenance window"
+	if w != nil {
+		until = fmt.Sprintf("the maintenance window %s", w)
+	}
+	printProgress(c, "goose: deferred heavy migration %s until %s\n", filepath.Base(m.Source), until)
+}
+
+// Deferred returns the pending migrations that UpAll with the options
+// would defer at the current time, see WithMaintenanceWindow.
+func (p *Plan) Deferred(opts ...OptionsFunc) (Migrations, error) {
+	c := runConfig()
+	o := applyOptions(opts)
+	var migrations Migrations
+	for _, m := range p.Pending {
+		deferred, _, err := o.deferred(c, m)
+		if err != nil {
+			return nil, err
+		}
+		if deferred {
+			migrations = append(migrations, m)
+		}
+	}
+	return migrations, nil
+}
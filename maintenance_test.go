@@ -0,0 +1,97 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+
+	writeSQLMigration(t, dir, 1, "a")
+	heavy := "-- +goose Up\n-- +goose HEAVY 23:00-02:00 UTC\nCREATE TABLE b (id int);\n\n-- +goose Down\nDROP TABLE b;\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00002_b.sql"), []byte(heavy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 3, "c")
+
+	window := WithMaintenanceWindow("")
+	if err := Up(db, dir, window); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 1 {
+		t.Fatalf("expected Up to stop before the heavy migration, got version %d, %v", v, err)
+	}
+
+	if err := UpAll(db, dir, window); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := AppliedDBVersions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied[3] || applied[2] {
+		t.Fatalf("expected UpAll to apply 3 and defer 2, got %v", applied)
+	}
+
+	migrations, err := CollectMigrations(dir, MinVersion, MaxVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deferred, err := NewPlan(applied, migrations).Deferred(window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deferred) != 1 || deferred[0].Version != 2 {
+		t.Errorf("expected 2 to be deferred, got %v", deferred)
+	}
+
+	now = time.Date(2024, 3, 2, 0, 30, 0, 0, time.UTC) // in the window, past midnight
+	if err := UpAll(db, dir, window); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := AppliedDBVersions(db); err != nil || !applied[2] {
+		t.Errorf("expected the heavy migration to be applied in its window, got %v, %v", applied, err)
+	}
+
+	if err := Up(db, dir, WithMaintenanceWindow("25:00-02:00")); err == nil {
+		t.Error("expected an invalid window to fail")
+	}
+
+	// Migrations that fail to parse aren't taken as light ones.
+	if err := ioutil.WriteFile(filepath.Join(dir, "00004_d.sql"), []byte("-- +goose Up\nCREATE TABLE d (id int)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err = CollectMigrations(dir, MinVersion, MaxVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPlan(applied, migrations).Deferred(window)
+	if err == nil || !strings.Contains(err.Error(), "00004_d.sql") {
+		t.Errorf("expected the invalid migration to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package goose
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// manifestFile is the optional manifest of a migrations directory,
+// excluding files and declaring dependencies between migrations:
+//
+//	{
+//		"exclude": ["*_scratch.sql"],
+//		"migrations": [
+//			{"version": 20240301120000, "depends_on": [20240305090000]}
+//		]
+//	}
+//
+// Excluded files, matched by name, are not migrations. A migration is
+// applied after the migrations it depends on, even if they have newer
+// versions: UpAll orders pending migrations so, and every command refuses
+// to apply a migration before its dependencies with ErrDependencyNotApplied.
+const manifestFile = "migrations.json"
+
+type manifest struct {
+	Exclude    []string `json:"exclude"`
+	Migrations []struct {
+		Version   int64   `json:"version"`
+		DependsOn []int64 `json:"depends_on"`
+	} `json:"migrations"`
+
+	dependencies map[int64][]int64
+}
+
+// loadManifest reads the manifest of dirpath, whose entries are names, or
+// returns an empty one if it has none.
+func loadManifest(c *config, dirpath string, names []string) (*manifest, error) {
+	m := &manifest{dependencies: make(map[int64][]int64)}
+	if !containsName(names, manifestFile) {
+		return m, nil
+	}
+
+	path := filepath.Join(dirpath, manifestFile)
+	f, err := c.source.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open manifest")
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read manifest")
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+
+	for _, pattern := range m.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "%s: exclude %q", path, pattern)
+		}
+	}
+	for _, mm := range m.Migrations {
+		if _, ok := m.dependencies[mm.Version]; ok {
+			return nil, errors.Errorf("%s: migration %d is listed more than once", path, mm.Version)
+		}
+		m.dependencies[mm.Version] = mm.DependsOn
+	}
+	if cycle := m.cycle(); cycle != nil {
+		return nil, errors.Errorf("%s: migrations depend on each other: %v", path, cycle)
+	}
+	return m, nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether the file name is excluded by the manifest.
+func (m *manifest) excluded(name string) bool {
+	return matchesAny(m.Exclude, name)
+}
+
+// cycle returns versions depending on each other, if any.
+func (m *manifest) cycle() []int64 {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[int64]int)
+	var path []int64
+	var visit func(v int64) []int64
+	visit = func(v int64) []int64 {
+		switch state[v] {
+		case visiting:
+			for i, p := range path {
+				if p == v {
+					return append(append([]int64(nil), path[i:]...), v)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[v] = visiting
+		path = append(path, v)
+		for _, d := range m.dependencies[v] {
+			if cycle := visit(d); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[v] = done
+		return nil
+	}
+
+	var versions []int64
+	for v := range m.dependencies {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, v := range versions {
+		if cycle := visit(v); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// applyManifest sets the dependencies of the migrations of dirpath from
+// its manifest.
+func applyManifest(c *config, dirpath string, migrations Migrations) error {
+	names, err := readMigrationDir(c, dirpath)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(c, dirpath, names)
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		migration.dependsOn = m.dependencies[migration.Version]
+	}
+	return nil
+}
+
+// orderByDependencies orders the migrations by version, except that
+// migrations come after the ones they depend on.
+func orderByDependencies(migrations Migrations) Migrations {
+	index := make(map[int64]bool, len(migrations))
+	hasDependencies := false
+	for _, m := range migrations {
+		index[m.Version] = true
+		hasDependencies = hasDependencies || len(m.dependsOn) > 0
+	}
+	if !hasDependencies {
+		return migrations
+	}
+
+	ordered := make(Migrations, 0, len(migrations))
+	placed := make(map[int64]bool, len(migrations))
+	for len(ordered) < len(migrations) {
+		progress := false
+		for _, m := range migrations {
+			if placed[m.Version] || !dependenciesPlaced(m, index, placed) {
+				continue
+			}
+			ordered = append(ordered, m)
+			placed[m.Version] = true
+			progress = true
+			break // restart from the oldest migration
+		}
+		if !progress {
+			// Dependencies on each other, refused by loadManifest.
+			for _, m := range migrations {
+				if !placed[m.Version] {
+					ordered = append(ordered, m)
+				}
+			}
+			break
+		}
+	}
+	return ordered
+}
+
+// dependenciesPlaced reports whether the dependencies of m among the
+// indexed migrations are placed.
+func dependenciesPlaced(m *Migration, index, placed map[int64]bool) bool {
+	for _, d := range m.dependsOn {
+		if index[d] && !placed[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDependencies fails with ErrDependencyNotApplied if migrations m
+// depends on are not applied.
+func checkDependencies(c *config, db *sql.DB, m *Migration) error {
+	if len(m.dependsOn) == 0 {
+		return nil
+	}
+
+	dependencies := make(Migrations, len(m.dependsOn))
+	for i, v := range m.dependsOn {
+		dependencies[i] = &Migration{Version: v}
+	}
+	applied, err := appliedVersions(c, db, dependencies)
+	if err != nil {
+		return err
+	}
+
+	var missing []int64
+	for _, v := range m.dependsOn {
+		if !applied[v] {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		return &ErrDependencyNotApplied{Version: m.Version, Dependencies: missing}
+	}
+	return nil
+}
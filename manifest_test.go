@@ -0,0 +1,94 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeManifest := func(src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, manifestFile), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for v, name := range []string{"a", "b", "c", "d"} {
+		writeSQLMigration(t, dir, int64(v+1), name)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "00005_scratch.sql"), []byte("not a migration"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeManifest(`{"exclude": ["*_scratch.sql"], "migrations": [{"version": 2, "depends_on": [4]}]}`)
+
+	// Up applies in version order and stops at 2.
+	err = Up(db, dir)
+	var notApplied *ErrDependencyNotApplied
+	if !errors.As(err, &notApplied) || notApplied.Version != 2 || fmt.Sprint(notApplied.Dependencies) != "[4]" {
+		t.Fatalf("expected 2 to wait for 4, got %v", err)
+	}
+
+	// UpAll applies dependencies first.
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	records, err := versionRecords(runConfig(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []int64
+	for _, r := range records {
+		order = append(order, r.VersionID)
+	}
+	if got := fmt.Sprint(order); got != "[0 1 3 4 2]" {
+		t.Errorf("expected the dependencies of 2 first, got %s", got)
+	}
+
+	// Up after it has nothing to apply, though the current version is 2.
+	if err := Up(db, dir); err != nil {
+		t.Fatalf("expected Up to skip the migrations applied after 2: %v", err)
+	}
+	if current, err := GetDBVersion(db); err != nil || current != 2 {
+		t.Errorf("expected version 2, got %d (%v)", current, err)
+	}
+
+	writeManifest(`{"migrations": [{"version": 2, "depends_on": [9]}]}`)
+	if err := os.Remove(filepath.Join(dir, "00005_scratch.sql")); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Validate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Message != "migration 2 depends on 9, which doesn't exist" {
+		t.Errorf("expected the unknown dependency to be reported, got %v", problems)
+	}
+
+	writeManifest(`{"migrations": [{"version": 2, "depends_on": [4]}, {"version": 4, "depends_on": [2]}]}`)
+	if _, err := CollectMigrations(dir, MinVersion, MaxVersion); err == nil {
+		t.Error("expected a dependency cycle to be refused")
+	}
+}
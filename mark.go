@@ -0,0 +1,90 @@
+package goose
+
+import (
+	"database/sql"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// MarkApplied records the migration of dir with the given version as
+// applied without running it, e.g. after a DBA applied a hotfix by hand.
+func MarkApplied(db *sql.DB, dir string, version int64) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return markApplied(c, db, dir, version)
+}
+
+// markApplied is MarkApplied, for callers holding runMu.
+func markApplied(c *config, db *sql.DB, dir string, version int64) error {
+	m, applied, err := markedMigration(c, db, dir, version)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return errors.Errorf("migration %d is already applied", version)
+	}
+
+	if err := recordVersion(c, db, m, true); err != nil {
+		return err
+	}
+	if err := recordChecksum(c, db, m); err != nil {
+		return err
+	}
+	c.logger.Println("MARKED APPLIED  ", filepath.Base(m.Source))
+	return nil
+}
+
+// MarkUnapplied records the migration of dir with the given version as
+// not applied without rolling it back.
+func MarkUnapplied(db *sql.DB, dir string, version int64) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return markUnapplied(c, db, dir, version)
+}
+
+// markUnapplied is MarkUnapplied, for callers holding runMu.
+func markUnapplied(c *config, db *sql.DB, dir string, version int64) error {
+	m, applied, err := markedMigration(c, db, dir, version)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errors.Errorf("migration %d is not applied", version)
+	}
+
+	if err := recordVersion(c, db, m, false); err != nil {
+		return err
+	}
+	if err := forgetChecksum(c, db, m); err != nil {
+		return err
+	}
+	c.logger.Println("MARKED UNAPPLIED", filepath.Base(m.Source))
+	return nil
+}
+
+// markedMigration returns the migration of dir with the given version and
+// whether it is applied.
+func markedMigration(c *config, db *sql.DB, dir string, version int64) (*Migration, bool, error) {
+	migrations, err := collectMigrationsRange(c, dir, MinVersion, MaxVersion)
+	if err != nil {
+		return nil, false, err
+	}
+
+	m, ok := migrations.ByVersion(version)
+	if !ok {
+		return nil, false, &ErrVersionNotFound{Version: version}
+	}
+
+	if _, err := ensureDBVersion(c, db); err != nil {
+		return nil, false, err
+	}
+	applied, err := appliedVersions(c, db, migrations)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return m, applied[version], nil
+}
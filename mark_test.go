@@ -0,0 +1,69 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkApplied(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "one")
+	writeSQLMigration(t, dir, 2, "two")
+
+	// The DBA created table two by hand.
+	if _, err := db.Exec("CREATE TABLE two (id int)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run("mark-applied", db, dir, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkApplied(db, dir, 2); err == nil {
+		t.Error("expected marking an applied migration to fail")
+	}
+	if err := MarkApplied(db, dir, 3); err == nil {
+		t.Error("expected marking a missing migration to fail")
+	}
+
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := AppliedDBVersions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied[1] || !applied[2] {
+		t.Fatalf("expected 1 and 2 to be applied, got %v", applied)
+	}
+
+	if err := MarkUnapplied(db, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkUnapplied(db, dir, 2); err == nil {
+		t.Error("expected marking an unapplied migration to fail")
+	}
+	if _, err := db.Exec("SELECT * FROM two"); err != nil {
+		t.Errorf("expected table two to be left alone: %v", err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 1 {
+		t.Errorf("expected version 1, got %d (%v)", v, err)
+	}
+}
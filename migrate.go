@@ -3,10 +3,13 @@ package goose
 import (
 	"database/sql"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,14 +21,22 @@ var (
 	// ErrNoNextVersion when the next migration version is not found.
 	ErrNoNextVersion = errors.New("no next version found")
 	// MaxVersion is the maximum allowed version.
-	MaxVersion int64 = 9223372036854775807 // max(int64)
+	MaxVersion int64 = math.MaxInt64
 
+	registryMu             sync.RWMutex
 	registeredGoMigrations = map[int64]*Migration{}
 )
 
+// MinVersion is the lowest version, the one of a database without
+// migrations.
+const MinVersion int64 = 0
+
 // Migrations slice.
 type Migrations []*Migration
 
+// TimestampedMigrations is Migrations, kept for compatibility.
+type TimestampedMigrations = Migrations
+
 // helpers so we can use pkg sort
 func (ms Migrations) Len() int      { return len(ms) }
 func (ms Migrations) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
@@ -36,19 +47,29 @@ func (ms Migrations) Less(i, j int) bool {
 	return ms[i].Version < ms[j].Version
 }
 
-// Current gets the current migration.
-func (ms Migrations) Current(current int64) (*Migration, error) {
-	for i, migration := range ms {
-		if migration.Version == current {
-			return ms[i], nil
+// ByVersion returns the migration with the given version, if any.
+func (ms Migrations) ByVersion(version int64) (*Migration, bool) {
+	for _, m := range ms {
+		if m.Version == version {
+			return m, true
 		}
 	}
+	return nil, false
+}
 
+// Current gets the current migration.
+func (ms Migrations) Current(current int64) (*Migration, error) {
+	if m, ok := ms.ByVersion(current); ok {
+		return m, nil
+	}
 	return nil, ErrNoCurrentVersion
 }
 
 // Next gets the next migration.
 func (ms Migrations) Next(current int64) (*Migration, error) {
+	if len(ms) == 0 {
+		return nil, ErrNoNextVersion
+	}
 	if current == 0 {
 		return ms[0], nil
 	}
@@ -107,41 +128,45 @@ func (ms Migrations) Last() (*Migration, error) {
 	return ms[len(ms)-1], nil
 }
 
-// Versioned gets versioned migrations.
-func (ms Migrations) versioned() (Migrations, error) {
+// Versioned returns the migrations with sequential versions, as opposed
+// to timestamps.
+func (ms Migrations) Versioned() Migrations {
+	c := runConfig()
 	var migrations Migrations
-
-	// assume that the user will never have more than 19700101000000 migrations
 	for _, m := range ms {
-		// parse version as timestmap
-		versionTime, err := time.Parse(timestampFormat, fmt.Sprintf("%d", m.Version))
-
-		if versionTime.Before(time.Unix(0, 0)) || err != nil {
+		if !isTimestamp(c, m.Version) {
 			migrations = append(migrations, m)
 		}
 	}
-
-	return migrations, nil
+	return migrations
 }
 
-// Timestamped gets the timestamped migrations.
-func (ms Migrations) timestamped() (Migrations, error) {
+// Timestamped returns the migrations with timestamp versions, like the ones
+// created by default.
+func (ms Migrations) Timestamped() Migrations {
+	c := runConfig()
 	var migrations Migrations
-
-	// assume that the user will never have more than 19700101000000 migrations
 	for _, m := range ms {
-		// parse version as timestmap
-		versionTime, err := time.Parse(timestampFormat, fmt.Sprintf("%d", m.Version))
-		if err != nil {
-			// probably not a timestamp
-			continue
+		if isTimestamp(c, m.Version) {
+			migrations = append(migrations, m)
 		}
+	}
+	return migrations
+}
 
-		if versionTime.After(time.Unix(0, 0)) {
-			migrations = append(migrations, m)
+// isTimestamp reports whether the version is a timestamp rather than a
+// sequential version, assuming there are never more than 19700101000000
+// sequential migrations. Timestamps may be in the timestamp format or in
+// the default one, with or without milliseconds, so versions created
+// before the format changed are still timestamps.
+func isTimestamp(c *config, version int64) bool {
+	for _, layout := range []string{c.timestampFormat, defaultTimestampFormat, millisecondTimestampFormat} {
+		t, err := parseTimestamp(layout, fmt.Sprint(version))
+		if err == nil && t.After(time.Unix(0, 0)) {
+			return true
 		}
 	}
-	return migrations, nil
+	return false
 }
 
 func (ms Migrations) String() string {
@@ -152,151 +177,133 @@ func (ms Migrations) String() string {
 	return str
 }
 
-type TimestampedMigrations Migrations
-
-// helpers so we can use pkg sort
-func (ms TimestampedMigrations) Len() int      { return len(ms) }
-func (ms TimestampedMigrations) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
-func (ms TimestampedMigrations) Less(i, j int) bool {
-	if ms[i].Version == ms[j].Version {
-		panic(fmt.Sprintf("goose: duplicate version %v detected:\n%v\n%v", ms[i].Version, ms[i].Source, ms[j].Source))
-	}
-	return ms[i].Version < ms[j].Version
+// AddMigration adds a migration.
+func AddMigration(up func(*sql.Tx) error, down func(*sql.Tx) error) {
+	_, filename, _, _ := runtime.Caller(1)
+	AddNamedMigration(filename, up, down)
 }
 
-// Current gets the current migration.
-func (ms TimestampedMigrations) Current(current int64) (*Migration, error) {
-	for i, migration := range ms {
-		if migration.Version == current {
-			return ms[i], nil
+// AddNamedMigration : Add a named migration.
+//
+// Files in a version directory are registered as its steps.
+func AddNamedMigration(filename string, up func(*sql.Tx) error, down func(*sql.Tx) error) {
+	c := runConfig()
+	if dir := filepath.Dir(filename); dir != "." {
+		if _, err := dirVersion(c, dir); err == nil {
+			addStep(filename, up, down)
+			return
 		}
 	}
 
-	return nil, ErrNoCurrentVersion
+	v, _ := parseVersion(c, filename)
+	registerMigration(v, filename, up, down)
 }
 
-// Next gets the next migration.
-func (ms TimestampedMigrations) Next(current int64) (*Migration, error) {
-	cur, err := ms.Current(current)
-	if err != nil {
-		return nil, err
-	}
-	if cur.Next == -1 {
-		return nil, ErrNoNextVersion
+// AddMigrationVersion adds a Go migration with an explicit version, for
+// migrations registered from helper constructors or generated code, whose
+// versions can't be derived from the name of the calling file. The name is
+// only used in logs and errors.
+func AddMigrationVersion(version int64, name string, up func(*sql.Tx) error, down func(*sql.Tx) error) {
+	if version <= MinVersion {
+		panic(fmt.Sprintf("failed to add migration %q: migration IDs must be greater than zero", name))
 	}
-	next, err := ms.Current(cur.Next)
-	if err != nil {
-		return nil, err
-	}
-
-	return next, nil
+	registerMigration(version, name, up, down)
 }
 
-// Previous : Get the previous migration.
-func (ms TimestampedMigrations) Previous(current int64) (*Migration, error) {
-	cur, err := ms.Current(current)
-	if err != nil {
-		return nil, err
+// AddSQLMigration adds a SQL migration from the statements of its Up and
+// Down sections, without any file, e.g. for migrations defined by code
+// generators or configuration. The sections are parsed like the sections
+// of SQL migration files, so they may use StatementBegin and StatementEnd,
+// and run in a transaction like Go migrations; the NO TRANSACTION, FOREIGN
+// KEYS OFF, TIMEOUT and COPY annotations are not supported. The name is
+// only used in logs and errors.
+func AddSQLMigration(version int64, name, upSQL, downSQL string) {
+	c := runConfig()
+	if version <= MinVersion {
+		panic(fmt.Sprintf("failed to add migration %q: migration IDs must be greater than zero", name))
 	}
-	if cur.Previous == -1 {
-		return nil, ErrNoNextVersion
+
+	up, err := sqlSection(c, upSQL, true)
+	if err != nil {
+		panic(fmt.Sprintf("failed to add migration %q: %v", name, err))
 	}
-	prev, err := ms.Current(cur.Previous)
+	down, err := sqlSection(c, downSQL, false)
 	if err != nil {
-		return nil, err
+		panic(fmt.Sprintf("failed to add migration %q: %v", name, err))
 	}
-
-	return prev, nil
+	registerMigration(version, name, Statements(up...), Statements(down...))
 }
 
-// Last gets the last migration.
-func (ms TimestampedMigrations) Last() (*Migration, error) {
-	if len(ms) == 0 {
-		return nil, ErrNoNextVersion
+// sqlSection parses the statements of an Up or Down section.
+func sqlSection(c *config, src string, direction bool) ([]string, error) {
+	annotation := "-- +goose Down\n"
+	if direction {
+		annotation = "-- +goose Up\n"
 	}
 
-	return ms[len(ms)-1], nil
-}
-
-// Versioned gets versioned migrations.
-func (ms TimestampedMigrations) versioned() (TimestampedMigrations, error) {
-	var migrations TimestampedMigrations
-
-	// assume that the user will never have more than 19700101000000 migrations
-	for _, m := range ms {
-		// parse version as timestmap
-		versionTime, err := time.Parse(timestampFormat, fmt.Sprintf("%d", m.Version))
-
-		if versionTime.Before(time.Unix(0, 0)) || err != nil {
-			migrations = append(migrations, m)
-		}
+	parsed, err := parseSQLMigration(c, strings.NewReader(annotation+src+"\n"), direction)
+	if err != nil {
+		return nil, err
 	}
-
-	return migrations, nil
+	if unsupported := unsupportedInGo(parsed); unsupported != "" {
+		return nil, errors.Errorf("the %s annotation is not supported", unsupported)
+	}
+	return stripAnnotations(parsed.statements), nil
 }
 
-// Timestamped gets the timestamped migrations.
-func (ms TimestampedMigrations) timestamped() (TimestampedMigrations, error) {
-	var migrations TimestampedMigrations
-
-	// assume that the user will never have more than 19700101000000 migrations
-	for _, m := range ms {
-		// parse version as timestmap
-		versionTime, err := time.Parse(timestampFormat, fmt.Sprintf("%d", m.Version))
-		if err != nil {
-			// probably not a timestamp
-			continue
-		}
+func registerMigration(v int64, source string, up func(*sql.Tx) error, down func(*sql.Tx) error) {
+	migration := &Migration{Version: v, Next: -1, Previous: -1, Registered: true, UpFn: up, DownFn: down, Source: source}
 
-		if versionTime.After(time.Unix(0, 0)) {
-			migrations = append(migrations, m)
-		}
-	}
-	return migrations, nil
-}
+	registryMu.Lock()
+	defer registryMu.Unlock()
 
-func (ms TimestampedMigrations) String() string {
-	str := ""
-	for _, m := range ms {
-		str += fmt.Sprintln(m)
+	if existing, ok := registeredGoMigrations[v]; ok {
+		panic(fmt.Sprintf("failed to add migration %q: version conflicts with %q", source, existing.Source))
 	}
-	return str
-}
 
-// AddMigration adds a migration.
-func AddMigration(up func(*sql.Tx) error, down func(*sql.Tx) error) {
-	_, filename, _, _ := runtime.Caller(1)
-	AddNamedMigration(filename, up, down)
+	registeredGoMigrations[v] = migration
 }
 
-// AddNamedMigration : Add a named migration.
-func AddNamedMigration(filename string, up func(*sql.Tx) error, down func(*sql.Tx) error) {
-	v, _ := NumericComponent(filename)
-	migration := &Migration{Version: v, Next: -1, Previous: -1, Registered: true, UpFn: up, DownFn: down, Source: filename}
+// registeredMigrations returns a snapshot of the registered Go migrations.
+func registeredMigrations() map[int64]*Migration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
 
-	if existing, ok := registeredGoMigrations[v]; ok {
-		panic(fmt.Sprintf("failed to add migration %q: version conflicts with %q", filename, existing.Source))
+	registered := make(map[int64]*Migration, len(registeredGoMigrations))
+	for v, m := range registeredGoMigrations {
+		registered[v] = m
 	}
 
-	registeredGoMigrations[v] = migration
+	return registered
 }
 
 // CollectMigrations returns all the valid looking migration scripts in the
 // migrations folder and go func registry, and key them by version.
+//
+// Only the versions between current and target are returned: the ones
+// above current up to target when migrating up, and the ones up to current
+// above target when migrating down. Use CollectMigrationsRange and
+// CollectPending for plain ranges.
 func CollectMigrations(dirpath string, current, target int64) (Migrations, error) {
-	if _, err := os.Stat(dirpath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("%s directory does not exists", dirpath)
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return collectMigrations(c, dirpath, current, target)
+}
+
+// collectMigrations is CollectMigrations, for callers holding runMu.
+func collectMigrations(c *config, dirpath string, current, target int64) (Migrations, error) {
+	sqlMigrationFiles, goMigrationFiles, versionDirs, err := migrationFiles(c, dirpath)
+	if err != nil {
+		return nil, err
 	}
+	registered := registeredMigrations()
 
 	var migrations Migrations
 
 	// SQL migration files.
-	sqlMigrationFiles, err := filepath.Glob(dirpath + "/**.sql")
-	if err != nil {
-		return nil, err
-	}
 	for _, file := range sqlMigrationFiles {
-		v, err := NumericComponent(file)
+		v, err := parseVersion(c, file)
 		if err != nil {
 			return nil, err
 		}
@@ -306,30 +313,38 @@ func CollectMigrations(dirpath string, current, target int64) (Migrations, error
 		}
 	}
 
-	// Go migrations registered via goose.AddMigration().
-	for _, migration := range registeredGoMigrations {
-		v, err := NumericComponent(migration.Source)
+	// Version directories.
+	for _, dir := range versionDirs {
+		v, err := dirVersion(c, dir)
 		if err != nil {
 			return nil, err
 		}
 		if versionFilter(v, current, target) {
+			migration := &Migration{Version: v, Next: -1, Previous: -1, Source: dir, dir: true}
 			migrations = append(migrations, migration)
 		}
 	}
 
-	// Go migration files
-	goMigrationFiles, err := filepath.Glob(dirpath + "/**.go")
-	if err != nil {
-		return nil, err
+	// Go migrations registered via goose.AddMigration().
+	for _, migration := range registered {
+		v := migration.Version
+		if v <= MinVersion {
+			return nil, errors.Errorf("registered Go migration %q has no version", migration.Source)
+		}
+		if versionFilter(v, current, target) {
+			migrations = append(migrations, migration)
+		}
 	}
+
+	// Go migration files
 	for _, file := range goMigrationFiles {
-		v, err := NumericComponent(file)
+		v, err := parseVersion(c, file)
 		if err != nil {
 			continue // Skip any files that don't have version prefix.
 		}
 
 		// Skip migrations already existing migrations registered via goose.AddMigration().
-		if _, ok := registeredGoMigrations[v]; ok {
+		if _, ok := registered[v]; ok {
 			continue
 		}
 
@@ -339,27 +354,95 @@ func CollectMigrations(dirpath string, current, target int64) (Migrations, error
 		}
 	}
 
+	if err := checkDuplicateVersions(migrations); err != nil {
+		return nil, err
+	}
+	if err := applyManifest(c, dirpath, migrations); err != nil {
+		return nil, err
+	}
 	migrations = sortAndConnectMigrations(migrations)
 
 	return migrations, nil
 }
 
+// CollectMigrationsRange returns the migrations with versions from from to
+// to, inclusive. CollectMigrationsRange(dir, MinVersion, MaxVersion)
+// returns all of them.
+func CollectMigrationsRange(dirpath string, from, to int64) (Migrations, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return collectMigrationsRange(c, dirpath, from, to)
+}
+
+// collectMigrationsRange is CollectMigrationsRange, for callers holding runMu.
+func collectMigrationsRange(c *config, dirpath string, from, to int64) (Migrations, error) {
+	if from > to {
+		return nil, errors.Errorf("invalid version range %d to %d", from, to)
+	}
+	// Versions start above MinVersion, which keeps from-1 from
+	// overflowing.
+	if from < MinVersion {
+		from = MinVersion
+	}
+
+	return collectMigrations(c, dirpath, from-1, to)
+}
+
+// CollectPending returns the migrations that are not applied to db,
+// including the ones older than the current version, which Up skips.
+// Their Previous and Next versions refer to all the migrations.
+func CollectPending(db *sql.DB, dirpath string) (Migrations, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return collectPending(c, db, dirpath)
+}
+
+// collectPending is CollectPending, for callers holding runMu.
+func collectPending(c *config, db *sql.DB, dirpath string) (Migrations, error) {
+	migrations, err := collectMigrationsRange(c, dirpath, MinVersion, MaxVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(c, db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending Migrations
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
+
 // CollectAllMigrations returns all the valid looking migration scripts in the
 // migrations folder and go func registry, and key them by version.
 func CollectAllMigrations(dirpath string, applied map[int64]bool, current, target int64) (Migrations, error) {
-	if _, err := os.Stat(dirpath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("%s directory does not exists", dirpath)
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return collectAllMigrations(c, dirpath, applied, current, target)
+}
+
+// collectAllMigrations is CollectAllMigrations, for callers holding runMu.
+func collectAllMigrations(c *config, dirpath string, applied map[int64]bool, current, target int64) (Migrations, error) {
+	sqlMigrationFiles, goMigrationFiles, versionDirs, err := migrationFiles(c, dirpath)
+	if err != nil {
+		return nil, err
 	}
+	registered := registeredMigrations()
 
 	var migrations Migrations
 
 	// SQL migration files.
-	sqlMigrationFiles, err := filepath.Glob(dirpath + "/**.sql")
-	if err != nil {
-		return nil, err
-	}
 	for _, file := range sqlMigrationFiles {
-		v, err := NumericComponent(file)
+		v, err := parseVersion(c, file)
 		if err != nil {
 			return nil, err
 		}
@@ -369,30 +452,38 @@ func CollectAllMigrations(dirpath string, applied map[int64]bool, current, targe
 		}
 	}
 
-	// Go migrations registered via goose.AddMigration().
-	for _, migration := range registeredGoMigrations {
-		v, err := NumericComponent(migration.Source)
+	// Version directories.
+	for _, dir := range versionDirs {
+		v, err := dirVersion(c, dir)
 		if err != nil {
 			return nil, err
 		}
 		if unappliedVersionFilter(v, current, target, applied[v]) {
+			migration := &Migration{Version: v, Next: -1, Previous: -1, Source: dir, dir: true}
 			migrations = append(migrations, migration)
 		}
 	}
 
-	// Go migration files
-	goMigrationFiles, err := filepath.Glob(dirpath + "/**.go")
-	if err != nil {
-		return nil, err
+	// Go migrations registered via goose.AddMigration().
+	for _, migration := range registered {
+		v := migration.Version
+		if v <= MinVersion {
+			return nil, errors.Errorf("registered Go migration %q has no version", migration.Source)
+		}
+		if unappliedVersionFilter(v, current, target, applied[v]) {
+			migrations = append(migrations, migration)
+		}
 	}
+
+	// Go migration files
 	for _, file := range goMigrationFiles {
-		v, err := NumericComponent(file)
+		v, err := parseVersion(c, file)
 		if err != nil {
 			continue // Skip any files that don't have version prefix.
 		}
 
 		// Skip migrations already existing migrations registered via goose.AddMigration().
-		if _, ok := registeredGoMigrations[v]; ok {
+		if _, ok := registered[v]; ok {
 			continue
 		}
 
@@ -402,65 +493,181 @@ func CollectAllMigrations(dirpath string, applied map[int64]bool, current, targe
 		}
 	}
 
-	migrations = sortAndConnectAllMigrations(migrations, applied)
+	if err := checkDuplicateVersions(migrations); err != nil {
+		return nil, err
+	}
+	if err := applyManifest(c, dirpath, migrations); err != nil {
+		return nil, err
+	}
+	migrations = NewPlan(applied, migrations).Migrations()
 
 	return migrations, nil
 }
 
-func sortAndConnectAllMigrations(migrations Migrations, applied map[int64]bool) Migrations {
-	sort.Sort(migrations)
+// EmptyDirMode is how a missing or empty migrations directory is handled.
+type EmptyDirMode int
+
+const (
+	// EmptyDirDefault fails on a missing directory and treats an empty one
+	// as having no migrations.
+	EmptyDirDefault EmptyDirMode = iota
+	// EmptyDirAllow treats a missing or empty directory as having no
+	// migrations, so Up is a no-op, e.g. for services shipped before their
+	// first migration.
+	EmptyDirAllow
+	// EmptyDirStrict fails on a missing directory and on a directory
+	// without migrations, unless Go migrations are registered.
+	EmptyDirStrict
+)
 
-	var am Migrations
-	var um Migrations
+func (m EmptyDirMode) String() string {
+	switch m {
+	case EmptyDirAllow:
+		return "allow"
+	case EmptyDirStrict:
+		return "strict"
+	}
+	return "default"
+}
 
-	// now that we're sorted in the appropriate direction,
-	// populate next and previous for each migration
-	for _, m := range migrations {
-		a := applied[m.Version]
-		// append applied
-		if a {
-			m.Applied = true
-			am = append(am, m)
-			continue
-		}
-		//append unapplied
-		um = append(um, m)
+// SetEmptyDirMode sets how a missing or empty migrations directory is
+// handled.
+func SetEmptyDirMode(m EmptyDirMode) {
+	updateConfig(func(c *config) { c.emptyDirMode = m })
+}
+
+// emptyDirError is the error for a missing migrations directory, or one
+// without migrations, as set with SetEmptyDirMode.
+type emptyDirError struct {
+	dir     string
+	missing bool
+}
+
+func (e *emptyDirError) Error() string {
+	if e.missing {
+		return fmt.Sprintf("%s directory does not exists", e.dir)
 	}
-	//connect applied migrations
-	for i, m := range am {
-		prev := int64(-1)
-		if i > 0 {
-			prev = migrations[i-1].Version
-			migrations[i-1].Next = m.Version
+	return fmt.Sprintf("%s directory has no migrations", e.dir)
+}
+
+// readMigrationDir returns the names of the entries of the migrations
+// directory, with a missing directory handled as set with SetEmptyDirMode.
+func readMigrationDir(c *config, dirpath string) ([]string, error) {
+	names, err := c.source.ReadDir(dirpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if c.emptyDirMode == EmptyDirAllow {
+				return nil, nil
+			}
+			return nil, &emptyDirError{dir: dirpath, missing: true}
 		}
-		migrations[i].Previous = prev
+		return nil, err
 	}
-	//connect unapplied migrations
-	for i, m := range um {
-		prev := int64(-1)
-		if i > 0 {
-			prev = um[i-1].Version
-			um[i-1].Next = m.Version
-		}
-		um[i].Previous = prev
+
+	return names, nil
+}
+
+// migrationFiles returns the paths of the SQL and Go files and of the
+// version directories in dirpath.
+func migrationFiles(c *config, dirpath string) (sqlFiles, goFiles, dirs []string, err error) {
+	sqlFiles, goFiles, dirs, _, err = walkMigrationFiles(c, dirpath)
+	return sqlFiles, goFiles, dirs, err
+}
+
+// walkMigrationFiles is migrationFiles, also returning the paths of the
+// .down.sql files, which are read with their paired .up.sql migrations.
+func walkMigrationFiles(c *config, dirpath string) (sqlFiles, goFiles, dirs, downFiles []string, err error) {
+	names, err := readMigrationDir(c, dirpath)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 
-	if len(am) == 0 {
-		migrations = um
-		return migrations
+	m, err := loadManifest(c, dirpath, names)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	excludes, err := excludePatterns(c, dirpath, names)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 
-	if len(um) != 0 {
-		if len(um) == 1 {
-			um[0].Next = -1
+	root := dirpath
+	repeatables := 0
+	visited := make(map[string]bool)
+	var walk func(dirpath string, names []string)
+	walk = func(dirpath string, names []string) {
+		for _, name := range names {
+			if m.excluded(name) || matchesAny(excludes, name) {
+				continue
+			}
+			switch fileExt(name) {
+			case ".sql":
+				if strings.HasSuffix(name, downSQLSuffix) {
+					downFiles = append(downFiles, filepath.Join(dirpath, name))
+					continue // read with the paired .up.sql migration
+				}
+				if isRepeatable(name) {
+					repeatables++
+					continue // applied by applyRepeatables
+				}
+				if isHookScript(c, filepath.Join(dirpath, name), root) {
+					continue // run by hooks
+				}
+				if isSchemaDump(c, filepath.Join(dirpath, name)) {
+					continue // written by writeSchemaDump
+				}
+				sqlFiles = append(sqlFiles, filepath.Join(dirpath, name))
+			case ".go":
+				if strings.HasSuffix(name, "_test.go") {
+					continue // compiled by go test only
+				}
+				goFiles = append(goFiles, filepath.Join(dirpath, name))
+			default:
+				path := filepath.Join(dirpath, name)
+				if _, err := dirVersion(c, name); err == nil {
+					if _, err := c.source.ReadDir(path); err == nil {
+						dirs = append(dirs, path)
+					}
+					continue
+				}
+				if !c.recursive || strings.HasPrefix(name, ".") || visited[realPath(c, path)] {
+					continue
+				}
+				if sub, err := c.source.ReadDir(path); err == nil {
+					visited[realPath(c, path)] = true
+					walk(path, sub)
+				}
+			}
 		}
-		am[len(am)-1].Next = um[0].Version
-		um[0].Previous = am[len(am)-1].Version
 	}
+	visited[realPath(c, dirpath)] = true
+	walk(dirpath, names)
 
-	migrations = append(am, um...)
+	if c.emptyDirMode == EmptyDirStrict && len(sqlFiles)+len(goFiles)+len(dirs)+repeatables == 0 && len(registeredMigrations()) == 0 {
+		return nil, nil, nil, nil, &emptyDirError{dir: dirpath}
+	}
 
-	return migrations
+	return sqlFiles, goFiles, dirs, downFiles, nil
+}
+
+// realPath resolves the symlinks of a path of the local filesystem, so a
+// recursive walk doesn't loop through symlinked directories.
+func realPath(c *config, path string) string {
+	if _, ok := c.source.(osSource); ok {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// SetRecursive sets whether migrations are also collected from the
+// subdirectories of the migrations directory, e.g. one per team, and
+// sorted together by version. Directories named like versions are always
+// version directories, and hidden ones are skipped. Exclusions of the
+// migrations directory apply to the names of subdirectories too.
+func SetRecursive(v bool) {
+	updateConfig(func(c *config) { c.recursive = v })
 }
 
 func sortAndConnectMigrations(migrations Migrations) Migrations {
@@ -468,6 +675,7 @@ func sortAndConnectMigrations(migrations Migrations) Migrations {
 
 	// now that we're sorted in the appropriate direction,
 	// populate next and previous for each migration
+	sum := ""
 	for i, m := range migrations {
 		prev := int64(-1)
 		if i > 0 {
@@ -475,6 +683,11 @@ func sortAndConnectMigrations(migrations Migrations) Migrations {
 			migrations[i-1].Next = m.Version
 		}
 		migrations[i].Previous = prev
+
+		// checksums of the applied set, for the compact version table
+		m.previousSetChecksum = sum
+		sum = appliedSetChecksum(sum, m.Version)
+		m.setChecksum = sum
 	}
 
 	return migrations
@@ -508,12 +721,29 @@ func unappliedVersionFilter(v, current, target int64, applied bool) bool {
 // retrieve the current version for this DB.
 // Create and initialize the DB version table if it doesn't exist.
 func AppliedDBVersions(db *sql.DB) (map[int64]bool, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return appliedDBVersions(c, db)
+}
+
+// appliedDBVersions is AppliedDBVersions, for callers holding runMu.
+func appliedDBVersions(c *config, db *sql.DB) (map[int64]bool, error) {
+	if s := currentStore(c); s != nil {
+		return storeApplied(s, db)
+	}
+	if c.compactVersionTable {
+		return nil, ErrCompactVersionTable
+	}
 
 	applied := make(map[int64]bool)
 
-	rows, err := GetDialect().dbVersionQuery(db)
+	rows, err := queryVersionTable(c, db)
+	if isVersionTableMissing(err) {
+		return applied, createMissingVersionTable(c, db)
+	}
 	if err != nil {
-		return applied, initVersionTable(db)
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -522,7 +752,7 @@ func AppliedDBVersions(db *sql.DB) (map[int64]bool, error) {
 	for rows.Next() {
 		var row MigrationRecord
 		if err = rows.Scan(&row.ID, &row.VersionID, &row.IsApplied, &row.TStamp); err != nil {
-			log.Fatal("error scanning rows:", err)
+			c.logger.Fatal("error scanning rows:", err)
 		}
 
 		// Mark a migration as applied, only if the latest occurrence of it is
@@ -538,60 +768,137 @@ func AppliedDBVersions(db *sql.DB) (map[int64]bool, error) {
 	return applied, nil
 }
 
-// EnsureDBVersion retrieves the current version for this DB.
-// Create and initialize the DB version table if it doesn't exist.
-func EnsureDBVersion(db *sql.DB) (int64, error) {
-	rows, err := GetDialect().dbVersionQuery(db)
+// appliedVersions returns the versions of migrations that are applied. With
+// a compact version table, these are the ones up to the current version.
+func appliedVersions(c *config, db *sql.DB, migrations Migrations) (map[int64]bool, error) {
+	if !c.compactVersionTable || currentStore(c) != nil {
+		return appliedDBVersions(c, db)
+	}
+
+	current, err := compactDBVersion(c, db)
 	if err != nil {
-		return 0, initVersionTable(db)
+		return nil, err
 	}
-	defer rows.Close()
 
-	// The most recent record for each migration specifies
-	// whether it has been applied or rolled back.
-	// The first version we find that has been applied is the current version.
+	applied := make(map[int64]bool)
+	for _, m := range migrations {
+		if m.Version <= current {
+			applied[m.Version] = true
+		}
+	}
 
-	toSkip := make([]int64, 0)
+	return applied, nil
+}
+
+// appliedDBVersionsInOrder returns the applied versions, most recently
+// applied first, following the insertion order of the version table.
+func appliedDBVersionsInOrder(c *config, db *sql.DB) ([]int64, error) {
+	if s := currentStore(c); s != nil {
+		versions, err := storeVersions(s, db, true)
+		if err != nil {
+			return nil, err
+		}
+		for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+			versions[i], versions[j] = versions[j], versions[i]
+		}
+		return versions, nil
+	}
+	if c.compactVersionTable {
+		current, err := compactDBVersion(c, db)
+		if err != nil || current == 0 {
+			return nil, err
+		}
+		return []int64{current}, nil
+	}
+
+	rows, err := queryVersionTable(c, db)
+	if isVersionTableMissing(err) {
+		return nil, createMissingVersionTable(c, db)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []int64
+	seen := make(map[int64]bool)
 
 	for rows.Next() {
 		var row MigrationRecord
 		if err = rows.Scan(&row.ID, &row.VersionID, &row.IsApplied, &row.TStamp); err != nil {
-			return 0, errors.Wrap(err, "failed to scan row")
+			return nil, errors.Wrap(err, "failed to scan row")
 		}
 
-		// have we already marked this version to be skipped?
-		skip := false
-		for _, v := range toSkip {
-			if v == row.VersionID {
-				skip = true
-				break
-			}
-		}
-
-		if skip {
+		// Only the latest occurrence of a version decides whether it is applied.
+		if seen[row.VersionID] {
 			continue
 		}
+		seen[row.VersionID] = true
 
-		// if version has been applied we're done
-		if row.IsApplied {
-			return row.VersionID, nil
+		if row.IsApplied && row.VersionID != 0 {
+			versions = append(versions, row.VersionID)
 		}
-
-		// latest version of migration has not been applied.
-		toSkip = append(toSkip, row.VersionID)
 	}
 	if err := rows.Err(); err != nil {
-		return 0, errors.Wrap(err, "failed to get next row")
+		return nil, errors.Wrap(err, "failed to get next row")
 	}
+
+	return versions, nil
+}
+
+// EnsureDBVersion retrieves the current version for this DB.
+// Create and initialize the DB version table if it doesn't exist.
+// Unless SetDialect was called, the dialect is detected from the driver of
+// db first. A fresh database and one whose migrations were all rolled back
+// are both at version 0; use CurrentState to tell them apart.
+func EnsureDBVersion(db *sql.DB) (int64, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return ensureDBVersion(c, db)
+}
+
+// ensureDBVersion is EnsureDBVersion, for callers holding runMu.
+func ensureDBVersion(c *config, db *sql.DB) (int64, error) {
+	detectDialect(c, db)
+
+	if s := currentStore(c); s != nil {
+		return storeDBVersion(s, db)
+	}
+	if c.compactVersionTable {
+		return compactDBVersion(c, db)
+	}
+
+	// The most recent record for each migration specifies
+	// whether it has been applied or rolled back.
+	// The latest migration still applied is the current version.
+	var version int64
+	err := db.QueryRow(currentVersionSQL(c, c.dialect)).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		if err := versionTableError(c, err); !isVersionTableMissing(err) {
+			return 0, err
+		}
+		if err := createMissingVersionTable(c, db); err != nil {
+			return 0, err
+		}
+		return 0, ensureVersionTableTTL(c, db)
+	}
+	if err := ensureVersionIndex(c, db); err != nil {
+		return 0, err
+	}
+	if err := ensureVersionTableTTL(c, db); err != nil {
+		return 0, err
+	}
+	if err == nil {
+		return version, nil
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to begin transaction")
 	}
 
-	if err := insertInitialMigration(tx); err != nil {
-		if err := tx.Rollback(); err != nil {
-			return 0, err
-		}
+	if err := insertInitialMigration(c, tx); err != nil {
 		return 0, errors.Wrap(err, "failed to insert initial migration")
 	}
 	if err := tx.Commit(); err != nil {
@@ -600,46 +907,169 @@ func EnsureDBVersion(db *sql.DB) (int64, error) {
 	return 0, nil
 }
 
+// versionIndexes holds the version tables whose index is known to exist.
+var versionIndexes sync.Map
+
+type versionIndexKey struct {
+	db    *sql.DB
+	table string
+}
+
+// ensureVersionIndex creates the index of the version table if it is
+// missing, e.g. on version tables created by older releases. The version
+// table of a database is only checked once per process.
+func ensureVersionIndex(c *config, db *sql.DB) error {
+	d := c.dialect
+	key := versionIndexKey{db: db, table: c.versionTableName()}
+	if _, ok := versionIndexes.Load(key); ok {
+		return nil
+	}
+	checker, ok := d.(versionIndexChecker)
+	if !ok || d.createVersionIndexSQL(c) == "" {
+		return nil
+	}
+
+	query, args := checker.versionIndexExistsQuery(c)
+	var exists int
+	if err := db.QueryRow(bind(c, query), args...).Scan(&exists); err != nil {
+		return errors.Wrap(err, "failed to query the index of the version table")
+	}
+	if exists == 0 {
+		if _, err := db.Exec(d.createVersionIndexSQL(c)); err != nil {
+			return errors.Wrap(err, "failed to create the index of the version table")
+		}
+	}
+	versionIndexes.Store(key, true)
+	return nil
+}
+
+// versionTableExists reports whether the version table exists, without
+// creating it. Version stores are always reported to exist.
+func versionTableExists(c *config, db *sql.DB) (bool, error) {
+	if currentStore(c) != nil {
+		return true, nil
+	}
+
+	t := versionTableFor(c, c.dialect)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE 1 = 0", t.versionID, t.name))
+	if err != nil {
+		if err := versionTableError(c, err); !isVersionTableMissing(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	rows.Close()
+	return true, nil
+}
+
+// queryVersionTable queries the version table, returning an
+// ErrVersionTableMissing if it doesn't exist.
+func queryVersionTable(c *config, db *sql.DB) (*sql.Rows, error) {
+	rows, err := c.dialect.dbVersionQuery(c, db)
+	if err != nil {
+		return nil, versionTableError(c, err)
+	}
+	return rows, nil
+}
+
+// versionTableError returns an ErrVersionTableMissing if the query of the
+// version table failed because it doesn't exist, so other failures, like
+// missing permissions or a lost connection, aren't mistaken for a new
+// database.
+func versionTableError(c *config, err error) error {
+	if c.dialect.isMissingTable(err) {
+		return &ErrVersionTableMissing{Table: c.versionTableName(), Err: err}
+	}
+	return errors.Wrap(err, "failed to query version table")
+}
+
+func isVersionTableMissing(err error) bool {
+	_, ok := err.(*ErrVersionTableMissing)
+	return ok
+}
+
+// createMissingVersionTable creates the version table after a query found
+// it missing, returning an ErrVersionTableMissing if it can't. A table
+// created meanwhile by a concurrent process is not an error.
+func createMissingVersionTable(c *config, db *sql.DB) error {
+	err := initVersionTable(c, db)
+	if err == nil {
+		return nil
+	}
+
+	t := versionTableFor(c, c.dialect)
+	exists := fmt.Sprintf("SELECT %s FROM %s WHERE 1 = 0", t.versionID, t.name)
+	if _, existsErr := db.Exec(exists); existsErr == nil {
+		return nil
+	}
+	return &ErrVersionTableMissing{Table: c.versionTableName(), Err: err}
+}
+
 // Create the db version table
 // and insert the initial 0 value into it
-func initVersionTable(db *sql.DB) error {
+func initVersionTable(c *config, db *sql.DB) error {
+	ddlInTx := transactionalDDL(c.dialect)
+	if !ddlInTx {
+		if err := createVersionTable(c, db); err != nil {
+			return errors.Wrap(err, "failed to create version table")
+		}
+	}
+
 	txn, err := db.Begin()
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to begin transaction")
 	}
 
-	if err := createVersionTable(txn); err != nil {
-		if err := txn.Rollback(); err != nil {
-			return err
+	if ddlInTx {
+		if err := createVersionTable(c, txn); err != nil {
+			txn.Rollback()
+			return errors.Wrap(err, "failed to create version table")
 		}
 	}
 
-	if err := insertInitialMigration(txn); err != nil {
-		if err := txn.Rollback(); err != nil {
-			return err
-		}
+	if err := insertInitialMigration(c, txn); err != nil {
+		return errors.Wrap(err, "failed to insert initial migration")
 	}
 
 	return txn.Commit()
 }
 
-func createVersionTable(tx *sql.Tx) error {
-	d := GetDialect()
+func createVersionTable(c *config, tx Querier) error {
+	if err := createSchema(c, tx); err != nil {
+		return err
+	}
+
+	d := c.dialect
 
-	if _, err := tx.Exec(d.createVersionTableSQL()); err != nil {
+	query := d.createVersionTableSQL(c)
+	if c.compactVersionTable {
+		query = d.createCompactVersionTableSQL(c)
+	}
+
+	if _, err := tx.Exec(query); err != nil {
 		return err
 	}
 
+	if index := d.createVersionIndexSQL(c); index != "" && !c.compactVersionTable {
+		if _, err := tx.Exec(index); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func insertInitialMigration(tx *sql.Tx) error {
-	d := GetDialect()
+func insertInitialMigration(c *config, tx *sql.Tx) error {
+	d := c.dialect
 
-	if _, err := tx.Exec(d.insertVersionSQL(), 0, true); err != nil {
-		if err := tx.Rollback(); err != nil {
-			return err
-		}
+	var err error
+	if c.compactVersionTable {
+		_, err = tx.Exec(compactInitialVersionSQL(c))
+	} else {
+		_, err = tx.Exec(bind(c, d.insertVersionSQL(c)), 0, true)
+	}
+	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
@@ -647,11 +1077,31 @@ func insertInitialMigration(tx *sql.Tx) error {
 }
 
 // GetDBVersion is an alias for EnsureDBVersion, but returns -1 in error.
+// The version is cached if SetVersionCacheTTL is set.
+//
+// Deprecated: use Provider.GetDBVersion, see NewProvider.
 func GetDBVersion(db *sql.DB) (int64, error) {
-	version, err := EnsureDBVersion(db)
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, "").GetDBVersion()
+}
+
+// getDBVersion is GetDBVersion, for callers holding runMu.
+func getDBVersion(c *config, db *sql.DB) (int64, error) {
+	ttl := c.versionCacheTTL
+	if ttl > 0 {
+		if version, ok := cachedDBVersion(c, db); ok {
+			return version, nil
+		}
+	}
+
+	version, err := ensureDBVersion(c, db)
 	if err != nil {
 		return -1, err
 	}
 
+	if ttl > 0 {
+		cacheDBVersion(c, db, version, ttl)
+	}
 	return version, nil
 }
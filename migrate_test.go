@@ -1,6 +1,13 @@
 package goose
 
 import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -25,6 +32,33 @@ func TestMigrationSort(t *testing.T) {
 	validateMigrationSort(t, ms, sorted)
 }
 
+func TestMigrationsAccessors(t *testing.T) {
+	ms := sortAndConnectMigrations(Migrations{
+		newMigration(20170506152110, "test"),
+		newMigration(1, "test"),
+		newMigration(2, "test"),
+	})
+
+	if m, ok := ms.ByVersion(2); !ok || m.Version != 2 {
+		t.Errorf("expected migration 2, got %v", m)
+	}
+	if _, ok := ms.ByVersion(3); ok {
+		t.Error("expected no migration 3")
+	}
+	if v := ms.Versioned(); len(v) != 2 || v[0].Version != 1 || v[1].Version != 2 {
+		t.Errorf("unexpected versioned migrations %v", v)
+	}
+	if ts := ms.Timestamped(); len(ts) != 1 || ts[0].Version != 20170506152110 {
+		t.Errorf("unexpected timestamped migrations %v", ts)
+	}
+
+	// TimestampedMigrations behaves as Migrations.
+	next, err := TimestampedMigrations(ms).Next(0)
+	if err != nil || next.Version != 1 {
+		t.Errorf("expected migration 1 after version 0, got %v (%v)", next, err)
+	}
+}
+
 func validateMigrationSort(t *testing.T, ms Migrations, sorted []int64) {
 
 	for i, m := range ms {
@@ -56,3 +90,332 @@ func validateMigrationSort(t *testing.T, ms Migrations, sorted []int64) {
 
 	t.Log(ms)
 }
+
+func TestVersionParser(t *testing.T) {
+	defer SetVersionParser(nil)
+
+	tests := []struct {
+		parser  VersionParser
+		name    string
+		version int64
+		err     bool
+	}{
+		{parser: nil, name: "00001_create_users.sql", version: 1},
+		{parser: nil, name: "V12__create_users.sql", err: true},
+		{parser: FlywayVersion, name: "V12__create_users.sql", version: 12},
+		{parser: FlywayVersion, name: "migrations/V7__rename.go", version: 7},
+		{parser: FlywayVersion, name: "00001_create_users.sql", err: true},
+		{parser: FlywayVersion, name: "V0__create_users.sql", err: true},
+	}
+
+	for _, test := range tests {
+		SetVersionParser(test.parser)
+		v, err := parseVersion(runConfig(), test.name)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got version %v", test.name, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if v != test.version {
+			t.Errorf("%s: incorrect version. got %v, want %v", test.name, v, test.version)
+		}
+	}
+}
+
+func TestCollectMigrationsRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for _, v := range []int64{1, 2, 3, 4} {
+		writeSQLMigration(t, dir, v, fmt.Sprintf("t%d", v))
+	}
+
+	tests := []struct {
+		from, to int64
+		want     []int64
+	}{
+		{MinVersion, MaxVersion, []int64{1, 2, 3, 4}},
+		{2, 3, []int64{2, 3}},
+		{3, 3, []int64{3}},
+		{5, MaxVersion, nil},
+		{math.MinInt64, 2, []int64{1, 2}},
+		{-5, -1, nil},
+	}
+	for _, test := range tests {
+		ms, err := CollectMigrationsRange(dir, test.from, test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := versions(ms); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d to %d: got %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+	if _, err := CollectMigrationsRange(dir, 3, 2); err == nil {
+		t.Error("expected an error for an inverted range")
+	}
+
+	if err := UpTo(db, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := CollectPending(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := versions(pending), []int64{3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pending: got %v, want %v", got, want)
+	}
+}
+
+func versions(ms Migrations) []int64 {
+	var vs []int64
+	for _, m := range ms {
+		vs = append(vs, m.Version)
+	}
+	return vs
+}
+
+func TestEmptyDirMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	defer SetEmptyDirMode(EmptyDirDefault)
+
+	missing := filepath.Join(dir, "missing")
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode           EmptyDirMode
+		missing, empty bool // whether Up fails
+	}{
+		{EmptyDirDefault, true, false},
+		{EmptyDirAllow, false, false},
+		{EmptyDirStrict, true, true},
+	}
+	for _, test := range tests {
+		SetEmptyDirMode(test.mode)
+		if err := Up(db, missing); (err != nil) != test.missing {
+			t.Errorf("%s: Up of a missing directory returned %v", test.mode, err)
+		}
+		if err := Up(db, empty); (err != nil) != test.empty {
+			t.Errorf("%s: Up of an empty directory returned %v", test.mode, err)
+		}
+	}
+}
+
+func TestAddMigrationVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	AddMigrationVersion(2, "create users", func(tx *sql.Tx) error {
+		_, err := tx.Exec("CREATE TABLE users (id int)")
+		return err
+	}, nil)
+	defer func() {
+		registryMu.Lock()
+		delete(registeredGoMigrations, 2)
+		registryMu.Unlock()
+	}()
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := GetDBVersion(db); err != nil || version != 2 {
+		t.Fatalf("expected version 2, got %d, %v", version, err)
+	}
+	if _, err := db.Exec("SELECT * FROM users"); err != nil {
+		t.Errorf("expected the registered migration to run: %v", err)
+	}
+}
+
+func TestAddSQLMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	AddSQLMigration(1, "create users", "CREATE TABLE users (id int);\nINSERT INTO users VALUES (1);", "DROP TABLE users;")
+	defer func() {
+		registryMu.Lock()
+		delete(registeredGoMigrations, 1)
+		registryMu.Unlock()
+	}()
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected the SQL migration to insert a user, got %d, %v", n, err)
+	}
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Error("expected the SQL migration to be rolled back")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected AddSQLMigration to panic on NO TRANSACTION")
+			}
+		}()
+		AddSQLMigration(2, "no tx", "-- +goose NO TRANSACTION\nSELECT 1;", "")
+	}()
+}
+
+func TestCollectSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := filepath.Join(dir, "files")
+	steps := filepath.Join(dir, "steps")
+	for _, d := range []string{files, steps} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSQLMigration(t, files, 1, "a")
+	if err := os.Rename(filepath.Join(files, "00001_a.sql"), filepath.Join(files, "00001_a.SQL")); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 2, "b")
+	writeSQLMigration(t, steps, 1, "c")
+
+	links := map[string]string{
+		filepath.Join(files, "00002_b.sql"): filepath.Join(dir, "00002_b.sql"),
+		filepath.Join(files, "00003_c"):     steps,
+		filepath.Join(dir, "link"):          files,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+
+	migrations, err := CollectMigrations(filepath.Join(dir, "link"), MinVersion, MaxVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	if !reflect.DeepEqual(versions, []int64{1, 2, 3}) {
+		t.Errorf("expected migrations through symlinks and with upper case extensions, got %v", versions)
+	}
+}
+
+func TestCollectRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetRecursive(false)
+
+	for _, sub := range []string{"users", "billing", ".git"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSQLMigration(t, filepath.Join(dir, "users"), 1, "a")
+	writeSQLMigration(t, filepath.Join(dir, "billing"), 2, "b")
+	writeSQLMigration(t, filepath.Join(dir, ".git"), 4, "d")
+	writeSQLMigration(t, dir, 3, "c")
+	if err := os.Symlink(dir, filepath.Join(dir, "billing", "loop")); err != nil {
+		t.Logf("symlinks are not supported: %v", err)
+	}
+
+	versions := func() []int64 {
+		t.Helper()
+		migrations, err := CollectMigrations(dir, MinVersion, MaxVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var versions []int64
+		for _, m := range migrations {
+			versions = append(versions, m.Version)
+		}
+		return versions
+	}
+
+	if got := versions(); !reflect.DeepEqual(got, []int64{3}) {
+		t.Errorf("expected subdirectories to be skipped by default, got %v", got)
+	}
+	SetRecursive(true)
+	if got := versions(); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("expected migrations of subdirectories sorted by version, got %v", got)
+	}
+
+	writeSQLMigration(t, filepath.Join(dir, "users"), 5, "e")
+	writeSQLMigration(t, filepath.Join(dir, "billing"), 5, "e")
+	_, err = CollectMigrations(dir, MinVersion, MaxVersion)
+	if want := "duplicate version 5: billing/00005_e.sql, users/00005_e.sql"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
@@ -1,6 +1,7 @@
 package goose
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"path/filepath"
@@ -29,6 +30,11 @@ type Migration struct {
 	Applied    bool
 	UpFn       func(*sql.Tx) error // Up go migration function
 	DownFn     func(*sql.Tx) error // Down go migration function
+
+	dir                 bool    // Source is a version directory
+	dependsOn           []int64 // versions to apply first, see manifestFile
+	setChecksum         string  // checksum of the applied set once applied
+	previousSetChecksum string  // checksum of the applied set before
 }
 
 func (m *Migration) String() string {
@@ -37,78 +43,241 @@ func (m *Migration) String() string {
 
 // Up runs an up migration.
 func (m *Migration) Up(db *sql.DB) error {
-	if err := m.run(db, true); err != nil {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return m.apply(c, db)
+}
+
+// apply is Up, for callers holding runMu.
+func (m *Migration) apply(c *config, db *sql.DB) error {
+	if err := m.up(c, db, options{}); err != errGuardSkipped {
+		return err
+	}
+	return nil
+}
+
+// up runs an up migration with the options o. It returns errGuardSkipped
+// if the migration was skipped and left pending.
+func (m *Migration) up(c *config, db *sql.DB, o options) error {
+	if err := checkDependencies(c, db, m); err != nil {
+		return err
+	}
+	if err := m.run(c, db, true, o); err != nil {
+		return err
+	}
+	if err := recordChecksum(c, db, m); err != nil {
 		return err
 	}
-	log.Println("OK   ", filepath.Base(m.Source))
+	printProgress(c, "OK    %s\n", filepath.Base(m.Source))
 	return nil
 }
 
 // Down runs a down migration.
 func (m *Migration) Down(db *sql.DB) error {
-	if err := m.run(db, false); err != nil {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return m.down(c, db, options{})
+}
+
+// down is Down with the options o, for callers holding runMu.
+func (m *Migration) down(c *config, db *sql.DB, o options) error {
+	if err := m.run(c, db, false, o); err != nil {
+		return err
+	}
+	if err := forgetChecksum(c, db, m); err != nil {
+		return err
+	}
+	printProgress(c, "OK    %s\n", filepath.Base(m.Source))
+	return nil
+}
+
+// run runs the migration with the transaction settings of o, returning an
+// ErrMigrationFailed if it fails, and reports its result to the result
+// handler and to o.
+func (m *Migration) run(c *config, db *sql.DB, direction bool, o options) error {
+	if err := markDirty(c, db, m); err != nil {
+		return err
+	}
+
+	result := &MigrationResult{Migration: m, Direction: direction}
+	start := time.Now()
+	ctx := withTxSettings(withResult(context.Background(), result), o.tx)
+	err := m.runMigration(ctx, c, db, direction)
+	if err == errGuardSkipped {
+		if clearErr := clearDirty(c, db, m, nil); clearErr != nil {
+			return clearErr
+		}
+		return err
+	}
+	if clearErr := clearDirty(c, db, m, err); clearErr != nil && err == nil {
+		err = clearErr
+	}
+	if err != nil {
 		return err
 	}
-	log.Println("OK   ", filepath.Base(m.Source))
+	result.Duration = time.Since(start)
+
+	if handler := c.resultHandler; handler != nil {
+		handler(result)
+	}
+	if o.results != nil {
+		o.results(result)
+	}
 	return nil
 }
 
-func (m *Migration) run(db *sql.DB, direction bool) error {
-	switch filepath.Ext(m.Source) {
-	case ".sql":
-		if err := runSQLMigration(db, m.Source, m.Version, direction); err != nil {
-			return errors.Wrapf(err, "failed to run SQL migration %q", filepath.Base(m.Source))
+func (m *Migration) runMigration(ctx context.Context, c *config, db *sql.DB, direction bool) error {
+	if m.dir {
+		if err := runVersionDir(c, ctx, db, m, direction); err != nil {
+			return migrationFailed(m, errors.Wrapf(err, "failed to run migration %q", filepath.Base(m.Source)))
 		}
+		return nil
+	}
 
-	case ".go":
-		if !m.Registered {
-			return errors.Errorf("failed to run Go migration %q: Go functions must be registered and built into a custom binary (see https://github.com/lonja/goose/tree/master/examples/go-migrations)", m.Source)
+	// Registered migrations may have any name, see AddMigrationVersion.
+	ext := fileExt(m.Source)
+	switch {
+	case ext == ".sql" && !m.Registered:
+		err := runSQLMigration(c, ctx, db, m, direction)
+		if err == errGuardSkipped {
+			return err
 		}
-		tx, err := db.Begin()
 		if err != nil {
-			return errors.Wrap(err, "failed to begin transaction")
+			return migrationFailed(m, errors.Wrapf(err, "failed to run SQL migration %q", filepath.Base(m.Source)))
 		}
 
-		fn := m.UpFn
-		if !direction {
-			fn = m.DownFn
+	case ext == ".go" || m.Registered:
+		if !m.Registered {
+			return errNotRegistered(m)
 		}
-		if fn != nil {
-			if err := fn(tx); err != nil {
-				tx.Rollback()
-				return errors.Wrapf(err, "failed to run Go migration %q", filepath.Base(m.Source))
-			}
+		timeout := c.migrationTimeout
+		ctx, cancel := migrationContext(ctx, timeout)
+		defer cancel()
+		err := retryBusy(c, func() error { return runGoMigration(ctx, c, db, m, direction, timeout) })
+		if err := timeoutError(ctx, err, timeout); err != nil {
+			return migrationFailed(m, err)
 		}
+	}
 
-		if direction {
-			if _, err := tx.Exec(GetDialect().insertVersionSQL(), m.Version, direction); err != nil {
-				tx.Rollback()
-				return errors.Wrap(err, "failed to execute transaction")
-			}
-		} else {
-			if _, err := tx.Exec(GetDialect().deleteVersionSQL(), m.Version); err != nil {
-				tx.Rollback()
-				return errors.Wrap(err, "failed to execute transaction")
-			}
-		}
+	return nil
+}
+
+// errNotRegistered returns the error of a Go migration file whose functions
+// aren't registered.
+func errNotRegistered(m *Migration) error {
+	return migrationFailed(m, errors.Errorf("failed to run Go migration %q: Go functions must be registered and built into a custom binary (see https://github.com/lonja/goose/tree/master/examples/go-migrations)", m.Source))
+}
+
+// runGoMigration runs the function of a registered Go migration and records
+// it in a single transaction, canceled with ctx.
+func runGoMigration(ctx context.Context, c *config, db *sql.DB, m *Migration, direction bool, timeout time.Duration) error {
+	ctx, begin, done, err := hookedBegin(ctx, c, db)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tx, err := begin(ctx, txOptions(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	if err := tagSession(c, tx, m.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := limitStatements(ctx, c, tx, timeout); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := applyTxSettings(ctx, c, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		if err := tx.Commit(); err != nil {
-			return errors.Wrap(err, "failed to commit transaction")
+	fn := m.UpFn
+	if !direction {
+		fn = m.DownFn
+	}
+	if fn != nil {
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "failed to run Go migration %q", filepath.Base(m.Source))
 		}
+	}
+
+	if err := recordVersion(c, tx, m, direction); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "failed to execute transaction")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// SetRollbackHistory sets whether rolling back a migration records it in
+// the version table with is_applied = false, keeping the full history for
+// auditing, instead of deleting the row of the migration. It has no effect
+// with a compact version table.
+func SetRollbackHistory(v bool) {
+	updateConfig(func(c *config) { c.rollbackHistory = v })
+}
 
+// recordVersion records in the version table that m was applied or rolled
+// back.
+func recordVersion(c *config, q Querier, m *Migration, direction bool) error {
+	defer InvalidateVersionCache()
+
+	if c.store != nil {
+		return recordStoreVersion(c.store, q, m, direction)
+	}
+	if c.compactVersionTable {
+		return recordCompactVersion(c, q, m, direction)
+	}
+
+	if direction || c.rollbackHistory {
+		if _, err := q.Exec(bind(c, c.dialect.insertVersionSQL(c)), m.Version, direction); err != nil {
+			return errors.Wrap(err, "failed to insert new goose version")
+		}
 		return nil
 	}
 
+	if _, err := q.Exec(bind(c, c.dialect.deleteVersionSQL(c)), m.Version); err != nil {
+		return errors.Wrap(err, "failed to delete goose version")
+	}
 	return nil
 }
 
+// VersionParser extracts the version number from a migration file name.
+type VersionParser func(name string) (int64, error)
+
+// SetVersionParser sets the function used to extract versions from migration
+// file names. A nil parser restores the default NumericComponent.
+func SetVersionParser(p VersionParser) {
+	if p == nil {
+		p = NumericComponent
+	}
+	updateConfig(func(c *config) { c.versionParser = p })
+}
+
+func parseVersion(c *config, name string) (int64, error) {
+	return c.versionParser(name)
+}
+
 // NumericComponent looks for migration scripts with names in the form:
 // XXX_descriptivename.ext where XXX specifies the version number
 // and ext specifies the type of migration
 func NumericComponent(name string) (int64, error) {
 	base := filepath.Base(name)
 
-	if ext := filepath.Ext(base); ext != ".go" && ext != ".sql" {
+	if ext := fileExt(base); ext != ".go" && ext != ".sql" {
 		return 0, errors.New("not a recognized migration file type")
 	}
 
@@ -124,3 +293,30 @@ func NumericComponent(name string) (int64, error) {
 
 	return n, e
 }
+
+// FlywayVersion looks for migration scripts with names in the Flyway form:
+// VXXX__descriptivename.ext where XXX specifies the version number.
+// Use it with SetVersionParser to adopt existing Flyway migrations as is.
+func FlywayVersion(name string) (int64, error) {
+	base := filepath.Base(name)
+
+	if ext := fileExt(base); ext != ".go" && ext != ".sql" {
+		return 0, errors.New("not a recognized migration file type")
+	}
+
+	if !strings.HasPrefix(base, "V") {
+		return 0, errors.New("no version prefix found")
+	}
+
+	idx := strings.Index(base, "__")
+	if idx < 0 {
+		return 0, errors.New("no separator found")
+	}
+
+	n, e := strconv.ParseInt(base[1:idx], 10, 64)
+	if e == nil && n <= 0 {
+		return 0, errors.New("migration IDs must be greater than zero")
+	}
+
+	return n, e
+}
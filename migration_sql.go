@@ -3,13 +3,15 @@ package goose
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 )
@@ -45,6 +47,63 @@ func endsWithSemicolon(line string) bool {
 	return strings.HasSuffix(prev, ";")
 }
 
+// endsWithDelimiter reports whether the line ends a statement delimited by
+// delimiter, set with the DELIMITER command of the mysql client.
+func endsWithDelimiter(line, delimiter string) bool {
+	if delimiter == ";" {
+		return endsWithSemicolon(line)
+	}
+	return strings.HasSuffix(strings.TrimSpace(line), delimiter)
+}
+
+// delimiterCommand parses a DELIMITER command, as used in mysql client
+// scripts to define stored procedures and triggers:
+//
+//	DELIMITER $$
+//	CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END$$
+//	DELIMITER ;
+func delimiterCommand(line string) (string, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.ToUpper(fields[0]) != "DELIMITER" {
+		return "", false, nil
+	}
+	if len(fields) != 2 {
+		return "", true, errors.Errorf("DELIMITER needs a single delimiter, got %q", strings.TrimSpace(line))
+	}
+	return fields[1], true, nil
+}
+
+var mysqlClientCommands = map[string]bool{
+	"CHARSET":   true,
+	"CONNECT":   true,
+	"NOTEE":     true,
+	"NOWARNING": true,
+	"PROMPT":    true,
+	"REHASH":    true,
+	"SOURCE":    true,
+	"SYSTEM":    true,
+	"TEE":       true,
+	"WARNINGS":  true,
+}
+
+// clientMetaCommand reports whether the line, starting a statement, is a
+// command interpreted by the psql or mysql command line clients rather
+// than by the server, and names the client.
+func clientMetaCommand(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+
+	if strings.HasPrefix(line, "\\") {
+		return "psql", true
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 && mysqlClientCommands[strings.ToUpper(strings.TrimSuffix(fields[0], ";"))] {
+		return "mysql", true
+	}
+
+	return "", false
+}
+
 // Split the given sql script into individual statements.
 //
 // The base case is to simply split on semicolons, as these
@@ -54,7 +113,63 @@ func endsWithSemicolon(line string) bool {
 // within a statement. For these cases, we provide the explicit annotations
 // 'StatementBegin' and 'StatementEnd' to allow the script to
 // tell us to ignore semicolons.
-func getSQLStatements(r io.Reader, direction bool) ([]string, bool, error) {
+func getSQLStatements(c *config, r io.Reader, direction bool) ([]string, bool, error) {
+	parsed, err := parseSQLMigration(c, r, direction)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return parsed.statements, parsed.useTx, nil
+}
+
+// parsedSQL is a SQL migration script parsed for one direction.
+type parsedSQL struct {
+	statements       []string // nil when streamed, see scanSQLMigration
+	count            int      // number of statements
+	copyBlocks       int      // number of '-- +goose COPY' blocks
+	loads            int      // number of '-- +goose LOADDATA' statements
+	useTx            bool
+	foreignKeysOff   bool               // '-- +goose FOREIGN KEYS OFF'
+	timeout          time.Duration      // '-- +goose TIMEOUT <duration>', 0 if none
+	environments     []string           // '-- +goose ENV <names>', nil for all
+	heavy            bool               // '-- +goose HEAVY [window]'
+	window           *maintenanceWindow // window of a heavy migration, if any
+	guards           []string           // '-- +goose ONLY IF <query>' conditions
+	allowDestructive bool               // '-- +goose ALLOW DESTRUCTIVE'
+	reapplyOnDrift   bool               // '-- +goose REAPPLY ON DRIFT'
+	destructive      string             // first statement refused by the deny policy, see SetDenyDestructive
+	upSections       int                // number of '-- +goose Up' annotations
+	downSections     int                // number of '-- +goose Down' annotations
+}
+
+// parseSQLMigration splits the script into the statements of the given
+// direction and collects its annotations. See getSQLStatements.
+func parseSQLMigration(c *config, r io.Reader, direction bool) (*parsedSQL, error) {
+	stmts := []string{}
+	parsed, err := scanSQLMigration(c, r, direction, func(query string) error {
+		stmts = append(stmts, query)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	parsed.statements = stmts
+
+	return parsed, nil
+}
+
+// scanSQLMigration is parseSQLMigration streaming the statements to emit
+// as they are parsed, instead of collecting them, so the memory used is
+// bounded by the largest statement. Errors returned by emit stop the scan.
+// Errors in the script may only be detected after some statements were
+// emitted.
+func scanSQLMigration(c *config, r io.Reader, direction bool, emit func(query string) error) (*parsedSQL, error) {
+	return scanSQLMigrationLines(c, r, direction, func(query string, line int) error { return emit(query) })
+}
+
+// scanSQLMigrationLines is scanSQLMigration also passing to emit the line
+// where each statement starts.
+func scanSQLMigrationLines(c *config, r io.Reader, direction bool, emit func(query string, line int) error) (*parsedSQL, error) {
 	var buf bytes.Buffer
 	scanBuf := bufferPool.Get().([]byte)
 	defer bufferPool.Put(scanBuf)
@@ -62,6 +177,17 @@ func getSQLStatements(r io.Reader, direction bool) ([]string, bool, error) {
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(scanBuf, scanBufSize)
 
+	destructive := ""
+	if deny := currentDenyPolicy(c); deny != nil {
+		next := emit
+		emit = func(query string, line int) error {
+			if destructive == "" && deny.denies(query) {
+				destructive = query
+			}
+			return next(query, line)
+		}
+	}
+
 	// track the count of each section
 	// so we can diagnose scripts with no annotations
 	upSections := 0
@@ -71,11 +197,46 @@ func getSQLStatements(r io.Reader, direction bool) ([]string, bool, error) {
 	ignoreSemicolons := false
 	directionIsActive := false
 	tx := true
-	stmts := []string{}
+	foreignKeysOff := false
+	var timeout time.Duration
+	var environments []string
+	heavy := false
+	allowDestructive := false
+	reapplyOnDrift := false
+	var window *maintenanceWindow
+	var guards []string
+	count := 0
+	copyBlocks := 0
+	loads := 0
+	copyNext := false // the next statement is a COPY block
+	copyData := false // reading the data of a COPY block
+	delimiter := ";"  // statement delimiter, see delimiterCommand
+	noSplit := false  // '-- +goose NO SPLIT'
+	partitioned := 0  // number of '-- +goose PARTITIONED' statements
+	sawSQL := false   // a statement was seen, in any direction
+
+	lineNum := 0
+	start := 0 // line of the first SQL line in buf
 
 	for scanner.Scan() {
 
 		line := scanner.Text()
+		lineNum++
+
+		// COPY data is taken as is, up to the \. terminator.
+		if copyData {
+			buf.WriteString(line + "\n")
+			if line == copyTerminator {
+				copyData = false
+				count++
+				if err := emit(buf.String(), start); err != nil {
+					return nil, err
+				}
+				buf.Reset()
+				start = 0
+			}
+			continue
+		}
 
 		// handle any goose-specific commands
 		if strings.HasPrefix(line, sqlCmdPrefix) {
@@ -107,45 +268,214 @@ func getSQLStatements(r io.Reader, direction bool) ([]string, bool, error) {
 			case "NO TRANSACTION":
 				tx = false
 				break
+
+			case "FOREIGN KEYS OFF":
+				foreignKeysOff = true
+				break
+
+			case "ALLOW DESTRUCTIVE":
+				allowDestructive = true
+				break
+
+			case "REAPPLY ON DRIFT":
+				reapplyOnDrift = true
+				break
+
+			case "NO SPLIT":
+				if sawSQL {
+					return nil, fmt.Errorf("parsing migration: line %d: '-- +goose NO SPLIT' must come before any statement", lineNum)
+				}
+				noSplit = true
+				break
+
+			case "COPY":
+				if directionIsActive {
+					copyNext = true
+					copyBlocks++
+				}
+				break
+
+			case "PARTITIONED":
+				if directionIsActive {
+					partitioned++
+				}
+				break
+
+			default:
+				if cmd == loadDataCmd || strings.HasPrefix(cmd, loadDataCmd+" ") {
+					if _, err := parseLoadDataCmd(cmd); err != nil {
+						return nil, fmt.Errorf("parsing migration: line %d: %v", lineNum, err)
+					}
+					if !directionIsActive {
+						continue
+					}
+					if noSplit || ignoreSemicolons || strings.TrimSpace(clearStatement(buf.String())) != "" {
+						return nil, fmt.Errorf("parsing migration: line %d: '-- +goose LOADDATA' must be between statements, and statements must be split", lineNum)
+					}
+					loads++
+					count++
+					if err := emit(sqlCmdPrefix+cmd+"\n", lineNum); err != nil {
+						return nil, err
+					}
+					buf.Reset()
+					start = 0
+					continue
+				}
+				if cmd == "HEAVY" || strings.HasPrefix(cmd, "HEAVY ") {
+					heavy = true
+					if spec := strings.TrimSpace(strings.TrimPrefix(cmd, "HEAVY")); spec != "" {
+						w, err := parseMaintenanceWindow(spec)
+						if err != nil {
+							return nil, fmt.Errorf("parsing migration: line %d: %v", lineNum, err)
+						}
+						window = w
+					}
+				}
+				if strings.HasPrefix(cmd, "TIMEOUT ") {
+					d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(cmd, "TIMEOUT ")))
+					if err != nil || d <= 0 {
+						return nil, fmt.Errorf("parsing migration: line %d: invalid timeout %q, use a duration such as 5m", lineNum, cmd)
+					}
+					timeout = d
+				}
+				if cmd == "ENV" || strings.HasPrefix(cmd, "ENV ") {
+					environments = nil
+					for _, name := range strings.Split(strings.TrimPrefix(cmd, "ENV"), ",") {
+						if name = strings.TrimSpace(name); name != "" {
+							environments = append(environments, name)
+						}
+					}
+					if len(environments) == 0 {
+						return nil, fmt.Errorf("parsing migration: line %d: '-- +goose ENV' needs environment names, such as staging,production", lineNum)
+					}
+				}
+				if cmd == "ONLY IF" || strings.HasPrefix(cmd, "ONLY IF ") {
+					guard := strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(cmd, "ONLY IF")), ";")
+					if guard == "" {
+						return nil, fmt.Errorf("parsing migration: line %d: '-- +goose ONLY IF' needs a query returning a boolean", lineNum)
+					}
+					guards = append(guards, guard)
+				}
 			}
 		}
 
+		if !sawSQL && !strings.HasPrefix(line, sqlCmdPrefix) && strings.TrimSpace(clearStatement(line)) != "" {
+			sawSQL = true
+		}
+
 		if !directionIsActive {
 			continue
 		}
 
+		// NO SPLIT: the section is sent as a single statement at the end.
+		if start == 0 && strings.TrimSpace(clearStatement(line)) != "" {
+			start = lineNum
+		}
+
+		if noSplit {
+			buf.WriteString(line + "\n")
+			continue
+		}
+
+		if !ignoreSemicolons && strings.TrimSpace(clearStatement(buf.String())) == "" {
+			d, ok, err := delimiterCommand(line)
+			if err != nil {
+				return nil, fmt.Errorf("parsing migration: line %d: %v", lineNum, err)
+			}
+			if ok {
+				delimiter = d
+				continue
+			}
+			if client, ok := clientMetaCommand(line); ok {
+				return nil, fmt.Errorf("parsing migration: line %d: %q is a %s client command, which database/sql can't execute. Use plain SQL statements instead", lineNum, strings.TrimSpace(line), client)
+			}
+		}
+
 		if _, err := buf.WriteString(line + "\n"); err != nil {
-			return nil, false, fmt.Errorf("io err: %v", err)
+			return nil, fmt.Errorf("io err: %v", err)
 		}
 
 		// Wrap up the two supported cases: 1) basic with semicolon; 2) psql statement
 		// Lines that end with semicolon that are in a statement block
 		// do not conclude statement.
-		if (!ignoreSemicolons && endsWithSemicolon(line)) || statementEnded {
+		if copyNext && !ignoreSemicolons && endsWithSemicolon(line) {
+			copyNext = false
+			copyData = true
+			continue
+		}
+		if (!ignoreSemicolons && endsWithDelimiter(line, delimiter)) || statementEnded {
+			query := buf.String()
+			if delimiter != ";" && !statementEnded {
+				// The server doesn't know the client delimiter.
+				query = strings.TrimSuffix(strings.TrimRight(query, " \t\r\n"), delimiter) + "\n"
+			}
 			statementEnded = false
-			stmts = append(stmts, buf.String())
+			count++
+			if err := emit(query, start); err != nil {
+				return nil, err
+			}
 			buf.Reset()
+			start = 0
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, false, fmt.Errorf("scanning migration: %v", err)
+		return nil, fmt.Errorf("scanning migration: %v", err)
+	}
+
+	if noSplit && strings.TrimSpace(clearStatement(buf.String())) != "" {
+		count++
+		if err := emit(buf.String(), start); err != nil {
+			return nil, err
+		}
+		buf.Reset()
 	}
 
 	// diagnose likely migration script errors
+	if copyData {
+		return nil, fmt.Errorf("parsing migration: COPY data isn't terminated by a line with %s", copyTerminator)
+	}
 	if ignoreSemicolons {
-		return nil, false, fmt.Errorf("parsing migration: saw '-- +goose StatementBegin' with no matching '-- +goose StatementEnd'")
+		return nil, fmt.Errorf("parsing migration: saw '-- +goose StatementBegin' with no matching '-- +goose StatementEnd'")
 	}
 
-	if bufferRemaining := strings.TrimSpace(buf.String()); len(bufferRemaining) > 0 {
-		return nil, false, fmt.Errorf("parsing migration: unexpected unfinished SQL query: %s. potential missing semicolon", bufferRemaining)
+	if bufferRemaining := strings.TrimSpace(clearStatement(buf.String())); len(bufferRemaining) > 0 {
+		return nil, fmt.Errorf("parsing migration: unexpected unfinished SQL query: %s. potential missing semicolon", bufferRemaining)
 	}
 
 	if upSections == 0 && downSections == 0 {
-		return nil, false, fmt.Errorf("parsing migration: no Up/Down annotations found, so no statements were executed. See https://bitbucket.org/liamstask/goose/overview for details")
+		return nil, fmt.Errorf("parsing migration: no Up/Down annotations found, so no statements were executed. See https://bitbucket.org/liamstask/goose/overview for details")
 	}
 
-	return stmts, tx, nil
+	if partitioned > 0 && (tx || noSplit) {
+		return nil, fmt.Errorf("parsing migration: '-- +goose PARTITIONED' statements run on their own outside of transactions, add '-- +goose NO TRANSACTION' and remove '-- +goose NO SPLIT'")
+	}
+
+	if noSplit && copyBlocks > 0 {
+		return nil, fmt.Errorf("parsing migration: '-- +goose COPY' needs statements to be split, remove '-- +goose NO SPLIT'")
+	}
+
+	if foreignKeysOff && !tx {
+		return nil, fmt.Errorf("parsing migration: '-- +goose FOREIGN KEYS OFF' needs a transaction to check foreign keys before committing, remove '-- +goose NO TRANSACTION'")
+	}
+
+	return &parsedSQL{
+		count:            count,
+		copyBlocks:       copyBlocks,
+		loads:            loads,
+		useTx:            tx,
+		foreignKeysOff:   foreignKeysOff,
+		timeout:          timeout,
+		environments:     environments,
+		heavy:            heavy,
+		window:           window,
+		guards:           guards,
+		allowDestructive: allowDestructive,
+		reapplyOnDrift:   reapplyOnDrift,
+		destructive:      destructive,
+		upSections:       upSections,
+		downSections:     downSections,
+	}, nil
 }
 
 // Run a migration specified in raw SQL.
@@ -156,76 +486,255 @@ func getSQLStatements(r io.Reader, direction bool) ([]string, bool, error) {
 //
 // All statements following an Up or Down directive are grouped together
 // until another direction directive is found.
-func runSQLMigration(db *sql.DB, sqlFile string, v int64, direction bool) error {
-	f, err := os.Open(sqlFile)
+//
+// The script is read twice and never held in memory: a first pass checks
+// it and collects its annotations, then its statements are executed as
+// they are read, so migrations of any size can run.
+func runSQLMigration(c *config, parent context.Context, db *sql.DB, m *Migration, direction bool) error {
+	parsed, err := scanSQLFile(c, m.Source, direction, collationCheck(c))
 	if err != nil {
-		return errors.Wrap(err, "failed to open SQL migration file")
+		return err
+	}
+	if direction {
+		if err := checkDestructive(parsed); err != nil {
+			return err
+		}
 	}
-	defer f.Close()
 
-	statements, useTx, err := getSQLStatements(f, direction)
+	parent = withSourceFile(parent, m.Source)
+	ok, err := checkGuards(parent, c, db, parsed.guards)
 	if err != nil {
 		return err
 	}
+	if !ok {
+		return skipGuarded(c, db, m, direction)
+	}
 
-	if useTx {
-		// TRANSACTION.
+	// statements executes the statements of the migration on q.
+	statements := func(ctx context.Context, q Querier) error {
+		i := 0
+		_, err := scanSQLFile(c, m.Source, direction, func(query string, line int) error {
+			i++
+			return execStatement(ctx, c, q, query, i, parsed.count, line)
+		})
+		return err
+	}
 
-		printInfo("Begin transaction\n")
+	timeout := parsed.timeout
+	if timeout == 0 {
+		timeout = c.migrationTimeout
+	}
+	ctx, cancel := migrationContext(parent, timeout)
+	defer cancel()
+
+	if parsed.useTx {
+		err := retryBusy(c, func() error {
+			return runSQLTx(ctx, c, db, m, statements, direction, parsed.foreignKeysOff, timeout)
+		})
+		return timeoutError(ctx, err, timeout)
+	}
 
-		tx, err := db.Begin()
-		if err != nil {
-			errors.Wrap(err, "failed to begin transaction")
+	// NO TRANSACTION. Statements executed before a failure stay applied.
+	q, release, err := noTxQuerier(ctx, c, db)
+	if err != nil {
+		return err
+	}
+	defer release()
+	executed := 0
+	_, err = scanSQLFile(c, m.Source, direction, func(query string, line int) error {
+		if err := execStatement(ctx, c, q, query, executed+1, parsed.count, line); err != nil {
+			return err
 		}
-
-		for _, query := range statements {
-			printInfo("Executing statement: %s\n", clearStatement(query))
-			if _, err = tx.Exec(query); err != nil {
-				printInfo("Rollback transaction\n")
-				tx.Rollback()
-				return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(query))
-			}
+		executed++
+		return nil
+	})
+	if err != nil {
+		err = timeoutError(ctx, err, timeout)
+		if executed > 0 {
+			return &ErrDirtyState{Version: m.Version, Err: err}
 		}
+		return err
+	}
+	if err := recordVersion(c, q, m, direction); err != nil {
+		return &ErrDirtyState{Version: m.Version, Err: err}
+	}
+	return nil
+}
 
-		if direction {
-			if _, err := tx.Exec(GetDialect().insertVersionSQL(), v, direction); err != nil {
-				printInfo("Rollback transaction\n")
-				tx.Rollback()
-				return errors.Wrap(err, "failed to insert new goose version")
-			}
-		} else {
-			if _, err := tx.Exec(GetDialect().deleteVersionSQL(), v); err != nil {
-				printInfo("Rollback transaction\n")
-				tx.Rollback()
-				return errors.Wrap(err, "failed to delete goose version")
-			}
+// collationCheck returns a function for scanSQLFile failing on statements
+// changing a collation, unless SetAllowCollationChanges is set.
+func collationCheck(c *config) func(query string, line int) error {
+	allowCollationChanges := c.allowCollationChanges
+	return func(query string, line int) error {
+		if !allowCollationChanges && changesCollation(query) {
+			return errors.Errorf("statement %q changes a collation or character set, which may rewrite whole tables; acknowledge it with SetAllowCollationChanges", clearStatement(query))
 		}
+		return nil
+	}
+}
 
-		printInfo("Commit transaction\n")
-		if err := tx.Commit(); err != nil {
-			return errors.Wrap(err, "failed to commit transaction")
+// runSQLTx executes the statements of a SQL migration and records it in a
+// single transaction, with foreign keys disabled if foreignKeysOff is set.
+// The transaction is canceled with ctx.
+func runSQLTx(ctx context.Context, c *config, db *sql.DB, m *Migration, statements func(context.Context, Querier) error, direction, foreignKeysOff bool, timeout time.Duration) error {
+	beginTx := hookedBegin
+	if foreignKeysOff {
+		beginTx = beginWithoutForeignKeys
+	}
+	ctx, begin, done, err := beginTx(ctx, c, db)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	printInfo(c, "Begin transaction\n")
+
+	tx, err := begin(ctx, txOptions(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	if err := tagSession(c, tx, m.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := limitStatements(ctx, c, tx, timeout); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := applyTxSettings(ctx, c, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := statements(ctx, tx); err != nil {
+		printInfo(c, "Rollback transaction\n")
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordVersion(c, tx, m, direction); err != nil {
+		printInfo(c, "Rollback transaction\n")
+		tx.Rollback()
+		return err
+	}
+
+	if foreignKeysOff {
+		if err := checkForeignKeys(c, tx); err != nil {
+			printInfo(c, "Rollback transaction\n")
+			tx.Rollback()
+			return err
 		}
+	}
 
-		return nil
+	printInfo(c, "Commit transaction\n")
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// execerContext is implemented by queriers that can cancel statements,
+// like *sql.DB and *sql.Tx.
+type execerContext interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// execStatements executes the statements in order, reporting the progress
+// of each one in verbose mode. Statements are canceled with ctx if q
+// supports it.
+func execStatements(ctx context.Context, c *config, q Querier, statements []string) error {
+	for i, query := range statements {
+		if err := execStatement(ctx, c, q, query, i+1, len(statements), 0); err != nil {
+			return err
+		}
 	}
 
-	// NO TRANSACTION.
-	for _, query := range statements {
-		printInfo("Executing statement: %s\n", clearStatement(query))
-		if _, err := db.Exec(query); err != nil {
-			return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(query))
+	return nil
+}
+
+// execStatement executes the i-th of n statements, starting at line of its
+// file, or 0 if unknown.
+func execStatement(ctx context.Context, c *config, q Querier, query string, i, n, line int) error {
+	start := time.Now()
+	printInfo(c, "Executing statement %d of %d: %s\n", i, n, clearStatement(query))
+	var res sql.Result
+	var err error
+	if block, ok := parseCopyBlock(query); ok {
+		res, err = execCopy(ctx, c, q, block)
+	} else if load, ok := parseLoadDataStatement(query); ok {
+		res, err = execLoadData(ctx, c, q, load)
+	} else if isPartitioned(query) {
+		res, err = execPartitioned(ctx, c, q, query)
+	} else if e, ok := q.(execerContext); ok {
+		res, err = e.ExecContext(ctx, query)
+	} else {
+		res, err = q.Exec(query)
+	}
+	if err != nil {
+		at := ""
+		if line > 0 {
+			at = fmt.Sprintf(" at line %d", line)
+		}
+		redacted := redactStatement(c, query)
+		return &statementError{
+			statement: redacted,
+			number:    i,
+			line:      line,
+			err:       errors.Wrapf(err, "failed to execute statement %d of %d%s %q", i, n, at, statementSnippet(redacted)),
 		}
 	}
-	if _, err := db.Exec(GetDialect().insertVersionSQL(), v, direction); err != nil {
-		return errors.Wrap(err, "failed to insert new goose version")
+	rows := recordStatement(ctx, i, query, res)
+	if rows >= 0 {
+		printInfo(c, "Executed statement %d of %d in %v, %d rows affected\n", i, n, time.Since(start), rows)
+	} else {
+		printInfo(c, "Executed statement %d of %d in %v\n", i, n, time.Since(start))
 	}
 
 	return nil
 }
 
-func printInfo(s string, args ...interface{}) {
-	if verbose {
-		log.Printf(s, args...)
+// scanSQLFile opens the SQL migration file and streams its statements for
+// direction to emit with the line where each one starts, see
+// scanSQLMigration.
+func scanSQLFile(c *config, name string, direction bool, emit func(query string, line int) error) (*parsedSQL, error) {
+	f, err := openSQLMigration(c, name, direction)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open SQL migration file")
+	}
+	defer f.Close()
+
+	return scanSQLMigrationLines(c, f, direction, emit)
+}
+
+// discardStatement is an emit function for scanSQLFile ignoring the
+// statements, to only check a script and collect its annotations.
+func discardStatement(query string, line int) error { return nil }
+
+const snippetSize = 200
+
+// statementSnippet returns the beginning of the statement for error
+// messages, cut between characters.
+func statementSnippet(s string) string {
+	s = strings.TrimSpace(clearStatement(s))
+	if len(s) <= snippetSize {
+		return s
+	}
+	cut := snippetSize
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// printInfo logs the details of a run, such as executed statements, in
+// verbose mode.
+func printInfo(c *config, s string, args ...interface{}) {
+	if c.verbosity >= VerbosityVerbose {
+		c.logger.Printf(s, args...)
 	}
 }
 
@@ -1,9 +1,17 @@
 package goose
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestSemicolons(t *testing.T) {
@@ -77,10 +85,15 @@ func TestSplitStatements(t *testing.T) {
 			direction: false,
 			count:     2,
 		},
+		{
+			sql:       clientCommandLookalikes,
+			direction: true,
+			count:     2,
+		},
 	}
 
 	for _, test := range tests {
-		stmts, _, err := getSQLStatements(strings.NewReader(test.sql), test.direction)
+		stmts, _, err := getSQLStatements(runConfig(), strings.NewReader(test.sql), test.direction)
 		if err != nil {
 			t.Error(err)
 		}
@@ -116,7 +129,7 @@ func TestUseTransactions(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		_, useTx, err := getSQLStatements(f, true)
+		_, useTx, err := getSQLStatements(runConfig(), f, true)
 		if err != nil {
 			t.Error(err)
 		}
@@ -145,9 +158,25 @@ func TestParsingErrors(t *testing.T) {
 			sql:   noUpDownAnnotations,
 			error: true,
 		},
+		{
+			sql:   psqlMetaCommand,
+			error: true,
+		},
+		{
+			sql:   invalidDelimiter,
+			error: true,
+		},
+		{
+			sql:   lateNoSplit,
+			error: true,
+		},
+		{
+			sql:   invalidTimeout,
+			error: true,
+		},
 	}
 	for _, test := range tests {
-		_, _, err := getSQLStatements(strings.NewReader(test.sql), true)
+		_, _, err := getSQLStatements(runConfig(), strings.NewReader(test.sql), true)
 		if err == nil {
 			t.Errorf("Failed transaction check. got %v, want %v", err, test.error)
 		}
@@ -262,3 +291,337 @@ CREATE TABLE post (
     PRIMARY KEY(id)
 );
 `
+
+func TestChangesCollation(t *testing.T) {
+	tests := []struct {
+		stmt   string
+		result bool
+	}{
+		{stmt: "ALTER TABLE users CONVERT TO CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;", result: true},
+		{stmt: "ALTER TABLE users MODIFY name varchar(255) CHARSET latin1;", result: true},
+		{stmt: "alter database app collate \"C\";", result: true},
+		{stmt: "ALTER TABLE users ALTER COLUMN name TYPE text COLLATE \"de_DE\";", result: true},
+		{stmt: "ALTER COLLATION \"de_DE\" REFRESH VERSION;", result: true},
+		{stmt: "ALTER DATABASE app REFRESH COLLATION VERSION;", result: true},
+		{stmt: "-- change encoding\nALTER TABLE users ADD COLUMN age int;", result: false},
+		{stmt: "CREATE TABLE users (name text COLLATE \"C\");", result: false},
+		{stmt: "ALTER TABLE users ADD COLUMN encoding_name text;", result: false},
+	}
+
+	for _, test := range tests {
+		if r := changesCollation(test.stmt); r != test.result {
+			t.Errorf("%q: incorrect collation check. got %v, want %v", test.stmt, r, test.result)
+		}
+	}
+}
+
+func TestCollationChecksBeforeMigrating(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	src := "-- +goose Up\nALTER TABLE a CONVERT TO CHARACTER SET utf8mb4;\n-- +goose Down\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00002_charset.sql"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, up := range map[string]func() error{
+		"Up":    func() error { return Up(db, dir) },
+		"UpAll": func() error { return UpAll(db, dir) },
+	} {
+		err := up()
+		if err == nil || !strings.Contains(err.Error(), "SetAllowCollationChanges") {
+			t.Fatalf("%s: got error %v, want the collation change refused", name, err)
+		}
+		if v, err := GetDBVersion(db); err != nil || v != 0 {
+			t.Errorf("%s: got version %d, %v, want no migration applied", name, v, err)
+		}
+	}
+}
+
+var psqlMetaCommand = `-- +goose Up
+\connect other_db
+CREATE TABLE post (id int);
+
+-- +goose Down
+DROP TABLE post;
+`
+
+var mysqlDelimiter = `-- +goose Up
+DELIMITER //
+CREATE PROCEDURE noop() BEGIN END //
+CREATE TRIGGER audit AFTER INSERT ON users FOR EACH ROW
+BEGIN
+    INSERT INTO audit (user_id) VALUES (NEW.id);
+    UPDATE counters SET users = users + 1;
+END//
+DELIMITER ;
+CREATE TABLE audit (user_id int);
+
+-- +goose Down
+DROP PROCEDURE noop;
+`
+
+var invalidDelimiter = `-- +goose Up
+DELIMITER
+CREATE TABLE post (id int);
+`
+
+func TestDelimiter(t *testing.T) {
+	stmts, _, err := getSQLStatements(runConfig(), strings.NewReader(mysqlDelimiter), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-- +goose Up\nCREATE PROCEDURE noop() BEGIN END \n",
+		"CREATE TRIGGER audit AFTER INSERT ON users FOR EACH ROW\nBEGIN\n    INSERT INTO audit (user_id) VALUES (NEW.id);\n    UPDATE counters SET users = users + 1;\nEND\n",
+		"CREATE TABLE audit (user_id int);\n",
+	}
+	if !reflect.DeepEqual(stmts, want) {
+		t.Errorf("got statements %q, want %q", stmts, want)
+	}
+}
+
+var clientCommandLookalikes = `-- +goose Up
+CREATE TABLE settings (
+    charset text,
+    source text
+);
+-- +goose StatementBegin
+CREATE FUNCTION backslash() RETURNS text AS $$
+SELECT '
+\n';
+$$ LANGUAGE sql;
+-- +goose StatementEnd
+`
+
+func TestRewrittenTable(t *testing.T) {
+	tests := []struct {
+		stmt  string
+		table string
+	}{
+		{stmt: "ALTER TABLE users ALTER COLUMN id TYPE bigint;", table: "users"},
+		{stmt: "ALTER TABLE ONLY public.users ALTER id SET DATA TYPE bigint;", table: "public.users"},
+		{stmt: "ALTER TABLE `users` MODIFY name varchar(512);", table: "users"},
+		{stmt: "alter table users engine=InnoDB;", table: "users"},
+		{stmt: "ALTER TABLE IF EXISTS events SET LOGGED;", table: "events"},
+		{stmt: "ALTER TABLE users ADD COLUMN age int;", table: ""},
+		{stmt: "ALTER TABLE users RENAME COLUMN name TO full_name;", table: ""},
+		{stmt: "CREATE INDEX users_name ON users (name);", table: ""},
+	}
+
+	for _, test := range tests {
+		table, ok := rewrittenTable(test.stmt)
+		if ok != (test.table != "") || table != test.table {
+			t.Errorf("%q: incorrect rewritten table. got %q, want %q", test.stmt, table, test.table)
+		}
+	}
+}
+
+func TestPairedSQLMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	files := map[string]string{
+		"00001_users.up.sql":   "CREATE TABLE users (id int);\n",
+		"00001_users.down.sql": "DROP TABLE users;\n",
+		"00002_posts.sql":      "-- +goose Up\nCREATE TABLE posts (id int);\n-- +goose Down\nDROP TABLE posts;\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := Validate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownTo(db, dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Error("expected users to be dropped by the .down.sql file")
+	}
+}
+
+var invalidTimeout = `-- +goose TIMEOUT five minutes
+-- +goose Up
+SELECT 1;
+`
+
+// insertsReader generates a migration of n INSERT statements on the fly.
+type insertsReader struct {
+	n, i int
+	buf  []byte
+}
+
+func (r *insertsReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		switch {
+		case r.i == 0:
+			r.buf = []byte("-- +goose Up\n")
+		case r.i > r.n:
+			return 0, io.EOF
+		default:
+			r.buf = []byte(fmt.Sprintf("INSERT INTO numbers VALUES (%d);\n", r.i))
+		}
+		r.i++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestScanSQLMigration(t *testing.T) {
+	// Statements are emitted while reading, and emit errors stop the scan.
+	r := &insertsReader{n: 1000000}
+	stop := errors.New("stop")
+	count := 0
+	_, err := scanSQLMigration(runConfig(), r, true, func(query string) error {
+		if count++; count == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected the emit error, got %v", err)
+	}
+	if r.i > 1000 {
+		t.Errorf("expected the scan to stop early, read %d statements", r.i)
+	}
+
+	parsed, err := scanSQLMigration(runConfig(), &insertsReader{n: 50000}, true, func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.count != 50000 || parsed.statements != nil {
+		t.Errorf("expected 50000 streamed statements, got %d and %d collected", parsed.count, len(parsed.statements))
+	}
+}
+
+func TestLargeSQLMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	f, err := os.Create(filepath.Join(dir, "00001_numbers.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(f, "-- +goose Up\nCREATE TABLE numbers (n int);\n"); err != nil {
+		t.Fatal(err)
+	}
+	const n = 20000
+	if _, err := io.Copy(f, &insertsReader{n: n, i: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM numbers").Scan(&count); err != nil || count != n {
+		t.Fatalf("expected %d rows, got %d (%v)", n, count, err)
+	}
+}
+
+var noSplit = `-- +goose NO SPLIT
+-- +goose Up
+CREATE TABLE post (id int);
+-- odd; edge case
+INSERT INTO post VALUES (1);
+
+-- +goose Down
+DROP TABLE post;
+`
+
+var lateNoSplit = `-- +goose Up
+CREATE TABLE post (id int);
+-- +goose NO SPLIT
+`
+
+func TestNoSplit(t *testing.T) {
+	for _, direction := range []bool{true, false} {
+		stmts, _, err := getSQLStatements(runConfig(), strings.NewReader(noSplit), direction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stmts) != 1 {
+			t.Fatalf("expected the section as a single statement, got %q", stmts)
+		}
+	}
+
+	stmts, _, err := getSQLStatements(runConfig(), strings.NewReader(noSplit), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-- +goose Up\nCREATE TABLE post (id int);\n-- odd; edge case\nINSERT INTO post VALUES (1);\n\n"; stmts[0] != want {
+		t.Errorf("got %q, want %q", stmts[0], want)
+	}
+}
+
+func TestStatementSnippet(t *testing.T) {
+	if got := statementSnippet("  SELECT 1;\n"); got != "SELECT 1;" {
+		t.Errorf("got snippet %q of a short statement", got)
+	}
+
+	// The snippet of a long statement is cut between characters, even if
+	// one of several bytes crosses its size.
+	long := "INSERT INTO t VALUES ('" + strings.Repeat("é", snippetSize) + "');"
+	got := statementSnippet(long)
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, "...") || len(got) > snippetSize+len("...") {
+		t.Errorf("got snippet %q", got)
+	}
+}
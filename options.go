@@ -0,0 +1,91 @@
+package goose
+
+import (
+	"database/sql"
+	"time"
+)
+
+// OptionsFunc sets an option of a migration run, e.g. of Up.
+type OptionsFunc func(o *options)
+
+type options struct {
+	maxPending  int // -1 for no limit
+	locker      SessionLocker
+	environment string // see WithEnvironment
+	tx          txSettings
+	progress    func(ProgressEvent)     // see WithProgress
+	fixOrder    bool                    // see WithFixOrder
+	idempotent  bool                    // see WithIdempotentTarget
+	maintenance bool                    // see WithMaintenanceWindow
+	window      string                  // see WithMaintenanceWindow
+	singleTx    bool                    // see WithSingleTransaction
+	filters     []func(*Migration) bool // see WithFileFilter
+	results     func(*MigrationResult)  // see UpAllWithResult
+}
+
+func applyOptions(opts []OptionsFunc) options {
+	o := options{maxPending: -1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithMaxPending makes Up fail with ErrTooManyPending, before applying any
+// migration, if more than n migrations are pending. It keeps services that
+// migrate on startup, like a stale replica, from applying a large backlog
+// without supervision.
+func WithMaxPending(n int) OptionsFunc {
+	return func(o *options) { o.maxPending = n }
+}
+
+// WithSessionLocker makes Up, UpByOne, Down, DownTo, Redo and Reset hold
+// the lock of l while migrating, so concurrent runs against the same
+// database wait for each other instead of failing with
+// ErrConcurrentMigration.
+func WithSessionLocker(l SessionLocker) OptionsFunc {
+	return func(o *options) { o.locker = l }
+}
+
+// WithIsolationLevel makes Up, Down, DownTo and Redo begin the transaction
+// of each migration at the isolation level, instead of the default of the
+// database.
+func WithIsolationLevel(level sql.IsolationLevel) OptionsFunc {
+	return func(o *options) { o.tx.isolation = level }
+}
+
+// WithLockTimeout limits how long the statements of each migration run by
+// Up, Down, DownTo or Redo wait for locks, so DDL fails instead of queuing
+// behind long running readers, and blocking every query queued behind it.
+// It sets lock_timeout on Postgres, and innodb_lock_wait_timeout and
+// lock_wait_timeout, in seconds, on MySQL and TiDB, for the session, where
+// it is reset before the connection returns to the pool. Migrations
+// without transaction have it set on their connection until they are done.
+func WithLockTimeout(d time.Duration) OptionsFunc {
+	return func(o *options) { o.tx.lockTimeout = d }
+}
+
+// WithStatementTimeout limits how long each statement of the migrations
+// run by Up, Down, DownTo or Redo may run on the server, with
+// statement_timeout on Postgres, as WithLockTimeout.
+// Unlike the timeout set with SetMigrationTimeout, it applies to single
+// statements and doesn't cancel the migration on the client.
+func WithStatementTimeout(d time.Duration) OptionsFunc {
+	return func(o *options) { o.tx.statementTimeout = d }
+}
+
+// WithFixOrder makes UpAll rewrite the rows of the version table once it
+// applied the pending migrations, so they follow the versions as if the
+// migrations older than the current version had been applied in order.
+// Rows already in order are left alone. It is off by default, leaving the
+// version table an append-only record of what was applied when.
+func WithFixOrder() OptionsFunc {
+	return func(o *options) { o.fixOrder = true }
+}
+
+// WithIdempotentTarget makes UpTo and DownTo do nothing when the database
+// is already past their version, instead of failing with
+// ErrWrongDirection, for pipelines running the same target again.
+func WithIdempotentTarget() OptionsFunc {
+	return func(o *options) { o.idempotent = true }
+}
@@ -0,0 +1,34 @@
+package goose
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parallel calls fn for each index in [0, n) from a pool of workers, one
+// per CPU, e.g. to hash or parse the files of large migration
+// directories. fn must store its results by index.
+func parallel(n int, fn func(i int)) {
+	workers := runtime.NumCPU()
+	if workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,102 @@
+package goose
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseMigration returns the migration of the SQL file or version
+// directory at path, to inspect its statements with UpStatements and
+// DownStatements without a database.
+func ParseMigration(path string) (*Migration, error) {
+	c := runConfig()
+	m := &Migration{Next: -1, Previous: -1, Source: path}
+
+	var err error
+	if fileExt(path) == ".sql" {
+		m.Version, err = parseVersion(c, path)
+	} else {
+		m.Version, err = dirVersion(c, path)
+		m.dir = true
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the version of %q", filepath.Base(path))
+	}
+
+	return m, nil
+}
+
+// UpStatements returns the statements the migration executes when
+// applied, without executing them, e.g. for review tooling. Goose
+// annotations are left out. Statements of Go migrations and of the Go
+// steps of version directories can't be listed.
+func (m *Migration) UpStatements() ([]string, error) {
+	c := runConfig()
+	return m.statements(c, true)
+}
+
+// DownStatements returns the statements the migration executes when
+// rolled back, see UpStatements.
+func (m *Migration) DownStatements() ([]string, error) {
+	c := runConfig()
+	return m.statements(c, false)
+}
+
+func (m *Migration) statements(c *config, direction bool) ([]string, error) {
+	files := []string{m.Source}
+	if m.dir {
+		steps, err := versionDirSteps(c, m.Source)
+		if err != nil {
+			return nil, err
+		}
+		if !direction {
+			for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+				steps[i], steps[j] = steps[j], steps[i]
+			}
+		}
+		files = steps
+	}
+
+	var statements []string
+	for _, file := range files {
+		if fileExt(file) != ".sql" {
+			if m.dir {
+				continue
+			}
+			return nil, errors.Errorf("%s is not a SQL migration", filepath.Base(file))
+		}
+
+		f, err := openSQLMigration(c, file, direction)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open SQL migration file")
+		}
+		parsed, err := parseSQLMigration(c, f, direction)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse SQL migration file %q", filepath.Base(file))
+		}
+		statements = append(statements, stripAnnotations(parsed.statements)...)
+	}
+
+	return statements, nil
+}
+
+// stripAnnotations removes the goose annotations parsed along with the
+// statements, and the statements left empty.
+func stripAnnotations(statements []string) []string {
+	var cleaned []string
+	for _, s := range statements {
+		var lines []string
+		for _, line := range strings.Split(s, "\n") {
+			if !strings.HasPrefix(line, sqlCmdPrefix) {
+				lines = append(lines, line)
+			}
+		}
+		if s = strings.TrimSpace(strings.Join(lines, "\n")); s != "" {
+			cleaned = append(cleaned, s)
+		}
+	}
+	return cleaned
+}
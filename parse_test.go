@@ -0,0 +1,61 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeSQLMigration(t, dir, 1, "a")
+	m, err := ParseMigration(filepath.Join(dir, "00001_a.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != 1 {
+		t.Errorf("expected version 1, got %d", m.Version)
+	}
+	up, err := m.UpStatements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"CREATE TABLE a (id int);"}; !reflect.DeepEqual(up, want) {
+		t.Errorf("expected up statements %q, got %q", want, up)
+	}
+	down, err := m.DownStatements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"DROP TABLE a;"}; !reflect.DeepEqual(down, want) {
+		t.Errorf("expected down statements %q, got %q", want, down)
+	}
+
+	// The down statements of a version directory run its steps backwards.
+	big := filepath.Join(dir, "00002_big")
+	if err := os.Mkdir(big, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, big, 1, "b")
+	writeSQLMigration(t, big, 2, "c")
+	if m, err = ParseMigration(big); err != nil {
+		t.Fatal(err)
+	}
+	if down, err = m.DownStatements(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"DROP TABLE c;", "DROP TABLE b;"}; !reflect.DeepEqual(down, want) {
+		t.Errorf("expected down statements %q, got %q", want, down)
+	}
+
+	if _, err := (&Migration{Source: "00003_data.go"}).UpStatements(); err == nil {
+		t.Error("expected an error listing the statements of a Go migration")
+	}
+}
@@ -0,0 +1,175 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Querier executes statements and queries.
+// It is implemented by *sql.DB and *sql.Tx.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// PartitionInterval is the time span covered by a single partition.
+type PartitionInterval int
+
+// Supported partition intervals.
+const (
+	PartitionDaily PartitionInterval = iota + 1
+	PartitionWeekly
+	PartitionMonthly
+	PartitionYearly
+)
+
+// start truncates t to the beginning of its partition.
+func (i PartitionInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	y, m, d := t.Date()
+	switch i {
+	case PartitionDaily:
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	case PartitionWeekly:
+		// Weeks start on Monday.
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC)
+	case PartitionMonthly:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// add moves t by n partitions.
+func (i PartitionInterval) add(t time.Time, n int) time.Time {
+	switch i {
+	case PartitionDaily:
+		return t.AddDate(0, 0, n)
+	case PartitionWeekly:
+		return t.AddDate(0, 0, 7*n)
+	case PartitionMonthly:
+		return t.AddDate(0, n, 0)
+	default:
+		return t.AddDate(n, 0, 0)
+	}
+}
+
+func (i PartitionInterval) layout() string {
+	switch i {
+	case PartitionDaily, PartitionWeekly:
+		return "20060102"
+	case PartitionMonthly:
+		return "200601"
+	default:
+		return "2006"
+	}
+}
+
+// PartitionSpec declares the time partitions of a Postgres table
+// partitioned by range on a timestamp column. Partitions are named
+// after the table with a _pYYYY[MM[DD]] suffix.
+type PartitionSpec struct {
+	Table    string // partitioned table, optionally schema qualified
+	Interval PartitionInterval
+	Premake  int // number of future partitions to create
+	Retain   int // number of past partitions to keep attached, 0 keeps all
+}
+
+type partitionRange struct {
+	name     string
+	from, to time.Time
+}
+
+// ranges returns the partitions from the one containing now
+// up to Premake partitions in the future.
+func (s PartitionSpec) ranges(now time.Time) []partitionRange {
+	start := s.Interval.start(now)
+
+	var ranges []partitionRange
+	for n := 0; n <= s.Premake; n++ {
+		from := s.Interval.add(start, n)
+		ranges = append(ranges, partitionRange{
+			name: s.Table + "_p" + from.Format(s.Interval.layout()),
+			from: from,
+			to:   s.Interval.add(from, 1),
+		})
+	}
+
+	return ranges
+}
+
+// EnsurePartitions creates the partitions of spec from the one containing
+// now up to Premake partitions ahead, and detaches the partitions that
+// ended more than Retain intervals ago. It is idempotent, so it can be
+// called from Go migrations and from periodic maintenance jobs alike.
+func EnsurePartitions(q Querier, spec PartitionSpec, now time.Time) error {
+	c := runConfig()
+	if spec.Table == "" || spec.Interval < PartitionDaily || spec.Interval > PartitionYearly {
+		return errors.New("partition spec needs a table and a valid interval")
+	}
+
+	for _, r := range spec.ranges(now) {
+		stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			r.name, spec.Table, r.from.Format("2006-01-02"), r.to.Format("2006-01-02"))
+		if _, err := q.Exec(stmt); err != nil {
+			return errors.Wrapf(err, "failed to create partition %s", r.name)
+		}
+	}
+
+	if spec.Retain <= 0 {
+		return nil
+	}
+
+	cutoff := spec.Interval.add(spec.Interval.start(now), -spec.Retain)
+	partitions, err := attachedPartitions(c, q, spec.Table)
+	if err != nil {
+		return err
+	}
+
+	base := spec.Table[strings.LastIndex(spec.Table, ".")+1:]
+	for _, name := range partitions {
+		if !strings.HasPrefix(name, base+"_p") {
+			continue
+		}
+		from, err := time.Parse(spec.Interval.layout(), strings.TrimPrefix(name, base+"_p"))
+		if err != nil {
+			continue // Not managed by the spec.
+		}
+		if spec.Interval.add(from, 1).After(cutoff) {
+			continue
+		}
+
+		qualified := strings.TrimSuffix(spec.Table, base) + name
+		if _, err := q.Exec(fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", spec.Table, qualified)); err != nil {
+			return errors.Wrapf(err, "failed to detach partition %s", qualified)
+		}
+		printProgress(c, "DETACHED %s\n", qualified)
+	}
+
+	return nil
+}
+
+// attachedPartitions returns the names of the partitions of table.
+func attachedPartitions(c *config, q Querier, table string) ([]string, error) {
+	rows, err := q.Query(bind(c, "SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = $1::regclass"), table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list partitions of %s", table)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
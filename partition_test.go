@@ -0,0 +1,55 @@
+package goose
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartitionRanges(t *testing.T) {
+	now := time.Date(2024, 12, 31, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec  PartitionSpec
+		names []string
+		last  string
+	}{
+		{
+			spec:  PartitionSpec{Table: "events", Interval: PartitionDaily, Premake: 2},
+			names: []string{"events_p20241231", "events_p20250101", "events_p20250102"},
+			last:  "2025-01-03",
+		},
+		{
+			spec:  PartitionSpec{Table: "events", Interval: PartitionWeekly, Premake: 1},
+			names: []string{"events_p20241230", "events_p20250106"},
+			last:  "2025-01-13",
+		},
+		{
+			spec:  PartitionSpec{Table: "ops.events", Interval: PartitionMonthly, Premake: 2},
+			names: []string{"ops.events_p202412", "ops.events_p202501", "ops.events_p202502"},
+			last:  "2025-03-01",
+		},
+		{
+			spec:  PartitionSpec{Table: "events", Interval: PartitionYearly},
+			names: []string{"events_p2024"},
+			last:  "2025-01-01",
+		},
+	}
+
+	for _, test := range tests {
+		ranges := test.spec.ranges(now)
+		if len(ranges) != len(test.names) {
+			t.Fatalf("incorrect number of partitions. got %v, want %v", len(ranges), len(test.names))
+		}
+		for i, r := range ranges {
+			if r.name != test.names[i] {
+				t.Errorf("incorrect partition name. got %v, want %v", r.name, test.names[i])
+			}
+			if i > 0 && !r.from.Equal(ranges[i-1].to) {
+				t.Errorf("partition %v doesn't start where %v ends", r.name, ranges[i-1].name)
+			}
+		}
+		if last := ranges[len(ranges)-1].to.Format("2006-01-02"); last != test.last {
+			t.Errorf("incorrect end of partitions. got %v, want %v", last, test.last)
+		}
+	}
+}
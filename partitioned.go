@@ -0,0 +1,64 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// partitionedDMLer is implemented by dialects that can run DML statements
+// as partitioned DML, like Spanner.
+type partitionedDMLer interface {
+	// partitionedDMLSQL returns the statements switching a session to
+	// partitioned DML and back.
+	partitionedDMLSQL() (on, off string)
+}
+
+// isPartitioned reports whether the statement is annotated with
+// '-- +goose PARTITIONED'. Partitioned DML is executed in parallel over
+// the partitions of a table, outside of any transaction and not
+// atomically, which suits large backfills:
+//
+//	-- +goose PARTITIONED
+//	UPDATE users SET active = true WHERE active IS NULL;
+func isPartitioned(query string) bool {
+	return strings.Contains(query, sqlCmdPrefix+"PARTITIONED\n")
+}
+
+// execPartitioned executes a DML statement as partitioned DML, on a
+// dedicated connection switched to partitioned DML for the statement.
+func execPartitioned(ctx context.Context, c *config, q Querier, query string) (sql.Result, error) {
+	d, ok := c.dialect.(partitionedDMLer)
+	if !ok {
+		return nil, errors.Errorf("'-- +goose PARTITIONED' is not supported by the %s dialect", dialectName(c.dialect))
+	}
+	if b, ok := q.(busyRetryQuerier); ok {
+		q = b.Querier
+	}
+	var conn *sql.Conn
+	switch q := q.(type) {
+	case *sql.DB:
+		c, release, err := migrationConn(ctx, c, q)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		conn = c
+	case connQuerier:
+		conn = q.conn
+	default:
+		return nil, errors.New("'-- +goose PARTITIONED' runs outside of transactions, add '-- +goose NO TRANSACTION'")
+	}
+
+	on, off := d.partitionedDMLSQL()
+	if _, err := conn.ExecContext(ctx, on); err != nil {
+		return nil, errors.Wrap(err, "failed to switch to partitioned DML")
+	}
+	res, err := conn.ExecContext(ctx, query)
+	if _, offErr := conn.ExecContext(context.Background(), off); offErr != nil && err == nil {
+		err = errors.Wrap(offErr, "failed to switch back from partitioned DML")
+	}
+	return res, err
+}
@@ -0,0 +1,24 @@
+package goose
+
+// PinVersion keeps Up, UpAll and UpByOne from applying migrations newer
+// than version, even when their files exist, so code can be deployed
+// before the schema change it ships with is allowed, as in staged
+// rollouts. Up stops at the pinned version, holding back repeatable
+// migrations too, and UpTo a newer version fails with ErrVersionPinned.
+// A negative version removes the pin.
+func PinVersion(version int64) {
+	updateConfig(func(c *config) { c.pinnedVersion = version })
+}
+
+// pinnedTarget returns the version up to which migrating to version is
+// allowed by PinVersion.
+func pinnedTarget(c *config, version int64) (int64, error) {
+	pinned := c.pinnedVersion
+	if pinned < 0 || version <= pinned {
+		return version, nil
+	}
+	if version != MaxVersion {
+		return 0, &ErrVersionPinned{Version: version, Pinned: pinned}
+	}
+	return pinned, nil
+}
@@ -0,0 +1,62 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPinVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for v, table := range []string{"a", "b", "c"} {
+		writeSQLMigration(t, dir, int64(v+1), table)
+	}
+
+	PinVersion(2)
+	defer PinVersion(-1)
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Errorf("expected Up to stop at the pinned version 2, got %d (%v)", v, err)
+	}
+	if _, err := UpByOne(db, dir); err != ErrNoNextVersion {
+		t.Errorf("expected ErrNoNextVersion beyond the pinned version, got %v", err)
+	}
+	var pinned *ErrVersionPinned
+	if err := UpTo(db, dir, 3); !errors.As(err, &pinned) || pinned.Pinned != 2 {
+		t.Errorf("expected ErrVersionPinned, got %v", err)
+	}
+	if err := Redo(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	PinVersion(-1)
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 3 {
+		t.Errorf("expected version 3 once unpinned, got %d (%v)", v, err)
+	}
+}
@@ -0,0 +1,121 @@
+package goose
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Placeholder is a style of query parameters, see SetPlaceholder.
+type Placeholder int
+
+const (
+	// PlaceholderDialect keeps the style of the dialect: $1 for Postgres
+	// and Redshift, ? for the others.
+	PlaceholderDialect Placeholder = iota
+	// PlaceholderQuestion is ?, as in MySQL and SQLite drivers.
+	PlaceholderQuestion
+	// PlaceholderDollar is $1, as in Postgres drivers.
+	PlaceholderDollar
+	// PlaceholderAtP is @p1, as in SQL Server drivers.
+	PlaceholderAtP
+	// PlaceholderColon is :1, as in Oracle drivers.
+	PlaceholderColon
+)
+
+func (p Placeholder) String() string {
+	switch p {
+	case PlaceholderQuestion:
+		return "?"
+	case PlaceholderDollar:
+		return "$1"
+	case PlaceholderAtP:
+		return "@p1"
+	case PlaceholderColon:
+		return ":1"
+	default:
+		return "dialect"
+	}
+}
+
+// SetPlaceholder sets the style of the parameters of the queries goose
+// runs on its own tables, for drivers that don't take the one of the
+// dialect, like a Postgres database behind an ODBC driver expecting ?.
+func SetPlaceholder(p Placeholder) {
+	updateConfig(func(c *config) { c.placeholder = p })
+}
+
+// WithPlaceholder sets the style of the query parameters of a Provider,
+// see SetPlaceholder.
+func WithPlaceholder(ph Placeholder) ProviderOption {
+	return func(p *Provider) error {
+		p.cfg.placeholder = ph
+		return nil
+	}
+}
+
+// bind rewrites the parameters of a query of the dialect in the style set
+// with SetPlaceholder. Parameters in quoted strings and identifiers are
+// left alone.
+func bind(c *config, query string) string {
+	p := c.placeholder
+	if p == PlaceholderDialect {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			b.WriteByte(c)
+			continue
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			b.WriteByte(c)
+			continue
+		case c == '?':
+			n++
+		case (c == '$' || c == ':') && digitsAt(query, i+1) > 0:
+			n++
+			i += digitsAt(query, i+1)
+		case c == '@' && i+1 < len(query) && query[i+1] == 'p' && digitsAt(query, i+2) > 0:
+			n++
+			i += 1 + digitsAt(query, i+2)
+		default:
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString(placeholder(p, n))
+	}
+	return b.String()
+}
+
+// placeholder returns the n-th parameter in the style p.
+func placeholder(p Placeholder, n int) string {
+	switch p {
+	case PlaceholderDollar:
+		return "$" + strconv.Itoa(n)
+	case PlaceholderAtP:
+		return "@p" + strconv.Itoa(n)
+	case PlaceholderColon:
+		return ":" + strconv.Itoa(n)
+	default:
+		return "?"
+	}
+}
+
+// digitsAt returns the number of digits at i in s.
+func digitsAt(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '9' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,109 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBind(t *testing.T) {
+	defer SetPlaceholder(PlaceholderDialect)
+
+	tests := []struct {
+		p     Placeholder
+		query string
+		want  string
+	}{
+		{PlaceholderDialect, "DELETE FROM t WHERE v=$1;", "DELETE FROM t WHERE v=$1;"},
+		{PlaceholderQuestion, "INSERT INTO t (a, b) VALUES ($1, $2);", "INSERT INTO t (a, b) VALUES (?, ?);"},
+		{PlaceholderDollar, "INSERT INTO t (a, b) VALUES (?, ?), (?, ?);", "INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4);"},
+		{PlaceholderAtP, "SELECT pg_total_relation_size($1::regclass);", "SELECT pg_total_relation_size(@p1::regclass);"},
+		{PlaceholderColon, "UPDATE t SET a = ?, b = '?' WHERE \"c?\" = ?;", "UPDATE t SET a = :1, b = '?' WHERE \"c?\" = :2;"},
+		{PlaceholderQuestion, "SELECT @p1, :2", "SELECT ?, ?"},
+		{PlaceholderQuestion, "SELECT CASE WHEN to_regclass($1) IS NULL THEN 0 ELSE 1 END;", "SELECT CASE WHEN to_regclass(?) IS NULL THEN 0 ELSE 1 END;"},
+	}
+	for _, tt := range tests {
+		SetPlaceholder(tt.p)
+		if got := bind(runConfig(), tt.query); got != tt.want {
+			t.Errorf("bind(%q) with %v: got %q, want %q", tt.query, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceholderMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	// SQLite also takes $1 parameters.
+	SetPlaceholder(PlaceholderDollar)
+	defer SetPlaceholder(PlaceholderDialect)
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 1 {
+		t.Errorf("expected version 1, got %d, %v", v, err)
+	}
+}
+
+func TestProviderPlaceholder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	writeSQLMigration(t, dir, 1, "a")
+	p, err := NewProvider(db, dir, WithDialect("sqlite3"), WithPlaceholder(PlaceholderAtP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	p.run(func(c *config) error {
+		got = bind(c, "SELECT 1 FROM t WHERE a = ? AND b = ?")
+		return nil
+	})
+	if got != "SELECT 1 FROM t WHERE a = @p1 AND b = @p2" {
+		t.Errorf("got query %q in the provider", got)
+	}
+	if bind(runConfig(), "a = ?") != "a = ?" {
+		t.Error("the placeholder of the provider leaked to the package level configuration")
+	}
+
+	p, err = NewProvider(db, dir, WithDialect("sqlite3"), WithPlaceholder(PlaceholderDollar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p.GetDBVersion(); err != nil || v != 1 {
+		t.Errorf("expected version 1, got %d, %v", v, err)
+	}
+}
@@ -0,0 +1,70 @@
+package goose
+
+import "sort"
+
+// Plan is the order in which UpAll walks the migrations of a database
+// that may have missing migrations, e.g. merged from a branch after newer
+// ones were applied: the applied migrations, in version order, followed
+// by the pending ones, in version order. Pending migrations older than
+// the current version are applied too, out of order, see OutOfOrder.
+type Plan struct {
+	Applied Migrations // applied migrations, in version order
+	Pending Migrations // migrations to apply, in version order
+}
+
+// NewPlan plans applying the available migrations to a database with the
+// applied versions, as returned by AppliedDBVersions. Applied versions
+// without a migration are ignored. The Applied field of the available
+// migrations is set. Pending migrations are in version order, except that
+// they follow the migrations they depend on, see manifestFile.
+func NewPlan(applied map[int64]bool, available Migrations) *Plan {
+	sorted := make(Migrations, len(available))
+	copy(sorted, available)
+	sort.Sort(sorted)
+
+	p := &Plan{}
+	for _, m := range sorted {
+		m.Applied = applied[m.Version]
+		if m.Applied {
+			p.Applied = append(p.Applied, m)
+		} else {
+			p.Pending = append(p.Pending, m)
+		}
+	}
+	p.Pending = orderByDependencies(p.Pending)
+	return p
+}
+
+// Migrations returns the applied migrations followed by the pending ones,
+// connected in that order.
+func (p *Plan) Migrations() Migrations {
+	migrations := make(Migrations, 0, len(p.Applied)+len(p.Pending))
+	migrations = append(migrations, p.Applied...)
+	migrations = append(migrations, p.Pending...)
+
+	for i, m := range migrations {
+		m.Previous, m.Next = -1, -1
+		if i > 0 {
+			m.Previous = migrations[i-1].Version
+			migrations[i-1].Next = m.Version
+		}
+	}
+	return migrations
+}
+
+// OutOfOrder returns the pending migrations older than the latest applied
+// one, which UpAll applies after it.
+func (p *Plan) OutOfOrder() Migrations {
+	if len(p.Applied) == 0 {
+		return nil
+	}
+	latest := p.Applied[len(p.Applied)-1].Version
+
+	var migrations Migrations
+	for _, m := range p.Pending {
+		if m.Version < latest {
+			migrations = append(migrations, m)
+		}
+	}
+	return migrations
+}
@@ -0,0 +1,265 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func planVersions(ms Migrations) string {
+	var versions []int64
+	for _, m := range ms {
+		versions = append(versions, m.Version)
+	}
+	return fmt.Sprint(versions)
+}
+
+func newPlanMigrations(versions ...int64) Migrations {
+	var ms Migrations
+	for _, v := range versions {
+		ms = append(ms, &Migration{Version: v, Next: -1, Previous: -1, Source: fmt.Sprintf("%05d_m.sql", v)})
+	}
+	return ms
+}
+
+func TestNewPlan(t *testing.T) {
+	tests := []struct {
+		name                                string
+		available                           Migrations
+		applied                             map[int64]bool
+		wantApplied, wantPending, wantOrder string
+		wantOutOfOrder                      string
+	}{
+		{
+			name:        "nothing applied",
+			available:   newPlanMigrations(3, 1, 2),
+			wantApplied: "[]", wantPending: "[1 2 3]", wantOrder: "[1 2 3]", wantOutOfOrder: "[]",
+		},
+		{
+			name:        "everything applied",
+			available:   newPlanMigrations(1, 2),
+			applied:     map[int64]bool{1: true, 2: true},
+			wantApplied: "[1 2]", wantPending: "[]", wantOrder: "[1 2]", wantOutOfOrder: "[]",
+		},
+		{
+			name:        "interleaved",
+			available:   newPlanMigrations(5, 4, 3, 2, 1),
+			applied:     map[int64]bool{1: true, 3: true, 5: true},
+			wantApplied: "[1 3 5]", wantPending: "[2 4]", wantOrder: "[1 3 5 2 4]", wantOutOfOrder: "[2 4]",
+		},
+		{
+			name:        "newer pending",
+			available:   newPlanMigrations(1, 2, 3),
+			applied:     map[int64]bool{1: true, 2: false},
+			wantApplied: "[1]", wantPending: "[2 3]", wantOrder: "[1 2 3]", wantOutOfOrder: "[]",
+		},
+		{
+			name:        "applied without migration",
+			available:   newPlanMigrations(2, 4),
+			applied:     map[int64]bool{1: true, 2: true, 3: true},
+			wantApplied: "[2]", wantPending: "[4]", wantOrder: "[2 4]", wantOutOfOrder: "[]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPlan(tt.applied, tt.available)
+			if got := planVersions(p.Applied); got != tt.wantApplied {
+				t.Errorf("got applied %s, want %s", got, tt.wantApplied)
+			}
+			if got := planVersions(p.Pending); got != tt.wantPending {
+				t.Errorf("got pending %s, want %s", got, tt.wantPending)
+			}
+			if got := planVersions(p.OutOfOrder()); got != tt.wantOutOfOrder {
+				t.Errorf("got out of order %s, want %s", got, tt.wantOutOfOrder)
+			}
+
+			ms := p.Migrations()
+			if got := planVersions(ms); got != tt.wantOrder {
+				t.Fatalf("got order %s, want %s", got, tt.wantOrder)
+			}
+			for i, m := range ms {
+				if m.Applied != tt.applied[m.Version] {
+					t.Errorf("%d: got applied %t", m.Version, m.Applied)
+				}
+				wantPrevious, wantNext := int64(-1), int64(-1)
+				if i > 0 {
+					wantPrevious = ms[i-1].Version
+				}
+				if i < len(ms)-1 {
+					wantNext = ms[i+1].Version
+				}
+				if m.Previous != wantPrevious || m.Next != wantNext {
+					t.Errorf("%d: got previous %d and next %d, want %d and %d", m.Version, m.Previous, m.Next, wantPrevious, wantNext)
+				}
+			}
+		})
+	}
+}
+
+func TestUpAllOutOfOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 3, "c")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 is applied after 3, and is the current version.
+	writeSQLMigration(t, dir, 2, "b")
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Fatalf("expected version 2, got %d, %v", v, err)
+	}
+
+	// 3 follows 2 in the plan but is applied already.
+	writeSQLMigration(t, dir, 4, "d")
+	if err := UpAll(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := AppliedDBVersions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := int64(1); v <= 4; v++ {
+		if !applied[v] {
+			t.Errorf("expected %d to be applied, got %v", v, applied)
+		}
+	}
+}
+
+func TestFixOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	versions := func() []int64 {
+		t.Helper()
+		records, err := versionRecords(runConfig(), db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vs []int64
+		for _, r := range records {
+			vs = append(vs, r.VersionID)
+		}
+		return vs
+	}
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 3, "c")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 2, "b")
+
+	// Without the option the rows keep the order migrations were applied in.
+	if err := Run("up-all-unapplied", db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(versions()); got != "[0 1 3 2]" {
+		t.Fatalf("expected the apply order, got %s", got)
+	}
+
+	if err := Run("up-all-unapplied", db, dir, "fix"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(versions()); got != "[0 1 2 3]" {
+		t.Fatalf("expected the version order, got %s", got)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 3 {
+		t.Errorf("expected version 3, got %d, %v", v, err)
+	}
+
+	// Rows in order are left alone.
+	if _, err := db.Exec("CREATE TRIGGER reorder BEFORE UPDATE ON goose_db_version BEGIN SELECT RAISE(FAIL, 'rewritten'); END"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpAll(db, dir, WithFixOrder()); err != nil {
+		t.Fatalf("expected no rewrite, got %v", err)
+	}
+}
+
+func TestUpAllWithResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 3, "c")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 2, "b")
+	writeSQLMigration(t, dir, 4, "d")
+
+	result, err := UpAllWithResult(db, dir, WithFixOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied []int64
+	for _, r := range result.Applied {
+		applied = append(applied, r.Migration.Version)
+		if !r.Direction || len(r.Statements) != 1 {
+			t.Errorf("expected the result of applying %d, got %+v", r.Migration.Version, r)
+		}
+	}
+	if !reflect.DeepEqual(applied, []int64{2, 4}) {
+		t.Errorf("got applied %v, want [2 4]", applied)
+	}
+	want := []MovedRecord{{ID: 3, VersionID: 2, Previous: 3}, {ID: 4, VersionID: 3, Previous: 2}}
+	if !reflect.DeepEqual(result.Moved, want) {
+		t.Errorf("got moved %+v, want %+v", result.Moved, want)
+	}
+	if result.Duration <= 0 {
+		t.Error("expected the duration of the run")
+	}
+}
@@ -0,0 +1,67 @@
+package goose
+
+// checkRunnable checks that the migrations can run in the direction
+// before running any of them, so a migration that can't run doesn't stop
+// Up or Down halfway: Go migrations and steps must be registered and SQL
+// migrations must parse, without collation changes unless allowed.
+func checkRunnable(c *config, migrations Migrations, direction bool) error {
+	found := make([][]Problem, len(migrations))
+	parallel(len(migrations), func(i int) {
+		found[i] = runnableProblems(c, migrations[i], direction)
+	})
+
+	var problems []Problem
+	for _, p := range found {
+		problems = append(problems, p...)
+	}
+	if len(problems) > 0 {
+		return &ErrNotRunnable{Problems: problems}
+	}
+	return nil
+}
+
+func runnableProblems(c *config, m *Migration, direction bool) []Problem {
+	if m.dir {
+		steps, err := versionDirSteps(c, m.Source)
+		if err != nil {
+			return []Problem{{Source: m.Source, Message: err.Error()}}
+		}
+
+		var problems []Problem
+		for _, step := range steps {
+			if fileExt(step) == ".sql" {
+				problems = append(problems, parseProblems(c, step, direction)...)
+			} else if _, ok := registeredStep(step); !ok {
+				problems = append(problems, Problem{Source: step, Message: "Go step is not registered, add it with goose.AddMigration and build it into a custom binary"})
+			}
+		}
+		return problems
+	}
+
+	switch ext := fileExt(m.Source); {
+	case m.Registered:
+	case ext == ".sql":
+		return parseProblems(c, m.Source, direction)
+	case ext == ".go":
+		return []Problem{{Source: m.Source, Message: "Go migration is not registered, add it with goose.AddMigration and build it into a custom binary"}}
+	}
+	return nil
+}
+
+func parseProblems(c *config, file string, direction bool) []Problem {
+	if _, err := scanSQLFile(c, file, direction, collationCheck(c)); err != nil {
+		return []Problem{{Source: file, Message: err.Error()}}
+	}
+	return nil
+}
+
+// between returns the migrations with versions in (from, to].
+func (ms Migrations) between(from, to int64) Migrations {
+	var migrations Migrations
+	for _, m := range ms {
+		if m.Version > from && m.Version <= to {
+			migrations = append(migrations, m)
+		}
+	}
+	return migrations
+}
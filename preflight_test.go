@@ -0,0 +1,51 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRunnable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	if err := ioutil.WriteFile(filepath.Join(dir, "00002_data.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 3, "c")
+
+	err = Up(db, dir)
+	notRunnable, ok := err.(*ErrNotRunnable)
+	if !ok || len(notRunnable.Problems) != 1 || filepath.Base(notRunnable.Problems[0].Source) != "00002_data.go" {
+		t.Fatalf("expected ErrNotRunnable for the unregistered Go migration, got %v", err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 0 {
+		t.Errorf("expected no migration to be applied, got version %d (%v)", v, err)
+	}
+
+	// Migrations outside of the plan don't matter.
+	if err := UpTo(db, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownTo(db, dir, 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+package goose
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ProgressPhase is the phase of a migration reported by a ProgressEvent.
+type ProgressPhase int
+
+const (
+	// MigrationStarted is reported before a migration runs.
+	MigrationStarted ProgressPhase = iota
+	// MigrationFinished is reported after a migration is applied.
+	MigrationFinished
+	// MigrationFailed is reported after a migration fails.
+	MigrationFailed
+	// MigrationSkipped is reported after a migration is skipped by its
+	// guard and left pending, see SetRetrySkipped.
+	MigrationSkipped
+)
+
+func (p ProgressPhase) String() string {
+	switch p {
+	case MigrationStarted:
+		return "started"
+	case MigrationFinished:
+		return "finished"
+	case MigrationFailed:
+		return "failed"
+	case MigrationSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// ProgressEvent reports a migration of a run of Up starting or ending, see
+// WithProgress.
+type ProgressEvent struct {
+	Phase     ProgressPhase
+	Migration *Migration
+	Index     int           // position of the migration in the run, from 1
+	Total     int           // number of migrations the run applies
+	Duration  time.Duration // time the migration took, once it ended
+	Err       error         // error of a failed migration
+}
+
+// WithProgress makes Up call fn as each migration starts and ends, so UIs
+// and deploy bots can show the progress of long runs as it happens rather
+// than parse the log. fn is called from the goroutine running Up; to
+// consume the events elsewhere, send them to a channel:
+//
+//	events := make(chan goose.ProgressEvent, 1)
+//	go func() {
+//		defer close(events)
+//		err = goose.Up(db, dir, goose.WithProgress(func(e goose.ProgressEvent) { events <- e }))
+//	}()
+//	for e := range events {
+//		bar.Set(e.Index, e.Total)
+//	}
+func WithProgress(fn func(ProgressEvent)) OptionsFunc {
+	return func(o *options) { o.progress = fn }
+}
+
+// upWithProgress applies m, reporting it to the progress function of o,
+// if any, as the i-th of total migrations.
+func upWithProgress(c *config, db *sql.DB, m *Migration, o options, i, total int) error {
+	if o.progress == nil {
+		return m.up(c, db, o)
+	}
+
+	e := ProgressEvent{Phase: MigrationStarted, Migration: m, Index: i, Total: total}
+	o.progress(e)
+
+	start := time.Now()
+	err := m.up(c, db, o)
+	e.Duration = time.Since(start)
+	switch {
+	case err == errGuardSkipped:
+		e.Phase = MigrationSkipped
+	case err != nil:
+		e.Phase, e.Err = MigrationFailed, err
+	default:
+		e.Phase = MigrationFinished
+	}
+	o.progress(e)
+
+	return err
+}
@@ -0,0 +1,77 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+	if err := ioutil.WriteFile(filepath.Join(dir, "00003_bad.sql"), []byte("-- +goose Up\nCREATE TABLE a (id int);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	err = Up(db, dir, WithProgress(func(e ProgressEvent) {
+		events = append(events, fmt.Sprintf("%d %s %d/%d %v", e.Migration.Version, e.Phase, e.Index, e.Total, e.Err != nil))
+	}))
+	if err == nil {
+		t.Fatal("expected migration 3 to fail")
+	}
+
+	want := []string{
+		"1 started 1/3 false", "1 finished 1/3 false",
+		"2 started 2/3 false", "2 finished 2/3 false",
+		"3 started 3/3 false", "3 failed 3/3 true",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("got events %q, want %q", events, want)
+	}
+
+	// Applied migrations following the current version are not counted.
+	if err := os.Remove(filepath.Join(dir, "00003_bad.sql")); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 3, "c")
+	writeSQLMigration(t, dir, 4, "d")
+	if err := UpAll(db, dir, WithFileFilter(func(path string) bool { return !strings.HasSuffix(path, "_c.sql") })); err != nil {
+		t.Fatal(err)
+	}
+	writeSQLMigration(t, dir, 5, "e")
+	if err := UpAll(db, dir, WithFileFilter(func(path string) bool { return !strings.HasSuffix(path, "_e.sql") })); err != nil {
+		t.Fatal(err)
+	}
+	events = nil
+	if err := Up(db, dir, WithProgress(func(e ProgressEvent) {
+		events = append(events, fmt.Sprintf("%d %s %d/%d %v", e.Migration.Version, e.Phase, e.Index, e.Total, e.Err != nil))
+	})); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"5 started 1/1 false", "5 finished 1/1 false"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("got events %q, want %q", events, want)
+	}
+}
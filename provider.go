@@ -0,0 +1,217 @@
+package goose
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// Provider migrates a database with the migrations of a directory and its
+// own configuration, so a program can migrate databases with different
+// dialects or version tables, e.g. shards of several kinds, without
+// changing the package level configuration. Its methods are the ones of
+// the package level functions, which are deprecated wrappers of them kept
+// for existing code.
+//
+// A Provider keeps its configuration and passes it to the runs of its
+// methods, so they neither wait for other goose runs nor for the Set...
+// functions, and providers can run concurrently.
+type Provider struct {
+	db     *sql.DB
+	dir    string
+	cfg    config
+	ownsDB bool // opened by NewProviderFromConfig
+}
+
+// packageProvider returns a Provider with the package level
+// configuration, for the package level functions wrapping the methods of
+// Provider. Callers hold runMu.
+func packageProvider(db *sql.DB, dir string) *Provider {
+	return &Provider{db: db, dir: dir, cfg: currentConfig()}
+}
+
+// ProviderOption configures a Provider, see NewProvider.
+type ProviderOption func(p *Provider) error
+
+// NewProvider returns a Provider migrating db with the migrations of dir.
+// It starts with the package level configuration, as set with the Set...
+// functions when it is called, changed by opts.
+func NewProvider(db *sql.DB, dir string, opts ...ProviderOption) (*Provider, error) {
+	if db == nil {
+		return nil, errors.New("provider needs a database")
+	}
+
+	p := &Provider{db: db, dir: dir, cfg: currentConfig()}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// WithDialect sets the dialect of a Provider, by the name SetDialect
+// accepts. Without it, the dialect is detected from the driver unless
+// SetDialect was called.
+func WithDialect(name string) ProviderOption {
+	return func(p *Provider) error {
+		d, err := newDialect(name)
+		if err != nil {
+			return err
+		}
+		p.cfg.dialect, p.cfg.dialectSet = d, true
+		return nil
+	}
+}
+
+// WithTableName sets the version table of a Provider, see SetTableName.
+func WithTableName(name string) ProviderOption {
+	return func(p *Provider) error {
+		if name == "" {
+			return errors.New("empty version table name")
+		}
+		p.cfg.tableName = name
+		return nil
+	}
+}
+
+// WithSchema sets the schema of the version table of a Provider, see
+// SetSchema.
+func WithSchema(schema string) ProviderOption {
+	return func(p *Provider) error {
+		p.cfg.schema = schema
+		return nil
+	}
+}
+
+// WithLogger sets the logger of a Provider, see SetLogger.
+func WithLogger(l Logger) ProviderOption {
+	return func(p *Provider) error {
+		p.cfg.logger = l
+		return nil
+	}
+}
+
+// WithVerbosity sets the amount of output of the runs of a Provider, see
+// SetVerbosity.
+func WithVerbosity(v Verbosity) ProviderOption {
+	return func(p *Provider) error {
+		p.cfg.verbosity = v
+		return nil
+	}
+}
+
+// run runs fn with a copy of the configuration of the provider, so the
+// dialect detected by a run doesn't change the provider.
+func (p *Provider) run(fn func(c *config) error) error {
+	c := p.cfg
+	return fn(&c)
+}
+
+// Up applies all available migrations, see Up.
+func (p *Provider) Up(opts ...OptionsFunc) error {
+	return p.UpTo(MaxVersion, opts...)
+}
+
+// UpTo migrates up to a specific version, see UpTo.
+func (p *Provider) UpTo(version int64, opts ...OptionsFunc) error {
+	o := applyOptions(opts)
+	return p.run(func(c *config) error {
+		return withSessionLock(c, o.locker, func() error { return upTo(c, p.db, p.dir, version, o) })
+	})
+}
+
+// UpAll applies all unapplied migrations, including the ones older than
+// the current version, and returns what it changed, see UpAllWithResult.
+func (p *Provider) UpAll(opts ...OptionsFunc) (*UpAllResult, error) {
+	var result *UpAllResult
+	err := p.run(func(c *config) error {
+		var err error
+		result, err = upAllWithResult(c, p.db, p.dir, applyOptions(opts))
+		return err
+	})
+	return result, err
+}
+
+// UpByOne migrates up by a single version, see UpByOne.
+func (p *Provider) UpByOne(opts ...OptionsFunc) (*Migration, error) {
+	o := applyOptions(opts)
+	var m *Migration
+	err := p.run(func(c *config) error {
+		return withSessionLock(c, o.locker, func() error {
+			var err error
+			m, err = upByOne(c, p.db, p.dir, o)
+			return err
+		})
+	})
+	return m, err
+}
+
+// Down rolls back a single migration from the current version, see Down.
+func (p *Provider) Down(opts ...OptionsFunc) (*Migration, error) {
+	o := applyOptions(opts)
+	var m *Migration
+	err := p.run(func(c *config) error {
+		return withSessionLock(c, o.locker, func() error {
+			var err error
+			m, err = down(c, p.db, p.dir, o)
+			return err
+		})
+	})
+	return m, err
+}
+
+// DownTo rolls back the migrations newer than a specific version, see
+// DownTo.
+func (p *Provider) DownTo(version int64, opts ...OptionsFunc) error {
+	return p.run(func(c *config) error {
+		return withSessionLock(c, applyOptions(opts).locker, func() error { return downTo(c, p.db, p.dir, version, opts...) })
+	})
+}
+
+// Redo rolls back the most recently applied migration, then runs it again.
+func (p *Provider) Redo(opts ...OptionsFunc) error {
+	o := applyOptions(opts)
+	return p.run(func(c *config) error {
+		return withSessionLock(c, o.locker, func() error { return redo(c, p.db, p.dir, o) })
+	})
+}
+
+// Reset rolls back all migrations.
+func (p *Provider) Reset(opts ...OptionsFunc) error {
+	o := applyOptions(opts)
+	return p.run(func(c *config) error {
+		return withSessionLock(c, o.locker, func() error { return reset(c, p.db, p.dir, o) })
+	})
+}
+
+// Status prints the status of all migrations.
+func (p *Provider) Status() error {
+	return p.run(func(c *config) error { return status(c, p.db, p.dir) })
+}
+
+// GetDBVersion returns the current version of the database, see
+// GetDBVersion.
+func (p *Provider) GetDBVersion() (int64, error) {
+	var version int64
+	err := p.run(func(c *config) error {
+		var err error
+		version, err = getDBVersion(c, p.db)
+		return err
+	})
+	return version, err
+}
+
+// Close closes the database of a provider returned by
+// NewProviderFromConfig. The database given to NewProvider is left open.
+func (p *Provider) Close() error {
+	if !p.ownsDB {
+		return nil
+	}
+	return p.db.Close()
+}
+
+// Run runs a goose command, as Run does.
+func (p *Provider) Run(command string, args ...string) error {
+	return p.run(func(c *config) error { return run(c, command, p.db, p.dir, args...) })
+}
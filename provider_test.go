@@ -0,0 +1,115 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"app", "audit"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSQLMigration(t, filepath.Join(dir, "app"), 1, "users")
+	writeSQLMigration(t, filepath.Join(dir, "app"), 2, "orders")
+	writeSQLMigration(t, filepath.Join(dir, "audit"), 7, "events")
+
+	app, err := NewProvider(db, filepath.Join(dir, "app"), WithDialect("sqlite3"), WithVerbosity(VerbosityQuiet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := NewProvider(db, filepath.Join(dir, "audit"), WithDialect("sqlite3"), WithTableName("audit_version"), WithVerbosity(VerbosityQuiet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProvider(db, dir, WithDialect("nosql")); err == nil {
+		t.Error("an unknown dialect was accepted")
+	}
+
+	done := make(chan error)
+	go func() { done <- audit.Up() }()
+	if err := app.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := app.GetDBVersion(); err != nil || v != 2 {
+		t.Errorf("got app version %d, %v, want 2", v, err)
+	}
+	if v, err := audit.GetDBVersion(); err != nil || v != 7 {
+		t.Errorf("got audit version %d, %v, want 7", v, err)
+	}
+	if TableName() != "goose_db_version" || dialectName(GetDialect()) != "postgres" {
+		t.Errorf("the package level configuration changed to %s, %s", TableName(), dialectName(GetDialect()))
+	}
+
+	if _, err := audit.Down(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run("down-to", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := app.GetDBVersion(); err != nil || v != 1 {
+		t.Errorf("got app version %d, %v, want 1", v, err)
+	}
+	if v, err := audit.GetDBVersion(); err != nil || v != 0 {
+		t.Errorf("got audit version %d, %v, want 0", v, err)
+	}
+}
+
+func TestProviderIndependentOfPackageRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	writeSQLMigration(t, dir, 1, "users")
+
+	p, err := NewProvider(db, dir, WithDialect("sqlite3"), WithVerbosity(VerbosityQuiet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As a Set... function waiting for a package level run does.
+	runMu.Lock()
+	defer runMu.Unlock()
+
+	done := make(chan error)
+	go func() { done <- p.Up() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the provider waited for the package level configuration")
+	}
+	if v, err := p.GetDBVersion(); err != nil || v != 1 {
+		t.Errorf("got version %d, %v, want 1", v, err)
+	}
+}
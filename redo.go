@@ -5,13 +5,22 @@ import (
 )
 
 // Redo rolls back the most recently applied migration, then runs it again.
-func Redo(db *sql.DB, dir string) error {
-	currentVersion, err := GetDBVersion(db)
+//
+// Deprecated: use Provider.Redo, see NewProvider.
+func Redo(db *sql.DB, dir string, opts ...OptionsFunc) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).Redo(opts...)
+}
+
+// redo is Redo, for callers holding runMu.
+func redo(c *config, db *sql.DB, dir string, o options) error {
+	currentVersion, err := ensureDBVersion(c, db)
 	if err != nil {
 		return err
 	}
 
-	migrations, err := CollectMigrations(dir, minVersion, maxVersion)
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
 	if err != nil {
 		return err
 	}
@@ -20,14 +29,23 @@ func Redo(db *sql.DB, dir string) error {
 	if err != nil {
 		return err
 	}
+	// Don't roll back a migration that can't be applied again.
+	if err := checkRunnable(c, Migrations{current}, true); err != nil {
+		return err
+	}
+
+	h := newHooks(db, dir, o)
+	if err := h.before(c); err != nil {
+		return err
+	}
 
-	if err := current.Down(db); err != nil {
+	if err := current.down(c, db, o); err != nil {
 		return err
 	}
 
-	if err := current.Up(db); err != nil {
+	if err := current.up(c, db, o); err != nil && err != errGuardSkipped {
 		return err
 	}
 
-	return nil
+	return h.after(c)
 }
@@ -0,0 +1,271 @@
+package goose
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// registrationsHeader starts the files written by GenerateRegistrations.
+const registrationsHeader = "// Code generated by goose generate-registrations; DO NOT EDIT."
+
+// goPackage is a parsed package of Go migrations.
+type goPackage struct {
+	name  string
+	files map[string]*ast.File // by base name
+	// registered holds the versions registered by the package. A file
+	// registering a migration the static analysis can't resolve, e.g.
+	// with a name that isn't a literal, registers its own version.
+	registered map[int64]bool
+}
+
+// parseGoPackage parses the Go files of dir, except test files and a file
+// written by GenerateRegistrations, and finds the migrations they register.
+func parseGoPackage(c *config, dir string) (*goPackage, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse Go migrations")
+	}
+	if len(pkgs) > 1 {
+		return nil, errors.Errorf("%s has more than one package", dir)
+	}
+
+	p := &goPackage{files: make(map[string]*ast.File), registered: make(map[int64]bool)}
+	for name, pkg := range pkgs {
+		p.name = name
+		for path, f := range pkg.Files {
+			if isGeneratedRegistrations(f) {
+				continue
+			}
+			p.files[filepath.Base(path)] = f
+			p.findRegistrations(c, filepath.Base(path), f)
+		}
+	}
+	return p, nil
+}
+
+// isGeneratedRegistrations reports whether f was written by
+// GenerateRegistrations, whose registrations are generated again.
+func isGeneratedRegistrations(f *ast.File) bool {
+	return len(f.Comments) > 0 && f.Comments[0].Pos() < f.Package && strings.HasPrefix(f.Comments[0].List[0].Text, registrationsHeader)
+}
+
+// findRegistrations records the migrations registered by the calls of the
+// goose registration functions in f, a file named name.
+func (p *goPackage) findRegistrations(c *config, name string, f *ast.File) {
+	gooseName := ""
+	for _, imp := range f.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == "github.com/lonja/goose/v4" {
+			gooseName = "goose"
+			if imp.Name != nil {
+				gooseName = imp.Name.Name
+			}
+		}
+	}
+	if gooseName == "" {
+		return
+	}
+
+	fileVersion := func() {
+		if v, err := parseVersion(c, name); err == nil {
+			p.registered[v] = true
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		var fn string
+		switch fun := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := fun.X.(*ast.Ident); ok && x.Name == gooseName {
+				fn = fun.Sel.Name
+			}
+		case *ast.Ident:
+			if gooseName == "." {
+				fn = fun.Name
+			}
+		}
+
+		switch fn {
+		case "AddMigration":
+			fileVersion()
+		case "AddNamedMigration":
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				fileVersion()
+				break
+			}
+			filename, _ := strconv.Unquote(lit.Value)
+			if v, err := parseVersion(c, filepath.Base(filename)); err == nil {
+				p.registered[v] = true
+			}
+		case "AddMigrationVersion", "AddSQLMigration":
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.INT {
+				fileVersion()
+				break
+			}
+			if v, err := strconv.ParseInt(lit.Value, 0, 64); err == nil {
+				p.registered[v] = true
+			}
+		}
+		return true
+	})
+}
+
+// migrationFuncs returns the functions of f that can be registered as the
+// Up and Down functions of its migration: functions taking a *sql.Tx and
+// returning an error, whose names start with Up and Down, ignoring case.
+func migrationFuncs(f *ast.File) (ups, downs []string) {
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !isTxFunc(fn.Type) {
+			continue
+		}
+		switch name := strings.ToLower(fn.Name.Name); {
+		case strings.HasPrefix(name, "up"):
+			ups = append(ups, fn.Name.Name)
+		case strings.HasPrefix(name, "down"):
+			downs = append(downs, fn.Name.Name)
+		}
+	}
+	return ups, downs
+}
+
+// isTxFunc reports whether t is func(*sql.Tx) error.
+func isTxFunc(t *ast.FuncType) bool {
+	if len(t.Params.List) != 1 || len(t.Params.List[0].Names) > 1 || t.Results == nil || len(t.Results.List) != 1 {
+		return false
+	}
+	star, ok := t.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Tx" {
+		return false
+	}
+	result, ok := t.Results.List[0].Type.(*ast.Ident)
+	return ok && result.Name == "error"
+}
+
+// unregisteredGoMigrations returns the Go migrations of dir whose
+// migrations aren't registered by the package.
+func unregisteredGoMigrations(c *config, dir string) (*goPackage, []string, error) {
+	_, goFiles, _, err := migrationFiles(c, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := parseGoPackage(c, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unregistered []string
+	for _, file := range goFiles {
+		v, err := parseVersion(c, file)
+		if err != nil {
+			continue // Skip any files that don't have version prefix.
+		}
+		if !p.registered[v] {
+			unregistered = append(unregistered, filepath.Base(file))
+		}
+	}
+	sort.Strings(unregistered)
+	return p, unregistered, nil
+}
+
+// CheckRegistrations checks, without building it, that every Go migration
+// of dir, the directory of a package of Go migrations, is registered with
+// AddMigration or another goose registration function, so a missing
+// registration fails the build instead of a migration at runtime. See
+// GenerateRegistrations.
+func CheckRegistrations(dir string) ([]Problem, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return checkRegistrations(c, dir)
+}
+
+// checkRegistrations is CheckRegistrations, for callers holding runMu.
+func checkRegistrations(c *config, dir string) ([]Problem, error) {
+	_, unregistered, err := unregisteredGoMigrations(c, dir)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	for _, name := range unregistered {
+		problems = append(problems, Problem{Source: filepath.Join(dir, name), Message: "Go migration is not registered, add it with goose.AddMigration or goose generate-registrations"})
+	}
+	return problems, nil
+}
+
+// GenerateRegistrations writes Go source registering the Go migrations of
+// dir that don't register themselves, for go:generate in the package of
+// the migrations:
+//
+//	//go:generate goose -dir . generate-registrations registrations.go
+//
+// A migration is registered with the functions of its file taking a
+// *sql.Tx and returning an error whose names start with Up and Down,
+// ignoring case, such as Up00002 and Down00002. A file with no such Up
+// function, or with several Up or Down functions, makes
+// GenerateRegistrations fail. The file it wrote before is ignored, so it
+// can be generated again.
+func GenerateRegistrations(w io.Writer, dir string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+
+	p, unregistered, err := unregisteredGoMigrations(c, dir)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n\npackage %s\n", registrationsHeader, p.name)
+	if len(unregistered) > 0 {
+		buf.WriteString("\nimport \"github.com/lonja/goose/v4\"\n\nfunc init() {\n")
+	}
+	for _, name := range unregistered {
+		f, ok := p.files[name]
+		if !ok {
+			return errors.Errorf("%s: not in the package of %s", name, dir)
+		}
+		ups, downs := migrationFuncs(f)
+		if len(ups) != 1 || len(downs) > 1 {
+			return errors.Errorf("%s: can't register the migration, found Up functions %v and Down functions %v; declare one of each as func(*sql.Tx) error or register it with goose.AddMigration", name, ups, downs)
+		}
+		down := "nil"
+		if len(downs) == 1 {
+			down = downs[0]
+		}
+		fmt.Fprintf(&buf, "goose.AddNamedMigration(%q, %s, %s)\n", name, ups[0], down)
+	}
+	if len(unregistered) > 0 {
+		buf.WriteString("}\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "failed to format generated code")
+	}
+	_, err = w.Write(src)
+	return err
+}
@@ -0,0 +1,119 @@
+package goose
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegistrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00001_registered.go": `package migrations
+
+import (
+	"database/sql"
+
+	"github.com/lonja/goose/v4"
+)
+
+func init() {
+	goose.AddMigration(up, down)
+}
+
+func up(tx *sql.Tx) error   { return nil }
+func down(tx *sql.Tx) error { return nil }
+`,
+		"00002_unregistered.go": `package migrations
+
+import "database/sql"
+
+func Up00002(tx *sql.Tx) error   { return nil }
+func Down00002(tx *sql.Tx) error { return nil }
+func Update(name string) error   { return nil }
+`,
+		"00003_versioned.go": `package migrations
+
+import "database/sql"
+
+func Up00003(tx *sql.Tx) error { return nil }
+`,
+		"00004_ambiguous.go": `package migrations
+
+import "database/sql"
+
+func UpUsers(tx *sql.Tx) error  { return nil }
+func UpOrders(tx *sql.Tx) error { return nil }
+`,
+		"helpers.go": `package migrations
+
+import g "github.com/lonja/goose/v4"
+
+func init() {
+	g.AddMigrationVersion(3, "versioned", Up00003, nil)
+}
+`,
+		"registrations.go": registrationsHeader + `
+
+package migrations
+
+import "github.com/lonja/goose/v4"
+
+func init() {
+	goose.AddNamedMigration("00002_unregistered.go", Up00002, Down00002)
+}
+`,
+		"00005_test.go": "package migrations\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := CheckRegistrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, filepath.Base(p.Source))
+	}
+	if want := []string{"00002_unregistered.go", "00004_ambiguous.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got unregistered %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := GenerateRegistrations(&buf, dir); err == nil {
+		t.Error("expected a migration with two Up functions to fail")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "00004_ambiguous.go")); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := GenerateRegistrations(&buf, dir); err != nil {
+		t.Fatal(err)
+	}
+	want := registrationsHeader + `
+
+package migrations
+
+import "github.com/lonja/goose/v4"
+
+func init() {
+	goose.AddNamedMigration("00002_unregistered.go", Up00002, Down00002)
+}
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
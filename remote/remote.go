@@ -0,0 +1,150 @@
+// Package remote reads migrations from object storage and web servers, so
+// goose can run them without syncing them to disk first. Sources satisfy
+// goose.MigrationSource:
+//
+//	src, dir, err := remote.Parse("s3://artifacts/app/migrations")
+//	if err != nil {
+//		return err
+//	}
+//	goose.SetMigrationSource(src)
+//	err = goose.Up(db, dir)
+package remote
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Source reads migration files. It is implemented by *HTTP and *S3.
+type Source interface {
+	ReadDir(dir string) ([]string, error)
+	Open(name string) (io.ReadCloser, error)
+}
+
+// Parse returns the source for a migrations URL and the directory to pass
+// to goose. Supported schemes are http and https, s3, and gs, which reads
+// Google Cloud Storage through its S3 compatible API. Object storage
+// credentials are read from the environment, see S3FromEnv.
+func Parse(rawurl string) (Source, string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return &HTTP{BaseURL: u.Scheme + "://" + u.Host}, u.Path, nil
+	case "s3":
+		return S3FromEnv(u.Host), strings.TrimPrefix(u.Path, "/"), nil
+	case "gs":
+		s := S3FromEnv(u.Host)
+		s.Endpoint = "https://storage.googleapis.com"
+		s.Region = "auto"
+		return s, strings.TrimPrefix(u.Path, "/"), nil
+	}
+
+	return nil, "", fmt.Errorf("%q: unsupported scheme %q", rawurl, u.Scheme)
+}
+
+// IsURL reports whether dir is a URL handled by Parse rather than a local path.
+func IsURL(dir string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://", "gs://"} {
+		if strings.HasPrefix(dir, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTP reads migrations from a web server. Directories are listed from the
+// links of the index page the server generates for them, e.g. with nginx
+// autoindex or Apache mod_autoindex.
+type HTTP struct {
+	BaseURL string
+	Client  *http.Client // http.DefaultClient if nil
+}
+
+var matchHref = regexp.MustCompile(`href="([^"?#]+)"`)
+
+// ReadDir returns the sorted names of the files linked from the index page
+// of dir.
+func (h *HTTP) ReadDir(dir string) ([]string, error) {
+	body, err := h.get("readdir", dir, strings.TrimSuffix(urlPath(dir), "/")+"/")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	page, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read index of %s", dir)
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range matchHref.FindAllStringSubmatch(string(page), -1) {
+		name, err := url.PathUnescape(m[1])
+		if err != nil || strings.Contains(name, "/") || seen[name] {
+			continue // subdirectories, parent and absolute links
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Open fetches the named file.
+func (h *HTTP) Open(name string) (io.ReadCloser, error) {
+	return h.get("open", name, urlPath(name))
+}
+
+func (h *HTTP) get(op, name, p string) (io.ReadCloser, error) {
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(h.BaseURL, "/") + (&url.URL{Path: p}).EscapedPath())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(op, name, resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// checkResponse closes the body of unsuccessful responses and turns them
+// into errors, reporting missing files with os.ErrNotExist.
+func checkResponse(op, name string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return &os.PathError{Op: op, Path: name, Err: fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))}
+}
+
+// urlPath turns a path built by goose with filepath.Join into an absolute
+// URL path.
+func urlPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
@@ -0,0 +1,130 @@
+package remote
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("../examples")))
+	defer srv.Close()
+
+	src := &HTTP{BaseURL: srv.URL}
+	names, err := src.ReadDir("sql-migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 || !strings.HasSuffix(names[0], ".sql") {
+		t.Fatalf("unexpected listing %v", names)
+	}
+
+	f, err := src.Open(filepath.Join("sql-migrations", names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("../examples/sql-migrations", names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("unexpected contents of %s", names[0])
+	}
+
+	if _, err := src.Open("sql-migrations/missing.sql"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestS3(t *testing.T) {
+	objects := map[string]string{
+		"db/migrations/00001_a.sql": "-- +goose Up\n",
+		"db/migrations/00002_b.sql": "-- +goose Up\n",
+		"db/other.sql":              "",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned request", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/bucket" {
+			// One object per page to exercise pagination.
+			if r.URL.Query().Get("continuation-token") == "" {
+				fmt.Fprint(w, `<ListBucketResult><Contents><Key>db/migrations/00002_b.sql</Key></Contents><IsTruncated>true</IsTruncated><NextContinuationToken>t</NextContinuationToken></ListBucketResult>`)
+				return
+			}
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>db/migrations/00001_a.sql</Key></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`)
+			return
+		}
+		body, ok := objects[strings.TrimPrefix(r.URL.Path, "/bucket/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	src := &S3{Bucket: "bucket", Endpoint: srv.URL, AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	names, err := src.ReadDir("db/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"00001_a.sql", "00002_b.sql"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+
+	f, err := src.Open(filepath.Join("db/migrations", names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := src.Open("db/migrations/missing.sql"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation.
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	if got, want := hex.EncodeToString(key), "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		url, dir string
+	}{
+		{"https://example.com/app/migrations", "/app/migrations"},
+		{"s3://bucket/app/migrations", "app/migrations"},
+		{"gs://bucket/migrations", "migrations"},
+	}
+	for _, test := range tests {
+		_, dir, err := Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dir != test.dir {
+			t.Errorf("%s: got dir %q, want %q", test.url, dir, test.dir)
+		}
+	}
+
+	if _, _, err := Parse("ftp://example.com/migrations"); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
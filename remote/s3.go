@@ -0,0 +1,252 @@
+package remote
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3 reads migrations from a bucket with the S3 API. It works with Amazon
+// S3 and compatible stores such as Google Cloud Storage (with HMAC keys)
+// and MinIO. Requests are signed with AWS Signature Version 4 unless
+// AccessKeyID is empty, in which case the bucket must be public.
+type S3 struct {
+	Bucket          string
+	Region          string // us-east-1 if empty
+	Endpoint        string // https://s3.<Region>.amazonaws.com if empty
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Client          *http.Client // http.DefaultClient if nil
+
+	now func() time.Time
+}
+
+// S3FromEnv returns an S3 source for bucket configured with the standard
+// AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables, and AWS_ENDPOINT_URL for
+// compatible stores.
+func S3FromEnv(bucket string) *S3 {
+	return &S3{
+		Bucket:          bucket,
+		Region:          os.Getenv("AWS_REGION"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// ReadDir returns the sorted names of the objects directly under the dir
+// prefix.
+func (s *S3) ReadDir(dir string) ([]string, error) {
+	prefix := strings.TrimPrefix(urlPath(dir), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var names []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+	for {
+		body, err := s.get("readdir", dir, "/"+s.Bucket, query)
+		if err != nil {
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(body).Decode(&page)
+		body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list %s", dir)
+		}
+
+		for _, obj := range page.Contents {
+			if name := strings.TrimPrefix(obj.Key, prefix); name != "" {
+				names = append(names, name)
+			}
+		}
+		if !page.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+
+	// S3 lists no objects for a missing prefix rather than failing.
+	if len(names) == 0 {
+		return nil, &os.PathError{Op: "readdir", Path: dir, Err: os.ErrNotExist}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Open fetches the named object.
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	return s.get("open", name, "/"+s.Bucket+urlPath(name), nil)
+}
+
+func (s *S3) get(op, name, p string, query url.Values) (io.ReadCloser, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.region())
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(endpoint, "/")+escapePath(p)+canonicalQuery(query), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.AccessKeyID != "" {
+		s.sign(req, escapePath(p), canonicalQuery(query))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(op, name, resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *S3) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+	return s.Region
+}
+
+// emptyPayloadHash is the SHA-256 of the empty body of GET requests.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds an AWS Signature Version 4 authorization header to req, which
+// requests the escaped path and query.
+func (s *S3) sign(req *http.Request, path, query string) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.TrimPrefix(query, "?"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region())
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashHex(canonicalRequest)}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.SecretAccessKey, date, s.region(), "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// canonicalQuery encodes query sorted by key, as required for signing.
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return "?" + strings.Join(parts, "&")
+}
+
+// escapePath escapes each segment of p the way AWS signs it.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = awsEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsEscape percent-encodes everything but unreserved characters.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
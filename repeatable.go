@@ -0,0 +1,198 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// repeatablePrefix marks repeatable migrations, as in Flyway: R__name.sql.
+const repeatablePrefix = "R__"
+
+// isRepeatable reports whether the migration file is a repeatable
+// migration. Repeatable migrations have no version and are applied again
+// whenever their contents change, after the versioned migrations. They
+// suit objects that are recreated as a whole, like views, stored
+// procedures and grants, and must be idempotent, e.g. CREATE OR REPLACE.
+func isRepeatable(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), repeatablePrefix) && fileExt(name) == ".sql"
+}
+
+func repeatableTableName(c *config) string {
+	return c.versionTableName() + "_repeatable"
+}
+
+// repeatableFiles returns the paths of the repeatable migrations of
+// dirpath, in name order.
+func repeatableFiles(c *config, dirpath string) ([]string, error) {
+	names, err := readMigrationDir(c, dirpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range names {
+		if isRepeatable(name) {
+			files = append(files, filepath.Join(dirpath, name))
+		}
+	}
+
+	return files, nil
+}
+
+// dbRepeatables returns the checksums of the applied repeatable migrations
+// keyed by file name. Create the repeatable migration table if it doesn't
+// exist.
+func dbRepeatables(c *config, db *sql.DB) (map[string]string, error) {
+	checksums := make(map[string]string)
+
+	rows, err := db.Query(fmt.Sprintf("SELECT name, checksum FROM %s", quoteTableName(c.dialect, repeatableTableName(c))))
+	if err != nil {
+		if _, err := db.Exec(c.dialect.createRepeatableTableSQL(c)); err != nil {
+			return nil, errors.Wrap(err, "failed to create repeatable migration table")
+		}
+		return checksums, nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, checksum string
+		if err := rows.Scan(&name, &checksum); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		checksums[name] = checksum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to get next row")
+	}
+
+	return checksums, nil
+}
+
+// applyRepeatables applies the repeatable migrations of dir that are new or
+// changed since they were last applied, in name order, running the pre
+// hook script of h first.
+func applyRepeatables(c *config, db *sql.DB, dir string, h *hooks) error {
+	files, err := repeatableFiles(c, dir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	recorded, err := dbRepeatables(c, db)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		checksum, err := fileChecksum(c, file)
+		if err != nil {
+			return err
+		}
+		if recorded[name] == checksum {
+			continue
+		}
+		if err := h.before(c); err != nil {
+			return err
+		}
+
+		if err := runRepeatable(c, db, file, checksum); err != nil {
+			return errors.Wrapf(err, "failed to run repeatable migration %q", name)
+		}
+		printProgress(c, "OK    %s\n", name)
+	}
+
+	return nil
+}
+
+// runRepeatable executes a repeatable migration and records its checksum.
+// The file may be plain SQL or have a '-- +goose Up' section.
+func runRepeatable(c *config, db *sql.DB, file, checksum string) error {
+	f, err := c.source.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "failed to open migration file")
+	}
+	defer f.Close()
+
+	parsed, err := parseSQLMigration(c, io.MultiReader(strings.NewReader("-- +goose Up\n"), f), true)
+	if err != nil {
+		return err
+	}
+
+	record := func(q Querier) error {
+		d := c.dialect
+		if _, err := q.Exec(bind(c, d.deleteRepeatableSQL(c)), filepath.Base(file)); err != nil {
+			return errors.Wrap(err, "failed to delete repeatable migration checksum")
+		}
+		if _, err := q.Exec(bind(c, d.insertRepeatableSQL(c)), filepath.Base(file), checksum); err != nil {
+			return errors.Wrap(err, "failed to insert repeatable migration checksum")
+		}
+		return nil
+	}
+
+	if !parsed.useTx {
+		q := busyRetryQuerier{db, c}
+		if err := execStatements(context.Background(), c, q, parsed.statements); err != nil {
+			return err
+		}
+		return record(q)
+	}
+
+	return retryBusy(c, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+		if err := execStatements(context.Background(), c, tx, parsed.statements); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := record(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(err, "failed to commit transaction")
+		}
+		return nil
+	})
+}
+
+// printRepeatableStatus prints whether the repeatable migrations of dir are
+// applied, pending, or changed since they were applied.
+func printRepeatableStatus(c *config, db *sql.DB, dir string) error {
+	files, err := repeatableFiles(c, dir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	recorded, err := dbRepeatables(c, db)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		checksum, err := fileChecksum(c, file)
+		if err != nil {
+			return err
+		}
+
+		state := "Pending"
+		switch recorded[name] {
+		case "":
+		case checksum:
+			state = "Applied"
+		default:
+			state = "Changed"
+		}
+		c.logger.Printf("    %-24s -- %v\n", state, name)
+	}
+
+	return nil
+}
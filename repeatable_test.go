@@ -0,0 +1,79 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepeatableMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "runs")
+	writeRepeatable := func(view string) {
+		t.Helper()
+		src := "DROP VIEW IF EXISTS v;\nCREATE VIEW v AS " + view + ";\nINSERT INTO runs VALUES (1);\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "R__views.sql"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM runs").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	writeRepeatable("SELECT 1 AS n")
+	for i := 0; i < 2; i++ {
+		if err := Up(db, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := runs(); n != 1 {
+		t.Fatalf("expected the repeatable migration to run once, ran %d times", n)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 1 {
+		t.Fatalf("expected version 1, got %d (%v)", v, err)
+	}
+
+	writeRepeatable("SELECT 2 AS n")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if n := runs(); n != 2 {
+		t.Fatalf("expected the changed repeatable migration to run again, ran %d times", n)
+	}
+	var n int
+	if err := db.QueryRow("SELECT n FROM v").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("expected the view to be replaced, got %d (%v)", n, err)
+	}
+
+	// Migrating to a specific version leaves repeatable migrations alone.
+	writeRepeatable("SELECT 3 AS n")
+	if err := UpTo(db, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := runs(); n != 2 {
+		t.Fatalf("expected UpTo not to run repeatable migrations, ran %d times", n)
+	}
+}
@@ -8,34 +8,60 @@ import (
 )
 
 // Reset rolls back all migrations
-func Reset(db *sql.DB, dir string) error {
-	migrations, err := CollectMigrations(dir, minVersion, maxVersion)
+//
+// Deprecated: use Provider.Reset, see NewProvider.
+func Reset(db *sql.DB, dir string, opts ...OptionsFunc) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).Reset(opts...)
+}
+
+// reset is Reset, for callers holding runMu.
+func reset(c *config, db *sql.DB, dir string, o options) error {
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
 	if err != nil {
 		return errors.Wrap(err, "failed to collect migrations")
 	}
-	statuses, err := dbMigrationsStatus(db)
+	statuses, err := dbMigrationsStatus(c, db, migrations)
 	if err != nil {
 		return errors.Wrap(err, "failed to get status of migrations")
 	}
-	sort.Sort(sort.Reverse(migrations))
-
+	var applied Migrations
 	for _, migration := range migrations {
-		if !statuses[migration.Version] {
-			continue
+		if statuses[migration.Version] {
+			applied = append(applied, migration)
 		}
-		if err = migration.Down(db); err != nil {
+	}
+	sort.Sort(sort.Reverse(applied))
+	if err := checkRunnable(c, applied, false); err != nil {
+		return err
+	}
+
+	h := newHooks(db, dir, o)
+	for _, migration := range applied {
+		if err := h.before(c); err != nil {
+			return err
+		}
+		if err = migration.down(c, db, o); err != nil {
 			return errors.Wrap(err, "failed to db-down")
 		}
 	}
 
-	return nil
+	return h.after(c)
 }
 
-func dbMigrationsStatus(db *sql.DB) (map[int64]bool, error) {
-	rows, err := GetDialect().dbVersionQuery(db)
-	if err != nil {
+func dbMigrationsStatus(c *config, db *sql.DB, migrations Migrations) (map[int64]bool, error) {
+	if c.compactVersionTable || currentStore(c) != nil {
+		return appliedVersions(c, db, migrations)
+	}
+
+	rows, err := queryVersionTable(c, db)
+	if isVersionTableMissing(err) {
 		return map[int64]bool{}, nil
 	}
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	// The most recent record for each migration specifies
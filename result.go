@@ -0,0 +1,75 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"time"
+)
+
+// MigrationResult is the outcome of a migration run successfully, see
+// SetResultHandler.
+type MigrationResult struct {
+	Migration  *Migration
+	Direction  bool // true if applied, false if rolled back
+	Duration   time.Duration
+	Statements []StatementResult // empty for Go migrations
+}
+
+// StatementResult is a statement executed by a SQL migration.
+type StatementResult struct {
+	Statement    string
+	RowsAffected int64 // -1 if the driver doesn't report it
+}
+
+// SetResultHandler sets a function called with the result of each
+// migration run successfully, e.g. to report how many rows the statements
+// of data migrations touched. Rows affected are also logged per statement
+// in verbose mode. A nil function removes the handler.
+func SetResultHandler(fn func(*MigrationResult)) {
+	updateConfig(func(c *config) { c.resultHandler = fn })
+}
+
+type resultKey struct{}
+
+// withResult returns a context recording the statements executed with it
+// in r.
+func withResult(ctx context.Context, r *MigrationResult) context.Context {
+	return context.WithValue(ctx, resultKey{}, r)
+}
+
+// recordStatement records the i-th statement executed with ctx and
+// returns the rows it affected, or -1 if unknown. Statements recorded by a
+// previous attempt of a retried migration are replaced.
+func recordStatement(ctx context.Context, i int, query string, res sql.Result) int64 {
+	rows := rowsAffected(res)
+
+	if r, ok := ctx.Value(resultKey{}).(*MigrationResult); ok && i > 0 && i <= len(r.Statements)+1 {
+		r.Statements = append(r.Statements[:i-1], StatementResult{Statement: clearStatement(query), RowsAffected: rows})
+	}
+	return rows
+}
+
+// rowsAffected returns the rows affected by a statement, or -1 if unknown.
+func rowsAffected(res sql.Result) int64 {
+	if res == nil || noDriverResult(res) {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// noDriverResult reports whether res is a result of database/sql without
+// the result of the driver, which github.com/mattn/go-sqlite3 leaves nil
+// for some statements, and which database/sql calls anyway.
+func noDriverResult(res sql.Result) bool {
+	v := reflect.ValueOf(res)
+	if v.Kind() != reflect.Struct || v.Type().PkgPath() != "database/sql" {
+		return false
+	}
+	resi := v.FieldByName("resi")
+	return resi.IsValid() && resi.Kind() == reflect.Interface && resi.IsNil()
+}
@@ -0,0 +1,78 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestResultHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	src := "-- +goose Up\nCREATE TABLE users (id int, active bool);\nINSERT INTO users VALUES (1, false), (2, false);\nUPDATE users SET active = true;\n-- +goose Down\nDROP TABLE users;\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00001_users.sql"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var results []*MigrationResult
+	SetResultHandler(func(r *MigrationResult) { results = append(results, r) })
+	defer SetResultHandler(nil)
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Direction || results[0].Migration.Version != 1 {
+		t.Fatalf("expected the result of applying migration 1, got %v", results)
+	}
+	statements := results[0].Statements
+	if len(statements) != 3 {
+		t.Fatalf("expected 3 statement results, got %v", statements)
+	}
+	if statements[2].Statement != "UPDATE users SET active = true;\n" || statements[2].RowsAffected != 2 {
+		t.Errorf("expected the UPDATE to affect 2 rows, got %+v", statements[2])
+	}
+}
+
+type fixedResult int64
+
+func (r fixedResult) LastInsertId() (int64, error) { return 0, nil }
+func (r fixedResult) RowsAffected() (int64, error) {
+	if r < 0 {
+		return 0, errors.New("not supported")
+	}
+	return int64(r), nil
+}
+
+func TestRowsAffected(t *testing.T) {
+	for _, c := range []struct {
+		res  sql.Result
+		want int64
+	}{
+		{nil, -1},
+		{fixedResult(3), 3},
+		{fixedResult(-1), -1},
+	} {
+		if got := rowsAffected(c.res); got != c.want {
+			t.Errorf("rowsAffected(%v) = %d, want %d", c.res, got, c.want)
+		}
+	}
+}
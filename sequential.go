@@ -0,0 +1,165 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetSequentialVersions enables the strict sequential versioning mode.
+// Create then numbers new migrations right after the latest one instead of
+// using a timestamp, and Up refuses to run when the migration versions
+// have gaps or duplicates, or when the applied migrations aren't exactly
+// the first ones, so the migration history stays contiguous.
+func SetSequentialVersions(v bool) {
+	updateConfig(func(c *config) { c.sequentialVersions = v })
+}
+
+// migrationSources returns the sources of the migrations of dir keyed by
+// version. More than one source for a version is a duplicate.
+func migrationSources(c *config, dir string) (map[int64][]string, error) {
+	sqlFiles, goFiles, dirs, err := migrationFiles(c, dir)
+	if err != nil {
+		return nil, err
+	}
+	registered := registeredMigrations()
+
+	sources := make(map[int64][]string)
+	for _, file := range sqlFiles {
+		v, err := parseVersion(c, file)
+		if err != nil {
+			continue // Skip any files that don't have version prefix.
+		}
+		sources[v] = append(sources[v], file)
+	}
+	for _, d := range dirs {
+		v, err := dirVersion(c, d)
+		if err != nil {
+			continue
+		}
+		sources[v] = append(sources[v], d)
+	}
+	for v, m := range registered {
+		sources[v] = append(sources[v], m.Source)
+	}
+	for _, file := range goFiles {
+		v, err := parseVersion(c, file)
+		if err != nil {
+			continue
+		}
+		if _, ok := registered[v]; ok {
+			continue // The registered migration is built from this file.
+		}
+		sources[v] = append(sources[v], file)
+	}
+
+	return sources, nil
+}
+
+// lastVersion returns the version of the latest migration of dir, 0 if
+// the directory is missing or has no migrations yet, whatever the empty
+// directory mode, as the first migration is being created.
+func lastVersion(c *config, dir string) (int64, error) {
+	sources, err := migrationSources(c, dir)
+	if _, ok := errors.Cause(err).(*emptyDirError); ok {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var last int64
+	for v := range sources {
+		if v > last {
+			last = v
+		}
+	}
+	return last, nil
+}
+
+// nextSequentialVersion returns the version following the latest migration
+// of dir.
+func nextSequentialVersion(c *config, dir string) (int64, error) {
+	last, err := lastVersion(c, dir)
+	if err != nil {
+		return 0, err
+	}
+	if isTimestamp(c, last) {
+		return 0, errors.Errorf("version %d is a timestamp; run goose fix before creating sequential migrations", last)
+	}
+
+	return last + 1, nil
+}
+
+// checkSequentialVersions returns an error describing the gaps and
+// duplicates in the versions of dir and in the applied set, if the strict
+// sequential versioning mode is enabled.
+func checkSequentialVersions(c *config, db *sql.DB, dir string) error {
+	if !c.sequentialVersions {
+		return nil
+	}
+
+	sources, err := migrationSources(c, dir)
+	if err != nil {
+		return err
+	}
+	versions := make([]int64, 0, len(sources))
+	for v := range sources {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	migrations := make(Migrations, 0, len(versions))
+	for _, v := range versions {
+		migrations = append(migrations, &Migration{Version: v})
+	}
+	applied, err := appliedVersions(c, db, migrations)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for i, v := range versions {
+		if files := sources[v]; len(files) > 1 {
+			names := make([]string, len(files))
+			for j, f := range files {
+				names[j] = filepath.Base(f)
+			}
+			problems = append(problems, fmt.Sprintf("duplicate version %d: %s", v, strings.Join(names, ", ")))
+		}
+		prev := int64(0)
+		if i > 0 {
+			prev = versions[i-1]
+		}
+		switch {
+		case v == prev+2:
+			problems = append(problems, fmt.Sprintf("version %d is missing", prev+1))
+		case v > prev+2:
+			problems = append(problems, fmt.Sprintf("versions %d to %d are missing", prev+1, v-1))
+		}
+		if i > 0 && applied[v] && !applied[prev] {
+			problems = append(problems, fmt.Sprintf("version %d is applied but %d isn't", v, prev))
+		}
+	}
+
+	var orphans []int64
+	for v := range applied {
+		if _, ok := sources[v]; !ok && v != 0 {
+			orphans = append(orphans, v)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i] < orphans[j] })
+	for _, v := range orphans {
+		problems = append(problems, fmt.Sprintf("applied version %d has no migration", v))
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("migration versions must be sequential: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
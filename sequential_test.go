@@ -0,0 +1,62 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSequentialVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetSequentialVersions(true)
+	defer SetSequentialVersions(false)
+
+	writeSQLMigration(t, dir, 1, "one")
+	if err := Create(nil, dir, "two", "sql"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00002_two.sql")); err != nil {
+		t.Fatalf("expected the next sequential version: %v", err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	writeSQLMigration(t, dir, 4, "four")
+	err = Up(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "version 3 is missing") {
+		t.Fatalf("expected a gap error, got %v", err)
+	}
+
+	writeSQLMigration(t, dir, 3, "three")
+	writeSQLMigration(t, dir, 3, "again")
+	err = Up(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "duplicate version 3") {
+		t.Fatalf("expected a duplicate error, got %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "00003_again.sql")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+}
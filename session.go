@@ -0,0 +1,168 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sessionTagger is implemented by dialects that can label the session
+// running a migration, so DBAs can identify it, e.g. in pg_stat_activity.
+//
+// MySQL connection attributes can only be set when connecting; set them in
+// the DSN instead, e.g. connectionAttributes=program_name:goose.
+type sessionTagger interface {
+	tagSessionSQL(tag string) string // sql string to label the current transaction
+}
+
+// SetSessionTagging enables or disables labeling the sessions running
+// migrations with "goose: <version>", e.g. in application_name on
+// Postgres for the transaction of the migration. It is disabled by
+// default and only applies to migrations run in a transaction.
+func SetSessionTagging(v bool) {
+	updateConfig(func(c *config) { c.tagSessions = v })
+}
+
+// tagSession labels the session of tx with the migration version.
+func tagSession(c *config, tx *sql.Tx, version int64) error {
+	if !c.tagSessions {
+		return nil
+	}
+
+	t, ok := c.dialect.(sessionTagger)
+	if !ok {
+		return nil
+	}
+
+	if _, err := tx.Exec(t.tagSessionSQL(fmt.Sprintf("goose: %d", version))); err != nil {
+		return errors.Wrap(err, "failed to tag session")
+	}
+
+	return nil
+}
+
+// sessionVariableSetter is implemented by dialects that can set session
+// variables, see SetSessionVariables.
+type sessionVariableSetter interface {
+	setSessionVariableSQL(name, value string) string // sql string to set a variable of the session
+	resetSessionVariableSQL(name string) string      // sql string to restore the default of a variable of the session
+}
+
+var sessionVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// SetSessionVariables sets variables of the session at the start of the
+// connection of every migration, such as sql_mode on MySQL, so migrations
+// behave the same whatever the defaults of the server:
+//
+//	goose.SetSessionVariables(map[string]string{
+//		"sql_mode":  "ANSI_QUOTES,STRICT_ALL_TABLES",
+//		"time_zone": "+00:00",
+//	})
+//
+// Numeric values are set as numbers, others as strings. With variables,
+// each migration runs on a dedicated connection of the pool, set up after
+// the connection hook; they are reset to their defaults before the
+// connection returns to the pool. They are supported by MySQL and TiDB.
+// nil removes them.
+func SetSessionVariables(vars map[string]string) error {
+	copied := make(map[string]string, len(vars))
+	for name, value := range vars {
+		if !sessionVariableName.MatchString(name) {
+			return errors.Errorf("invalid session variable name %q", name)
+		}
+		copied[name] = value
+	}
+	if len(copied) == 0 {
+		copied = nil
+	}
+	updateConfig(func(c *config) { c.sessionVariables = copied })
+	return nil
+}
+
+// SetSQLMode sets the sql_mode session variable of MySQL and TiDB for
+// migrations, keeping the other variables set with SetSessionVariables.
+// An empty mode removes it, leaving the default of the server.
+func SetSQLMode(mode string) {
+	updateConfig(func(c *config) { c.sessionVariables = withSQLMode(c.sessionVariables, mode) })
+}
+
+// withSQLMode returns a copy of the session variables vars with the
+// sql_mode variable set to mode, or removed if empty.
+func withSQLMode(vars map[string]string, mode string) map[string]string {
+	copied := make(map[string]string, len(vars)+1)
+	for name, value := range vars {
+		copied[name] = value
+	}
+	if mode == "" {
+		delete(copied, "sql_mode")
+	} else {
+		copied["sql_mode"] = mode
+	}
+	if len(copied) == 0 {
+		return nil
+	}
+	return copied
+}
+
+// sessionVariablesSQL returns the statements setting the session variables
+// of vars, in name order, failing for dialects that don't support them.
+func sessionVariablesSQL(c *config, vars map[string]string) ([]string, error) {
+	d := c.dialect
+	s, ok := d.(sessionVariableSetter)
+	if !ok {
+		return nil, errors.Errorf("session variables are not supported by the %s dialect", dialectName(d))
+	}
+
+	names := sortedNames(vars)
+	statements := make([]string, len(names))
+	for i, name := range names {
+		statements[i] = s.setSessionVariableSQL(name, vars[name])
+	}
+	return statements, nil
+}
+
+// sortedNames returns the names of the session variables vars, in order.
+func sortedNames(vars map[string]string) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setSessionVariables sets the session variables of SetSessionVariables on
+// the dedicated connection of a migration.
+func setSessionVariables(ctx context.Context, c *config, conn *sql.Conn) error {
+	vars := c.sessionVariables
+	if len(vars) == 0 {
+		return nil
+	}
+	statements, err := sessionVariablesSQL(c, vars)
+	if err != nil {
+		return err
+	}
+	for _, query := range statements {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "failed to execute %q", query)
+		}
+	}
+	return nil
+}
+
+var matchDecimal = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// mysqlSessionValue returns value as a MySQL literal: a number if it is a
+// decimal one, a string otherwise.
+func mysqlSessionValue(value string) string {
+	if matchDecimal.MatchString(value) {
+		return value
+	}
+	r := strings.NewReplacer(`\`, `\\`, `'`, `''`)
+	return "'" + r.Replace(value) + "'"
+}
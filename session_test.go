@@ -0,0 +1,77 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// taggingDialect records the session tags in a table.
+type taggingDialect struct{ Sqlite3Dialect }
+
+func (taggingDialect) tagSessionSQL(tag string) string {
+	return "INSERT INTO session_tags VALUES ('" + tag + "')"
+}
+
+func TestSessionTagging(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE session_tags (tag text)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterDialect("tagging", taggingDialect{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDialect("tagging"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	tags := func() []string {
+		t.Helper()
+		rows, err := db.Query("SELECT tag FROM session_tags")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var tags []string
+		for rows.Next() {
+			var tag string
+			if err := rows.Scan(&tag); err != nil {
+				t.Fatal(err)
+			}
+			tags = append(tags, tag)
+		}
+		return tags
+	}
+
+	writeSQLMigration(t, dir, 1, "a")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := tags(); len(got) != 0 {
+		t.Errorf("expected sessions not to be tagged by default, got %v", got)
+	}
+
+	SetSessionTagging(true)
+	defer SetSessionTagging(false)
+	writeSQLMigration(t, dir, 2, "b")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := tags(); len(got) != 1 || got[0] != "goose: 2" {
+		t.Errorf("expected the session of 2 to be tagged, got %v", got)
+	}
+}
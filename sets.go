@@ -0,0 +1,126 @@
+package goose
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationSet is a directory of migrations with its own version table, so
+// independent sets of migrations, like the schema of an application and
+// the one of its analytics, can share a database without fighting over
+// versions.
+type MigrationSet struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+	// Table is the version table of the set, the version table name
+	// followed by _ and the name of the set if empty. Set it to the
+	// version table of a directory migrated before it became a set to keep
+	// its history.
+	Table string `json:"table,omitempty"`
+}
+
+var validSetName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// table returns the version table of the set.
+func (s MigrationSet) table(c *config) string {
+	return s.tableIn(c)
+}
+
+// tableIn returns the version table of the set with the configuration c.
+func (s MigrationSet) tableIn(c *config) string {
+	if s.Table != "" {
+		return s.Table
+	}
+	return c.tableName + "_" + s.Name
+}
+
+// Run runs a goose command, as Run does, on the migrations of the set with
+// its version table. The tables goose keeps next to the version table,
+// like the checksums, are the set's own too.
+//
+// The version table of the set is in the configuration of its run only,
+// so other goose functions running meanwhile don't use it.
+func (s MigrationSet) Run(command string, db *sql.DB, args ...string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	c.tableName = s.tableIn(c)
+	return run(c, command, db, s.Dir, args...)
+}
+
+// rollbackCommands run on the sets in reverse order, so sets roll back
+// before the ones listed before them.
+var rollbackCommands = map[string]bool{"down": true, "down-to": true, "down-all": true, "reset": true}
+
+// RunSets runs a goose command on every set, in order, or in reverse order
+// for the commands rolling back migrations, and stops at the first set that
+// fails.
+func RunSets(command string, db *sql.DB, sets []MigrationSet, args ...string) error {
+	c := runConfig()
+	order := make([]MigrationSet, len(sets))
+	copy(order, sets)
+	if rollbackCommands[command] {
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	}
+
+	for _, s := range order {
+		printProgress(c, "goose: migration set %s\n", s.Name)
+		if err := s.Run(command, db, args...); err != nil {
+			return errors.Wrapf(err, "migration set %s", s.Name)
+		}
+	}
+	return nil
+}
+
+// LoadSets reads the migration sets listed in a JSON manifest:
+//
+//	{"sets": [
+//		{"name": "app", "dir": "app"},
+//		{"name": "analytics", "dir": "analytics", "table": "analytics_version"}
+//	]}
+//
+// Relative directories are relative to the manifest.
+func LoadSets(path string) ([]MigrationSet, error) {
+	c := runConfig()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read migration sets")
+	}
+	var manifest struct {
+		Sets []MigrationSet `json:"sets"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse migration sets %s", path)
+	}
+
+	names := make(map[string]bool)
+	tables := make(map[string]string)
+	for i, s := range manifest.Sets {
+		if !validSetName.MatchString(s.Name) {
+			return nil, errors.Errorf("%s: migration set %q: name must be letters, digits and underscores", path, s.Name)
+		}
+		if names[s.Name] {
+			return nil, errors.Errorf("%s: duplicate migration set %q", path, s.Name)
+		}
+		names[s.Name] = true
+		if s.Dir == "" {
+			return nil, errors.Errorf("%s: migration set %q has no dir", path, s.Name)
+		}
+		if !filepath.IsAbs(s.Dir) {
+			manifest.Sets[i].Dir = filepath.Join(filepath.Dir(path), s.Dir)
+		}
+		table := s.table(c)
+		if other, ok := tables[table]; ok {
+			return nil, errors.Errorf("%s: migration sets %q and %q share the version table %s", path, other, s.Name, table)
+		}
+		tables[table] = s.Name
+	}
+	return manifest.Sets, nil
+}
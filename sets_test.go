@@ -0,0 +1,152 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrationSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for _, name := range []string{"app", "analytics"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSQLMigration(t, filepath.Join(dir, "app"), 1, "users")
+	writeSQLMigration(t, filepath.Join(dir, "app"), 2, "orders")
+	writeSQLMigration(t, filepath.Join(dir, "analytics"), 1, "events")
+
+	manifest := filepath.Join(dir, "sets.json")
+	src := `{"sets": [{"name": "app", "dir": "app", "table": "goose_db_version"}, {"name": "analytics", "dir": "analytics"}]}`
+	if err := ioutil.WriteFile(manifest, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sets, err := LoadSets(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunSets("up", db, sets); err != nil {
+		t.Fatal(err)
+	}
+	versionOf := func(table string) int64 {
+		t.Helper()
+		SetTableName(table)
+		defer SetTableName("goose_db_version")
+		v, err := GetDBVersion(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := versionOf("goose_db_version"); v != 2 {
+		t.Errorf("expected app at version 2, got %d", v)
+	}
+	if v := versionOf("goose_db_version_analytics"); v != 1 {
+		t.Errorf("expected analytics at version 1, got %d", v)
+	}
+	if TableName() != "goose_db_version" {
+		t.Errorf("expected the version table to be restored, got %s", TableName())
+	}
+
+	// Sets run independently.
+	if err := sets[1].Run("down", db); err != nil {
+		t.Fatal(err)
+	}
+	if v := versionOf("goose_db_version"); v != 2 {
+		t.Errorf("expected app to stay at version 2, got %d", v)
+	}
+	if v := versionOf("goose_db_version_analytics"); v != 0 {
+		t.Errorf("expected analytics at version 0, got %d", v)
+	}
+
+	src = `{"sets": [{"name": "a", "dir": "app", "table": "t"}, {"name": "b", "dir": "analytics", "table": "t"}]}`
+	if err := ioutil.WriteFile(manifest, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSets(manifest); err == nil {
+		t.Error("expected sets sharing a version table to be refused")
+	}
+}
+
+func TestMigrationSetConcurrentRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for _, name := range []string{"app", "analytics"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSQLMigration(t, filepath.Join(dir, "app"), 1, "users")
+	writeSQLMigration(t, filepath.Join(dir, "analytics"), 5, "events")
+	if err := Up(db, filepath.Join(dir, "app")); err != nil {
+		t.Fatal(err)
+	}
+	set := MigrationSet{Name: "analytics", Dir: filepath.Join(dir, "analytics")}
+
+	// Runs of the set don't leak its version table to other goose calls.
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 20; i++ {
+			command := "up"
+			if i%2 == 1 {
+				command = "down"
+			}
+			if err := set.Run(command, db); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for running := true; running; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			running = false
+		default:
+		}
+		if v, err := GetDBVersion(db); err != nil || v != 1 {
+			t.Fatalf("got version %d, %v from the version table, want 1", v, err)
+		}
+	}
+	if TableName() != "goose_db_version" {
+		t.Errorf("expected the version table to be restored, got %s", TableName())
+	}
+}
@@ -0,0 +1,109 @@
+package goose
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MigrationSource provides read access to migration files, so they can be
+// loaded from somewhere other than the local filesystem.
+type MigrationSource interface {
+	// ReadDir returns the sorted names of the entries in dir. It must return
+	// an error satisfying os.IsNotExist when dir doesn't exist.
+	ReadDir(dir string) ([]string, error)
+	// Open opens the named migration file for reading.
+	Open(name string) (io.ReadCloser, error)
+}
+
+// SetMigrationSource sets the source migration files are read from.
+// A nil source restores the local filesystem.
+func SetMigrationSource(s MigrationSource) {
+	if s == nil {
+		s = osSource{}
+	}
+	updateConfig(func(c *config) { c.source = s })
+}
+
+// osSource reads migration files from the local filesystem.
+type osSource struct{}
+
+func (osSource) ReadDir(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (osSource) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// fileExt returns the extension of a migration file in lower case, so
+// files saved as 00001_init.SQL by tools on case-insensitive filesystems,
+// like the ones of Windows and macOS, are migrations too.
+func fileExt(name string) string {
+	return strings.ToLower(filepath.Ext(name))
+}
+
+const (
+	upSQLSuffix   = ".up.sql"
+	downSQLSuffix = ".down.sql"
+)
+
+// pairedDownFile returns the .down.sql file paired with an .up.sql
+// migration, in the two-file convention of golang-migrate.
+func pairedDownFile(name string) (string, bool) {
+	if !strings.HasSuffix(name, upSQLSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, upSQLSuffix) + downSQLSuffix, true
+}
+
+// openSQLMigration opens the SQL migration file for direction. Paired
+// .up.sql and .down.sql files are read as if annotated with
+// '-- +goose Up' and '-- +goose Down'; a missing .down.sql file is an
+// empty Down section.
+func openSQLMigration(c *config, name string, direction bool) (io.ReadCloser, error) {
+	src := c.source
+
+	down, paired := pairedDownFile(name)
+	if !paired {
+		return src.Open(name)
+	}
+
+	if direction {
+		f, err := src.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return annotatedFile{io.MultiReader(strings.NewReader("-- +goose Up\n"), f), f}, nil
+	}
+
+	f, err := src.Open(down)
+	if os.IsNotExist(err) {
+		return ioutil.NopCloser(strings.NewReader("-- +goose Down\n")), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return annotatedFile{io.MultiReader(strings.NewReader("-- +goose Down\n"), f), f}, nil
+}
+
+// annotatedFile reads a migration file preceded by an annotation.
+type annotatedFile struct {
+	io.Reader
+	io.Closer
+}
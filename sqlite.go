@@ -0,0 +1,162 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// busyDetector is implemented by dialects whose databases report lock
+// contention with errors that go away by retrying, e.g. SQLITE_BUSY.
+type busyDetector interface {
+	isBusy(err error) bool
+}
+
+// foreignKeyToggler is implemented by dialects that can disable foreign key
+// enforcement for a connection, for the '-- +goose FOREIGN KEYS OFF'
+// annotation.
+type foreignKeyToggler interface {
+	foreignKeysQuery() string           // sql query returning whether foreign keys are enforced
+	foreignKeysSQL(enabled bool) string // sql string to enable or disable foreign keys
+	foreignKeyCheckSQL() string         // sql query listing foreign key violations
+}
+
+// SetBusyTimeout sets how long migrations are retried while the database
+// reports being busy, e.g. SQLite in WAL mode with another writer, or
+// CockroachDB and YugabyteDB with a serialization failure. It defaults to
+// 5s; zero disables retrying, except serialization failures, which are
+// retried for 30s then. Migrations run in a transaction are retried as a
+// whole, others statement by statement.
+func SetBusyTimeout(d time.Duration) {
+	updateConfig(func(c *config) { c.busyTimeout = d })
+}
+
+// retryBusy calls fn until it doesn't fail with a busy error or the busy
+// timeout expires.
+func retryBusy(c *config, fn func() error) error {
+	d, ok := c.dialect.(busyDetector)
+	timeout := c.busyTimeout
+	if r, ok := d.(serializationRetrier); ok && timeout <= 0 {
+		timeout = r.serializationRetryTimeout()
+	}
+	if !ok || timeout <= 0 {
+		return fn()
+	}
+
+	deadline := time.Now().Add(timeout)
+	wait := 10 * time.Millisecond
+	for {
+		err := fn()
+		if err == nil || !d.isBusy(errors.Cause(err)) || time.Now().Add(wait).After(deadline) {
+			return err
+		}
+
+		printInfo(c, "Database is busy, retrying in %v\n", wait)
+		time.Sleep(wait)
+		if wait *= 2; wait > 500*time.Millisecond {
+			wait = 500 * time.Millisecond
+		}
+	}
+}
+
+// busyRetryQuerier retries each statement executed outside of a
+// transaction while the database is busy.
+type busyRetryQuerier struct {
+	Querier
+	c *config // of the run
+}
+
+func (q busyRetryQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := retryBusy(q.c, func() (err error) {
+		if e, ok := q.Querier.(execerContext); ok {
+			res, err = e.ExecContext(ctx, query, args...)
+		} else {
+			res, err = q.Querier.Exec(query, args...)
+		}
+		return err
+	})
+	return res, err
+}
+
+func (q busyRetryQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := retryBusy(q.c, func() (err error) {
+		res, err = q.Querier.Exec(query, args...)
+		return err
+	})
+	return res, err
+}
+
+// beginWithoutForeignKeys returns a function beginning transactions on a
+// dedicated connection with foreign keys disabled, and a function restoring
+// them and releasing the connection, like hookedBegin. SQLite ignores
+// changes to foreign_keys within a transaction, so they are disabled
+// before it.
+func beginWithoutForeignKeys(ctx context.Context, c *config, db *sql.DB) (context.Context, func(context.Context, *sql.TxOptions) (*sql.Tx, error), func(), error) {
+	t, ok := c.dialect.(foreignKeyToggler)
+	if !ok {
+		return nil, nil, nil, errors.Errorf("'-- +goose FOREIGN KEYS OFF' is not supported by the %s dialect", dialectName(c.dialect))
+	}
+
+	conn, release, err := migrationConn(ctx, c, db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var enabled bool
+	if err := conn.QueryRowContext(ctx, t.foreignKeysQuery()).Scan(&enabled); err != nil {
+		release()
+		return nil, nil, nil, errors.Wrap(err, "failed to query foreign keys")
+	}
+	if _, err := conn.ExecContext(ctx, t.foreignKeysSQL(false)); err != nil {
+		release()
+		return nil, nil, nil, errors.Wrap(err, "failed to disable foreign keys")
+	}
+
+	done := func() {
+		if enabled {
+			// ctx may be done by now.
+			if _, err := conn.ExecContext(context.Background(), t.foreignKeysSQL(true)); err != nil {
+				c.logger.Printf("goose: failed to re-enable foreign keys: %v\n", err)
+			}
+		}
+		release()
+	}
+
+	return withConn(ctx, conn), conn.BeginTx, done, nil
+}
+
+// checkForeignKeys fails if tx left rows violating foreign keys, before
+// it is committed.
+func checkForeignKeys(c *config, tx *sql.Tx) error {
+	t := c.dialect.(foreignKeyToggler)
+
+	rows, err := tx.Query(t.foreignKeyCheckSQL())
+	if err != nil {
+		return errors.Wrap(err, "failed to check foreign keys")
+	}
+	defer rows.Close()
+
+	var violations []string
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int64
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return errors.Wrap(err, "failed to scan foreign key violation")
+		}
+		violations = append(violations, fmt.Sprintf("%s row %d references a missing %s row", table, rowid.Int64, parent))
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "failed to check foreign keys")
+	}
+	if len(violations) > 0 {
+		return errors.Errorf("foreign key violations: %s", strings.Join(violations, "; "))
+	}
+
+	return nil
+}
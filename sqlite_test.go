@@ -0,0 +1,124 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForeignKeysOff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	migrations := map[string]string{
+		"00001_tables.sql": `-- +goose Up
+CREATE TABLE parent (id INTEGER PRIMARY KEY);
+CREATE TABLE child (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES parent(id));
+INSERT INTO parent VALUES (1);
+INSERT INTO child VALUES (1, 1);
+-- +goose Down
+`,
+		// The standard SQLite table rebuild, which fails with foreign keys on.
+		"00002_rebuild.sql": `-- +goose FOREIGN KEYS OFF
+-- +goose Up
+CREATE TABLE new_parent (id INTEGER PRIMARY KEY, name TEXT NOT NULL DEFAULT '');
+INSERT INTO new_parent (id) SELECT id FROM parent;
+DROP TABLE parent;
+ALTER TABLE new_parent RENAME TO parent;
+-- +goose Down
+`,
+		"00003_orphan.sql": `-- +goose FOREIGN KEYS OFF
+-- +goose Up
+DELETE FROM parent;
+-- +goose Down
+`,
+	}
+	for name, src := range migrations {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := UpTo(db, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	err = UpTo(db, dir, 3)
+	if err == nil || !strings.Contains(err.Error(), "foreign key violations") {
+		t.Fatalf("expected a foreign key violation, got %v", err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Fatalf("expected version 2, got %d (%v)", v, err)
+	}
+
+	var enabled bool
+	if err := db.QueryRow("PRAGMA foreign_keys;").Scan(&enabled); err != nil {
+		t.Fatal(err)
+	}
+	if !enabled {
+		t.Error("expected foreign keys to be enabled again")
+	}
+}
+
+func TestBusyRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Without a busy timeout in the driver, SQLite fails right away.
+	dsn := filepath.Join(dir, "test.db") + "?_busy_timeout=0"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	other, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "one")
+	if _, err := EnsureDBVersion(db); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := other.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.Exec("CREATE TABLE lock (id int)"); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(200*time.Millisecond, func() { lock.Rollback() })
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+}
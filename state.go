@@ -0,0 +1,73 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// State is the state of a database as goose sees it, see CurrentState.
+type State struct {
+	// Version is the current version, 0 if no migration is applied.
+	Version int64
+	// Initialized reports whether the version table exists. A database at
+	// version 0 with a version table had its migrations rolled back,
+	// while one without was never migrated. It is always set with a
+	// Store, see SetStore.
+	Initialized bool
+	// Dirty reports whether a migration is marked as running, see
+	// SetDirtyTracking, and DirtyVersion is its version.
+	Dirty        bool
+	DirtyVersion int64
+}
+
+// CurrentState returns the state of db. Unlike EnsureDBVersion, it doesn't
+// create the version table, so a fresh database can be told apart from
+// one whose migrations were all rolled back. Unless SetDialect was called,
+// the dialect is detected from the driver of db first.
+func CurrentState(db *sql.DB) (State, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+
+	detectDialect(c, db)
+
+	var s State
+	if store := currentStore(c); store != nil {
+		versions, err := storeVersions(store, db, false)
+		if err != nil {
+			return State{}, err
+		}
+		if len(versions) > 0 {
+			s.Version = versions[len(versions)-1]
+		}
+		s.Initialized = true
+		return s, nil
+	}
+
+	query := currentVersionSQL(c, c.dialect)
+	if c.compactVersionTable {
+		t := versionTableFor(c, c.dialect)
+		query = fmt.Sprintf("SELECT %s FROM %s", t.versionID, t.name)
+	}
+	err := db.QueryRow(query).Scan(&s.Version)
+	if err != nil && err != sql.ErrNoRows {
+		if err := versionTableError(c, err); !isVersionTableMissing(err) {
+			return State{}, err
+		}
+		return s, nil
+	}
+	s.Initialized = true
+
+	// The dirty table is only created by migrations tracking it.
+	err = db.QueryRow(fmt.Sprintf("SELECT version_id FROM %s", quoteTableName(c.dialect, dirtyTableName(c)))).Scan(&s.DirtyVersion)
+	switch {
+	case err == nil:
+		s.Dirty = true
+	case err == sql.ErrNoRows, c.dialect.isMissingTable(err):
+	default:
+		return State{}, errors.Wrap(err, "failed to query dirty table")
+	}
+	return s, nil
+}
@@ -10,31 +10,62 @@ import (
 )
 
 // Status prints the status of all migrations.
+//
+// Deprecated: use Provider.Status, see NewProvider.
 func Status(db *sql.DB, dir string) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).Status()
+}
+
+// status is Status, for callers holding runMu.
+func status(c *config, db *sql.DB, dir string) error {
 	// collect all migrations
-	migrations, err := CollectMigrations(dir, minVersion, maxVersion)
+	migrations, err := collectMigrations(c, dir, MinVersion, MaxVersion)
 	if err != nil {
 		return errors.Wrap(err, "failed to collect migrations")
 	}
 
 	// must ensure that the version table exists if we're running on a pristine DB
-	if _, err := EnsureDBVersion(db); err != nil {
+	current, err := ensureDBVersion(c, db)
+	if err != nil {
 		return errors.Wrap(err, "failed to ensure DB version")
 	}
 
-	log.Println("    Applied At                  Migration")
-	log.Println("    =======================================")
+	var stored map[int64]bool
+	if currentStore(c) != nil {
+		if stored, err = appliedDBVersions(c, db); err != nil {
+			return err
+		}
+	}
+	c.logger.Println("    Applied At                  Migration")
+	c.logger.Println("    =======================================")
 	for _, migration := range migrations {
-		if err := printMigrationStatus(db, migration.Version, filepath.Base(migration.Source)); err != nil {
+		if c.compactVersionTable || stored != nil {
+			// Neither the compact version table nor a store record when
+			// each migration was applied.
+			appliedAt := "Pending"
+			if stored != nil && stored[migration.Version] || stored == nil && migration.Version <= current {
+				appliedAt = "Applied"
+			}
+			c.logger.Printf("    %-24s -- %v\n", appliedAt, filepath.Base(migration.Source))
+			continue
+		}
+		if err := printMigrationStatus(c, db, migration.Version, filepath.Base(migration.Source)); err != nil {
 			return errors.Wrap(err, "failed to print status")
 		}
 	}
 
-	return nil
+	return printRepeatableStatus(c, db, dir)
 }
 
-func printMigrationStatus(db *sql.DB, version int64, script string) error {
-	q := fmt.Sprintf("SELECT tstamp, is_applied FROM %s WHERE version_id=%d ORDER BY tstamp DESC LIMIT 1", TableName(), version)
+func printMigrationStatus(c *config, db *sql.DB, version int64, script string) error {
+	t := versionTableFor(c, c.dialect)
+	from := t.name
+	if h, ok := c.dialect.(historicalReader); ok {
+		from += " " + h.asOfSystemTime()
+	}
+	q := firstRow(c.dialect, fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s=%d ORDER BY %s DESC, %s DESC", t.tstamp, t.isApplied, from, t.versionID, version, t.tstamp, t.id))
 
 	var row MigrationRecord
 	err := db.QueryRow(q).Scan(&row.TStamp, &row.IsApplied)
@@ -48,7 +79,6 @@ func printMigrationStatus(db *sql.DB, version int64, script string) error {
 	} else {
 		appliedAt = "Pending"
 	}
-
-	log.Printf("    %-24s -- %v\n", appliedAt, script)
+	c.logger.Printf("    %-24s -- %v\n", appliedAt, script)
 	return nil
 }
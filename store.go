@@ -0,0 +1,93 @@
+package goose
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// Store keeps track of the applied migrations in place of the version
+// table, for deployments tracking the schema version apart from the data,
+// e.g. in an embedded key-value store. See SetStore.
+type Store interface {
+	// EnsureTable creates the storage of versions if it doesn't exist.
+	EnsureTable(db *sql.DB) error
+	// InsertVersion records that the migration of version was applied. q
+	// runs the migration, so a store keeping versions in the migrated
+	// database can record it in the same transaction.
+	InsertVersion(q Querier, version int64) error
+	// DeleteVersion records that the migration of version was rolled back.
+	DeleteVersion(q Querier, version int64) error
+	// ListApplied returns the versions of the applied migrations, in the
+	// order they were applied.
+	ListApplied(db *sql.DB) ([]int64, error)
+}
+
+// ErrStore is returned by operations that need the version table when a
+// Store keeps track of the applied migrations.
+var ErrStore = errors.New("not supported with a version store")
+
+// SetStore sets the store keeping track of the applied migrations. nil,
+// the default, restores the version table. With a store, the version
+// table settings, like SetCompactVersionTable and SetRollbackHistory, have
+// no effect.
+//
+// Versions are recorded before the transaction of their migration
+// commits, so a store outside the migrated database may keep a version
+// whose migration then failed to commit.
+func SetStore(s Store) {
+	updateConfig(func(c *config) { c.store = s })
+}
+
+// currentStore returns the store set with SetStore, nil for the version
+// table.
+func currentStore(c *config) Store {
+	return c.store
+}
+
+// storeVersions returns the applied versions of the store, in the order
+// they were applied, creating its storage first if create is set.
+func storeVersions(s Store, db *sql.DB, create bool) ([]int64, error) {
+	if create {
+		if err := s.EnsureTable(db); err != nil {
+			return nil, errors.Wrap(err, "failed to ensure version store")
+		}
+	}
+	versions, err := s.ListApplied(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list applied versions")
+	}
+	return versions, nil
+}
+
+// storeDBVersion returns the current version of the store: the last
+// applied migration.
+func storeDBVersion(s Store, db *sql.DB) (int64, error) {
+	versions, err := storeVersions(s, db, true)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// storeApplied returns the applied versions of the store as a set.
+func storeApplied(s Store, db *sql.DB) (map[int64]bool, error) {
+	versions, err := storeVersions(s, db, true)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+// recordStoreVersion records in the store that m was applied or rolled
+// back.
+func recordStoreVersion(s Store, q Querier, m *Migration, direction bool) error {
+	if direction {
+		return errors.Wrap(s.InsertVersion(q, m.Version), "failed to insert new goose version")
+	}
+	return errors.Wrap(s.DeleteVersion(q, m.Version), "failed to delete goose version")
+}
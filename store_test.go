@@ -0,0 +1,97 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// memoryStore keeps the applied versions in memory.
+type memoryStore struct {
+	versions []int64
+	ensured  bool
+}
+
+func (s *memoryStore) EnsureTable(db *sql.DB) error {
+	s.ensured = true
+	return nil
+}
+
+func (s *memoryStore) InsertVersion(q Querier, version int64) error {
+	s.versions = append(s.versions, version)
+	return nil
+}
+
+func (s *memoryStore) DeleteVersion(q Querier, version int64) error {
+	for i, v := range s.versions {
+		if v == version {
+			s.versions = append(s.versions[:i], s.versions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ListApplied(db *sql.DB) ([]int64, error) {
+	return append([]int64(nil), s.versions...), nil
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	store := &memoryStore{}
+	SetStore(store)
+	defer SetStore(nil)
+
+	for v := int64(1); v <= 3; v++ {
+		writeSQLMigration(t, dir, v, fmt.Sprintf("t%d", v))
+	}
+
+	if err := UpTo(db, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !store.ensured || !reflect.DeepEqual(store.versions, []int64{1, 2}) {
+		t.Errorf("expected versions 1 and 2 in the store, got %v", store.versions)
+	}
+	if version, err := EnsureDBVersion(db); err != nil || version != 2 {
+		t.Errorf("got version %d, %v, want 2", version, err)
+	}
+	if _, err := db.Exec("SELECT 1 FROM goose_db_version"); err == nil {
+		t.Error("expected no version table with a store")
+	}
+
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(store.versions, []int64{1}) {
+		t.Errorf("expected version 2 to be deleted from the store, got %v", store.versions)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := CurrentState(db); err != nil || state.Version != 3 || !state.Initialized {
+		t.Errorf("got state %+v, %v, want version 3", state, err)
+	}
+	if err := Status(db, dir); err != nil {
+		t.Error(err)
+	}
+}
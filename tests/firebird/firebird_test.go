@@ -0,0 +1,69 @@
+// Package firebird tests the firebird dialect against a Firebird database.
+// It is a module of its own, so the goose module doesn't depend on the
+// driver.
+package firebird
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lonja/goose/v4"
+	_ "github.com/nakagami/firebirdsql"
+)
+
+// TestFirebird migrates a Firebird database up and down. It runs against
+// the database of GOOSE_FIREBIRD_DSN, e.g. of the firebird docker image:
+//
+//	docker run -d -p 3050:3050 -e FIREBIRD_DATABASE=goose.fdb -e FIREBIRD_USER=goose -e FIREBIRD_PASSWORD=goose firebirdsql/firebird
+//	GOOSE_FIREBIRD_DSN=goose:goose@localhost:3050/goose.fdb go test
+func TestFirebird(t *testing.T) {
+	dsn := os.Getenv("GOOSE_FIREBIRD_DSN")
+	if dsn == "" {
+		t.Skip("GOOSE_FIREBIRD_DSN is not set")
+	}
+
+	db, err := sql.Open("firebirdsql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for v, table := range []string{"fb_a", "fb_b"} {
+		src := fmt.Sprintf("-- +goose Up\nCREATE TABLE %s (id int);\n\n-- +goose Down\nDROP TABLE %s;\n", table, table)
+		name := filepath.Join(dir, fmt.Sprintf("%05d_%s.sql", v+1, table))
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := goose.Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := goose.GetDialect().(*goose.FirebirdDialect); !ok {
+		t.Errorf("got dialect %T, want firebird detected from the driver", goose.GetDialect())
+	}
+	if v, err := goose.GetDBVersion(db); err != nil || v != 2 {
+		t.Errorf("expected version 2, got %d (%v)", v, err)
+	}
+	if err := goose.Status(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := goose.Reset(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := goose.GetDBVersion(db); err != nil || v != 0 {
+		t.Errorf("expected version 0 after reset, got %d (%v)", v, err)
+	}
+	if _, err := db.Exec("DROP TABLE " + goose.TableName()); err != nil {
+		t.Fatal(err)
+	}
+}
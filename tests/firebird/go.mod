@@ -0,0 +1,10 @@
+module github.com/lonja/goose/tests/firebird
+
+go 1.19
+
+require (
+	github.com/lonja/goose/v4 v4.0.0
+	github.com/nakagami/firebirdsql v0.9.10
+)
+
+replace github.com/lonja/goose/v4 => ../../
@@ -0,0 +1,168 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// statementTimeouter is implemented by dialects that can also enforce a
+// timeout on the server, for the statements of a transaction.
+type statementTimeouter interface {
+	statementTimeoutSQL(d time.Duration) string        // sql string to limit the duration of statements in the transaction
+	sessionStatementTimeoutSQL(d time.Duration) string // sql string to limit the duration of statements of the session
+	resetStatementTimeoutSQL() string                  // sql string to restore the statement timeout of the session
+}
+
+// lockTimeouter is implemented by dialects that can limit how long the
+// statements of a transaction wait for locks.
+type lockTimeouter interface {
+	lockTimeoutSQL(d time.Duration) []string        // sql strings to limit how long statements wait for locks
+	sessionLockTimeoutSQL(d time.Duration) []string // sql strings to limit how long statements of the session wait for locks
+	resetLockTimeoutSQL() []string                  // sql strings to restore the lock timeouts of the session
+}
+
+// txSettings are the settings of the transactions of migrations, see
+// WithIsolationLevel, WithLockTimeout and WithStatementTimeout.
+type txSettings struct {
+	isolation        sql.IsolationLevel
+	lockTimeout      time.Duration
+	statementTimeout time.Duration
+}
+
+type txSettingsKey struct{}
+
+// withTxSettings returns a copy of ctx carrying the transaction settings
+// of a migration.
+func withTxSettings(ctx context.Context, s txSettings) context.Context {
+	return context.WithValue(ctx, txSettingsKey{}, s)
+}
+
+// txOptions returns the options beginning the transaction of the
+// migration run with ctx.
+func txOptions(ctx context.Context) *sql.TxOptions {
+	s, _ := ctx.Value(txSettingsKey{}).(txSettings)
+	if s.isolation == sql.LevelDefault {
+		return nil
+	}
+	return &sql.TxOptions{Isolation: s.isolation}
+}
+
+// applyTxSettings sets the lock and statement timeouts of the migration
+// run with ctx in its transaction, failing for dialects that don't support
+// them.
+func applyTxSettings(ctx context.Context, c *config, tx *sql.Tx) error {
+	statements, _, err := timeoutStatements(ctx, c, false)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range statements {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "failed to execute %q", query)
+		}
+	}
+	return nil
+}
+
+// applyConnSettings sets the lock and statement timeouts of the migration
+// run with ctx on conn, for migrations without transaction, failing for
+// dialects that don't support them. They are reset when the connection is
+// released, see migrationConn.
+func applyConnSettings(ctx context.Context, c *config, conn *sql.Conn) error {
+	statements, _, err := timeoutStatements(ctx, c, true)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range statements {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "failed to execute %q", query)
+		}
+	}
+	return nil
+}
+
+// hasTimeouts reports whether the migration run with ctx has lock or
+// statement timeouts.
+func hasTimeouts(ctx context.Context) bool {
+	s, _ := ctx.Value(txSettingsKey{}).(txSettings)
+	return s.lockTimeout > 0 || s.statementTimeout > 0
+}
+
+// timeoutStatements returns the statements setting the lock and statement
+// timeouts of the migration run with ctx, in its transaction or, with
+// session, on its connection, and the ones restoring the timeouts of the
+// session, as some dialects, like MySQL, set them for the session even in
+// transactions.
+func timeoutStatements(ctx context.Context, c *config, session bool) (statements, resets []string, err error) {
+	s, _ := ctx.Value(txSettingsKey{}).(txSettings)
+	d := c.dialect
+
+	if s.lockTimeout > 0 {
+		l, ok := d.(lockTimeouter)
+		if !ok {
+			return nil, nil, errors.Errorf("lock timeouts are not supported by the %s dialect", dialectName(d))
+		}
+		if session {
+			statements = append(statements, l.sessionLockTimeoutSQL(s.lockTimeout)...)
+		} else {
+			statements = append(statements, l.lockTimeoutSQL(s.lockTimeout)...)
+		}
+		resets = append(resets, l.resetLockTimeoutSQL()...)
+	}
+	if s.statementTimeout > 0 {
+		t, ok := d.(statementTimeouter)
+		if !ok {
+			return nil, nil, errors.Errorf("statement timeouts are not supported by the %s dialect", dialectName(d))
+		}
+		if session {
+			statements = append(statements, t.sessionStatementTimeoutSQL(s.statementTimeout))
+		} else {
+			statements = append(statements, t.statementTimeoutSQL(s.statementTimeout))
+		}
+		resets = append(resets, t.resetStatementTimeoutSQL())
+	}
+	return statements, resets, nil
+}
+
+// SetMigrationTimeout sets how long a migration may run before it is
+// canceled and rolled back. It applies to migrations without a
+// '-- +goose TIMEOUT <duration>' annotation; zero, the default, means no
+// timeout.
+func SetMigrationTimeout(d time.Duration) {
+	updateConfig(func(c *config) { c.migrationTimeout = d })
+}
+
+// migrationContext returns a context derived from parent, canceled after
+// the timeout, if any.
+func migrationContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// limitStatements enforces the timeout on the server as well, for dialects
+// supporting it, so statements don't outlive a canceled client.
+func limitStatements(ctx context.Context, c *config, tx *sql.Tx, timeout time.Duration) error {
+	t, ok := c.dialect.(statementTimeouter)
+	if !ok || timeout <= 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, t.statementTimeoutSQL(timeout)); err != nil {
+		return errors.Wrap(err, "failed to set statement timeout")
+	}
+	return nil
+}
+
+// timeoutError explains errors caused by the timeout of ctx.
+func timeoutError(ctx context.Context, err error, timeout time.Duration) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(err, "migration timed out after %v", timeout)
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrationTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "users")
+	slow := `-- +goose TIMEOUT 100ms
+-- +goose Up
+CREATE TABLE numbers (n INTEGER);
+INSERT INTO numbers WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM c) SELECT n FROM c;
+-- +goose Down
+DROP TABLE numbers;
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "00002_slow.sql"), []byte(slow), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = Up(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("migration was canceled after %v", elapsed)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 1 {
+		t.Fatalf("expected version 1, got %d (%v)", v, err)
+	}
+	if _, err := db.Exec("SELECT * FROM numbers"); err == nil {
+		t.Fatal("timed out migration was not rolled back")
+	}
+}
@@ -0,0 +1,116 @@
+package goose
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultTimestampFormat is the layout of the versions of new migrations.
+const defaultTimestampFormat = "20060102150405"
+
+// millisecondTimestampFormat is the default layout with milliseconds.
+const millisecondTimestampFormat = defaultTimestampFormat + ".000"
+
+// SetTimestampFormat sets the layout, as in time.Format, of the versions
+// of new migrations, e.g. "200601021504" for minutes or
+// "20060102150405.000" for milliseconds, so developers creating migrations
+// in the same second get different versions. As versions are numbers, the
+// layout must format times with digits only, but for the separator of
+// fractional seconds, which is left out. An empty layout restores the
+// default, 20060102150405.
+func SetTimestampFormat(layout string) error {
+	layout, err := checkTimestampFormat(layout)
+	if err != nil {
+		return err
+	}
+	updateConfig(func(c *config) { c.timestampFormat = layout })
+	return nil
+}
+
+// checkTimestampFormat returns the timestamp format layout, the default
+// one if empty, or an error if it doesn't format versions.
+func checkTimestampFormat(layout string) (string, error) {
+	if layout == "" {
+		layout = defaultTimestampFormat
+	}
+	ref := formatTimestamp(layout, time.Date(2006, 1, 2, 15, 4, 5, 123456789, time.UTC))
+	if strings.Trim(ref, "0123456789") != "" || len(ref) > 18 {
+		return "", errors.Errorf("timestamp format %q must format times with at most 18 digits only", layout)
+	}
+	if _, err := parseTimestamp(layout, ref); err != nil {
+		return "", errors.Wrapf(err, "invalid timestamp format %q", layout)
+	}
+	return layout, nil
+}
+
+// SetClock sets the function returning the time new migrations are
+// versioned with and maintenance windows are checked against, e.g. a fixed
+// time in tests. A nil function restores time.Now.
+func SetClock(now func() time.Time) {
+	updateConfig(func(c *config) { c.clock = now })
+}
+
+// SetTimestampUTC sets whether new migrations are versioned with the time
+// in UTC rather than in the local timezone, so teams spanning timezones
+// create versions in the order they wrote the migrations.
+func SetTimestampUTC(utc bool) {
+	updateConfig(func(c *config) { c.timestampUTC = utc })
+}
+
+// currentTime returns the time of the clock set with SetClock.
+func currentTime(c *config) time.Time {
+	if clock := c.clock; clock != nil {
+		return clock()
+	}
+	return time.Now()
+}
+
+// formatTimestamp formats t in the layout, leaving out the separator of
+// fractional seconds.
+func formatTimestamp(layout string, t time.Time) string {
+	return strings.Replace(t.Format(layout), ".", "", 1)
+}
+
+// parseTimestamp parses a version formatted by formatTimestamp.
+func parseTimestamp(layout, version string) (time.Time, error) {
+	ref := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(layout)
+	if i := strings.Index(ref, "."); i >= 0 && i < len(version) {
+		version = version[:i] + "." + version[i:]
+	}
+	return time.Parse(layout, version)
+}
+
+// timestampVersion returns the version of a new migration of dir, the
+// current time in the timestamp format. Versions are monotonic: if a
+// migration of dir has a timestamp version in the format that is the same
+// or later, as when migrations are created in the same second, the version
+// is the next timestamp after it.
+func timestampVersion(c *config, dir string) (string, error) {
+	t := currentTime(c)
+	if c.timestampUTC {
+		t = t.UTC()
+	}
+	version := formatTimestamp(c.timestampFormat, t)
+
+	last, err := lastVersion(c, dir)
+	if err != nil {
+		return "", err
+	}
+	if n, err := strconv.ParseInt(version, 10, 64); err != nil || n > last {
+		return version, nil
+	}
+	lastTime, err := parseTimestamp(c.timestampFormat, strconv.FormatInt(last, 10))
+	if err != nil {
+		return version, nil // not a timestamp in the format
+	}
+	for _, d := range []time.Duration{time.Millisecond, time.Second, time.Minute, time.Hour, 24 * time.Hour} {
+		next := formatTimestamp(c.timestampFormat, lastTime.Add(d))
+		if n, err := strconv.ParseInt(next, 10, 64); err == nil && n > last {
+			return next, nil
+		}
+	}
+	return version, nil
+}
@@ -0,0 +1,105 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimestampVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	SetClock(func() time.Time { return time.Date(2020, 3, 4, 5, 6, 7, 0, zone) })
+	defer SetClock(nil)
+
+	if err := Create(nil, dir, "local", "sql"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20200304050607_local.sql")); err != nil {
+		t.Fatalf("expected a version in the timezone of the clock: %v", err)
+	}
+
+	SetTimestampUTC(true)
+	defer SetTimestampUTC(false)
+	if err := SetTimestampFormat("200601021504"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTimestampFormat("")
+	if err := Create(nil, dir, "utc", "sql"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "202003040306_utc.sql")); err != nil {
+		t.Fatalf("expected a version in UTC with minutes: %v", err)
+	}
+	if !isTimestamp(runConfig(), 202003040306) {
+		t.Error("expected versions in the timestamp format to be timestamps")
+	}
+
+	for _, layout := range []string{"2006-01-02", "Jan 2006", "20060102150405.000000000"} {
+		if err := SetTimestampFormat(layout); err == nil {
+			t.Errorf("expected %q to be refused", layout)
+		}
+	}
+}
+
+func TestMonotonicVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	SetClock(func() time.Time { return time.Date(2020, 3, 4, 5, 6, 59, 999000000, time.UTC) })
+	defer SetClock(nil)
+
+	// The first migration is created in a directory without migrations.
+	SetEmptyDirMode(EmptyDirStrict)
+	defer SetEmptyDirMode(EmptyDirDefault)
+
+	for _, name := range []string{"one", "two"} {
+		if err := Create(nil, dir, name, "sql"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"20200304050659_one.sql", "20200304050700_two.sql"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected versions following each other in the same second: %v", err)
+		}
+	}
+
+	if err := SetTimestampFormat("20060102150405.000"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTimestampFormat("")
+	for _, name := range []string{"three", "four"} {
+		if err := Create(nil, dir, name, "sql"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"20200304050659999_three.sql", "20200304050700000_four.sql"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected versions with milliseconds: %v", err)
+		}
+	}
+
+	migrations, err := CollectMigrations(dir, MinVersion, MaxVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 4 || migrations[3].Version != 20200304050700000 {
+		t.Fatalf("got migrations %v", migrations)
+	}
+	if n := len(migrations.Timestamped()); n != 4 {
+		t.Errorf("got %d timestamped migrations, want the ones with and without milliseconds", n)
+	}
+	if n := len(migrations.Versioned()); n != 0 {
+		t.Errorf("got %d versioned migrations, want none", n)
+	}
+}
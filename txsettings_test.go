@@ -0,0 +1,102 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTxSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+
+	err = Up(db, dir, WithLockTimeout(time.Second))
+	if err == nil || !strings.Contains(err.Error(), "lock timeouts are not supported by the sqlite3 dialect") {
+		t.Fatalf("expected lock timeouts to be rejected, got %v", err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 0 {
+		t.Errorf("expected nothing to be migrated, got version %d (%v)", v, err)
+	}
+
+	if err := UpTo(db, dir, 1, WithIsolationLevel(sql.LevelSerializable)); err != nil {
+		t.Fatal(err)
+	}
+	if opts := txOptions(context.Background()); opts != nil {
+		t.Errorf("expected no options by default, got %+v", opts)
+	}
+	ctx := withTxSettings(context.Background(), txSettings{isolation: sql.LevelSerializable})
+	if opts := txOptions(ctx); opts == nil || opts.Isolation != sql.LevelSerializable {
+		t.Errorf("expected a serializable transaction, got %+v", opts)
+	}
+
+	// Rolling back and migrations without transaction have the settings
+	// too.
+	_, err = Down(db, dir, WithLockTimeout(time.Second))
+	if err == nil || !strings.Contains(err.Error(), "lock timeouts are not supported by the sqlite3 dialect") {
+		t.Fatalf("expected lock timeouts to be rejected by Down, got %v", err)
+	}
+	err = Redo(db, dir, WithStatementTimeout(time.Second))
+	if err == nil || !strings.Contains(err.Error(), "statement timeouts are not supported by the sqlite3 dialect") {
+		t.Fatalf("expected statement timeouts to be rejected by Redo, got %v", err)
+	}
+	src := "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE TABLE c (id int);\n-- +goose Down\nDROP TABLE c;\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "00003_c.sql"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpTo(db, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	err = Up(db, dir, WithLockTimeout(time.Second))
+	if err == nil || !strings.Contains(err.Error(), "lock timeouts are not supported by the sqlite3 dialect") {
+		t.Fatalf("expected lock timeouts to be rejected for migrations without transaction, got %v", err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 2 {
+		t.Errorf("expected version 2, got %d (%v)", v, err)
+	}
+
+	if got, want := (PostgresDialect{}).sessionLockTimeoutSQL(1500*time.Millisecond), []string{"SET lock_timeout = 1500;"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := (PostgresDialect{}).lockTimeoutSQL(1500*time.Millisecond), []string{"SET LOCAL lock_timeout = 1500;"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	want := []string{"SET SESSION innodb_lock_wait_timeout = 2;", "SET SESSION lock_wait_timeout = 2;"}
+	if got := (MySQLDialect{}).lockTimeoutSQL(1500 * time.Millisecond); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Timeouts set for the session are reset before the connection
+	// returns to the pool.
+	if err := SetDialect("mysql"); err != nil {
+		t.Fatal(err)
+	}
+	ctx = withTxSettings(context.Background(), txSettings{lockTimeout: time.Second})
+	_, resets, err := timeoutStatements(ctx, runConfig(), false)
+	want = []string{"SET SESSION innodb_lock_wait_timeout = DEFAULT;", "SET SESSION lock_wait_timeout = DEFAULT;"}
+	if err != nil || !reflect.DeepEqual(resets, want) {
+		t.Errorf("got %q (%v), want %q", resets, err, want)
+	}
+}
@@ -3,151 +3,575 @@ package goose
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
-// UpTo migrates up to a specific version.
-func UpTo(db *sql.DB, dir string, version int64) error {
-	migrations, err := CollectMigrations(dir, minVersion, version)
+// UpTo migrates up to a specific version, applying it. It fails with
+// ErrWrongDirection if the database is past the version, unless
+// WithIdempotentTarget is set.
+//
+// Deprecated: use Provider.UpTo, see NewProvider.
+func UpTo(db *sql.DB, dir string, version int64, opts ...OptionsFunc) error {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).UpTo(version, opts...)
+}
+
+func upTo(c *config, db *sql.DB, dir string, version int64, o options) error {
+	version, err := pinnedTarget(c, version)
 	if err != nil {
 		return err
 	}
+	if err := checkSequentialVersions(c, db, dir); err != nil {
+		return err
+	}
+	if err := checkMaxPending(c, db, dir, o); err != nil {
+		return err
+	}
+	if err := o.checkMaintenanceWindow(); err != nil {
+		return err
+	}
+	if err := checkStrictOrder(c, db, dir, o); err != nil {
+		return err
+	}
+	if err := verifyAppliedChecksums(c, db, dir); err != nil {
+		return err
+	}
 
-	for {
-		current, err := GetDBVersion(db)
+	migrations, err := collectMigrations(c, dir, MinVersion, version)
+	if err != nil {
+		return err
+	}
+	migrations = o.selected(c, migrations)
+	currentVersion, err := ensureDBVersion(c, db)
+	if err != nil {
+		return err
+	}
+	if currentVersion > version {
+		if o.idempotent {
+			printProgress(c, "goose: no migrations to run. current version: %d\n", currentVersion)
+			return nil
+		}
+		return &ErrWrongDirection{Command: "up-to", Target: version, Current: currentVersion}
+	}
+	// Migrations following the current version may be applied already,
+	// when UpAll or filtered runs applied migrations out of order.
+	applied, err := appliedVersions(c, db, migrations)
+	if err != nil {
+		return err
+	}
+	var pending Migrations
+	for _, m := range migrations.between(currentVersion, version) {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	if err := checkRunnable(c, pending, true); err != nil {
+		return err
+	}
+	if o.singleTx {
+		return upBatch(c, db, dir, pending, o, true, version == MaxVersion)
+	}
+
+	h := newHooks(db, dir, o)
+	expected := int64(-1) // version after the last applied migration
+	cursor := int64(-1)   // migration walked past without applying it, if any
+	for run := 1; ; {
+		current, err := ensureDBVersion(c, db)
 		if err != nil {
 			return err
 		}
+		if expected >= 0 && current != expected {
+			return &ErrConcurrentMigration{Expected: expected, Actual: current}
+		}
 
-		next, err := migrations.Next(current)
+		from := current
+		if cursor >= 0 {
+			from = cursor
+		}
+		next, err := migrations.Next(from)
 		if err != nil {
 			if err == ErrNoNextVersion {
-				log.Printf("goose: no migrations to run. current version: %d\n", current)
-				return nil
+				printProgress(c, "goose: no migrations to run. current version: %d\n", current)
+				if version == MaxVersion {
+					if err := applyRepeatables(c, db, dir, h); err != nil {
+						return err
+					}
+				}
+				return h.after(c)
 			}
 			return err
 		}
+		if applied[next.Version] {
+			cursor = next.Version
+			continue
+		}
 
-		if err = next.Up(db); err != nil {
+		deferred, window, err := o.deferred(c, next)
+		if err != nil {
 			return err
 		}
+		if deferred {
+			deferHeavy(c, next, window)
+			return h.after(c)
+		}
+
+		if err := h.before(c); err != nil {
+			return err
+		}
+		err = upWithProgress(c, db, next, o, run, len(pending))
+		run++
+		if err == errGuardSkipped {
+			cursor = next.Version
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		expected, cursor = next.Version, -1
 	}
 }
 
 // Up applies all available migrations.
-func Up(db *sql.DB, dir string) error {
-	return UpTo(db, dir, maxVersion)
+//
+// Deprecated: use Provider.Up, see NewProvider.
+func Up(db *sql.DB, dir string, opts ...OptionsFunc) error {
+	return UpTo(db, dir, MaxVersion, opts...)
+}
+
+// UpAll applies all unapplied migrations, including the ones older than
+// the current version. The version table keeps the order they were applied
+// in, unless WithFixOrder is set.
+//
+// Deprecated: use Provider.UpAll, see NewProvider.
+func UpAll(db *sql.DB, dir string, opts ...OptionsFunc) error {
+	_, err := UpAllWithResult(db, dir, opts...)
+	return err
 }
 
-func UpAll(db *sql.DB, dir string) error {
-	applied, err := AppliedDBVersions(db)
+// UpWithVersion is Up, also returning the version of the database once
+// migrated, see UpToWithVersion.
+func UpWithVersion(db *sql.DB, dir string, opts ...OptionsFunc) (int64, error) {
+	return UpToWithVersion(db, dir, MaxVersion, opts...)
+}
+
+// UpToWithVersion is UpTo, also returning the version of the database once
+// migrated, so callers don't need another query to know it. It is the one
+// reached before the failing migration if UpTo fails, or -1 if it can't be
+// read.
+func UpToWithVersion(db *sql.DB, dir string, version int64, opts ...OptionsFunc) (int64, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	o := applyOptions(opts)
+	return withVersion(c, db, func() error {
+		return withSessionLock(c, o.locker, func() error { return upTo(c, db, dir, version, o) })
+	})
+}
+
+// UpAllWithVersion is UpAll, also returning the version of the database
+// once migrated, see UpToWithVersion.
+func UpAllWithVersion(db *sql.DB, dir string, opts ...OptionsFunc) (int64, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return withVersion(c, db, func() error {
+		_, err := upAllWithResult(c, db, dir, applyOptions(opts))
+		return err
+	})
+}
+
+// withVersion runs fn, then returns the version of the database with the
+// error of fn, if any.
+func withVersion(c *config, db *sql.DB, fn func() error) (int64, error) {
+	err := fn()
+	current, versionErr := ensureDBVersion(c, db)
+	if versionErr != nil {
+		current = -1
+		if err == nil {
+			err = versionErr
+		}
+	}
+	return current, err
+}
+
+// UpAllResult reports what a run of UpAll changed, e.g. for deployment
+// audit logs.
+type UpAllResult struct {
+	// Applied are the migrations applied, in order, with their durations.
+	Applied []*MigrationResult
+	// Moved are the rows of the version table rewritten by WithFixOrder.
+	Moved    []MovedRecord
+	Duration time.Duration
+}
+
+// MovedRecord is a row of the version table rewritten by WithFixOrder to
+// record another version.
+type MovedRecord struct {
+	ID        int64 // row of the version table
+	VersionID int64 // version it records now
+	Previous  int64 // version it recorded before
+}
+
+// UpAllWithResult is UpAll, returning what it applied and reordered. If a
+// migration fails, the result has the migrations applied before it.
+//
+// Deprecated: use Provider.UpAll, see NewProvider.
+func UpAllWithResult(db *sql.DB, dir string, opts ...OptionsFunc) (*UpAllResult, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).UpAll(opts...)
+}
+
+// upAllWithResult is UpAllWithResult, for callers holding runMu.
+func upAllWithResult(c *config, db *sql.DB, dir string, o options) (*UpAllResult, error) {
+	result := &UpAllResult{}
+	results := o.results
+	o.results = func(r *MigrationResult) {
+		result.Applied = append(result.Applied, r)
+		if results != nil {
+			results(r)
+		}
+	}
+
+	start := time.Now()
+	err := withSessionLock(c, o.locker, func() error {
+		if err := upAll(c, db, dir, o); err != nil {
+			return err
+		}
+		if o.fixOrder {
+			moved, err := fixUp(c, db)
+			result.Moved = moved
+			return err
+		}
+		return nil
+	})
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+func upAll(c *config, db *sql.DB, dir string, o options) error {
+	if err := checkSequentialVersions(c, db, dir); err != nil {
+		return err
+	}
+	if err := checkMaxPending(c, db, dir, o); err != nil {
+		return err
+	}
+	if err := o.checkMaintenanceWindow(); err != nil {
+		return err
+	}
+	if err := verifyAppliedChecksums(c, db, dir); err != nil {
+		return err
+	}
+
+	applied, err := appliedDBVersions(c, db)
 	if err != nil {
 		return err
 	}
 
-	migrations, err := CollectAllMigrations(dir, applied, minVersion, MaxVersion)
+	target, err := pinnedTarget(c, MaxVersion)
 	if err != nil {
 		return err
 	}
+	migrations, err := collectAllMigrations(c, dir, applied, MinVersion, target)
+	if err != nil {
+		return err
+	}
+	migrations = o.selected(c, migrations)
 
-	for {
-		current, err := GetDBVersion(db)
+	var pending Migrations
+	for _, m := range migrations {
+		if !m.Applied {
+			pending = append(pending, m)
+		}
+	}
+	if err := checkRunnable(c, pending, true); err != nil {
+		return err
+	}
+	if o.singleTx {
+		return upBatch(c, db, dir, pending, o, false, target == MaxVersion)
+	}
+
+	h := newHooks(db, dir, o)
+	expected := int64(-1) // version after the last applied migration
+	cursor := int64(-1)   // migration walked past without applying it, if any
+	for run := 1; ; {
+		current, err := ensureDBVersion(c, db)
 		if err != nil {
 			return err
 		}
+		if expected >= 0 && current != expected {
+			return &ErrConcurrentMigration{Expected: expected, Actual: current}
+		}
 
-		next, err := migrations.Next(current)
+		from := current
+		if cursor >= 0 {
+			from = cursor
+		}
+		next, err := migrations.Next(from)
 		if err != nil {
 			if err == ErrNoNextVersion {
-				log.Printf("goose: no migrations to run. current version: %d\n", current)
-				return nil
+				printProgress(c, "goose: no migrations to run. current version: %d\n", current)
+				if target == MaxVersion {
+					if err := applyRepeatables(c, db, dir, h); err != nil {
+						return err
+					}
+				}
+				return h.after(c)
 			}
 			return err
 		}
 
-		if err = next.Up(db); err != nil {
+		// The current version may be older than applied migrations
+		// following it in the plan, when migrations were applied out of
+		// order.
+		if next.Applied {
+			cursor = next.Version
+			continue
+		}
+
+		deferred, window, err := o.deferred(c, next)
+		if err != nil {
+			return err
+		}
+		if deferred {
+			deferHeavy(c, next, window)
+			cursor = next.Version
+			continue
+		}
+
+		if err := h.before(c); err != nil {
+			return err
+		}
+		err = upWithProgress(c, db, next, o, run, len(pending))
+		run++
+		if err == errGuardSkipped {
+			cursor = next.Version
+			continue
+		}
+		if err != nil {
 			return err
 		}
+		expected, cursor = next.Version, -1
 	}
 }
 
-func fixUp(db *sql.DB) error {
-	log.Print("goose: fixing migrations order\n")
-	rows, err := GetDialect().dbVersionQuery(db)
+// fixUp rewrites the rows of the version table so their order follows the
+// versions, as if the migrations applied out of order by UpAll had been
+// applied in order, and returns the rows it moved. Rows already in order
+// are left alone, so running it again changes nothing.
+func fixUp(c *config, db *sql.DB) ([]MovedRecord, error) {
+	if c.compactVersionTable {
+		return nil, ErrCompactVersionTable
+	}
+	if currentStore(c) != nil {
+		return nil, ErrStore
+	}
+	if c.noFixUp {
+		printProgress(c, "goose: not fixing migrations order, the no-fixup feature is enabled\n")
+		return nil, nil
+	}
+
+	records, err := versionRecords(c, db)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer rows.Close()
-	tx, err := db.Begin()
-	var prevRow *MigrationRecord
-	for rows.Next() {
-		row := new(MigrationRecord)
-		if err = rows.Scan(&row.ID, &row.VersionID, &row.IsApplied, &row.TStamp); err != nil {
-			log.Fatal("error scanning rows:", err)
-		}
-		if prevRow == nil {
-			prevRow = row
-			continue
+	ordered := make([]*MigrationRecord, len(records))
+	copy(ordered, records)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].VersionID < ordered[j].VersionID })
+
+	var moved []int
+	for i := range records {
+		if records[i] != ordered[i] {
+			moved = append(moved, i)
 		}
-		if prevRow.ID > row.ID && prevRow.VersionID < row.VersionID {
-			if err := swapRows(tx, prevRow, row); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-			continue
-		} else if prevRow.ID < row.ID && prevRow.VersionID > row.VersionID {
-			if err := swapRows(tx, prevRow, row); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-			prevRow = row
+	}
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	printProgress(c, "goose: fixing migrations order\n")
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	for _, i := range moved {
+		if err := updateRecord(c, tx, records[i].ID, ordered[i]); err != nil {
+			tx.Rollback()
+			return nil, err
 		}
-		prevRow = row
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit transaction")
 	}
 
-	return tx.Commit()
+	rows := make([]MovedRecord, len(moved))
+	for n, i := range moved {
+		printInfo(c, "OK    moved %d to row %d\n", ordered[i].VersionID, records[i].ID)
+		rows[n] = MovedRecord{ID: records[i].ID, VersionID: ordered[i].VersionID, Previous: records[i].VersionID}
+	}
+	return rows, nil
 }
 
-func swapRows(tx *sql.Tx, row1 *MigrationRecord, row2 *MigrationRecord) error {
-	row2.ID, row1.ID = row1.ID, row2.ID
-	q := fmt.Sprintf(`UPDATE "%s" SET version_id = %d, is_applied = %t, tstamp = '%s' WHERE id = %d;`, TableName(), row1.VersionID, row1.IsApplied, row1.TStamp.Format(time.RFC3339), row1.ID)
-	_, err := tx.Exec(q)
+// versionRecords returns the rows of the version table in ID order.
+func versionRecords(c *config, db *sql.DB) ([]*MigrationRecord, error) {
+	rows, err := queryVersionTable(c, db)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	q = fmt.Sprintf(`UPDATE "%s" SET version_id = %d, is_applied = %t, tstamp = '%s' WHERE id = %d;`, TableName(), row2.VersionID, row2.IsApplied, row2.TStamp.Format(time.RFC3339), row2.ID)
-	_, err = tx.Exec(q)
-	if err != nil {
-		return err
+	defer rows.Close()
+
+	var records []*MigrationRecord
+	for rows.Next() {
+		row := new(MigrationRecord)
+		if err := rows.Scan(&row.ID, &row.VersionID, &row.IsApplied, &row.TStamp); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		records = append(records, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to query version table")
 	}
-	log.Printf("OK    swapped %d and %d", row1.VersionID, row2.VersionID)
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
 
+// updateRecord sets the row id of the version table to the values of r.
+func updateRecord(c *config, tx *sql.Tx, id int64, r *MigrationRecord) error {
+	t := versionTableFor(c, c.dialect)
+	q := fmt.Sprintf(`UPDATE %s SET %s = %d, %s = %t, %s = '%s' WHERE %s = %d;`, t.name, t.versionID, r.VersionID, t.isApplied, r.IsApplied, t.tstamp, r.TStamp.Format(time.RFC3339), t.id, id)
+	if _, err := tx.Exec(q); err != nil {
+		return errors.Wrapf(err, "failed to move %d to row %d", r.VersionID, id)
+	}
 	return nil
 }
 
-// UpByOne migrates up by a single version.
-func UpByOne(db *sql.DB, dir string) error {
-	migrations, err := CollectMigrations(dir, minVersion, maxVersion)
-	if err != nil {
-		return err
+// UpByOne migrates up by a single version and returns the applied
+// migration. Migrations already applied out of order, e.g. by UpAll, are
+// skipped. It returns ErrNoNextVersion when there is nothing to apply, or
+// when the next migration is deferred to a maintenance window.
+//
+// Deprecated: use Provider.UpByOne, see NewProvider.
+func UpByOne(db *sql.DB, dir string, opts ...OptionsFunc) (*Migration, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	return packageProvider(db, dir).UpByOne(opts...)
+}
+
+// upByOne is UpByOne, for callers holding runMu.
+func upByOne(c *config, db *sql.DB, dir string, o options) (*Migration, error) {
+	if err := checkSequentialVersions(c, db, dir); err != nil {
+		return nil, err
+	}
+	if err := checkMaxPending(c, db, dir, o); err != nil {
+		return nil, err
+	}
+	if err := o.checkMaintenanceWindow(); err != nil {
+		return nil, err
+	}
+	if err := checkStrictOrder(c, db, dir, o); err != nil {
+		return nil, err
+	}
+	if err := verifyAppliedChecksums(c, db, dir); err != nil {
+		return nil, err
 	}
 
-	currentVersion, err := GetDBVersion(db)
+	target, err := pinnedTarget(c, MaxVersion)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	migrations, err := collectMigrations(c, dir, MinVersion, target)
+	if err != nil {
+		return nil, err
+	}
+	migrations = o.selected(c, migrations)
 
-	next, err := migrations.Next(currentVersion)
+	currentVersion, err := ensureDBVersion(c, db)
+	if err != nil {
+		return nil, err
+	}
+	// Migrations following the current version may be applied already,
+	// when UpAll or filtered runs applied migrations out of order.
+	applied, err := appliedVersions(c, db, migrations)
 	if err != nil {
-		if err == ErrNoNextVersion {
-			log.Printf("goose: no migrations to run. current version: %d\n", currentVersion)
+		return nil, err
+	}
+
+	from := currentVersion
+	var next *Migration
+	for {
+		next, err = migrations.Next(from)
+		if err != nil {
+			if err == ErrNoNextVersion {
+				printProgress(c, "goose: no migrations to run. current version: %d\n", currentVersion)
+			}
+			return nil, err
 		}
-		return err
+		if !applied[next.Version] {
+			break
+		}
+		from = next.Version
 	}
 
-	if err = next.Up(db); err != nil {
-		return err
+	deferred, window, err := o.deferred(c, next)
+	if err != nil {
+		return nil, err
+	}
+	if deferred {
+		deferHeavy(c, next, window)
+		return nil, ErrNoNextVersion
+	}
+
+	h := newHooks(db, dir, o)
+	if err := h.before(c); err != nil {
+		return nil, err
+	}
+	if err = next.up(c, db, o); err != nil && err != errGuardSkipped {
+		return nil, err
 	}
+	if err := h.after(c); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
 
+// PendingCount returns the number of migrations of dir not applied to db,
+// including the ones older than the current version, see CollectPending.
+func PendingCount(db *sql.DB, dir string) (int, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+
+	if _, err := ensureDBVersion(c, db); err != nil {
+		return 0, err
+	}
+	pending, err := collectPending(c, db, dir)
+	if err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+// checkMaxPending fails if more migrations selected by o are pending than
+// allowed with WithMaxPending.
+func checkMaxPending(c *config, db *sql.DB, dir string, o options) error {
+	if o.maxPending < 0 {
+		return nil
+	}
+
+	if _, err := ensureDBVersion(c, db); err != nil {
+		return err
+	}
+	pending, err := collectPending(c, db, dir)
+	if err != nil {
+		return err
+	}
+	if n := len(o.selected(c, pending)); n > o.maxPending {
+		return &ErrTooManyPending{Pending: n, Max: o.maxPending}
+	}
 	return nil
 }
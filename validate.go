@@ -0,0 +1,224 @@
+package goose
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Problem is an issue with a migration found by Validate.
+type Problem struct {
+	Source  string // migration file, empty for problems spanning files
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Source == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", filepath.Base(p.Source), p.Message)
+}
+
+// Validate checks the migrations in dir without touching a database:
+// every SQL migration must parse in both directions and have a Down
+// section, even if it's empty, except .up.sql files, whose .down.sql file
+// is optional; .down.sql files must have their .up.sql file; versions
+// must be unique; and Go migrations must be registered. It returns the
+// problems found, or an error if the migrations couldn't be read at all.
+func Validate(dir string) ([]Problem, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return validate(c, dir)
+}
+
+// validate is Validate, for callers holding runMu.
+func validate(c *config, dir string) ([]Problem, error) {
+	sqlFiles, goFiles, dirs, downFiles, err := walkMigrationFiles(c, dir)
+	if err != nil {
+		return nil, err
+	}
+	registered := registeredMigrations()
+
+	var problems []Problem
+	sources := make(map[int64][]string)
+
+	for _, file := range sqlFiles {
+		v, err := parseVersion(c, file)
+		if err != nil {
+			problems = append(problems, Problem{Source: file, Message: err.Error()})
+			continue
+		}
+		sources[v] = append(sources[v], file)
+		problems = append(problems, validateSQLMigration(c, file)...)
+	}
+	problems = append(problems, orphanDownFiles(sqlFiles, downFiles)...)
+
+	for _, file := range goFiles {
+		v, err := parseVersion(c, file)
+		if err != nil {
+			continue // Skip any files that don't have version prefix.
+		}
+		sources[v] = append(sources[v], file)
+		if _, ok := registered[v]; !ok {
+			problems = append(problems, Problem{Source: file, Message: "Go migration is not registered, add it with goose.AddMigration and build it into a custom binary"})
+		}
+	}
+
+	for _, d := range dirs {
+		v, err := dirVersion(c, d)
+		if err != nil {
+			continue
+		}
+		sources[v] = append(sources[v], d)
+		problems = append(problems, validateVersionDir(c, d)...)
+	}
+
+	// Registered Go migrations collide with SQL files and version
+	// directories of the same version.
+	for v, m := range registered {
+		if len(sources[v]) > 0 && fileExt(sources[v][0]) != ".go" {
+			sources[v] = append(sources[v], m.Source)
+		}
+	}
+
+	problems = append(problems, validateDependencies(c, dir, sources, registered)...)
+
+	var versions []int64
+	for v, files := range sources {
+		if len(files) > 1 {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, v := range versions {
+		var names []string
+		for _, file := range sources[v] {
+			names = append(names, filepath.Base(file))
+		}
+		problems = append(problems, Problem{Message: fmt.Sprintf("duplicate version %d: %s", v, strings.Join(names, ", "))})
+	}
+
+	return problems, nil
+}
+
+// validateDependencies checks that the migrations in the manifest of dir
+// and their dependencies exist.
+func validateDependencies(c *config, dir string, sources map[int64][]string, registered map[int64]*Migration) []Problem {
+	names, err := readMigrationDir(c, dir)
+	if err != nil {
+		return nil
+	}
+	m, err := loadManifest(c, dir, names)
+	if err != nil {
+		return nil // reported by migrationFiles
+	}
+	exists := func(v int64) bool {
+		_, ok := registered[v]
+		return ok || len(sources[v]) > 0
+	}
+
+	var versions []int64
+	for v := range m.dependencies {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	var problems []Problem
+	source := filepath.Join(dir, manifestFile)
+	for _, v := range versions {
+		if !exists(v) {
+			problems = append(problems, Problem{Source: source, Message: fmt.Sprintf("no migration %d", v)})
+		}
+		for _, d := range m.dependencies[v] {
+			if !exists(d) {
+				problems = append(problems, Problem{Source: source, Message: fmt.Sprintf("migration %d depends on %d, which doesn't exist", v, d)})
+			}
+		}
+	}
+	return problems
+}
+
+// validateVersionDir checks the steps of a version directory like
+// migrations; Go steps must be registered.
+func validateVersionDir(c *config, dir string) []Problem {
+	steps, err := versionDirSteps(c, dir)
+	if err != nil {
+		return []Problem{{Source: dir, Message: err.Error()}}
+	}
+
+	var problems []Problem
+	for _, step := range steps {
+		if fileExt(step) == ".sql" {
+			problems = append(problems, validateSQLMigration(c, step)...)
+		} else if _, ok := registeredStep(step); !ok {
+			problems = append(problems, Problem{Source: step, Message: "Go step is not registered, add it with goose.AddMigration and build it into a custom binary"})
+		}
+	}
+
+	names, err := c.source.ReadDir(dir)
+	if err != nil {
+		return append(problems, Problem{Source: dir, Message: err.Error()})
+	}
+	var downFiles []string
+	for _, name := range names {
+		if strings.HasSuffix(name, downSQLSuffix) {
+			downFiles = append(downFiles, filepath.Join(dir, name))
+		}
+	}
+	return append(problems, orphanDownFiles(steps, downFiles)...)
+}
+
+// orphanDownFiles reports the .down.sql files of downFiles without their
+// .up.sql file among sqlFiles, which would never be run.
+func orphanDownFiles(sqlFiles, downFiles []string) []Problem {
+	paired := make(map[string]bool)
+	for _, file := range sqlFiles {
+		if down, ok := pairedDownFile(file); ok {
+			paired[down] = true
+		}
+	}
+
+	var problems []Problem
+	for _, down := range downFiles {
+		if !paired[down] {
+			up := strings.TrimSuffix(filepath.Base(down), downSQLSuffix) + upSQLSuffix
+			problems = append(problems, Problem{Source: down, Message: fmt.Sprintf("no %s file, the Down migration would never run", up)})
+		}
+	}
+	return problems
+}
+
+func validateSQLMigration(c *config, file string) []Problem {
+	var problems []Problem
+	seen := make(map[string]bool)
+
+	for _, direction := range []bool{true, false} {
+		f, err := openSQLMigration(c, file, direction)
+		if err != nil {
+			return []Problem{{Source: file, Message: err.Error()}}
+		}
+		parsed, err := parseSQLMigration(c, f, direction)
+		f.Close()
+		if err != nil {
+			// Both directions report the same annotation errors.
+			if !seen[err.Error()] {
+				seen[err.Error()] = true
+				problems = append(problems, Problem{Source: file, Message: err.Error()})
+			}
+			continue
+		}
+
+		if _, paired := pairedDownFile(file); direction && parsed.downSections == 0 && !paired {
+			problems = append(problems, Problem{Source: file, Message: "no '-- +goose Down' section, add an empty one if the migration can't be rolled back"})
+		}
+		if direction {
+			if err := checkDestructive(parsed); err != nil {
+				problems = append(problems, Problem{Source: file, Message: err.Error()})
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,64 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00001_ok.sql":          "-- +goose Up\nCREATE TABLE one (id int);\n\n-- +goose Down\nDROP TABLE one;\n",
+		"00002_no_down.sql":     "-- +goose Up\nCREATE TABLE two (id int);\n",
+		"00003_empty_down.sql":  "-- +goose Up\nCREATE TABLE three (id int);\n\n-- +goose Down\n",
+		"00004_unbalanced.sql":  statementBeginNoStatementEnd,
+		"00005_duplicate.sql":   "-- +goose Up\nSELECT 1;\n-- +goose Down\n",
+		"00005_duplicate_2.sql": "-- +goose Up\nSELECT 2;\n-- +goose Down\n",
+		"00006_unregistered.go": "package migrations\n",
+		"helpers.go":            "package migrations\n",
+		"00007_down_broken.sql": "-- +goose Up\nSELECT 1;\n-- +goose Down\nDROP TABLE seven\n",
+		"00008_no_down.up.sql":  "CREATE TABLE eight (id int);\n",
+		"00009_orphan.down.sql": "DROP TABLE nine;\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := Validate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"00002_no_down.sql: no '-- +goose Down' section",
+		"00004_unbalanced.sql: parsing migration: saw '-- +goose StatementBegin'",
+		"00006_unregistered.go: Go migration is not registered",
+		"00007_down_broken.sql: parsing migration: unexpected unfinished SQL query",
+		"00009_orphan.down.sql: no 00009_orphan.up.sql file",
+		"duplicate version 5: 00005_duplicate.sql, 00005_duplicate_2.sql",
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("incorrect number of problems. got %v, want %v: %v", len(problems), len(expected), problems)
+	}
+	for _, want := range expected {
+		found := false
+		for _, p := range problems {
+			if strings.HasPrefix(p.String(), want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing problem %q in %v", want, problems)
+		}
+	}
+}
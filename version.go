@@ -2,27 +2,203 @@ package goose
 
 import (
 	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
 // Version prints the current version of the database.
 func Version(db *sql.DB, dir string) error {
-	current, err := GetDBVersion(db)
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return printVersion(c, db, dir)
+}
+
+// printVersion is Version, for callers holding runMu.
+func printVersion(c *config, db *sql.DB, dir string) error {
+	current, err := getDBVersion(c, db)
 	if err != nil {
 		return err
 	}
-
-	log.Printf("goose: version %v\n", current)
+	c.logger.Printf("goose: version %v\n", current)
 	return nil
 }
 
-var tableName = "goose_db_version"
+// Versions returns the current version of the database and the version of
+// the latest migration of dir, 0 if there is none, so deploy gates can
+// tell whether the database is behind the code.
+func Versions(db *sql.DB, dir string) (dbVersion, fileVersion int64, err error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
+	return dbAndFileVersions(c, db, dir)
+}
+
+// dbAndFileVersions is Versions, for callers holding runMu.
+func dbAndFileVersions(c *config, db *sql.DB, dir string) (dbVersion, fileVersion int64, err error) {
+	migrations, err := collectMigrationsRange(c, dir, MinVersion, MaxVersion)
+	if err != nil {
+		return -1, -1, err
+	}
+	if last, err := migrations.Last(); err == nil {
+		fileVersion = last.Version
+	}
+
+	dbVersion, err = getDBVersion(c, db)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return dbVersion, fileVersion, nil
+}
+
+// IsUpToDate reports whether all the migrations of dir are applied to db,
+// with the versions of the pending ones, for readiness probes and
+// admission checks. Migrations missing from the history, e.g. merged
+// after newer ones were applied, are pending too. Migrations beyond the
+// version pinned with PinVersion are not required. It doesn't create the
+// version table of a new database, whose migrations are all pending.
+func IsUpToDate(db *sql.DB, dir string) (bool, []int64, error) {
+	runMu.RLock()
+	defer runMu.RUnlock()
+	c := runConfig()
 
-// TableName returns goose db version table name
+	target, err := pinnedTarget(c, MaxVersion)
+	if err != nil {
+		return false, nil, err
+	}
+	migrations, err := collectMigrations(c, dir, MinVersion, target)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// A missing version table isn't created: everything is pending.
+	applied := make(map[int64]bool)
+	exists, err := versionTableExists(c, db)
+	if err != nil {
+		return false, nil, err
+	}
+	if exists {
+		if applied, err = appliedVersions(c, db, migrations); err != nil {
+			return false, nil, err
+		}
+	}
+
+	var pending []int64
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m.Version)
+		}
+	}
+	return len(pending) == 0, pending, nil
+}
+
+// TableName returns goose db version table name, qualified with the
+// schema set with SetSchema.
 func TableName() string {
-	return tableName
+	return runConfig().versionTableName()
 }
 
-// SetTableName set goose db version table name
+// versionTableName is the name of the version table, qualified with the
+// schema, if any.
+func (c *config) versionTableName() string {
+	if c.schema == "" || strings.Contains(c.tableName, ".") {
+		return c.tableName
+	}
+	return c.schema + "." + c.tableName
+}
+
+// SetTableName set goose db version table name. The name may be qualified
+// with a schema, e.g. myschema.goose_db_version; parts that aren't plain
+// identifiers are quoted for the dialect.
 func SetTableName(n string) {
-	tableName = n
+	updateConfig(func(c *config) { c.tableName = n })
+}
+
+// VersionColumns are the column names of the version table.
+type VersionColumns struct {
+	ID        string // auto-incremented row id, "id" by default
+	VersionID string // migration version, "version_id" by default
+	IsApplied string // whether the row records an apply or a rollback, "is_applied" by default
+	Timestamp string // time of the apply or rollback, "tstamp" by default
+}
+
+// defaultVersionColumns are the column names of the version table created
+// by goose.
+var defaultVersionColumns = VersionColumns{ID: "id", VersionID: "version_id", IsApplied: "is_applied", Timestamp: "tstamp"}
+
+// SetVersionColumns sets the column names of the version table, so along
+// with SetTableName goose can adopt an existing bookkeeping table with the
+// same layout, e.g. one with singular names or prefixed columns. Empty
+// names keep their default.
+func SetVersionColumns(c VersionColumns) {
+	if c.ID == "" {
+		c.ID = defaultVersionColumns.ID
+	}
+	if c.VersionID == "" {
+		c.VersionID = defaultVersionColumns.VersionID
+	}
+	if c.IsApplied == "" {
+		c.IsApplied = defaultVersionColumns.IsApplied
+	}
+	if c.Timestamp == "" {
+		c.Timestamp = defaultVersionColumns.Timestamp
+	}
+	updateConfig(func(cfg *config) { cfg.versionColumns = c })
+}
+
+// versionTable is the name and the column names of the version table,
+// quoted for a dialect.
+type versionTable struct {
+	name, id, versionID, isApplied, tstamp string
+}
+
+func versionTableFor(c *config, d SQLDialect) versionTable {
+	cols := c.versionColumns
+	return versionTable{
+		name:      quoteTableName(d, c.versionTableName()),
+		id:        quoteColumnName(d, cols.ID),
+		versionID: quoteColumnName(d, cols.VersionID),
+		isApplied: quoteColumnName(d, cols.IsApplied),
+		tstamp:    quoteColumnName(d, cols.Timestamp),
+	}
+}
+
+// quoteColumnName quotes a column name for d, unless it is a plain
+// identifier, which keeps the case folding of the database.
+func quoteColumnName(d SQLDialect, name string) string {
+	if plainIdentifier.MatchString(name) {
+		return name
+	}
+	return d.quoteIdentifier(name)
+}
+
+// schemaCreator is implemented by dialects that can create the schema of
+// the version table.
+type schemaCreator interface {
+	createSchemaSQL(schema string) string // sql string to create the schema if it doesn't exist
+}
+
+// SetSchema sets the schema of the version table and the other goose
+// tables, e.g. "ops", so the bookkeeping lives outside of the default
+// schema. The schema is created along with the version table if the
+// dialect supports it; on MySQL and TiDB it is a database. It doesn't
+// apply to table names qualified with SetTableName.
+func SetSchema(s string) {
+	updateConfig(func(c *config) { c.schema = s })
+}
+
+// createSchema creates the schema set with SetSchema, if any.
+func createSchema(c *config, tx Querier) error {
+	schema := c.schema
+	d, ok := c.dialect.(schemaCreator)
+	if schema == "" || !ok {
+		return nil
+	}
+
+	if _, err := tx.Exec(d.createSchemaSQL(quoteTableName(c.dialect, schema))); err != nil {
+		return errors.Wrapf(err, "failed to create schema %s", schema)
+	}
+	return nil
 }
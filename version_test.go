@@ -0,0 +1,246 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	check := func(wantDB, wantFile int64) {
+		t.Helper()
+		dbVersion, fileVersion, err := Versions(db, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dbVersion != wantDB || fileVersion != wantFile {
+			t.Errorf("got versions %d and %d, want %d and %d", dbVersion, fileVersion, wantDB, wantFile)
+		}
+	}
+
+	check(0, 0)
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+	check(0, 2)
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	check(2, 2)
+}
+
+func TestMaxPending(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	for v, table := range []string{"a", "b", "c"} {
+		writeSQLMigration(t, dir, int64(v+1), table)
+	}
+	if n, err := PendingCount(db, dir); err != nil || n != 3 {
+		t.Fatalf("expected 3 pending migrations, got %d, %v", n, err)
+	}
+
+	err = Up(db, dir, WithMaxPending(2))
+	if e, ok := err.(*ErrTooManyPending); !ok || e.Pending != 3 || e.Max != 2 {
+		t.Fatalf("expected ErrTooManyPending, got %v", err)
+	}
+	if n, err := PendingCount(db, dir); err != nil || n != 3 {
+		t.Fatalf("expected no migration to be applied, got %d pending, %v", n, err)
+	}
+
+	if err := Up(db, dir, WithMaxPending(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir, WithMaxPending(0)); err != nil {
+		t.Fatalf("expected nothing pending to pass, got %v", err)
+	}
+}
+
+func TestVersionColumns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+	SetTableName("schema_migration")
+	defer SetTableName("goose_db_version")
+	SetVersionColumns(VersionColumns{ID: "pk", VersionID: "version", IsApplied: "applied", Timestamp: "applied.at"})
+	defer SetVersionColumns(VersionColumns{})
+
+	// An existing table of another tool, with version 1 applied.
+	if _, err := db.Exec(`CREATE TABLE schema_migration (
+		pk INTEGER PRIMARY KEY AUTOINCREMENT,
+		version INTEGER NOT NULL,
+		applied INTEGER NOT NULL,
+		"applied.at" TIMESTAMP DEFAULT (datetime('now')),
+		author TEXT
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migration (version, applied) VALUES (0, 1), (1, 1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 2, "b")
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT * FROM a"); err == nil {
+		t.Error("expected migration 1 not to run again")
+	}
+	if err := Status(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := GetDBVersion(db); err != nil || v != 1 {
+		t.Errorf("expected version 1, got %d, %v", v, err)
+	}
+}
+
+func TestIsUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	check := func(wantOK bool, wantPending string) {
+		t.Helper()
+		ok, pending, err := IsUpToDate(db, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != wantOK || fmt.Sprint(pending) != wantPending {
+			t.Errorf("got %t and pending %v, want %t and %s", ok, pending, wantOK, wantPending)
+		}
+	}
+
+	check(true, "[]")
+	writeSQLMigration(t, dir, 1, "a")
+	writeSQLMigration(t, dir, 3, "c")
+	check(false, "[1 3]")
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'goose_db_version'").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected the version table not to be created, got %d, %v", n, err)
+	}
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	check(true, "[]")
+
+	// Migrations missing from the history are pending.
+	writeSQLMigration(t, dir, 2, "b")
+	check(false, "[2]")
+
+	PinVersion(1)
+	defer PinVersion(-1)
+	check(true, "[]")
+}
+
+func TestCurrentState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	check := func(want State) {
+		t.Helper()
+		s, err := CurrentState(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != want {
+			t.Errorf("got state %+v, want %+v", s, want)
+		}
+	}
+
+	writeSQLMigration(t, dir, 1, "a")
+	check(State{})
+	check(State{}) // the version table isn't created
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	check(State{Version: 1, Initialized: true})
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	check(State{Version: 0, Initialized: true})
+
+	SetDirtyTracking(true)
+	defer SetDirtyTracking(false)
+	if err := markDirty(runConfig(), db, &Migration{Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	check(State{Version: 0, Initialized: true, Dirty: true, DirtyVersion: 1})
+}
@@ -0,0 +1,194 @@
+package goose
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Version directories hold a migration split over several files, e.g.
+//
+//	20240101120000_big_change/
+//	    01_tables.sql
+//	    02_indexes.sql
+//	    03_data.go
+//
+// The files are steps run in name order when migrating up, and in reverse
+// order when migrating down, in a single transaction recorded as the one
+// version of the directory. SQL steps have the usual Up and Down sections;
+// Go steps are registered with AddMigration like other Go migrations.
+
+var registeredSteps = map[string]*Migration{}
+
+// dirVersion parses the version of a version directory. Version parsers
+// expect a file name, so the name is given a .sql extension.
+func dirVersion(c *config, name string) (int64, error) {
+	return parseVersion(c, name+".sql")
+}
+
+// stepKey identifies a step by the names of its version directory and
+// file, which are the same where it is registered and where it is run.
+func stepKey(path string) string {
+	return filepath.Base(filepath.Dir(path)) + "/" + filepath.Base(path)
+}
+
+// addStep registers a Go step of a version directory, see AddNamedMigration.
+func addStep(filename string, up, down func(*sql.Tx) error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	key := stepKey(filename)
+	if existing, ok := registeredSteps[key]; ok {
+		panic(fmt.Sprintf("failed to add migration %q: step conflicts with %q", filename, existing.Source))
+	}
+	registeredSteps[key] = &Migration{Registered: true, UpFn: up, DownFn: down, Source: filename}
+}
+
+func registeredStep(path string) (*Migration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	m, ok := registeredSteps[stepKey(path)]
+	return m, ok
+}
+
+// versionDirSteps returns the paths of the steps of a version directory,
+// in name order.
+func versionDirSteps(c *config, dir string) ([]string, error) {
+	names, err := c.source.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read version directory")
+	}
+
+	var steps []string
+	for _, name := range names {
+		switch fileExt(name) {
+		case ".sql":
+			if strings.HasSuffix(name, downSQLSuffix) {
+				continue // read with the paired .up.sql step
+			}
+			steps = append(steps, filepath.Join(dir, name))
+		case ".go":
+			steps = append(steps, filepath.Join(dir, name))
+		}
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("version directory has no SQL or Go files")
+	}
+
+	return steps, nil
+}
+
+// runVersionDir runs the steps of a version directory and records its
+// version in a single transaction.
+func runVersionDir(c *config, parent context.Context, db *sql.DB, m *Migration, direction bool) error {
+	steps, err := versionDirSteps(c, m.Source)
+	if err != nil {
+		return err
+	}
+	if !direction {
+		for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+	}
+
+	// Check the steps before running any of them.
+	count := 0
+	for _, step := range steps {
+		if fileExt(step) == ".go" {
+			if _, ok := registeredStep(step); !ok {
+				return errors.Errorf("Go step %q must be registered and built into a custom binary", filepath.Base(step))
+			}
+			continue
+		}
+
+		parsed, err := scanSQLFile(c, step, direction, collationCheck(c))
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse step %q", filepath.Base(step))
+		}
+		if direction {
+			if err := checkDestructive(parsed); err != nil {
+				return errors.Wrapf(err, "step %q", filepath.Base(step))
+			}
+		}
+		if !parsed.useTx || parsed.foreignKeysOff || parsed.timeout > 0 {
+			return errors.Errorf("step %q: the NO TRANSACTION, FOREIGN KEYS OFF and TIMEOUT annotations are not supported in version directories", filepath.Base(step))
+		}
+		count += parsed.count
+	}
+
+	statements := func(ctx context.Context, q Querier) error {
+		i := 0
+		for _, step := range steps {
+			if fileExt(step) == ".go" {
+				if err := runGoStep(c, q, step, direction); err != nil {
+					return err
+				}
+				continue
+			}
+
+			_, err := scanSQLFile(c, step, direction, func(query string, line int) error {
+				i++
+				return execStatement(ctx, c, q, query, i, count, line)
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to run step %q", filepath.Base(step))
+			}
+		}
+		return nil
+	}
+
+	timeout := c.migrationTimeout
+	ctx, cancel := migrationContext(parent, timeout)
+	defer cancel()
+
+	err = retryBusy(c, func() error {
+		return runSQLTx(ctx, c, db, m, statements, direction, false, timeout)
+	})
+	return timeoutError(ctx, err, timeout)
+}
+
+// runGoStep runs the function of a registered Go step in the transaction
+// of its version directory.
+func runGoStep(c *config, q Querier, step string, direction bool) error {
+	m, _ := registeredStep(step)
+	fn := m.UpFn
+	if !direction {
+		fn = m.DownFn
+	}
+	if fn == nil {
+		return nil
+	}
+
+	printInfo(c, "Executing Go step %s\n", filepath.Base(step))
+	if err := fn(q.(*sql.Tx)); err != nil {
+		return errors.Wrapf(err, "failed to run Go step %q", filepath.Base(step))
+	}
+	return nil
+}
+
+// dirChecksum returns the hex encoded SHA-256 of the names and contents of
+// the steps of a version directory.
+func dirChecksum(c *config, dir string) (string, error) {
+	steps, err := versionDirSteps(c, dir)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, step := range steps {
+		io.WriteString(h, filepath.Base(step)+"\n")
+		if err := hashFile(c, h, step); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
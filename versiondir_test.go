@@ -0,0 +1,97 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	writeSQLMigration(t, dir, 1, "a")
+	big := filepath.Join(dir, "00002_big_change")
+	if err := os.Mkdir(big, 0755); err != nil {
+		t.Fatal(err)
+	}
+	steps := map[string]string{
+		"01_tables.sql":  "-- +goose Up\nCREATE TABLE users (id int, name text);\n-- +goose Down\nDROP TABLE users;\n",
+		"03_indexes.sql": "-- +goose Up\nCREATE INDEX users_name ON users (name);\n-- +goose Down\nDROP INDEX users_name;\n",
+	}
+	for name, src := range steps {
+		if err := ioutil.WriteFile(filepath.Join(big, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Go steps are registered from their file in the version directory.
+	if err := ioutil.WriteFile(filepath.Join(big, "02_data.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	AddNamedMigration(filepath.Join("migrations", "00002_big_change", "02_data.go"), func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO users VALUES (1, 'alice')")
+		return err
+	}, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM users")
+		return err
+	})
+
+	migrations, err := CollectMigrationsRange(dir, MinVersion, MaxVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[1].Source != big {
+		t.Fatalf("expected the version directory as migration 2, got %v", migrations)
+	}
+	if problems, err := Validate(dir); err != nil || len(problems) > 0 {
+		t.Fatalf("expected no problems, got %v, %v", problems, err)
+	}
+
+	if err := Up(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM users INDEXED BY users_name").Scan(&name); err != nil || name != "alice" {
+		t.Fatalf("expected all steps to run, got %q, %v", name, err)
+	}
+	if version, err := GetDBVersion(db); err != nil || version != 2 {
+		t.Fatalf("expected version 2, got %d, %v", version, err)
+	}
+
+	if _, err := Down(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Error("expected the steps to be rolled back")
+	}
+
+	// A failing step rolls back the whole directory.
+	if err := ioutil.WriteFile(filepath.Join(big, "04_broken.sql"), []byte("-- +goose Up\nSELECT * FROM missing;\n-- +goose Down\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(db, dir); err == nil {
+		t.Fatal("expected the broken step to fail")
+	}
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Error("expected the failed version directory to be rolled back")
+	}
+	if version, err := GetDBVersion(db); err != nil || version != 1 {
+		t.Errorf("expected version 1, got %d, %v", version, err)
+	}
+}
@@ -0,0 +1,172 @@
+package goose
+
+import (
+	"database/sql"
+	"os"
+	"time"
+)
+
+// watchDebounce is how long the files must stay unchanged before Watch
+// applies them, so a migration is not applied while still being saved.
+var watchDebounce = time.Second
+
+// SetWatchInterval sets how often Watch polls the migrations directory.
+// It defaults to 500ms; use a longer interval on network filesystems.
+func SetWatchInterval(d time.Duration) {
+	updateConfig(func(c *config) { c.watchInterval = watchInterval(d) })
+}
+
+// watchInterval returns the interval d, or the default one if not
+// positive.
+func watchInterval(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 500 * time.Millisecond
+	}
+	return d
+}
+
+// fileState identifies a version of a migration file.
+type fileState struct {
+	modTime  time.Time
+	size     int64
+	checksum string
+}
+
+// Watch applies pending migrations of dir, then keeps polling dir and
+// applies new migrations as they are saved, until stop is closed. It is
+// meant for local development databases.
+//
+// Watch polls rather than relying on filesystem notifications, so it works
+// on network filesystems and in containers. Files are compared by
+// checksum, so timestamps jittering on such filesystems don't trigger
+// anything.
+//
+// Failed migrations are reported and retried once their files change
+// again; Watch only returns when stop is closed or dir can't be read.
+func Watch(db *sql.DB, dir string, stop <-chan struct{}) error {
+	// Hold runMu while polling and applying only, so the configuration
+	// can change between polls.
+	return watch(db, dir, stop, func() (*config, func()) {
+		runMu.RLock()
+		return runConfig(), runMu.RUnlock
+	})
+}
+
+// watch is Watch, calling hold around each poll for the configuration of
+// the poll. Callers holding runMu pass a hold returning their
+// configuration and doing nothing.
+func watch(db *sql.DB, dir string, stop <-chan struct{}, hold func() (*config, func())) error {
+	c, release := hold()
+	last, err := watchSnapshot(c, dir, nil)
+	if err != nil {
+		release()
+		return err
+	}
+	watchApply(c, db, dir)
+	interval := c.watchInterval
+	release()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var changedAt time.Time
+	pending := false
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := func() error {
+			c, release := hold()
+			defer release()
+
+			snapshot, err := watchSnapshot(c, dir, last)
+			if err != nil {
+				return err
+			}
+			changed := !sameSnapshot(last, snapshot)
+			last = snapshot
+			if changed {
+				changedAt = time.Now()
+				pending = true
+				return nil
+			}
+
+			if pending && time.Since(changedAt) >= watchDebounce {
+				pending = false
+				watchApply(c, db, dir)
+			}
+			return nil
+		}(); err != nil {
+			return err
+		}
+	}
+}
+
+// watchApply applies the pending migrations and reports the outcome.
+func watchApply(c *config, db *sql.DB, dir string) {
+	if err := upTo(c, db, dir, MaxVersion, applyOptions(nil)); err != nil {
+		c.logger.Printf("goose watch: FAILED: %v\n", err)
+		c.logger.Printf("goose watch: fix the migration and save it again to retry\n")
+		return
+	}
+	c.logger.Printf("goose watch: watching %s for new migrations\n", dir)
+}
+
+// watchSnapshot returns the state of the migration files in dir. Checksums
+// of files whose modification time and size didn't change since the
+// previous snapshot are reused. Files that can't be stat'ed, e.g. with a
+// remote MigrationSource, are always checksummed.
+func watchSnapshot(c *config, dir string, previous map[string]fileState) (map[string]fileState, error) {
+	sqlFiles, goFiles, dirs, err := migrationFiles(c, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]fileState)
+	for _, name := range append(sqlFiles, goFiles...) {
+		var state fileState
+		if info, err := os.Stat(name); err == nil {
+			state.modTime, state.size = info.ModTime(), info.Size()
+			if prev, ok := previous[name]; ok && prev.modTime.Equal(state.modTime) && prev.size == state.size {
+				snapshot[name] = prev
+				continue
+			}
+		}
+
+		state.checksum, err = fileChecksum(c, name)
+		if err != nil {
+			// Removed since it was listed; the next poll will notice.
+			continue
+		}
+		snapshot[name] = state
+	}
+	for _, name := range dirs {
+		// Version directories are always checksummed, modifying a step
+		// doesn't change the directory.
+		checksum, err := dirChecksum(c, name)
+		if err != nil {
+			continue
+		}
+		snapshot[name] = fileState{checksum: checksum}
+	}
+
+	return snapshot, nil
+}
+
+// sameSnapshot reports whether the snapshots have the same files with the
+// same contents.
+func sameSnapshot(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, state := range a {
+		if other, ok := b[name]; !ok || other.checksum != state.checksum {
+			return false
+		}
+	}
+	return true
+}
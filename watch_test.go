@@ -0,0 +1,88 @@
+package goose
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The test polls the version while Watch migrates.
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDialect("postgres")
+
+	defer func(debounce time.Duration) { watchDebounce = debounce }(watchDebounce)
+	watchDebounce = 50 * time.Millisecond
+	SetWatchInterval(10 * time.Millisecond)
+	defer SetWatchInterval(0)
+
+	writeSQLMigration(t, dir, 1, "one")
+
+	// Create the version table first, so polling doesn't race Watch for it.
+	if _, err := EnsureDBVersion(db); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- Watch(db, dir, stop) }()
+
+	waitForVersion := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			v, err := GetDBVersion(db)
+			if err == nil && v == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for version %d, got %d (%v)", want, v, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitForVersion(1)
+	writeSQLMigration(t, dir, 2, "two")
+	waitForVersion(2)
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Timestamps changing without the contents, e.g. on network
+	// filesystems, are not changes.
+	before, err := watchSnapshot(runConfig(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "00002_two.sql"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	after, err := watchSnapshot(runConfig(), dir, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameSnapshot(before, after) {
+		t.Error("expected a timestamp change alone not to change the snapshot")
+	}
+}